@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/instancemanagers"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/persisters"
+	"github.com/pivotal-golang/lager"
+)
+
+// adopt records an existing database of the cluster as the database of a
+// service instance.
+func adopt(conf config.Config, persister persisters.StatePersister, logger lager.Logger, args []string) error {
+	flags := flag.NewFlagSet("adopt", flag.ContinueOnError)
+	UID := flags.Int("bdb-uid", 0, "UID of the database to adopt")
+	instanceID := flags.String("instance-id", "", "ID of the service instance the platform knows the database by")
+	planID := flags.String("plan", "", "ID of the plan of the service instance")
+	orgGUID := flags.String("org-guid", "", "GUID of the organization of the service instance")
+	spaceGUID := flags.String("space-guid", "", "GUID of the space of the service instance")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *UID <= 0 || *instanceID == "" || *planID == "" {
+		return fmt.Errorf("usage: adopt -bdb-uid N -instance-id ID -plan ID [-org-guid GUID] [-space-guid GUID]")
+	}
+
+	instance := persisters.ServiceInstance{
+		ID:               *instanceID,
+		PlanID:           *planID,
+		ServiceID:        conf.ServiceBroker.ServiceID,
+		OrganizationGUID: *orgGUID,
+		SpaceGUID:        *spaceGUID,
+	}
+	err := instancemanagers.NewDefault(conf, logger).Adopt(instance, *UID, persister)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Database %d is now the database of the instance %s\n", *UID, *instanceID)
+	return nil
+}
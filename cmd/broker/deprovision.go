@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/admin"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/instancebinders"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/instancemanagers"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/persisters"
+	"github.com/pivotal-golang/lager"
+)
+
+// deprovision deletes all the service instances of an organization or a
+// space, e.g. after the organization was offboarded, with the checks of
+// the broker. With -dry-run it only lists them.
+func deprovision(conf config.Config, persister persisters.StatePersister, logger lager.Logger, args []string) error {
+	flags := flag.NewFlagSet("deprovision", flag.ContinueOnError)
+	orgGUID := flags.String("org-guid", "", "GUID of the organization whose instances are deleted")
+	spaceGUID := flags.String("space-guid", "", "GUID of the space whose instances are deleted")
+	dryRun := flags.Bool("dry-run", false, "List the instances that would be deleted")
+	output := outputFlag(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	asJSON, err := checkOutput(*output)
+	if err != nil {
+		return err
+	}
+
+	state, _, err := persister.Load()
+	if err != nil {
+		return err
+	}
+	bulk, err := admin.NewBulkDeprovision(state, *orgGUID, *spaceGUID, *dryRun)
+	if err == admin.ErrNoOwnerGUID {
+		return fmt.Errorf("usage: deprovision -org-guid GUID | -space-guid GUID [-dry-run] [-output json]")
+	}
+	if err != nil {
+		return err
+	}
+
+	if !*dryRun {
+		broker := redislabs.NewServiceBroker(
+			instancemanagers.NewDefault(conf, logger),
+			instancebinders.NewDefault(conf, logger),
+			persister,
+			conf,
+			logger,
+		)
+		bulk.Run(broker, conf.ServiceBroker.ServiceID, func(change func()) { change() }, logger)
+	}
+
+	if asJSON {
+		return printJSON(bulk)
+	}
+	for _, instance := range bulk.Instances {
+		switch {
+		case *dryRun:
+			fmt.Printf("instance %s (plan %s, space %s, %d bindings) would be deleted\n",
+				instance.InstanceID, instance.PlanID, instance.SpaceGUID, instance.Bindings)
+		case instance.Error != "":
+			fmt.Printf("instance %s: %s\n", instance.InstanceID, instance.Error)
+		default:
+			fmt.Printf("instance %s: deleted\n", instance.InstanceID)
+		}
+	}
+	if *dryRun {
+		fmt.Printf("%d instances would be deleted\n", len(bulk.Instances))
+		return nil
+	}
+	fmt.Printf("%d instances deleted, %d failed\n", bulk.Succeeded, bulk.Failed)
+	if bulk.Failed > 0 {
+		return fmt.Errorf("failed to delete %d instances", bulk.Failed)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/cloudfoundry-incubator/candiedyaml"
+	"github.com/pivotal-golang/lager"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/apiclient"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+)
+
+// The generated plans only list the keys the suggestions set, in the
+// order of the example config.
+type generatedPlans struct {
+	Plans []generatedPlan `yaml:"plans"`
+}
+
+type generatedPlan struct {
+	Name        string            `yaml:"name"`
+	ID          string            `yaml:"id"`
+	Description string            `yaml:"description"`
+	Settings    generatedSettings `yaml:"settings"`
+}
+
+type generatedSettings struct {
+	Memory          int64  `yaml:"memory"`
+	Replication     bool   `yaml:"replication"`
+	ShardCount      int64  `yaml:"shard_count"`
+	ShardsPlacement string `yaml:"shards_placement,omitempty"`
+	Persistence     string `yaml:"persistence"`
+}
+
+// generatePlans prints plans sized for the nodes of the cluster, to be
+// reviewed and pasted into the broker section of a new config.
+func generatePlans(conf config.Config, logger lager.Logger, args []string) error {
+	flags := flag.NewFlagSet("generate-plans", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	nodes, err := apiclient.New(conf, logger).ListNodes()
+	if err != nil {
+		return fmt.Errorf("failed to list the nodes of the cluster at %s: %s", conf.Cluster.Address, err)
+	}
+	plans := redislabs.SuggestPlans(nodes)
+	if len(plans) == 0 {
+		return fmt.Errorf("the cluster at %s does not report the memory of its nodes", conf.Cluster.Address)
+	}
+
+	generated := generatedPlans{}
+	for _, plan := range plans {
+		settings := plan.ServiceInstanceConfig
+		generated.Plans = append(generated.Plans, generatedPlan{
+			Name:        plan.Name,
+			ID:          plan.ID,
+			Description: plan.Description,
+			Settings: generatedSettings{
+				Memory:          settings.MemoryLimit,
+				Replication:     settings.Replication,
+				ShardCount:      settings.ShardCount,
+				ShardsPlacement: settings.ShardsPlacement,
+				Persistence:     settings.Persistence,
+			},
+		})
+	}
+	output, err := candiedyaml.Marshal(generated)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("# Plans suggested for the %d nodes of the cluster, to review and paste into the broker section of the config.\n", len(nodes))
+	fmt.Print(string(output))
+	return nil
+}
@@ -6,12 +6,22 @@ import (
 	"net/http"
 	"os"
 	"path"
+	"time"
 
 	"github.com/RedisLabs/cf-redislabs-broker/redislabs"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/admin"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/api"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/apiclient"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/audit"
 	"github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
 	"github.com/RedisLabs/cf-redislabs-broker/redislabs/instancebinders"
 	"github.com/RedisLabs/cf-redislabs-broker/redislabs/instancemanagers"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/logging"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/metrics"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/migrations"
 	"github.com/RedisLabs/cf-redislabs-broker/redislabs/persisters"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/reconcilers"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/usage"
 	"github.com/pivotal-cf/brokerapi"
 	"github.com/pivotal-golang/lager"
 )
@@ -24,7 +34,27 @@ var (
 
 func init() {
 	flag.StringVar(&brokerConfigPath, "c", "", "Configuration File")
+	flag.StringVar(&brokerConfigPath, "config", "", "Configuration File (same as -c)")
 	flag.StringVar(&brokerStateRoot, "s", os.Getenv("HOME"), "State Root Folder")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s -c config.yml [-s state-root] [command]\n\n", os.Args[0])
+		fmt.Fprintln(os.Stderr, "Commands:")
+		fmt.Fprintln(os.Stderr, "  reconcile [-repair] [-output json] compare the broker state with the cluster")
+		fmt.Fprintln(os.Stderr, "  export-state [-o FILE]             write the broker state for a backup")
+		fmt.Fprintln(os.Stderr, "  import-state [-overwrite] FILE     restore the broker state from a backup")
+		fmt.Fprintln(os.Stderr, "  adopt -bdb-uid N -instance-id ID -plan ID")
+		fmt.Fprintln(os.Stderr, "                                     record an existing database as a service instance")
+		fmt.Fprintln(os.Stderr, "  deprovision -org-guid GUID | -space-guid GUID [-dry-run]")
+		fmt.Fprintln(os.Stderr, "                                     delete the instances of an organization or a space")
+		fmt.Fprintln(os.Stderr, "  state list|show ID|rm ID           inspect the broker state or remove an instance,")
+		fmt.Fprintln(os.Stderr, "                                     list and show accept -output json")
+		fmt.Fprintln(os.Stderr, "  generate-plans                     print plans sized for the nodes of the cluster")
+		fmt.Fprintln(os.Stderr, "  register -api URL -broker-url URL  register the broker with Cloud Foundry")
+		fmt.Fprintln(os.Stderr, "  smoke-test [-plan ID]              run an instance lifecycle against the cluster")
+		fmt.Fprintln(os.Stderr, "  validate [-offline]                check the config and the cluster, print the catalog")
+		fmt.Fprintln(os.Stderr, "\nWithout a command the service broker is started.\n\nOptions:")
+		flag.PrintDefaults()
+	}
 
 	flag.Parse()
 
@@ -33,43 +63,206 @@ func init() {
 
 func main() {
 	brokerLogger := lager.NewLogger("redislabs-service-broker")
-	brokerLogger.RegisterSink(lager.NewWriterSink(os.Stdout, lager.DEBUG))
-	brokerLogger.RegisterSink(lager.NewWriterSink(os.Stderr, lager.ERROR))
+	// The config is not loaded yet, so the errors are always redacted.
+	brokerLogger.RegisterSink(logging.NewRedactingSink(lager.NewWriterSink(os.Stderr, lager.ERROR)))
 
 	if brokerConfigPath == "" {
 		brokerLogger.Error("No config file specified", nil)
-		return
+		os.Exit(1)
 	}
 
-	brokerLogger.Info("Using config file: " + brokerConfigPath)
-
 	conf, err := config.LoadFromFile(brokerConfigPath)
 	if err != nil {
 		brokerLogger.Error("Failed to load the config file", err, lager.Data{
 			"broker-config-path": brokerConfigPath,
 		})
-		return
+		os.Exit(1)
+	}
+
+	command := flag.Arg(0)
+	if command == "" {
+		// The broker does not start with a config it would not work
+		// with. The commands check what they need, validate all of it.
+		if problems := conf.Validate(); len(problems) > 0 {
+			for _, problem := range problems {
+				brokerLogger.Error("The config is invalid", problem, lager.Data{
+					"broker-config-path": brokerConfigPath,
+				})
+			}
+			os.Exit(1)
+		}
+		// Commands print their own output to stdout, so only the server
+		// logs to the configured sinks.
+		if err := logging.Configure(brokerLogger, conf.ServiceBroker.Log); err != nil {
+			brokerLogger.Error("Failed to set up logging", err)
+			os.Exit(1)
+		}
+	}
+
+	brokerLogger.Info("Using config file: " + brokerConfigPath)
+
+	storage, err := statePersister(conf)
+	if err != nil {
+		brokerLogger.Error("Failed to set up the state persister", err)
+		os.Exit(1)
+	}
+	stateMigrations := migrations.Default(conf, brokerLogger)
+	persister := persisters.NewMigratingPersister(storage, stateMigrations)
+
+	switch command {
+	case "":
+		serve(conf, persister, storage, brokerLogger)
+	case "reconcile":
+		err = reconcile(conf, persister, brokerLogger, flag.Args()[1:])
+	case "export-state":
+		err = exportState(persister, flag.Args()[1:])
+	case "import-state":
+		err = importState(persister, stateMigrations, flag.Args()[1:])
+	case "state":
+		err = state(persister, flag.Args()[1:])
+	case "adopt":
+		err = adopt(conf, persister, brokerLogger, flag.Args()[1:])
+	case "deprovision":
+		err = deprovision(conf, persister, brokerLogger, flag.Args()[1:])
+	case "generate-plans":
+		err = generatePlans(conf, brokerLogger, flag.Args()[1:])
+	case "register":
+		err = register(conf, brokerLogger, flag.Args()[1:])
+	case "validate":
+		err = validate(conf, brokerLogger, flag.Args()[1:])
+	case "smoke-test":
+		err = smokeTest(conf, brokerLogger, flag.Args()[1:])
+	default:
+		flag.Usage()
+		err = fmt.Errorf("unknown command %q", command)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// statePersister creates the persister selected by the config.
+func statePersister(conf config.Config) (persisters.StatePersister, error) {
+	persisterConf := conf.ServiceBroker.StatePersister
+	switch persisterConf.Type {
+	case "", "local":
+		statePath := localPersisterPath
+		if persisterConf.File != "" {
+			statePath = persisterConf.File
+		}
+		return persisters.NewLocalPersister(statePath), nil
+	case "redis":
+		return persisters.NewRedisPersister(persisterConf.Redis), nil
+	}
+	return nil, fmt.Errorf("unknown state persister type %q, use local or redis", persisterConf.Type)
+}
+
+// elect starts the leader election among the brokers sharing the state,
+// calling elected every time this broker becomes the leader. A broker that
+// does not share its state leads on its own, so elected is called once and
+// nil is returned.
+func elect(conf config.Config, storage persisters.StatePersister, elected func(), brokerLogger lager.Logger) reconcilers.Leader {
+	leaser, ok := storage.(persisters.Leaser)
+	if !ok {
+		elected()
+		return nil
 	}
+	ttl := time.Duration(conf.ServiceBroker.StatePersister.LeaseTTL) * time.Second
+	if ttl <= 0 {
+		ttl = reconcilers.DefaultLeaseTTL
+	}
+	hostname, _ := os.Hostname()
+	elector := reconcilers.NewElector(leaser, fmt.Sprintf("%s-%d", hostname, os.Getpid()), ttl, brokerLogger).OnElected(elected)
+	elector.Elect()
+	go elector.Run()
+	return elector
+}
 
+func serve(conf config.Config, persister persisters.StatePersister, storage persisters.StatePersister, brokerLogger lager.Logger) {
+	// Features the cluster does not support are rejected once its version
+	// is known. If it can not be detected, nothing is rejected up front.
+	if _, err := apiclient.New(conf, brokerLogger).DetectVersion(); err != nil {
+		brokerLogger.Error("Failed to detect the cluster version, the features of the cluster are not checked", err)
+	}
+
+	instanceManager := instancemanagers.NewDefault(conf, brokerLogger)
+	instanceBinder := instancebinders.NewDefault(conf, brokerLogger)
 	serviceBroker := redislabs.NewServiceBroker(
-		instancemanagers.NewDefault(conf, brokerLogger),
-		instancebinders.NewDefault(conf, brokerLogger),
-		persisters.NewLocalPersister(localPersisterPath),
+		instanceManager,
+		instanceBinder,
+		persister,
 		conf,
 		brokerLogger,
 	)
+	serviceBroker.Scope = func(logger lager.Logger) (redislabs.ServiceInstanceManager, redislabs.ServiceInstanceBinder) {
+		return instanceManager.WithLogger(logger), instanceBinder.WithLogger(logger)
+	}
+
+	// The tasks left by a broker are resumed by the leader only, so that
+	// brokers starting together do not finish them twice, and by every
+	// broker that takes over from a leader that went away. They are
+	// resumed once the broker is set up, so that it hears of the
+	// instances they record.
+	leader := elect(conf, storage, func() {
+		if err := instanceManager.ResumeTasks(persister); err != nil {
+			brokerLogger.Error("Failed to resume the unfinished tasks", err)
+		}
+	}, brokerLogger)
+
+	if conf.ServiceBroker.OrphanCheckInterval > 0 {
+		detector := reconcilers.NewOrphanDetector(conf, persister, brokerLogger).WithLeader(leader)
+		go detector.Run(time.Duration(conf.ServiceBroker.OrphanCheckInterval) * time.Second)
+	}
+
+	if conf.ServiceBroker.CredentialRefreshInterval > 0 {
+		refresher := reconcilers.NewCredentialRefresher(conf, persister, brokerLogger).WithLeader(leader)
+		go refresher.Run(time.Duration(conf.ServiceBroker.CredentialRefreshInterval) * time.Second)
+	}
+
+	if conf.ServiceBroker.PasswordRotationGracePeriod > 0 {
+		retirer := reconcilers.NewPasswordRetirer(conf, persister, brokerLogger).WithLeader(leader)
+		go retirer.Run(time.Minute)
+	}
+
+	if conf.ServiceBroker.DeletionRetentionPeriod > 0 {
+		reaper := reconcilers.NewDeletedInstanceReaper(conf, persister, brokerLogger).WithLeader(leader)
+		go reaper.Run(time.Minute)
+	}
+
+	if conf.ServiceBroker.Metrics.Interval > 0 {
+		sink, err := metrics.NewStatsD(conf.ServiceBroker.Metrics)
+		if err != nil {
+			brokerLogger.Error("Failed to set up the metrics", err)
+			os.Exit(1)
+		}
+		forwarder := metrics.NewForwarder(conf, persister, sink, brokerLogger).WithLeader(leader)
+		go forwarder.Run(time.Duration(conf.ServiceBroker.Metrics.Interval) * time.Second)
+	}
 
 	credentials := brokerapi.BrokerCredentials{
 		Username: conf.ServiceBroker.Auth.Username,
 		Password: conf.ServiceBroker.Auth.Password,
 	}
 
-	brokerAPI := brokerapi.New(serviceBroker, brokerLogger, credentials)
-	http.Handle("/", brokerAPI)
+	if err := audit.Configure(conf.ServiceBroker.SecurityEvents); err != nil {
+		brokerLogger.Error("Failed to set up the security events", err)
+		os.Exit(1)
+	}
+
+	brokerAPI := api.New(serviceBroker, brokerLogger, credentials)
+	http.Handle("/", audit.WatchAuthentication(brokerAPI, "broker"))
+	if conf.ServiceBroker.Admin.Auth.Username != "" {
+		http.Handle("/admin/", audit.WatchAdmin(admin.NewHandler(conf, persister, instanceManager, serviceBroker, brokerLogger)))
+		http.Handle("/debug/", audit.WatchAdmin(admin.NewDebugHandler(conf, persister, brokerLogger)))
+	}
+	if conf.ServiceBroker.UsageAPI {
+		http.Handle("/instances/", audit.WatchAuthentication(usage.NewHandler(conf, persister, brokerLogger), "usage"))
+	}
 	brokerLogger.Info("Listening for requests", lager.Data{
 		"port": conf.ServiceBroker.Port,
 	})
-	err = http.ListenAndServe(fmt.Sprintf(":%d", conf.ServiceBroker.Port), nil)
+	err := http.ListenAndServe(fmt.Sprintf(":%d", conf.ServiceBroker.Port), nil)
 	if err != nil {
 		brokerLogger.Error("Failed to start the server", err)
 	}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/cluster"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/persisters"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/reconcilers"
+)
+
+// The JSON output of the commands is meant for pipelines, so its schema
+// is kept stable: fields may be added but are never renamed or removed.
+// Passwords are never part of it.
+
+type instanceOutput struct {
+	ID               string          `json:"id"`
+	PlanID           string          `json:"plan_id"`
+	OrganizationGUID string          `json:"organization_guid"`
+	SpaceGUID        string          `json:"space_guid"`
+	Status           string          `json:"status"` // available or deleted
+	DatabaseUID      int             `json:"database_uid"`
+	Host             string          `json:"host"`
+	Port             int             `json:"port"`
+	IPList           []string        `json:"ip_list"`
+	CreatedAt        string          `json:"created_at,omitempty"`
+	DeletedAt        string          `json:"deleted_at,omitempty"`
+	Bindings         []bindingOutput `json:"bindings"`
+}
+
+type bindingOutput struct {
+	ID        string `json:"id"`
+	AppGUID   string `json:"app_guid"`
+	CreatedAt string `json:"created_at,omitempty"`
+}
+
+type reconcileOutput struct {
+	InSync   bool          `json:"in_sync"`
+	Repaired bool          `json:"repaired"`
+	Drifts   []driftOutput `json:"drifts"`
+}
+
+type driftOutput struct {
+	Kind        string          `json:"kind"`
+	InstanceID  string          `json:"instance_id,omitempty"`
+	DatabaseUID int             `json:"database_uid"`
+	Stored      *endpointOutput `json:"stored,omitempty"`
+	Actual      *endpointOutput `json:"actual,omitempty"`
+}
+
+type endpointOutput struct {
+	Host   string   `json:"host"`
+	Port   int      `json:"port"`
+	IPList []string `json:"ip_list"`
+}
+
+// outputFlag adds the -output flag to the flags of a command.
+func outputFlag(flags *flag.FlagSet) *string {
+	return flags.String("output", "text", "Output format, text or json")
+}
+
+// checkOutput rejects unknown output formats and tells whether JSON is
+// requested.
+func checkOutput(output string) (bool, error) {
+	switch output {
+	case "text":
+		return false, nil
+	case "json":
+		return true, nil
+	}
+	return false, fmt.Errorf("unknown output format %q, use text or json", output)
+}
+
+func printJSON(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	return encoder.Encode(v)
+}
+
+func newInstanceOutput(instance persisters.ServiceInstance, status string, bindings []persisters.Binding) instanceOutput {
+	output := instanceOutput{
+		ID:               instance.ID,
+		PlanID:           instance.PlanID,
+		OrganizationGUID: instance.OrganizationGUID,
+		SpaceGUID:        instance.SpaceGUID,
+		Status:           status,
+		DatabaseUID:      instance.Credentials.UID,
+		Host:             instance.Credentials.Host,
+		Port:             instance.Credentials.Port,
+		IPList:           instance.Credentials.IPList,
+		CreatedAt:        formatTime(instance.CreatedAt),
+		DeletedAt:        formatTime(instance.DeletedAt),
+		Bindings:         []bindingOutput{},
+	}
+	if output.IPList == nil {
+		output.IPList = []string{}
+	}
+	for _, binding := range bindings {
+		output.Bindings = append(output.Bindings, bindingOutput{
+			ID:        binding.ID,
+			AppGUID:   binding.AppGUID,
+			CreatedAt: formatTime(binding.CreatedAt),
+		})
+	}
+	return output
+}
+
+func newDriftOutput(drift reconcilers.Drift) driftOutput {
+	output := driftOutput{
+		Kind:        drift.Kind,
+		InstanceID:  drift.InstanceID,
+		DatabaseUID: drift.Stored.UID,
+	}
+	if drift.Kind != reconcilers.DatabaseOrphaned {
+		output.Stored = newEndpointOutput(drift.Stored)
+	}
+	if drift.Kind != reconcilers.DatabaseMissing {
+		output.DatabaseUID = drift.Actual.UID
+		output.Actual = newEndpointOutput(drift.Actual)
+	}
+	return output
+}
+
+func newEndpointOutput(credentials cluster.InstanceCredentials) *endpointOutput {
+	output := &endpointOutput{
+		Host:   credentials.Host,
+		Port:   credentials.Port,
+		IPList: credentials.IPList,
+	}
+	if output.IPList == nil {
+		output.IPList = []string{}
+	}
+	return output
+}
+
+// formatTime leaves out unset times.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/persisters"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/reconcilers"
+	"github.com/pivotal-golang/lager"
+)
+
+// reconcile reports the differences between the broker state and
+// the cluster. With -repair it also writes the corrected state.
+func reconcile(conf config.Config, persister persisters.StatePersister, logger lager.Logger, args []string) error {
+	flags := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	repair := flags.Bool("repair", false, "Update the broker state to match the cluster")
+	output := outputFlag(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	asJSON, err := checkOutput(*output)
+	if err != nil {
+		return err
+	}
+
+	reconciler := reconcilers.NewStateReconciler(conf, persister, logger)
+
+	var drifts []reconcilers.Drift
+	if *repair {
+		drifts, err = reconciler.Repair()
+	} else {
+		drifts, err = reconciler.Diff()
+	}
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		res := reconcileOutput{
+			InSync:   len(drifts) == 0,
+			Repaired: *repair && len(drifts) > 0,
+			Drifts:   []driftOutput{},
+		}
+		for _, drift := range drifts {
+			res.Drifts = append(res.Drifts, newDriftOutput(drift))
+		}
+		return printJSON(res)
+	}
+	if len(drifts) == 0 {
+		fmt.Println("The broker state is in sync with the cluster")
+		return nil
+	}
+	for _, drift := range drifts {
+		switch drift.Kind {
+		case reconcilers.DatabaseMissing:
+			fmt.Printf("instance %s: database %d does not exist on the cluster\n", drift.InstanceID, drift.Stored.UID)
+		case reconcilers.CredentialsMissing:
+			fmt.Printf("instance %s: credentials of database %d are missing, actual endpoint %s:%d\n",
+				drift.InstanceID, drift.Actual.UID, drift.Actual.Host, drift.Actual.Port)
+		case reconcilers.CredentialsChanged:
+			fmt.Printf("instance %s: credentials of database %d changed, endpoint %s:%d -> %s:%d\n",
+				drift.InstanceID, drift.Actual.UID, drift.Stored.Host, drift.Stored.Port, drift.Actual.Host, drift.Actual.Port)
+		case reconcilers.DatabaseOrphaned:
+			fmt.Printf("database %d is not used by any service instance\n", drift.Actual.UID)
+		}
+	}
+	if *repair {
+		fmt.Println("The broker state has been updated")
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/cfregistration"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+	"github.com/pivotal-golang/lager"
+)
+
+// register creates or updates the service broker in Cloud Foundry and
+// enables access to the configured plans.
+func register(conf config.Config, logger lager.Logger, args []string) error {
+	flags := flag.NewFlagSet("register", flag.ContinueOnError)
+	api := flags.String("api", "", "Cloud Controller API endpoint, e.g. https://api.example.com")
+	username := flags.String("username", os.Getenv("CF_USERNAME"), "CF user allowed to manage service brokers, $CF_USERNAME by default")
+	password := flags.String("password", os.Getenv("CF_PASSWORD"), "Password of the CF user, $CF_PASSWORD by default")
+	brokerURL := flags.String("broker-url", "", "URL the Cloud Controller reaches the broker at")
+	name := flags.String("name", conf.ServiceBroker.Name, "Name of the service broker registration")
+	skipSSLValidation := flags.Bool("skip-ssl-validation", false, "Do not verify the certificates of the Cloud Controller and UAA")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *api == "" || *brokerURL == "" || *username == "" {
+		return fmt.Errorf("usage: register -api URL -broker-url URL -username USER [-password PASSWORD] [-name NAME]")
+	}
+
+	registrar := cfregistration.NewRegistrar(conf, *api, *username, *password, *skipSSLValidation, os.Stdout, logger)
+	return registrar.Register(*name, *brokerURL)
+}
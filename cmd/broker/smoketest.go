@@ -0,0 +1,29 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/smoketest"
+	"github.com/pivotal-golang/lager"
+)
+
+// smokeTest provisions, binds, pings, unbinds and deprovisions a database
+// to verify a deployment, e.g. from a BOSH errand.
+func smokeTest(conf config.Config, logger lager.Logger, args []string) error {
+	flags := flag.NewFlagSet("smoke-test", flag.ContinueOnError)
+	planID := flags.String("plan", "", "ID of the plan to test, the first plan by default")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	err := smoketest.NewRunner(conf, *planID, os.Stdout, logger).Run()
+	if err != nil {
+		fmt.Println("FAIL")
+		return err
+	}
+	fmt.Println("PASS")
+	return nil
+}
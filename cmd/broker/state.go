@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/persisters"
+)
+
+// exportState writes the broker state to a file, or to stdout when no
+// file is given.
+func exportState(persister persisters.StatePersister, args []string) error {
+	flags := flag.NewFlagSet("export-state", flag.ContinueOnError)
+	output := flags.String("o", "", "Write the state to this file instead of stdout")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	return persisters.Export(persister, w)
+}
+
+// importState replaces the broker state with a previously exported one.
+func importState(persister persisters.StatePersister, migrations []persisters.Migration, args []string) error {
+	flags := flag.NewFlagSet("import-state", flag.ContinueOnError)
+	overwrite := flags.Bool("overwrite", false, "Replace a state that already has service instances")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: import-state [-overwrite] FILE")
+	}
+
+	f, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err = persisters.Import(persister, f, migrations, *overwrite); err != nil {
+		return err
+	}
+	fmt.Println("The broker state has been imported")
+	return nil
+}
+
+// state inspects the service instances recorded in the broker state and
+// removes single entries, e.g. orphaned ones.
+func state(persister persisters.StatePersister, args []string) error {
+	usage := fmt.Errorf("usage: state list [-output json] | state show [-output json] INSTANCE_ID | state rm INSTANCE_ID")
+	if len(args) == 0 {
+		return usage
+	}
+	flags := flag.NewFlagSet("state "+args[0], flag.ContinueOnError)
+	output := outputFlag(flags)
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	asJSON, err := checkOutput(*output)
+	if err != nil {
+		return err
+	}
+	switch args[0] {
+	case "list":
+		if flags.NArg() != 0 {
+			return usage
+		}
+		return listInstances(persister, asJSON)
+	case "show", "rm":
+		if flags.NArg() != 1 {
+			return usage
+		}
+		if args[0] == "show" {
+			return showInstance(persister, flags.Arg(0), asJSON)
+		}
+		return removeInstance(persister, flags.Arg(0))
+	}
+	return usage
+}
+
+func listInstances(persister persisters.StatePersister, asJSON bool) error {
+	s, _, err := persister.Load()
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		instances := []instanceOutput{}
+		for _, instance := range s.AvailableInstances {
+			instances = append(instances, newInstanceOutput(instance, "available", s.InstanceBindings(instance.ID)))
+		}
+		for _, instance := range s.DeletedInstances {
+			instances = append(instances, newInstanceOutput(instance, "deleted", s.InstanceBindings(instance.ID)))
+		}
+		return printJSON(instances)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "INSTANCE\tPLAN\tDATABASE\tENDPOINT\tBINDINGS\tSTATUS")
+	for _, instance := range s.AvailableInstances {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s:%d\t%d\tavailable\n", instance.ID, instance.PlanID, instance.Credentials.UID,
+			instance.Credentials.Host, instance.Credentials.Port, len(s.InstanceBindings(instance.ID)))
+	}
+	for _, instance := range s.DeletedInstances {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s:%d\t%d\tdeleted %s\n", instance.ID, instance.PlanID, instance.Credentials.UID,
+			instance.Credentials.Host, instance.Credentials.Port, len(s.InstanceBindings(instance.ID)), instance.DeletedAt.Format(time.RFC3339))
+	}
+	return w.Flush()
+}
+
+// showInstance prints the recorded instance with its bindings. The
+// passwords are left out, export-state reveals them if need be.
+func showInstance(persister persisters.StatePersister, instanceID string, asJSON bool) error {
+	s, _, err := persister.Load()
+	if err != nil {
+		return err
+	}
+	instance, ok := s.FindInstance(instanceID)
+	if !ok {
+		return fmt.Errorf("instance %s is not in the broker state", instanceID)
+	}
+	if asJSON {
+		status := "available"
+		if !instance.DeletedAt.IsZero() {
+			status = "deleted"
+		}
+		return printJSON(newInstanceOutput(instance, status, s.InstanceBindings(instanceID)))
+	}
+	instance.Credentials.Password = ""
+	instance.ExpiringPasswords = nil
+	bindings := s.InstanceBindings(instanceID)
+	for i := range bindings {
+		bindings[i].Password = ""
+	}
+	encoded, err := json.MarshalIndent(struct {
+		persisters.ServiceInstance
+		Bindings []persisters.Binding
+	}{instance, bindings}, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(encoded))
+	return nil
+}
+
+// removeInstance forgets the instance and its bindings. Its database, if
+// any, is not deleted.
+func removeInstance(persister persisters.StatePersister, instanceID string) error {
+	err := persisters.Update(persister, func(s *persisters.State) error {
+		if !s.RemoveInstance(instanceID) {
+			return fmt.Errorf("instance %s is not in the broker state", instanceID)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Instance %s has been removed from the broker state\n", instanceID)
+	return nil
+}
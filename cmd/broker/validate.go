@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/apiclient"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/cluster"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/logging"
+	"github.com/pivotal-golang/lager"
+)
+
+// validate checks the config and the connection to the cluster, and
+// prints the catalog the broker would serve, without starting it.
+func validate(conf config.Config, logger lager.Logger, args []string) error {
+	flags := flag.NewFlagSet("validate", flag.ContinueOnError)
+	offline := flags.Bool("offline", false, "Do not connect to the cluster")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	problems := conf.Validate()
+	if _, err := logging.ParseLevel(conf.ServiceBroker.Log.Level); err != nil {
+		problems = append(problems, err)
+	}
+	if format := conf.ServiceBroker.Log.Format; format != "" && format != logging.JSONFormat && format != logging.HumanFormat {
+		problems = append(problems, logging.ErrUnknownFormat)
+	}
+	for _, problem := range problems {
+		fmt.Println("config:", problem)
+	}
+	if len(problems) > 0 {
+		return errors.New("the config is invalid")
+	}
+	fmt.Println("The config is valid")
+
+	if !*offline {
+		client := apiclient.New(conf, logger)
+		info, err := client.GetClusterInfo()
+		if err != nil {
+			return fmt.Errorf("failed to connect to the cluster at %s: %s", conf.Cluster.Address, err)
+		}
+		fmt.Printf("Connected to the cluster %s at %s\n", info.Name, conf.Cluster.Address)
+		version, err := client.DetectVersion()
+		if err != nil {
+			return fmt.Errorf("failed to detect the version of the cluster: %s", err)
+		}
+		fmt.Printf("The cluster runs version %s\n", version)
+		for _, plan := range conf.ServiceBroker.Plans {
+			if plan.ACL.Role != "" {
+				if err := client.Supports(cluster.ACLUsers); err != nil {
+					fmt.Printf("plan %q: %s\n", plan.Name, err)
+				}
+			}
+		}
+	}
+
+	broker := redislabs.NewServiceBroker(nil, nil, nil, conf, logger)
+	catalog, err := json.MarshalIndent(map[string]interface{}{
+		"services": broker.Catalog(),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(catalog))
+	return nil
+}
@@ -0,0 +1,121 @@
+package admin
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/persisters"
+)
+
+// securityGroupRule is a rule of a Cloud Foundry application security
+// group.
+type securityGroupRule struct {
+	Protocol    string `json:"protocol"`
+	Destination string `json:"destination"`
+	Ports       string `json:"ports"`
+	Description string `json:"description,omitempty"`
+}
+
+// securityGroup responds with the rules of an application security group
+// that lets apps reach the databases of the available instances, ready
+// for cf create-security-group.
+func (h *handler) securityGroup(w http.ResponseWriter, req *http.Request) {
+	state, _, err := h.persister.Load()
+	if err != nil {
+		h.logger.Error("Failed to load the broker state", err)
+		h.respond(w, http.StatusInternalServerError, errorResponse{Description: err.Error()})
+		return
+	}
+	h.respond(w, http.StatusOK, h.securityGroupRules(state))
+}
+
+// securityGroupRules covers the endpoint addresses of the databases with
+// a range of IPv4 addresses, and the ports of the databases and of the
+// plan port ranges with a range of ports, as security groups accept a
+// single range of ports per rule. IPv6 addresses get a rule each.
+func (h *handler) securityGroupRules(state *persisters.State) []securityGroupRule {
+	var (
+		ipv4       []net.IP
+		ipv6       []string
+		ports      []int
+		seen       = map[string]bool{}
+		addAddress = func(address string) {
+			ip := net.ParseIP(address)
+			if ip == nil || seen[ip.String()] {
+				return
+			}
+			seen[ip.String()] = true
+			if v4 := ip.To4(); v4 != nil {
+				ipv4 = append(ipv4, v4)
+			} else {
+				ipv6 = append(ipv6, ip.String())
+			}
+		}
+	)
+	for _, instance := range state.AvailableInstances {
+		creds := instance.Credentials
+		ports = append(ports, creds.Port)
+		for _, address := range creds.IPList {
+			addAddress(address)
+		}
+		for _, e := range creds.ReadEndpoints {
+			ports = append(ports, e.Port)
+			for _, address := range e.IPList {
+				addAddress(address)
+			}
+		}
+	}
+	for _, plan := range h.conf.ServiceBroker.Plans {
+		settings := plan.ServiceInstanceConfig
+		if settings.PortRange.Max > 0 {
+			ports = append(ports, settings.PortRange.Min, settings.PortRange.Max)
+		}
+		if settings.Port > 0 {
+			ports = append(ports, settings.Port)
+		}
+	}
+
+	rules := []securityGroupRule{}
+	if len(ports) == 0 || len(seen) == 0 {
+		return rules
+	}
+	sort.Ints(ports)
+	portRange := fmt.Sprintf("%d-%d", ports[0], ports[len(ports)-1])
+	if ports[0] == ports[len(ports)-1] {
+		portRange = fmt.Sprintf("%d", ports[0])
+	}
+	description := fmt.Sprintf("%s databases", h.conf.ServiceBroker.Name)
+
+	if len(ipv4) > 0 {
+		sort.Sort(byAddress(ipv4))
+		destination := ipv4[0].String()
+		if len(ipv4) > 1 {
+			destination += "-" + ipv4[len(ipv4)-1].String()
+		}
+		rules = append(rules, securityGroupRule{
+			Protocol:    "tcp",
+			Destination: destination,
+			Ports:       portRange,
+			Description: description,
+		})
+	}
+	sort.Strings(ipv6)
+	for _, address := range ipv6 {
+		rules = append(rules, securityGroupRule{
+			Protocol:    "tcp",
+			Destination: address,
+			Ports:       portRange,
+			Description: description,
+		})
+	}
+	return rules
+}
+
+type byAddress []net.IP
+
+func (a byAddress) Len() int           { return len(a) }
+func (a byAddress) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byAddress) Less(i, j int) bool { return bytes.Compare(a[i], a[j]) < 0 }
@@ -0,0 +1,92 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+
+	"github.com/gorilla/mux"
+	"github.com/pivotal-cf/brokerapi/auth"
+	"github.com/pivotal-golang/lager"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/apiclient"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/persisters"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/reconcilers"
+)
+
+type varsResponse struct {
+	Goroutines  int            `json:"goroutines"`
+	ActivePolls int64          `json:"active_polls"`
+	Memory      memoryResponse `json:"memory"`
+	State       stateResponse  `json:"state"`
+	// CredentialDrifts counts the instances whose credentials have been
+	// refreshed since the broker started.
+	CredentialDrifts int64 `json:"credential_drifts"`
+}
+
+type memoryResponse struct {
+	Alloc       uint64 `json:"alloc"`
+	HeapObjects uint64 `json:"heap_objects"`
+	NumGC       uint32 `json:"num_gc"`
+}
+
+type stateResponse struct {
+	Instances        int    `json:"instances"`
+	DeletedInstances int    `json:"deleted_instances"`
+	Tasks            int    `json:"tasks"`
+	Bytes            int    `json:"bytes"`
+	Error            string `json:"error,omitempty"`
+}
+
+// NewDebugHandler returns the runtime diagnostics of the broker, the pprof
+// profiles under /debug/pprof/ and a summary under /debug/vars, protected
+// by the admin credentials. They help to track down goroutine leaks, for
+// instance of the loops polling for new databases.
+func NewDebugHandler(conf config.Config, persister persisters.StatePersister, logger lager.Logger) http.Handler {
+	h := &handler{
+		persister: persister,
+		logger:    logger.Session("debug"),
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/debug/vars", h.vars).Methods("GET")
+	router.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	router.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	router.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	router.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	router.PathPrefix("/debug/pprof/").HandlerFunc(pprof.Index)
+
+	return auth.NewWrapper(conf.ServiceBroker.Admin.Auth.Username, conf.ServiceBroker.Admin.Auth.Password).Wrap(router)
+}
+
+func (h *handler) vars(w http.ResponseWriter, req *http.Request) {
+	var memory runtime.MemStats
+	runtime.ReadMemStats(&memory)
+
+	res := varsResponse{
+		Goroutines:  runtime.NumGoroutine(),
+		ActivePolls: apiclient.ActivePolls(),
+		Memory: memoryResponse{
+			Alloc:       memory.Alloc,
+			HeapObjects: memory.HeapObjects,
+			NumGC:       memory.NumGC,
+		},
+		CredentialDrifts: reconcilers.CredentialDrifts(),
+	}
+
+	state, _, err := h.persister.Load()
+	if err != nil {
+		h.logger.Error("Failed to load the broker state", err)
+		res.State.Error = err.Error()
+	} else {
+		res.State.Instances = len(state.AvailableInstances)
+		res.State.DeletedInstances = len(state.DeletedInstances)
+		res.State.Tasks = len(state.Tasks)
+		if encoded, err := json.Marshal(state); err == nil {
+			res.State.Bytes = len(encoded)
+		}
+	}
+	h.respond(w, http.StatusOK, res)
+}
@@ -0,0 +1,241 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-golang/lager"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/persisters"
+)
+
+// ErrNoOwnerGUID is returned for bulk deprovisions that would not be
+// limited to an organization or a space.
+var ErrNoOwnerGUID = errors.New("an organization or a space GUID is required")
+
+// deprovisionDryRun is the state of the reports of dry runs.
+const deprovisionDryRun = "dry run"
+
+// Deprovisioner deletes service instances the way the broker does, so
+// that bulk deprovisions get the same safety checks as the platform, like
+// the deletion protection of instances.
+type Deprovisioner interface {
+	Deprovision(instanceID string, details brokerapi.DeprovisionDetails, asyncAllowed bool) (brokerapi.IsAsync, error)
+}
+
+type deprovisionRequest struct {
+	OrganizationGUID string `json:"organization_guid"`
+	SpaceGUID        string `json:"space_guid"`
+	DryRun           bool   `json:"dry_run"`
+}
+
+// BulkDeprovision is the report of the deprovisioning of all the instances
+// of an organization or a space, e.g. after an organization was offboarded.
+type BulkDeprovision struct {
+	ID               string                `json:"id,omitempty"`
+	OrganizationGUID string                `json:"organization_guid,omitempty"`
+	SpaceGUID        string                `json:"space_guid,omitempty"`
+	DryRun           bool                  `json:"dry_run"`
+	State            string                `json:"state"`
+	StartedAt        string                `json:"started_at,omitempty"`
+	FinishedAt       string                `json:"finished_at,omitempty"`
+	Succeeded        int                   `json:"succeeded"`
+	Failed           int                   `json:"failed"`
+	Instances        []InstanceDeprovision `json:"instances"`
+}
+
+// InstanceDeprovision is the state of an instance of a bulk deprovision.
+type InstanceDeprovision struct {
+	InstanceID       string `json:"instance_id"`
+	PlanID           string `json:"plan_id,omitempty"`
+	OrganizationGUID string `json:"organization_guid,omitempty"`
+	SpaceGUID        string `json:"space_guid,omitempty"`
+	Bindings         int    `json:"bindings"`
+	State            string `json:"state"`
+	Error            string `json:"error,omitempty"`
+}
+
+// NewBulkDeprovision selects the instances of the state in the organization
+// and the space, either of which may be empty but not both. A dry run is
+// complete as it is, the others are still to be run.
+func NewBulkDeprovision(state *persisters.State, orgGUID, spaceGUID string, dryRun bool) (*BulkDeprovision, error) {
+	if orgGUID == "" && spaceGUID == "" {
+		return nil, ErrNoOwnerGUID
+	}
+	d := &BulkDeprovision{
+		OrganizationGUID: orgGUID,
+		SpaceGUID:        spaceGUID,
+		DryRun:           dryRun,
+		State:            upgradePending,
+		Instances:        []InstanceDeprovision{},
+	}
+	if dryRun {
+		d.State = deprovisionDryRun
+	}
+	for _, instance := range state.AvailableInstances {
+		if orgGUID != "" && instance.OrganizationGUID != orgGUID {
+			continue
+		}
+		if spaceGUID != "" && instance.SpaceGUID != spaceGUID {
+			continue
+		}
+		d.Instances = append(d.Instances, InstanceDeprovision{
+			InstanceID:       instance.ID,
+			PlanID:           instance.PlanID,
+			OrganizationGUID: instance.OrganizationGUID,
+			SpaceGUID:        instance.SpaceGUID,
+			Bindings:         len(state.InstanceBindings(instance.ID)),
+			State:            d.State,
+		})
+	}
+	return d, nil
+}
+
+// Run deprovisions the instances one at a time. A failing instance does
+// not stop the others, the report counts the failures instead. Every
+// change of the report is made through record, so that it can be read
+// while it runs.
+func (d *BulkDeprovision) Run(deprovisioner Deprovisioner, serviceID string, record func(change func()), logger lager.Logger) {
+	record(func() {
+		d.State = upgradeInProgress
+		d.StartedAt = time.Now().UTC().Format(time.RFC3339)
+	})
+	for i := range d.Instances {
+		instance := &d.Instances[i]
+		record(func() { instance.State = upgradeInProgress })
+		_, err := deprovisioner.Deprovision(instance.InstanceID, brokerapi.DeprovisionDetails{
+			PlanID:    instance.PlanID,
+			ServiceID: serviceID,
+		}, false)
+		record(func() {
+			if err != nil {
+				instance.State, instance.Error = upgradeFailed, err.Error()
+				d.Failed++
+			} else {
+				instance.State = upgradeSucceeded
+				d.Succeeded++
+			}
+		})
+		if err != nil {
+			logger.Error("Failed to deprovision an instance", err, lager.Data{"instance-id": instance.InstanceID})
+		} else {
+			logger.Info("Deprovisioned an instance", lager.Data{"instance-id": instance.InstanceID})
+		}
+	}
+	record(func() {
+		d.State = upgradeSucceeded
+		if d.Failed > 0 {
+			d.State = upgradeFailed
+		}
+		d.FinishedAt = time.Now().UTC().Format(time.RFC3339)
+	})
+}
+
+// deprovisions tracks the bulk deprovisions started since the broker
+// started.
+type deprovisions struct {
+	lock  sync.Mutex
+	count int
+	all   map[string]*BulkDeprovision
+}
+
+func newDeprovisions() *deprovisions {
+	return &deprovisions{all: map[string]*BulkDeprovision{}}
+}
+
+func (d *deprovisions) add(deprovision *BulkDeprovision) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.count++
+	deprovision.ID = fmt.Sprintf("%d-deprovision", d.count)
+	d.all[deprovision.ID] = deprovision
+}
+
+// report returns a copy of the deprovision, safe to encode while it runs.
+func (d *deprovisions) report(ID string) (BulkDeprovision, bool) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	deprovision, ok := d.all[ID]
+	if !ok {
+		return BulkDeprovision{}, false
+	}
+	report := *deprovision
+	report.Instances = append([]InstanceDeprovision{}, deprovision.Instances...)
+	return report, true
+}
+
+// set records a change of a deprovision.
+func (d *deprovisions) set(change func()) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	change()
+}
+
+// deprovisionInstances deletes all the instances of an organization or a
+// space. A dry run responds with the instances that would be deleted.
+// Otherwise it responds right away with the report of the deprovision,
+// which runs in the background.
+func (h *handler) deprovisionInstances(w http.ResponseWriter, req *http.Request) {
+	var request deprovisionRequest
+	if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+		h.respond(w, http.StatusBadRequest, errorResponse{Description: err.Error()})
+		return
+	}
+	if request.OrganizationGUID == "" && request.SpaceGUID == "" {
+		h.respond(w, http.StatusBadRequest, errorResponse{Description: ErrNoOwnerGUID.Error()})
+		return
+	}
+	if h.deprovisioner == nil && !request.DryRun {
+		h.respond(w, http.StatusNotImplemented, errorResponse{Description: "deprovisions are not supported"})
+		return
+	}
+
+	state, _, err := h.persister.Load()
+	if err != nil {
+		h.logger.Error("Failed to load the broker state", err)
+		h.respond(w, http.StatusInternalServerError, errorResponse{Description: err.Error()})
+		return
+	}
+	deprovision, err := NewBulkDeprovision(state, request.OrganizationGUID, request.SpaceGUID, request.DryRun)
+	if err != nil {
+		h.respond(w, http.StatusBadRequest, errorResponse{Description: err.Error()})
+		return
+	}
+	if request.DryRun {
+		h.respond(w, http.StatusOK, deprovision)
+		return
+	}
+
+	h.deprovisions.add(deprovision)
+	logger := h.logger.Session("deprovision", lager.Data{"deprovision-id": deprovision.ID})
+	logger.Info("Starting a bulk deprovision", lager.Data{
+		"organization-guid": request.OrganizationGUID,
+		"space-guid":        request.SpaceGUID,
+		"instances":         len(deprovision.Instances),
+	})
+
+	report, _ := h.deprovisions.report(deprovision.ID)
+	go func() {
+		deprovision.Run(h.deprovisioner, h.conf.ServiceBroker.ServiceID, h.deprovisions.set, logger)
+		logger.Info("Finished a bulk deprovision", lager.Data{
+			"succeeded": deprovision.Succeeded,
+			"failed":    deprovision.Failed,
+		})
+	}()
+	h.respond(w, http.StatusAccepted, report)
+}
+
+func (h *handler) showDeprovision(w http.ResponseWriter, req *http.Request) {
+	report, ok := h.deprovisions.report(mux.Vars(req)["deprovision_id"])
+	if !ok {
+		h.respond(w, http.StatusNotFound, errorResponse{Description: "deprovision does not exist"})
+		return
+	}
+	h.respond(w, http.StatusOK, report)
+}
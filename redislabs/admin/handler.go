@@ -0,0 +1,346 @@
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-cf/brokerapi/auth"
+	"github.com/pivotal-golang/lager"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/apiclient"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/audit"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/logging"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/migrations"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/persisters"
+)
+
+type handler struct {
+	conf          config.Config
+	apiClient     apiclient.Client
+	persister     persisters.StatePersister
+	migrations    []persisters.Migration
+	updater       InstanceUpdater
+	upgrades      *upgrades
+	deprovisioner Deprovisioner
+	deprovisions  *deprovisions
+	logger        lager.Logger
+}
+
+type instanceResponse struct {
+	ID               string   `json:"id"`
+	PlanID           string   `json:"plan_id,omitempty"`
+	OrganizationGUID string   `json:"organization_guid,omitempty"`
+	SpaceGUID        string   `json:"space_guid,omitempty"`
+	DatabaseUID      int      `json:"database_uid"`
+	Host             string   `json:"host"`
+	Port             int      `json:"port"`
+	IPList           []string `json:"ip_list"`
+	DeletedAt        string   `json:"deleted_at,omitempty"`
+	Status           string   `json:"status,omitempty"`
+	StatusError      string   `json:"status_error,omitempty"`
+	// Parameters are the ones the instance was provisioned or last
+	// updated with, their passwords redacted.
+	Parameters map[string]interface{} `json:"parameters,omitempty"`
+	// Bindings are only shown for available instances.
+	Bindings []bindingResponse `json:"bindings,omitempty"`
+}
+
+type bindingResponse struct {
+	ID                     string `json:"id"`
+	AppGUID                string `json:"app_guid,omitempty"`
+	CreatedAt              string `json:"created_at"`
+	CredentialsFingerprint string `json:"credentials_fingerprint"`
+}
+
+type errorResponse struct {
+	Description string `json:"description"`
+}
+
+// NewHandler returns the operator facing API protected by the admin
+// credentials. It lets operators troubleshoot service instances without
+// reading the state file by hand. Plan upgrades apply their settings with
+// the updater and bulk deprovisions delete instances with the
+// deprovisioner, they are not supported if those are nil.
+func NewHandler(conf config.Config, persister persisters.StatePersister, updater InstanceUpdater, deprovisioner Deprovisioner, logger lager.Logger) http.Handler {
+	h := &handler{
+		conf:          conf,
+		apiClient:     apiclient.New(conf, logger),
+		persister:     persister,
+		migrations:    migrations.Default(conf, logger),
+		updater:       updater,
+		upgrades:      newUpgrades(),
+		deprovisioner: deprovisioner,
+		deprovisions:  newDeprovisions(),
+		logger:        logger.Session("admin"),
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/admin/instances", h.listInstances).Methods("GET")
+	router.HandleFunc("/admin/instances/{instance_id}", h.showInstance).Methods("GET")
+	router.HandleFunc("/admin/instances/{instance_id}/deletion_protection", h.removeDeletionProtection).Methods("DELETE")
+	router.HandleFunc("/admin/deleted_instances", h.listDeletedInstances).Methods("GET")
+	router.HandleFunc("/admin/deleted_instances/{instance_id}/restore", h.restoreInstance).Methods("POST")
+	router.HandleFunc("/admin/state", h.exportState).Methods("GET")
+	router.HandleFunc("/admin/state", h.importState).Methods("PUT")
+	router.HandleFunc("/admin/security_group", h.securityGroup).Methods("GET")
+	router.HandleFunc("/admin/cluster/credentials", h.changeClusterCredentials).Methods("PUT")
+	router.HandleFunc("/admin/plans/{plan_id}/upgrade", h.upgradePlan).Methods("POST")
+	router.HandleFunc("/admin/upgrades/{upgrade_id}", h.showUpgrade).Methods("GET")
+	router.HandleFunc("/admin/deprovisions", h.deprovisionInstances).Methods("POST")
+	router.HandleFunc("/admin/deprovisions/{deprovision_id}", h.showDeprovision).Methods("GET")
+	router.HandleFunc("/admin/usage", h.usageReport).Methods("GET")
+
+	return auth.NewWrapper(conf.ServiceBroker.Admin.Auth.Username, conf.ServiceBroker.Admin.Auth.Password).Wrap(router)
+}
+
+func (h *handler) listInstances(w http.ResponseWriter, req *http.Request) {
+	state, _, err := h.persister.Load()
+	if err != nil {
+		h.logger.Error("Failed to load the broker state", err)
+		h.respond(w, http.StatusInternalServerError, errorResponse{Description: err.Error()})
+		return
+	}
+
+	instances := []instanceResponse{}
+	for _, instance := range state.AvailableInstances {
+		res := newInstanceResponse(instance)
+		res.Bindings = newBindingResponses(state.InstanceBindings(instance.ID))
+		instances = append(instances, res)
+	}
+	h.respond(w, http.StatusOK, instances)
+}
+
+func (h *handler) showInstance(w http.ResponseWriter, req *http.Request) {
+	instanceID := mux.Vars(req)["instance_id"]
+
+	state, _, err := h.persister.Load()
+	if err != nil {
+		h.logger.Error("Failed to load the broker state", err)
+		h.respond(w, http.StatusInternalServerError, errorResponse{Description: err.Error()})
+		return
+	}
+
+	for _, instance := range state.AvailableInstances {
+		if instance.ID == instanceID {
+			res := newInstanceResponse(instance)
+			res.Bindings = newBindingResponses(state.InstanceBindings(instance.ID))
+			status, err := h.apiClient.GetDatabaseStatus(instance.Credentials.UID)
+			if err != nil {
+				res.StatusError = err.Error()
+			} else {
+				res.Status = status
+			}
+			h.respond(w, http.StatusOK, res)
+			return
+		}
+	}
+	h.respond(w, http.StatusNotFound, errorResponse{Description: "instance does not exist"})
+}
+
+func (h *handler) listDeletedInstances(w http.ResponseWriter, req *http.Request) {
+	state, _, err := h.persister.Load()
+	if err != nil {
+		h.logger.Error("Failed to load the broker state", err)
+		h.respond(w, http.StatusInternalServerError, errorResponse{Description: err.Error()})
+		return
+	}
+
+	instances := []instanceResponse{}
+	for _, instance := range state.DeletedInstances {
+		res := newInstanceResponse(instance)
+		res.DeletedAt = instance.DeletedAt.Format(time.RFC3339)
+		instances = append(instances, res)
+	}
+	h.respond(w, http.StatusOK, instances)
+}
+
+// restoreInstance brings back a deleted instance whose database has not
+// been reaped yet.
+func (h *handler) restoreInstance(w http.ResponseWriter, req *http.Request) {
+	instanceID := mux.Vars(req)["instance_id"]
+
+	var restored persisters.ServiceInstance
+	err := persisters.Update(h.persister, func(state *persisters.State) error {
+		taken := false
+		for _, instance := range state.AvailableInstances {
+			taken = taken || instance.ID == instanceID
+		}
+		found := false
+		deleted := []persisters.ServiceInstance{}
+		for _, instance := range state.DeletedInstances {
+			if instance.ID != instanceID {
+				deleted = append(deleted, instance)
+				continue
+			}
+			instance.DeletedAt = time.Time{}
+			state.AvailableInstances = append(state.AvailableInstances, instance)
+			restored, found = instance, true
+		}
+		if !found {
+			return brokerapi.ErrInstanceDoesNotExist
+		}
+		// The platform may have reused the ID of the deleted instance.
+		if taken {
+			return brokerapi.ErrInstanceAlreadyExists
+		}
+		state.DeletedInstances = deleted
+		return nil
+	})
+	if err == brokerapi.ErrInstanceDoesNotExist {
+		h.respond(w, http.StatusNotFound, errorResponse{Description: "deleted instance does not exist"})
+		return
+	}
+	if err == brokerapi.ErrInstanceAlreadyExists {
+		h.respond(w, http.StatusConflict, errorResponse{Description: "an available instance has the ID of the deleted instance"})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to save the broker state", err)
+		h.respond(w, http.StatusInternalServerError, errorResponse{Description: err.Error()})
+		return
+	}
+	UID := restored.Credentials.UID
+	if err = apiclient.SetDatabaseTag(h.apiClient, UID, apiclient.DeletedAtTag, ""); err != nil {
+		h.logger.Error("Failed to untag the restored database", err, lager.Data{"instance-id": instanceID, "UID": UID})
+	}
+	h.logger.Info("Restored a deleted instance", lager.Data{"instance-id": instanceID})
+	h.respond(w, http.StatusOK, newInstanceResponse(restored))
+}
+
+// removeDeletionProtection lets operators delete a protected instance
+// without asking its developers to update it first.
+func (h *handler) removeDeletionProtection(w http.ResponseWriter, req *http.Request) {
+	instanceID := mux.Vars(req)["instance_id"]
+
+	err := persisters.Update(h.persister, func(state *persisters.State) error {
+		for i, instance := range state.AvailableInstances {
+			if instance.ID != instanceID {
+				continue
+			}
+			if instance.Parameters != nil {
+				delete(state.AvailableInstances[i].Parameters, "deletion_protection")
+			}
+			return nil
+		}
+		return brokerapi.ErrInstanceDoesNotExist
+	})
+	if err == brokerapi.ErrInstanceDoesNotExist {
+		h.respond(w, http.StatusNotFound, errorResponse{Description: "instance does not exist"})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to save the broker state", err)
+		h.respond(w, http.StatusInternalServerError, errorResponse{Description: err.Error()})
+		return
+	}
+	h.logger.Info("Removed the deletion protection", lager.Data{"instance-id": instanceID})
+	h.respond(w, http.StatusOK, struct{}{})
+}
+
+func (h *handler) exportState(w http.ResponseWriter, req *http.Request) {
+	buf := &bytes.Buffer{}
+	if err := persisters.Export(h.persister, buf); err != nil {
+		h.logger.Error("Failed to export the broker state", err)
+		h.respond(w, http.StatusInternalServerError, errorResponse{Description: err.Error()})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="state.json"`)
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// importState replaces the broker state with the request body. A state
+// with service instances is only replaced given ?overwrite=true.
+func (h *handler) importState(w http.ResponseWriter, req *http.Request) {
+	overwrite := req.URL.Query().Get("overwrite") == "true"
+	err := persisters.Import(h.persister, req.Body, h.migrations, overwrite)
+	switch err {
+	case nil:
+		h.logger.Info("Imported the broker state")
+		h.respond(w, http.StatusOK, struct{}{})
+	case persisters.ErrStateNotEmpty:
+		h.respond(w, http.StatusConflict, errorResponse{Description: err.Error()})
+	default:
+		h.logger.Error("Failed to import the broker state", err)
+		h.respond(w, http.StatusBadRequest, errorResponse{Description: err.Error()})
+	}
+}
+
+type credentialsRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// changeClusterCredentials makes the broker use new cluster API
+// credentials from now on. The config has to be changed as well for them
+// to survive a restart.
+func (h *handler) changeClusterCredentials(w http.ResponseWriter, req *http.Request) {
+	var credentials credentialsRequest
+	if err := json.NewDecoder(req.Body).Decode(&credentials); err != nil {
+		h.respond(w, http.StatusBadRequest, errorResponse{Description: err.Error()})
+		return
+	}
+	if credentials.Username == "" || credentials.Password == "" {
+		h.respond(w, http.StatusBadRequest, errorResponse{Description: "a username and a password are required"})
+		return
+	}
+
+	err := apiclient.ChangeCredentials(h.conf.Cluster, credentials.Username, credentials.Password, h.logger)
+	switch err {
+	case nil:
+		admin, _, _ := req.BasicAuth()
+		audit.Emit(audit.CredentialsRotated, map[string]string{
+			"msg":   "cluster API credentials changed",
+			"suser": admin,
+			"duser": credentials.Username,
+		})
+		h.respond(w, http.StatusOK, struct{}{})
+	case apiclient.ErrCredentialsRejected:
+		h.respond(w, http.StatusUnprocessableEntity, errorResponse{Description: err.Error()})
+	default:
+		h.logger.Error("Failed to change the cluster credentials", err)
+		h.respond(w, http.StatusBadGateway, errorResponse{Description: err.Error()})
+	}
+}
+
+func (h *handler) respond(w http.ResponseWriter, status int, response interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		h.logger.Error("Failed to encode the response", err, lager.Data{"status": status})
+	}
+}
+
+func newInstanceResponse(instance persisters.ServiceInstance) instanceResponse {
+	return instanceResponse{
+		ID:               instance.ID,
+		PlanID:           instance.PlanID,
+		OrganizationGUID: instance.OrganizationGUID,
+		SpaceGUID:        instance.SpaceGUID,
+		DatabaseUID:      instance.Credentials.UID,
+		Host:             instance.Credentials.Host,
+		Port:             instance.Credentials.Port,
+		IPList:           instance.Credentials.IPList,
+		Parameters:       logging.RedactValues(instance.Parameters),
+	}
+}
+
+func newBindingResponses(bindings []persisters.Binding) []bindingResponse {
+	responses := []bindingResponse{}
+	for _, binding := range bindings {
+		responses = append(responses, bindingResponse{
+			ID:                     binding.ID,
+			AppGUID:                binding.AppGUID,
+			CreatedAt:              binding.CreatedAt.Format(time.RFC3339),
+			CredentialsFingerprint: binding.CredentialsFingerprint,
+		})
+	}
+	return responses
+}
@@ -0,0 +1,626 @@
+package admin_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/admin"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/audit"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/cluster"
+	brokerconfig "github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/logging"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/persisters"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/testing"
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-golang/lager"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Admin API", func() {
+	var (
+		handler     http.Handler
+		proxy       testing.HTTPProxy
+		tmpStateDir string
+		persister   persisters.StatePersister
+		logger      = lager.NewLogger("test")
+		// clusterPassword is the password of the last request to the
+		// database.
+		clusterPassword string
+		updater         *fakeUpdater
+		deprovisioner   *fakeDeprovisioner
+	)
+
+	send := func(method string, path string, username string, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, path, strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		req.SetBasicAuth(username, "admin-password")
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+	request := func(path string, username string) *httptest.ResponseRecorder {
+		return send("GET", path, username, "")
+	}
+
+	BeforeEach(func() {
+		var err error
+		tmpStateDir, err = ioutil.TempDir("", "redislabs-state-test")
+		Expect(err).NotTo(HaveOccurred())
+		persister = persisters.NewLocalPersister(path.Join(tmpStateDir, "state.json"))
+		_, err = persister.Save(&persisters.State{
+			AvailableInstances: []persisters.ServiceInstance{
+				{
+					ID:         "test-instance",
+					Parameters: map[string]interface{}{"deletion_protection": true, "authentication_redis_pass": "secret"},
+					Credentials: cluster.InstanceCredentials{
+						UID:      1,
+						Host:     "example.com",
+						Port:     11909,
+						IPList:   []string{"10.0.2.5"},
+						Password: "secret",
+					},
+				},
+			},
+			Bindings: []persisters.Binding{
+				{ID: "test-binding", InstanceID: "test-instance", AppGUID: "app-guid"},
+			},
+		}, persisters.AnyRevision)
+		Expect(err).NotTo(HaveOccurred())
+
+		proxy = testing.NewHTTPProxy()
+		clusterPassword = ""
+		proxy.RegisterEndpointHandler("/v1/bdbs/1", func(w http.ResponseWriter, r *http.Request) interface{} {
+			_, clusterPassword, _ = r.BasicAuth()
+			return map[string]interface{}{"uid": 1, "status": "active"}
+		})
+
+		conf := brokerconfig.Config{
+			Cluster: brokerconfig.ClusterConfig{Address: proxy.URL()},
+			ServiceBroker: brokerconfig.ServiceBrokerConfig{
+				Admin: brokerconfig.AdminConfig{
+					Auth: brokerconfig.AuthConfig{Username: "admin", Password: "admin-password"},
+				},
+				Plans: []brokerconfig.ServicePlanConfig{{ID: "test-plan", Name: "test"}},
+			},
+		}
+		updater = &fakeUpdater{}
+		deprovisioner = &fakeDeprovisioner{}
+		handler = admin.NewHandler(conf, persister, updater, deprovisioner, logger)
+	})
+
+	AfterEach(func() {
+		proxy.Close()
+		os.RemoveAll(tmpStateDir)
+	})
+
+	It("Requires the admin credentials", func() {
+		Expect(request("/admin/instances", "someone").Code).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("Lists the instances without exposing passwords", func() {
+		res := request("/admin/instances", "admin")
+		Expect(res.Code).To(Equal(http.StatusOK))
+		Expect(res.Body.String()).NotTo(ContainSubstring("secret"))
+
+		var instances []map[string]interface{}
+		Expect(json.Unmarshal(res.Body.Bytes(), &instances)).To(Succeed())
+		Expect(instances).To(HaveLen(1))
+		Expect(instances[0]["id"]).To(Equal("test-instance"))
+		Expect(instances[0]["host"]).To(Equal("example.com"))
+		Expect(instances[0]["parameters"]).To(Equal(map[string]interface{}{
+			"deletion_protection":       true,
+			"authentication_redis_pass": logging.Redacted,
+		}))
+	})
+
+	It("Generates a security group covering the databases", func() {
+		state, revision, err := persister.Load()
+		Expect(err).NotTo(HaveOccurred())
+		state.AvailableInstances = append(state.AvailableInstances, persisters.ServiceInstance{
+			ID: "other-instance",
+			Credentials: cluster.InstanceCredentials{
+				UID:    2,
+				Port:   12001,
+				IPList: []string{"10.0.2.7", "10.0.2.5"},
+			},
+		})
+		_, err = persister.Save(state, revision)
+		Expect(err).NotTo(HaveOccurred())
+
+		res := request("/admin/security_group", "admin")
+		Expect(res.Code).To(Equal(http.StatusOK))
+		var rules []map[string]interface{}
+		Expect(json.Unmarshal(res.Body.Bytes(), &rules)).To(Succeed())
+		Expect(rules).To(HaveLen(1))
+		Expect(rules[0]["protocol"]).To(Equal("tcp"))
+		Expect(rules[0]["destination"]).To(Equal("10.0.2.5-10.0.2.7"))
+		Expect(rules[0]["ports"]).To(Equal("11909-12001"))
+	})
+
+	It("Shows an instance with its current status", func() {
+		res := request("/admin/instances/test-instance", "admin")
+		Expect(res.Code).To(Equal(http.StatusOK))
+
+		var instance map[string]interface{}
+		Expect(json.Unmarshal(res.Body.Bytes(), &instance)).To(Succeed())
+		Expect(instance["database_uid"]).To(BeEquivalentTo(1))
+		Expect(instance["status"]).To(Equal("active"))
+		Expect(instance["parameters"]).To(HaveKeyWithValue("deletion_protection", true))
+		Expect(instance["bindings"]).To(HaveLen(1))
+		Expect(instance["bindings"].([]interface{})[0]).To(HaveKeyWithValue("app_guid", "app-guid"))
+	})
+
+	It("Responds with 404 to unknown instances", func() {
+		Expect(request("/admin/instances/unknown", "admin").Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("Restores a deleted instance", func() {
+		var tags interface{}
+		proxy.RegisterEndpointHandler("/v1/bdbs/2", func(w http.ResponseWriter, r *http.Request) interface{} {
+			if r.Method == "PUT" {
+				var settings map[string]interface{}
+				Expect(json.NewDecoder(r.Body).Decode(&settings)).To(Succeed())
+				tags = settings["tags"]
+			}
+			return map[string]interface{}{"uid": 2, "tags": []map[string]string{
+				{"key": "cf_instance_id", "value": "deleted-instance"},
+				{"key": "cf_deleted_at", "value": "2026-01-02T03:04:05Z"},
+			}}
+		})
+		state, revision, err := persister.Load()
+		Expect(err).NotTo(HaveOccurred())
+		state.DeletedInstances = []persisters.ServiceInstance{{
+			ID:          "deleted-instance",
+			Credentials: cluster.InstanceCredentials{UID: 2},
+			DeletedAt:   time.Now(),
+		}}
+		_, err = persister.Save(state, revision)
+		Expect(err).NotTo(HaveOccurred())
+
+		res := request("/admin/deleted_instances", "admin")
+		Expect(res.Code).To(Equal(http.StatusOK))
+		Expect(res.Body.String()).To(ContainSubstring("deleted-instance"))
+
+		res = send("POST", "/admin/deleted_instances/deleted-instance/restore", "admin", "")
+		Expect(res.Code).To(Equal(http.StatusOK))
+		state, _, err = persister.Load()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state.DeletedInstances).To(BeEmpty())
+		Expect(state.AvailableInstances).To(HaveLen(2))
+		Expect(state.AvailableInstances[1].ID).To(Equal("deleted-instance"))
+		Expect(tags).To(Equal([]interface{}{
+			map[string]interface{}{"key": "cf_instance_id", "value": "deleted-instance"},
+		}))
+
+		res = send("POST", "/admin/deleted_instances/deleted-instance/restore", "admin", "")
+		Expect(res.Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("Does not restore a deleted instance whose ID is taken", func() {
+		state, revision, err := persister.Load()
+		Expect(err).NotTo(HaveOccurred())
+		state.DeletedInstances = []persisters.ServiceInstance{{
+			ID:          "test-instance",
+			Credentials: cluster.InstanceCredentials{UID: 2},
+			DeletedAt:   time.Now(),
+		}}
+		_, err = persister.Save(state, revision)
+		Expect(err).NotTo(HaveOccurred())
+
+		res := send("POST", "/admin/deleted_instances/test-instance/restore", "admin", "")
+		Expect(res.Code).To(Equal(http.StatusConflict))
+		state, _, err = persister.Load()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state.AvailableInstances).To(HaveLen(1))
+		Expect(state.DeletedInstances).To(HaveLen(1))
+	})
+
+	It("Removes the deletion protection of an instance", func() {
+		res := send("DELETE", "/admin/instances/test-instance/deletion_protection", "admin", "")
+		Expect(res.Code).To(Equal(http.StatusOK))
+		Expect(request("/admin/state", "admin").Body.String()).NotTo(ContainSubstring("deletion_protection"))
+
+		res = send("DELETE", "/admin/instances/unknown/deletion_protection", "admin", "")
+		Expect(res.Code).To(Equal(http.StatusNotFound))
+	})
+
+	Describe("Rotating the cluster credentials", func() {
+		BeforeEach(func() {
+			proxy.RegisterEndpointHandler("/v1/cluster", func(w http.ResponseWriter, r *http.Request) interface{} {
+				if _, p, _ := r.BasicAuth(); p != "new-password" {
+					w.WriteHeader(http.StatusUnauthorized)
+					return map[string]interface{}{"description": "unauthorized"}
+				}
+				return map[string]interface{}{"name": "cluster.example.com"}
+			})
+		})
+
+		It("Switches to credentials the cluster accepts", func() {
+			res := send("PUT", "/admin/cluster/credentials", "admin", `{"username": "admin@example.com", "password": "new-password"}`)
+			Expect(res.Code).To(Equal(http.StatusOK))
+
+			Expect(request("/admin/instances/test-instance", "admin").Code).To(Equal(http.StatusOK))
+			Expect(clusterPassword).To(Equal("new-password"))
+		})
+
+		It("Reports the rotation as a security event", func() {
+			output := &bytes.Buffer{}
+			audit.SetEmitter(audit.NewWriterEmitter(output))
+			defer audit.Configure(brokerconfig.SecurityEventsConfig{})
+
+			res := send("PUT", "/admin/cluster/credentials", "admin", `{"username": "admin@example.com", "password": "new-password"}`)
+			Expect(res.Code).To(Equal(http.StatusOK))
+			Expect(output.String()).To(ContainSubstring("|credentials-rotated|"))
+			Expect(output.String()).To(ContainSubstring("duser=admin@example.com"))
+			Expect(output.String()).NotTo(ContainSubstring("new-password"))
+		})
+
+		It("Keeps the credentials the cluster rejects from being used", func() {
+			res := send("PUT", "/admin/cluster/credentials", "admin", `{"username": "admin@example.com", "password": "wrong"}`)
+			Expect(res.Code).To(Equal(http.StatusUnprocessableEntity))
+
+			Expect(request("/admin/instances/test-instance", "admin").Code).To(Equal(http.StatusOK))
+			Expect(clusterPassword).To(BeEmpty())
+		})
+
+		It("Requires a username and a password", func() {
+			res := send("PUT", "/admin/cluster/credentials", "admin", `{"username": "admin@example.com"}`)
+			Expect(res.Code).To(Equal(http.StatusBadRequest))
+		})
+	})
+
+	Describe("Upgrading the instances of a plan", func() {
+		BeforeEach(func() {
+			state, revision, err := persister.Load()
+			Expect(err).NotTo(HaveOccurred())
+			for _, ID := range []string{"instance-1", "instance-2", "instance-3"} {
+				state.AvailableInstances = append(state.AvailableInstances, persisters.ServiceInstance{ID: ID, PlanID: "test-plan"})
+			}
+			_, err = persister.Save(state, revision)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		upgrade := func(body string) map[string]interface{} {
+			res := send("POST", "/admin/plans/test-plan/upgrade", "admin", body)
+			Expect(res.Code).To(Equal(http.StatusAccepted))
+			var started map[string]interface{}
+			Expect(json.Unmarshal(res.Body.Bytes(), &started)).To(Succeed())
+
+			var report map[string]interface{}
+			Eventually(func() interface{} {
+				res := request("/admin/upgrades/"+started["id"].(string), "admin")
+				Expect(res.Code).To(Equal(http.StatusOK))
+				Expect(json.Unmarshal(res.Body.Bytes(), &report)).To(Succeed())
+				return report["state"]
+			}, 5).ShouldNot(Equal("in progress"))
+			return report
+		}
+		instanceStates := func(report map[string]interface{}) map[string]string {
+			states := map[string]string{}
+			for _, i := range report["instances"].([]interface{}) {
+				instance := i.(map[string]interface{})
+				states[instance["instance_id"].(string)] = instance["state"].(string)
+			}
+			return states
+		}
+
+		It("Applies the settings to every instance of the plan in batches", func() {
+			report := upgrade(`{"settings": {"data_persistence": "aof"}, "batch_size": 2}`)
+			Expect(report["state"]).To(Equal("succeeded"))
+			Expect(instanceStates(report)).To(Equal(map[string]string{
+				"instance-1": "succeeded",
+				"instance-2": "succeeded",
+				"instance-3": "succeeded",
+			}))
+			Expect(updater.updated()).To(ConsistOf("instance-1", "instance-2", "instance-3"))
+			Expect(updater.settings).To(Equal(map[string]interface{}{"data_persistence": "aof"}))
+		})
+
+		It("Stops after a batch with failures", func() {
+			updater.failing = "instance-1"
+			report := upgrade(`{"settings": {"data_persistence": "aof"}, "batch_size": 2}`)
+			Expect(report["state"]).To(Equal("failed"))
+			Expect(instanceStates(report)).To(Equal(map[string]string{
+				"instance-1": "failed",
+				"instance-2": "succeeded",
+				"instance-3": "skipped",
+			}))
+			Expect(updater.updated()).To(ConsistOf("instance-2"))
+		})
+
+		It("Requires settings and a known plan", func() {
+			Expect(send("POST", "/admin/plans/test-plan/upgrade", "admin", `{}`).Code).To(Equal(http.StatusBadRequest))
+			Expect(send("POST", "/admin/plans/unknown/upgrade", "admin", `{"settings": {"data_persistence": "aof"}}`).Code).To(Equal(http.StatusNotFound))
+			Expect(request("/admin/upgrades/unknown", "admin").Code).To(Equal(http.StatusNotFound))
+		})
+	})
+
+	Describe("Deprovisioning the instances of an organization", func() {
+		BeforeEach(func() {
+			state, revision, err := persister.Load()
+			Expect(err).NotTo(HaveOccurred())
+			state.AvailableInstances = append(state.AvailableInstances,
+				persisters.ServiceInstance{ID: "instance-1", OrganizationGUID: "org-1", SpaceGUID: "space-1"},
+				persisters.ServiceInstance{ID: "instance-2", OrganizationGUID: "org-1", SpaceGUID: "space-2"},
+				persisters.ServiceInstance{ID: "instance-3", OrganizationGUID: "org-2", SpaceGUID: "space-3"},
+			)
+			state.Bindings = append(state.Bindings, persisters.Binding{ID: "binding-1", InstanceID: "instance-1"})
+			_, err = persister.Save(state, revision)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		deprovision := func(body string) map[string]interface{} {
+			res := send("POST", "/admin/deprovisions", "admin", body)
+			Expect(res.Code).To(Equal(http.StatusAccepted))
+			var started map[string]interface{}
+			Expect(json.Unmarshal(res.Body.Bytes(), &started)).To(Succeed())
+
+			var report map[string]interface{}
+			Eventually(func() interface{} {
+				res := request("/admin/deprovisions/"+started["id"].(string), "admin")
+				Expect(res.Code).To(Equal(http.StatusOK))
+				Expect(json.Unmarshal(res.Body.Bytes(), &report)).To(Succeed())
+				return report["state"]
+			}, 5).Should(SatisfyAny(Equal("succeeded"), Equal("failed")))
+			return report
+		}
+
+		It("Lists the instances it would delete in a dry run", func() {
+			res := send("POST", "/admin/deprovisions", "admin", `{"organization_guid": "org-1", "dry_run": true}`)
+			Expect(res.Code).To(Equal(http.StatusOK))
+
+			var report map[string]interface{}
+			Expect(json.Unmarshal(res.Body.Bytes(), &report)).To(Succeed())
+			Expect(report["state"]).To(Equal("dry run"))
+			instances := report["instances"].([]interface{})
+			Expect(instances).To(HaveLen(2))
+			Expect(instances[0]).To(HaveKeyWithValue("instance_id", "instance-1"))
+			Expect(instances[0]).To(HaveKeyWithValue("bindings", BeEquivalentTo(1)))
+			Expect(instances[1]).To(HaveKeyWithValue("instance_id", "instance-2"))
+			Expect(deprovisioner.deprovisioned()).To(BeEmpty())
+		})
+
+		It("Deletes the instances of the organization", func() {
+			report := deprovision(`{"organization_guid": "org-1"}`)
+			Expect(report["state"]).To(Equal("succeeded"))
+			Expect(report["succeeded"]).To(BeEquivalentTo(2))
+			Expect(deprovisioner.deprovisioned()).To(Equal([]string{"instance-1", "instance-2"}))
+		})
+
+		It("Narrows the instances down to a space", func() {
+			deprovision(`{"organization_guid": "org-1", "space_guid": "space-2"}`)
+			Expect(deprovisioner.deprovisioned()).To(Equal([]string{"instance-2"}))
+		})
+
+		It("Summarizes the failures without stopping at them", func() {
+			deprovisioner.failing = "instance-1"
+			report := deprovision(`{"organization_guid": "org-1"}`)
+			Expect(report["state"]).To(Equal("failed"))
+			Expect(report["succeeded"]).To(BeEquivalentTo(1))
+			Expect(report["failed"]).To(BeEquivalentTo(1))
+			instances := report["instances"].([]interface{})
+			Expect(instances[0]).To(HaveKeyWithValue("state", "failed"))
+			Expect(instances[0]).To(HaveKeyWithValue("error", "deprovision failed"))
+			Expect(deprovisioner.deprovisioned()).To(Equal([]string{"instance-2"}))
+		})
+
+		It("Requires an organization or a space", func() {
+			Expect(send("POST", "/admin/deprovisions", "admin", `{"dry_run": true}`).Code).To(Equal(http.StatusBadRequest))
+			Expect(request("/admin/deprovisions/unknown", "admin").Code).To(Equal(http.StatusNotFound))
+			Expect(deprovisioner.deprovisioned()).To(BeEmpty())
+		})
+	})
+
+	Describe("Reporting the usage", func() {
+		BeforeEach(func() {
+			state, revision, err := persister.Load()
+			Expect(err).NotTo(HaveOccurred())
+			state.AvailableInstances = append(state.AvailableInstances,
+				persisters.ServiceInstance{
+					ID: "instance-1", OrganizationGUID: "org-1", SpaceGUID: "space-1",
+					Credentials: cluster.InstanceCredentials{UID: 2},
+					CreatedAt:   time.Now().Add(-4 * time.Hour),
+				},
+				persisters.ServiceInstance{
+					ID: "instance-2", OrganizationGUID: "org-1", SpaceGUID: "space-2", PlanID: "test-plan",
+					Parameters:  map[string]interface{}{"memory_size": float64(1024), "data_persistence": "snapshot"},
+					Credentials: cluster.InstanceCredentials{UID: 3},
+					CreatedAt:   time.Now().Add(-2 * time.Hour),
+				},
+			)
+			_, err = persister.Save(state, revision)
+			Expect(err).NotTo(HaveOccurred())
+
+			proxy.RegisterEndpointHandler("/v1/bdbs/2", func(w http.ResponseWriter, r *http.Request) interface{} {
+				return map[string]interface{}{"uid": 2, "memory_size": 2048, "data_persistence": "aof"}
+			})
+			proxy.RegisterEndpointHandler("/v1/bdbs/stats/last/2", func(w http.ResponseWriter, r *http.Request) interface{} {
+				return map[string]interface{}{"2": map[string]interface{}{"used_memory": 512.0}}
+			})
+		})
+
+		It("Aggregates the instances by organization and space", func() {
+			res := request("/admin/usage", "admin")
+			Expect(res.Code).To(Equal(http.StatusOK))
+
+			var report map[string]interface{}
+			Expect(json.Unmarshal(res.Body.Bytes(), &report)).To(Succeed())
+			Expect(report["group_by"]).To(Equal("space"))
+			groups := report["groups"].([]interface{})
+			Expect(groups).To(HaveLen(3))
+			Expect(groups[1]).To(HaveKeyWithValue("space_guid", "space-1"))
+			Expect(groups[1]).To(HaveKeyWithValue("memory_limit", BeEquivalentTo(2048)))
+			Expect(groups[1]).To(HaveKeyWithValue("used_memory", BeEquivalentTo(512)))
+			Expect(groups[1]).To(HaveKeyWithValue("persistence", HaveKeyWithValue("aof", BeEquivalentTo(1))))
+			Expect(groups[1]).To(HaveKeyWithValue("instances_without_stats", BeEquivalentTo(0)))
+
+			// The cluster has no stats of the second instance, it is
+			// reported with its plan and parameters instead.
+			Expect(groups[2]).To(HaveKeyWithValue("space_guid", "space-2"))
+			Expect(groups[2]).To(HaveKeyWithValue("memory_limit", BeEquivalentTo(1024)))
+			Expect(groups[2]).To(HaveKeyWithValue("persistence", HaveKeyWithValue("snapshot", BeEquivalentTo(1))))
+			Expect(groups[2]).To(HaveKeyWithValue("instances_without_stats", BeEquivalentTo(1)))
+		})
+
+		It("Aggregates the instances by organization", func() {
+			res := request("/admin/usage?group_by=org", "admin")
+			Expect(res.Code).To(Equal(http.StatusOK))
+
+			var report map[string]interface{}
+			Expect(json.Unmarshal(res.Body.Bytes(), &report)).To(Succeed())
+			groups := report["groups"].([]interface{})
+			Expect(groups).To(HaveLen(2))
+			group := groups[1].(map[string]interface{})
+			Expect(group["organization_guid"]).To(Equal("org-1"))
+			Expect(group["instances"]).To(BeEquivalentTo(2))
+			Expect(group["memory_limit"]).To(BeEquivalentTo(3072))
+			Expect(group["oldest_instance_age"]).To(BeNumerically("~", 4*3600, 60))
+			Expect(group["average_instance_age"]).To(BeNumerically("~", 3*3600, 60))
+
+			Expect(request("/admin/usage?group_by=app", "admin").Code).To(Equal(http.StatusBadRequest))
+		})
+
+		It("Reports the usage as CSV", func() {
+			res := request("/admin/usage?format=csv&group_by=org", "admin")
+			Expect(res.Code).To(Equal(http.StatusOK))
+			Expect(res.Header().Get("Content-Type")).To(Equal("text/csv"))
+
+			lines := strings.Split(strings.TrimSpace(res.Body.String()), "\n")
+			Expect(lines).To(HaveLen(3))
+			Expect(lines[0]).To(Equal("organization_guid,space_guid,instances,memory_limit,used_memory," +
+				"persistence_disabled,persistence_aof,persistence_snapshot," +
+				"oldest_instance_age,average_instance_age,instances_without_stats"))
+			Expect(lines[2]).To(HavePrefix("org-1,,2,3072,512,0,1,1,"))
+		})
+	})
+
+	Describe("Backing up the state", func() {
+		It("Exports the complete state", func() {
+			res := request("/admin/state", "admin")
+			Expect(res.Code).To(Equal(http.StatusOK))
+
+			var state persisters.State
+			Expect(json.Unmarshal(res.Body.Bytes(), &state)).To(Succeed())
+			Expect(state.AvailableInstances).To(HaveLen(1))
+			Expect(state.AvailableInstances[0].Credentials.Password).To(Equal("secret"))
+		})
+
+		It("Does not overwrite instances on import unless asked to", func() {
+			exported := request("/admin/state", "admin").Body.String()
+			imported := strings.Replace(exported, "test-instance", "restored-instance", 1)
+
+			res := send("PUT", "/admin/state", "admin", imported)
+			Expect(res.Code).To(Equal(http.StatusConflict))
+
+			res = send("PUT", "/admin/state?overwrite=true", "admin", imported)
+			Expect(res.Code).To(Equal(http.StatusOK))
+			Expect(request("/admin/instances/restored-instance", "admin").Code).To(Equal(http.StatusOK))
+			Expect(request("/admin/instances/test-instance", "admin").Code).To(Equal(http.StatusNotFound))
+		})
+
+		It("Rejects malformed states", func() {
+			res := send("PUT", "/admin/state?overwrite=true", "admin", "{")
+			Expect(res.Code).To(Equal(http.StatusBadRequest))
+		})
+	})
+	Context("Diagnostics", func() {
+		BeforeEach(func() {
+			conf := brokerconfig.Config{
+				ServiceBroker: brokerconfig.ServiceBrokerConfig{
+					Admin: brokerconfig.AdminConfig{
+						Auth: brokerconfig.AuthConfig{Username: "admin", Password: "admin-password"},
+					},
+				},
+			}
+			handler = admin.NewDebugHandler(conf, persister, logger)
+		})
+
+		It("Requires the admin credentials", func() {
+			Expect(request("/debug/vars", "someone").Code).To(Equal(http.StatusUnauthorized))
+			Expect(request("/debug/pprof/", "someone").Code).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("Reports the runtime and state statistics", func() {
+			res := request("/debug/vars", "admin")
+			Expect(res.Code).To(Equal(http.StatusOK))
+
+			var vars map[string]interface{}
+			Expect(json.Unmarshal(res.Body.Bytes(), &vars)).To(Succeed())
+			Expect(vars["goroutines"]).To(BeNumerically(">", 0))
+			Expect(vars).To(HaveKey("active_polls"))
+			Expect(vars).To(HaveKey("credential_drifts"))
+			Expect(vars["state"]).To(HaveKeyWithValue("instances", BeEquivalentTo(1)))
+			Expect(vars["state"]).To(HaveKeyWithValue("bytes", BeNumerically(">", 0)))
+		})
+
+		It("Serves the pprof profiles", func() {
+			res := request("/debug/pprof/", "admin")
+			Expect(res.Code).To(Equal(http.StatusOK))
+			Expect(res.Body.String()).To(ContainSubstring("goroutine"))
+
+			res = request("/debug/pprof/goroutine?debug=1", "admin")
+			Expect(res.Code).To(Equal(http.StatusOK))
+			Expect(res.Body.String()).To(ContainSubstring("goroutine profile"))
+		})
+	})
+})
+
+// fakeUpdater records the instances it updated, all but the failing one.
+type fakeUpdater struct {
+	lock      sync.Mutex
+	instances []string
+	settings  map[string]interface{}
+	failing   string
+}
+
+func (u *fakeUpdater) Update(instance persisters.ServiceInstance, settings map[string]interface{}, asyncAllowed bool, persister persisters.StatePersister) (bool, error) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	if instance.ID == u.failing {
+		return false, errors.New("update failed")
+	}
+	u.instances = append(u.instances, instance.ID)
+	u.settings = settings
+	return false, nil
+}
+
+func (u *fakeUpdater) updated() []string {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	return append([]string{}, u.instances...)
+}
+
+// fakeDeprovisioner records the instances it deprovisioned, all but the
+// failing one.
+type fakeDeprovisioner struct {
+	lock      sync.Mutex
+	instances []string
+	failing   string
+}
+
+func (d *fakeDeprovisioner) Deprovision(instanceID string, details brokerapi.DeprovisionDetails, asyncAllowed bool) (brokerapi.IsAsync, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if instanceID == d.failing {
+		return false, errors.New("deprovision failed")
+	}
+	d.instances = append(d.instances, instanceID)
+	return false, nil
+}
+
+func (d *fakeDeprovisioner) deprovisioned() []string {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return append([]string{}, d.instances...)
+}
@@ -0,0 +1,228 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pivotal-golang/lager"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/persisters"
+)
+
+// DefaultUpgradeBatchSize is the number of instances upgraded at a time
+// unless the request says otherwise.
+var DefaultUpgradeBatchSize = 5
+
+// InstanceUpdater applies settings to the database of an instance, as the
+// instance manager of the broker does.
+type InstanceUpdater interface {
+	Update(instance persisters.ServiceInstance, settings map[string]interface{}, asyncAllowed bool, persister persisters.StatePersister) (bool, error)
+}
+
+// States of upgrades and of the instances they upgrade.
+const (
+	upgradePending    = "pending"
+	upgradeInProgress = "in progress"
+	upgradeSucceeded  = "succeeded"
+	upgradeFailed     = "failed"
+	upgradeSkipped    = "skipped"
+)
+
+type upgradeRequest struct {
+	Settings  map[string]interface{} `json:"settings"`
+	BatchSize int                    `json:"batch_size"`
+}
+
+// upgrade is the report of an upgrade, kept until the broker restarts.
+type upgrade struct {
+	ID         string                 `json:"id"`
+	PlanID     string                 `json:"plan_id"`
+	Settings   map[string]interface{} `json:"settings"`
+	BatchSize  int                    `json:"batch_size"`
+	State      string                 `json:"state"`
+	StartedAt  string                 `json:"started_at"`
+	FinishedAt string                 `json:"finished_at,omitempty"`
+	Instances  []instanceUpgrade      `json:"instances"`
+}
+
+type instanceUpgrade struct {
+	InstanceID string `json:"instance_id"`
+	State      string `json:"state"`
+	Error      string `json:"error,omitempty"`
+}
+
+// upgrades tracks the upgrades started since the broker started.
+type upgrades struct {
+	lock  sync.Mutex
+	count int
+	all   map[string]*upgrade
+}
+
+func newUpgrades() *upgrades {
+	return &upgrades{all: map[string]*upgrade{}}
+}
+
+func (u *upgrades) add(upg *upgrade) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	u.count++
+	upg.ID = fmt.Sprintf("%d-%s", u.count, upg.PlanID)
+	u.all[upg.ID] = upg
+}
+
+// report returns a copy of the upgrade, safe to encode while it runs.
+func (u *upgrades) report(ID string) (upgrade, bool) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	upg, ok := u.all[ID]
+	if !ok {
+		return upgrade{}, false
+	}
+	report := *upg
+	report.Instances = append([]instanceUpgrade{}, upg.Instances...)
+	return report, true
+}
+
+// set records a change of the upgrade.
+func (u *upgrades) set(change func()) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	change()
+}
+
+// upgradePlan applies the settings of the request to the databases of all
+// the instances of a plan, e.g. after a cluster upgrade changed defaults.
+// It responds right away with the report of the upgrade, which runs in
+// batches in the background. A batch with failures stops the upgrade.
+func (h *handler) upgradePlan(w http.ResponseWriter, req *http.Request) {
+	planID := mux.Vars(req)["plan_id"]
+	if h.updater == nil {
+		h.respond(w, http.StatusNotImplemented, errorResponse{Description: "upgrades are not supported"})
+		return
+	}
+	known := false
+	for _, plan := range h.conf.ServiceBroker.Plans {
+		if plan.ID == planID {
+			known = true
+		}
+	}
+	if !known {
+		h.respond(w, http.StatusNotFound, errorResponse{Description: "plan does not exist"})
+		return
+	}
+
+	var request upgradeRequest
+	if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+		h.respond(w, http.StatusBadRequest, errorResponse{Description: err.Error()})
+		return
+	}
+	if len(request.Settings) == 0 {
+		h.respond(w, http.StatusBadRequest, errorResponse{Description: "settings are required"})
+		return
+	}
+	if request.BatchSize <= 0 {
+		request.BatchSize = DefaultUpgradeBatchSize
+	}
+
+	state, _, err := h.persister.Load()
+	if err != nil {
+		h.logger.Error("Failed to load the broker state", err)
+		h.respond(w, http.StatusInternalServerError, errorResponse{Description: err.Error()})
+		return
+	}
+	upg := &upgrade{
+		PlanID:    planID,
+		Settings:  request.Settings,
+		BatchSize: request.BatchSize,
+		State:     upgradeInProgress,
+		StartedAt: time.Now().UTC().Format(time.RFC3339),
+		Instances: []instanceUpgrade{},
+	}
+	for _, instance := range state.AvailableInstances {
+		if instance.PlanID == planID {
+			upg.Instances = append(upg.Instances, instanceUpgrade{InstanceID: instance.ID, State: upgradePending})
+		}
+	}
+	h.upgrades.add(upg)
+	h.logger.Info("Starting an upgrade", lager.Data{
+		"upgrade-id": upg.ID,
+		"plan-id":    planID,
+		"instances":  len(upg.Instances),
+	})
+
+	report, _ := h.upgrades.report(upg.ID)
+	go h.runUpgrade(upg)
+	h.respond(w, http.StatusAccepted, report)
+}
+
+func (h *handler) showUpgrade(w http.ResponseWriter, req *http.Request) {
+	report, ok := h.upgrades.report(mux.Vars(req)["upgrade_id"])
+	if !ok {
+		h.respond(w, http.StatusNotFound, errorResponse{Description: "upgrade does not exist"})
+		return
+	}
+	h.respond(w, http.StatusOK, report)
+}
+
+func (h *handler) runUpgrade(upg *upgrade) {
+	logger := h.logger.Session("upgrade", lager.Data{"upgrade-id": upg.ID})
+	failed := false
+	for start := 0; start < len(upg.Instances); start += upg.BatchSize {
+		end := start + upg.BatchSize
+		if end > len(upg.Instances) {
+			end = len(upg.Instances)
+		}
+
+		wg := sync.WaitGroup{}
+		for i := start; i < end; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				instanceID := upg.Instances[i].InstanceID
+				h.upgrades.set(func() { upg.Instances[i].State = upgradeInProgress })
+
+				// Every instance gets its own copy of the settings,
+				// since updates may change them.
+				settings := map[string]interface{}{}
+				for name, value := range upg.Settings {
+					settings[name] = value
+				}
+				_, err := h.updater.Update(persisters.ServiceInstance{ID: instanceID}, settings, false, h.persister)
+				h.upgrades.set(func() {
+					if err != nil {
+						upg.Instances[i].State, upg.Instances[i].Error = upgradeFailed, err.Error()
+						failed = true
+					} else {
+						upg.Instances[i].State = upgradeSucceeded
+					}
+				})
+				if err != nil {
+					logger.Error("Failed to upgrade an instance", err, lager.Data{"instance-id": instanceID})
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		if failed {
+			h.upgrades.set(func() {
+				for i := end; i < len(upg.Instances); i++ {
+					upg.Instances[i].State = upgradeSkipped
+				}
+			})
+			break
+		}
+	}
+
+	h.upgrades.set(func() {
+		upg.State = upgradeSucceeded
+		if failed {
+			upg.State = upgradeFailed
+		}
+		upg.FinishedAt = time.Now().UTC().Format(time.RFC3339)
+	})
+	logger.Info("Finished an upgrade", lager.Data{"failed": failed})
+}
@@ -0,0 +1,199 @@
+package admin
+
+import (
+	"encoding/csv"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pivotal-golang/lager"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/persisters"
+)
+
+// persistenceLevels are the persistence levels of the databases, in the
+// order of the columns of CSV reports.
+var persistenceLevels = []string{"disabled", "aof", "snapshot"}
+
+// usageReport is the usage of the instances, e.g. to charge the
+// organizations back for their databases.
+type usageReport struct {
+	GeneratedAt string       `json:"generated_at"`
+	GroupBy     string       `json:"group_by"`
+	Groups      []usageGroup `json:"groups"`
+}
+
+// usageGroup is the usage of the instances of an organization, or of a
+// space of it. Memory is in bytes and ages in seconds.
+type usageGroup struct {
+	OrganizationGUID string         `json:"organization_guid"`
+	SpaceGUID        string         `json:"space_guid,omitempty"`
+	Instances        int            `json:"instances"`
+	MemoryLimit      int64          `json:"memory_limit"`
+	UsedMemory       int64          `json:"used_memory"`
+	Persistence      map[string]int `json:"persistence"`
+	// The ages are only computed from the instances whose creation time
+	// is known, which earlier broker versions did not record.
+	OldestInstanceAge  int64 `json:"oldest_instance_age"`
+	AverageInstanceAge int64 `json:"average_instance_age"`
+	// InstancesWithoutStats are the instances the cluster did not report
+	// the stats of. Their memory limit and persistence are the ones of
+	// their plan and parameters.
+	InstancesWithoutStats int `json:"instances_without_stats"`
+
+	ages []int64
+}
+
+func (h *handler) usageReport(w http.ResponseWriter, req *http.Request) {
+	groupBy := req.URL.Query().Get("group_by")
+	if groupBy == "" {
+		groupBy = "space"
+	}
+	if groupBy != "space" && groupBy != "org" {
+		h.respond(w, http.StatusBadRequest, errorResponse{Description: "group_by must be org or space"})
+		return
+	}
+
+	state, _, err := h.persister.Load()
+	if err != nil {
+		h.logger.Error("Failed to load the broker state", err)
+		h.respond(w, http.StatusInternalServerError, errorResponse{Description: err.Error()})
+		return
+	}
+
+	now := time.Now()
+	groups := map[string]*usageGroup{}
+	for _, instance := range state.AvailableInstances {
+		spaceGUID := instance.SpaceGUID
+		if groupBy == "org" {
+			spaceGUID = ""
+		}
+		key := instance.OrganizationGUID + "/" + spaceGUID
+		group, ok := groups[key]
+		if !ok {
+			group = &usageGroup{
+				OrganizationGUID: instance.OrganizationGUID,
+				SpaceGUID:        spaceGUID,
+				Persistence:      map[string]int{},
+			}
+			groups[key] = group
+		}
+
+		group.Instances++
+		memoryLimit, persistence := h.provisionedSettings(instance)
+		stats, err := h.apiClient.GetDatabaseStats(instance.Credentials.UID)
+		if err != nil {
+			h.logger.Error("Failed to get the database stats", err, lager.Data{"instance-id": instance.ID})
+			group.InstancesWithoutStats++
+		} else {
+			memoryLimit = stats.MemoryLimit
+			group.UsedMemory += stats.UsedMemory
+			if stats.Persistence != "" {
+				persistence = stats.Persistence
+			}
+		}
+		group.MemoryLimit += memoryLimit
+		group.Persistence[persistence]++
+		if !instance.CreatedAt.IsZero() {
+			group.ages = append(group.ages, int64(now.Sub(instance.CreatedAt).Seconds()))
+		}
+	}
+
+	report := usageReport{
+		GeneratedAt: now.UTC().Format(time.RFC3339),
+		GroupBy:     groupBy,
+		Groups:      []usageGroup{},
+	}
+	for _, group := range groups {
+		var total int64
+		for _, age := range group.ages {
+			total += age
+			if age > group.OldestInstanceAge {
+				group.OldestInstanceAge = age
+			}
+		}
+		if len(group.ages) > 0 {
+			group.AverageInstanceAge = total / int64(len(group.ages))
+		}
+		report.Groups = append(report.Groups, *group)
+	}
+	sort.Slice(report.Groups, func(i, j int) bool {
+		if report.Groups[i].OrganizationGUID != report.Groups[j].OrganizationGUID {
+			return report.Groups[i].OrganizationGUID < report.Groups[j].OrganizationGUID
+		}
+		return report.Groups[i].SpaceGUID < report.Groups[j].SpaceGUID
+	})
+
+	if req.URL.Query().Get("format") == "csv" || strings.Contains(req.Header.Get("Accept"), "text/csv") {
+		h.respondCSV(w, report)
+		return
+	}
+	h.respond(w, http.StatusOK, report)
+}
+
+// provisionedSettings returns the memory limit and persistence an instance
+// was provisioned with, according to its plan and parameters.
+func (h *handler) provisionedSettings(instance persisters.ServiceInstance) (int64, string) {
+	var memoryLimit int64
+	persistence := ""
+	for _, plan := range h.conf.ServiceBroker.Plans {
+		if plan.ID == instance.PlanID {
+			memoryLimit = plan.ServiceInstanceConfig.MemoryLimit
+			persistence = plan.ServiceInstanceConfig.Persistence
+		}
+	}
+	switch size := instance.Parameters["memory_size"].(type) {
+	case float64:
+		memoryLimit = int64(size)
+	case int64:
+		memoryLimit = size
+	case int:
+		memoryLimit = int64(size)
+	}
+	if value, ok := instance.Parameters["data_persistence"].(string); ok && value != "" {
+		persistence = value
+	}
+	if persistence == "" {
+		persistence = "disabled"
+	}
+	return memoryLimit, persistence
+}
+
+func (h *handler) respondCSV(w http.ResponseWriter, report usageReport) {
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="usage.csv"`)
+	w.WriteHeader(http.StatusOK)
+
+	header := []string{"organization_guid", "space_guid", "instances", "memory_limit", "used_memory"}
+	for _, level := range persistenceLevels {
+		header = append(header, "persistence_"+level)
+	}
+	header = append(header, "oldest_instance_age", "average_instance_age", "instances_without_stats")
+
+	writer := csv.NewWriter(w)
+	writer.Write(header)
+	for _, group := range report.Groups {
+		row := []string{
+			group.OrganizationGUID,
+			group.SpaceGUID,
+			strconv.Itoa(group.Instances),
+			strconv.FormatInt(group.MemoryLimit, 10),
+			strconv.FormatInt(group.UsedMemory, 10),
+		}
+		for _, level := range persistenceLevels {
+			row = append(row, strconv.Itoa(group.Persistence[level]))
+		}
+		row = append(row,
+			strconv.FormatInt(group.OldestInstanceAge, 10),
+			strconv.FormatInt(group.AverageInstanceAge, 10),
+			strconv.Itoa(group.InstancesWithoutStats),
+		)
+		writer.Write(row)
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		h.logger.Error("Failed to write the CSV report", err)
+	}
+}
@@ -0,0 +1,46 @@
+package api
+
+import "github.com/pivotal-cf/brokerapi"
+
+// Service is a service of the catalog. It adds the fields of later
+// versions of the API to the service of brokerapi.
+type Service struct {
+	brokerapi.Service
+	Metadata *ServiceMetadata `json:"metadata,omitempty"`
+	Plans    []ServicePlan    `json:"plans"`
+}
+
+// ServiceMetadata adds the fields of later versions of the API to the
+// service metadata of brokerapi.
+type ServiceMetadata struct {
+	brokerapi.ServiceMetadata
+	// Shareable lets the platform share instances with other spaces.
+	Shareable bool `json:"shareable"`
+}
+
+// ServicePlan adds the fields of later versions of the API to the plan of
+// brokerapi. Fields that are nil are left to the service.
+type ServicePlan struct {
+	brokerapi.ServicePlan
+	Metadata       *ServicePlanMetadata `json:"metadata,omitempty"`
+	Bindable       *bool                `json:"bindable,omitempty"`
+	PlanUpdateable *bool                `json:"plan_updateable,omitempty"`
+}
+
+// ServicePlanMetadata adds the fields specific to this broker to the plan
+// metadata of brokerapi.
+type ServicePlanMetadata struct {
+	brokerapi.ServicePlanMetadata
+	AllowedOrganizations []string `json:"allowedOrganizations,omitempty"`
+}
+
+// A Catalog provides the services of a broker with the fields brokerapi
+// lacks. The catalog of brokers implementing it is served instead of
+// their Services.
+type Catalog interface {
+	Catalog() []Service
+}
+
+type catalogResponse struct {
+	Services []Service `json:"services"`
+}
@@ -0,0 +1,288 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-cf/brokerapi/auth"
+	"github.com/pivotal-golang/lager"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/brokererrors"
+)
+
+// brokerapiErrors gives the errors of the brokerapi package the
+// responses brokerapi would have given them.
+var brokerapiErrors = map[error]*brokererrors.Error{
+	brokerapi.ErrInstanceAlreadyExists:  brokererrors.NewConflict(brokerapi.ErrInstanceAlreadyExists.Error()),
+	brokerapi.ErrInstanceDoesNotExist:   brokererrors.NewNotFound(brokerapi.ErrInstanceDoesNotExist.Error()),
+	brokerapi.ErrInstanceLimitMet:       brokererrors.NewInternal(brokerapi.ErrInstanceLimitMet.Error()),
+	brokerapi.ErrPlanQuotaExceeded:      brokererrors.NewInternal(brokerapi.ErrPlanQuotaExceeded.Error()),
+	brokerapi.ErrBindingAlreadyExists:   brokererrors.NewConflict(brokerapi.ErrBindingAlreadyExists.Error()),
+	brokerapi.ErrBindingDoesNotExist:    brokererrors.NewGone(brokerapi.ErrBindingDoesNotExist.Error()),
+	brokerapi.ErrAsyncRequired:          brokererrors.NewAsyncRequired(brokerapi.ErrAsyncRequired.Error()),
+	brokerapi.ErrPlanChangeNotSupported: brokererrors.NewUnprocessableEntity(brokererrors.PlanChangeNotSupported, brokerapi.ErrPlanChangeNotSupported.Error()),
+	brokerapi.ErrRawParamsInvalid:       brokererrors.NewUnprocessableEntity("", brokerapi.ErrRawParamsInvalid.Error()),
+}
+
+// requestScoped is implemented by service brokers that can process a
+// request with a logger of its own.
+type requestScoped interface {
+	WithLogger(lager.Logger) brokerapi.ServiceBroker
+}
+
+// bindingGetter is implemented by service brokers that tell whether a
+// binding existed already with the same details. Such a binding is
+// responded with 200 rather than 201.
+type bindingGetter interface {
+	BindOrGet(instanceID, bindingID string, details brokerapi.BindDetails) (brokerapi.Binding, bool, error)
+}
+
+type handler struct {
+	serviceBroker brokerapi.ServiceBroker
+	logger        lager.Logger
+}
+
+// New returns the Open Service Broker API of the service broker. Unlike
+// brokerapi.New it reports the errors of the brokererrors package with
+// their status and error code, so that the platform can show them to
+// developers.
+func New(serviceBroker brokerapi.ServiceBroker, logger lager.Logger, credentials brokerapi.BrokerCredentials) http.Handler {
+	router := mux.NewRouter()
+	AttachRoutes(router, serviceBroker, logger)
+	versioned := checkAPIVersion(router, &handler{serviceBroker: serviceBroker, logger: logger})
+	authenticated := auth.NewWrapper(credentials.Username, credentials.Password).Wrap(versioned)
+	return logRequests(authenticated, logger)
+}
+
+func AttachRoutes(router *mux.Router, serviceBroker brokerapi.ServiceBroker, logger lager.Logger) {
+	h := &handler{serviceBroker: serviceBroker, logger: logger}
+	router.HandleFunc("/v2/catalog", h.catalog).Methods("GET")
+
+	router.HandleFunc("/v2/service_instances/{instance_id}", h.provision).Methods("PUT")
+	router.HandleFunc("/v2/service_instances/{instance_id}", h.deprovision).Methods("DELETE")
+	router.HandleFunc("/v2/service_instances/{instance_id}/last_operation", h.lastOperation).Methods("GET")
+	router.HandleFunc("/v2/service_instances/{instance_id}", h.update).Methods("PATCH")
+
+	router.HandleFunc("/v2/service_instances/{instance_id}/service_bindings/{binding_id}", h.bind).Methods("PUT")
+	router.HandleFunc("/v2/service_instances/{instance_id}/service_bindings/{binding_id}", h.unbind).Methods("DELETE")
+}
+
+func (h *handler) catalog(w http.ResponseWriter, req *http.Request) {
+	if catalog, ok := h.serviceBroker.(Catalog); ok {
+		h.respond(w, http.StatusOK, catalogResponse{Services: catalog.Catalog()})
+		return
+	}
+	h.respond(w, http.StatusOK, brokerapi.CatalogResponse{
+		Services: h.serviceBroker.Services(),
+	})
+}
+
+func (h *handler) provision(w http.ResponseWriter, req *http.Request) {
+	instanceID := mux.Vars(req)["instance_id"]
+	logger := h.requestLogger(req).Session("provision", lager.Data{"instance-id": instanceID})
+
+	var details brokerapi.ProvisionDetails
+	if !h.decode(w, req, logger, &details) {
+		return
+	}
+	asyncAllowed, _ := strconv.ParseBool(req.URL.Query().Get("accepts_incomplete"))
+
+	spec, err := h.broker(logger).Provision(instanceID, details, asyncAllowed)
+	if err != nil {
+		h.fail(w, logger, err)
+		return
+	}
+
+	status := http.StatusCreated
+	if spec.IsAsync {
+		status = http.StatusAccepted
+	}
+	h.respond(w, status, brokerapi.ProvisioningResponse{DashboardURL: spec.DashboardURL})
+}
+
+func (h *handler) update(w http.ResponseWriter, req *http.Request) {
+	instanceID := mux.Vars(req)["instance_id"]
+	logger := h.requestLogger(req).Session("update", lager.Data{"instance-id": instanceID})
+
+	var details brokerapi.UpdateDetails
+	if !h.decode(w, req, logger, &details) {
+		return
+	}
+	asyncAllowed, _ := strconv.ParseBool(req.URL.Query().Get("accepts_incomplete"))
+
+	isAsync, err := h.broker(logger).Update(instanceID, details, asyncAllowed)
+	if err != nil {
+		h.fail(w, logger, err)
+		return
+	}
+
+	status := http.StatusOK
+	if isAsync {
+		status = http.StatusAccepted
+	}
+	h.respond(w, status, brokerapi.EmptyResponse{})
+}
+
+func (h *handler) deprovision(w http.ResponseWriter, req *http.Request) {
+	instanceID := mux.Vars(req)["instance_id"]
+	logger := h.requestLogger(req).Session("deprovision", lager.Data{"instance-id": instanceID})
+
+	details := brokerapi.DeprovisionDetails{
+		PlanID:    req.FormValue("plan_id"),
+		ServiceID: req.FormValue("service_id"),
+	}
+	asyncAllowed := req.FormValue("accepts_incomplete") == "true"
+
+	isAsync, err := h.broker(logger).Deprovision(instanceID, details, asyncAllowed)
+	if err == brokerapi.ErrInstanceDoesNotExist {
+		err = brokererrors.NewGone(err.Error())
+	}
+	if err != nil {
+		h.fail(w, logger, err)
+		return
+	}
+
+	status := http.StatusOK
+	if isAsync {
+		status = http.StatusAccepted
+	}
+	h.respond(w, status, brokerapi.EmptyResponse{})
+}
+
+func (h *handler) bind(w http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	instanceID, bindingID := vars["instance_id"], vars["binding_id"]
+	logger := h.requestLogger(req).Session("bind", lager.Data{
+		"instance-id": instanceID,
+		"binding-id":  bindingID,
+	})
+
+	var details brokerapi.BindDetails
+	if !h.decode(w, req, logger, &details) {
+		return
+	}
+
+	var (
+		binding brokerapi.Binding
+		existed bool
+		err     error
+	)
+	broker := h.broker(logger)
+	if getter, ok := broker.(bindingGetter); ok {
+		binding, existed, err = getter.BindOrGet(instanceID, bindingID, details)
+	} else {
+		binding, err = broker.Bind(instanceID, bindingID, details)
+	}
+	if err != nil {
+		h.fail(w, logger, err)
+		return
+	}
+
+	status := http.StatusCreated
+	if existed {
+		status = http.StatusOK
+	}
+	h.respond(w, status, binding)
+}
+
+func (h *handler) unbind(w http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	instanceID, bindingID := vars["instance_id"], vars["binding_id"]
+	logger := h.requestLogger(req).Session("unbind", lager.Data{
+		"instance-id": instanceID,
+		"binding-id":  bindingID,
+	})
+
+	details := brokerapi.UnbindDetails{
+		PlanID:    req.FormValue("plan_id"),
+		ServiceID: req.FormValue("service_id"),
+	}
+
+	err := h.broker(logger).Unbind(instanceID, bindingID, details)
+	if err == brokerapi.ErrInstanceDoesNotExist {
+		err = brokererrors.NewGone(err.Error())
+	}
+	if err != nil {
+		h.fail(w, logger, err)
+		return
+	}
+	h.respond(w, http.StatusOK, brokerapi.EmptyResponse{})
+}
+
+func (h *handler) lastOperation(w http.ResponseWriter, req *http.Request) {
+	instanceID := mux.Vars(req)["instance_id"]
+	logger := h.requestLogger(req).Session("last-operation", lager.Data{"instance-id": instanceID})
+
+	operation, err := h.broker(logger).LastOperation(instanceID)
+	if err != nil {
+		h.fail(w, logger, err)
+		return
+	}
+	h.respond(w, http.StatusOK, brokerapi.LastOperationResponse{
+		State:       string(operation.State),
+		Description: operation.Description,
+	})
+}
+
+// requestLogger returns the logger for the log lines of a request, which
+// carry its correlation ID.
+func (h *handler) requestLogger(req *http.Request) lager.Logger {
+	id := req.Header.Get(CorrelationIDHeader)
+	if id == "" {
+		return h.logger
+	}
+	return h.logger.WithData(lager.Data{"correlation-id": id})
+}
+
+// broker returns the service broker to process a request with. Brokers
+// that support it log the operations of the request, including the calls
+// to the cluster API, with the logger of the request.
+func (h *handler) broker(logger lager.Logger) brokerapi.ServiceBroker {
+	if scoped, ok := h.serviceBroker.(requestScoped); ok {
+		return scoped.WithLogger(logger)
+	}
+	return h.serviceBroker
+}
+
+// decode reads the request body into details. It responds with 422 and
+// returns false if the body is malformed.
+func (h *handler) decode(w http.ResponseWriter, req *http.Request, logger lager.Logger, details interface{}) bool {
+	if err := json.NewDecoder(req.Body).Decode(details); err != nil {
+		h.fail(w, logger, brokererrors.NewUnprocessableEntity("", err.Error()))
+		return false
+	}
+	return true
+}
+
+func (h *handler) fail(w http.ResponseWriter, logger lager.Logger, err error) {
+	e, ok := brokerapiErrors[err]
+	if !ok {
+		e = brokererrors.From(err)
+	}
+	logger.Error("request-failed", err, lager.Data{
+		"status": e.StatusCode,
+		"code":   e.Code,
+	})
+
+	// The API expects an empty object when a resource is already gone.
+	if e.StatusCode == http.StatusGone {
+		h.respond(w, e.StatusCode, brokerapi.EmptyResponse{})
+		return
+	}
+	h.respond(w, e.StatusCode, brokerapi.ErrorResponse{
+		Error:       e.Code,
+		Description: e.Description,
+	})
+}
+
+func (h *handler) respond(w http.ResponseWriter, status int, response interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		h.logger.Error("Failed to encode the response", err, lager.Data{"status": status})
+	}
+}
@@ -0,0 +1,256 @@
+package api_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-cf/brokerapi/fakes"
+	"github.com/pivotal-golang/lager"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/api"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/brokererrors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// scopedBroker records the loggers the handler processes requests with.
+type scopedBroker struct {
+	*fakes.FakeServiceBroker
+	loggers []lager.Logger
+}
+
+func (b *scopedBroker) WithLogger(logger lager.Logger) brokerapi.ServiceBroker {
+	b.loggers = append(b.loggers, logger)
+	return b.FakeServiceBroker
+}
+
+// catalogBroker provides a catalog with the fields brokerapi lacks.
+type catalogBroker struct {
+	*fakes.FakeServiceBroker
+}
+
+func (b catalogBroker) Catalog() []api.Service {
+	notBindable := false
+	return []api.Service{{
+		Service: brokerapi.Service{ID: "service-id", Bindable: true},
+		Plans: []api.ServicePlan{{
+			ServicePlan: brokerapi.ServicePlan{ID: "plan-id"},
+			Bindable:    &notBindable,
+		}},
+	}}
+}
+
+// boundBroker has bound every binding already with the same details.
+type boundBroker struct {
+	*fakes.FakeServiceBroker
+}
+
+func (b boundBroker) BindOrGet(instanceID, bindingID string, details brokerapi.BindDetails) (brokerapi.Binding, bool, error) {
+	binding, err := b.Bind(instanceID, bindingID, details)
+	return binding, true, err
+}
+
+var _ = Describe("Service broker API", func() {
+	var (
+		broker   *fakes.FakeServiceBroker
+		handler  http.Handler
+		headers  http.Header
+		recorder *httptest.ResponseRecorder
+	)
+
+	send := func(method string, path string, body string) (int, map[string]interface{}) {
+		req, err := http.NewRequest(method, path, strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		req.SetBasicAuth("user", "password")
+		req.Header.Set(api.APIVersionHeader, "2.13")
+		for name := range headers {
+			req.Header.Set(name, headers.Get(name))
+		}
+		recorder = httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+
+		response := map[string]interface{}{}
+		Expect(json.Unmarshal(recorder.Body.Bytes(), &response)).To(Succeed())
+		return recorder.Code, response
+	}
+
+	BeforeEach(func() {
+		headers = http.Header{}
+		broker = &fakes.FakeServiceBroker{InstanceLimit: 3}
+		handler = api.New(broker, lager.NewLogger("test"), brokerapi.BrokerCredentials{
+			Username: "user",
+			Password: "password",
+		})
+	})
+
+	It("Provisions instances", func() {
+		status, _ := send("PUT", "/v2/service_instances/instance-id", `{"plan_id": "plan-id"}`)
+		Expect(status).To(Equal(http.StatusCreated))
+		Expect(broker.ProvisionedInstanceIDs).To(Equal([]string{"instance-id"}))
+	})
+
+	It("Serves the catalog with the fields brokerapi lacks", func() {
+		handler = api.New(catalogBroker{broker}, lager.NewLogger("test"), brokerapi.BrokerCredentials{
+			Username: "user",
+			Password: "password",
+		})
+		status, response := send("GET", "/v2/catalog", "")
+		Expect(status).To(Equal(http.StatusOK))
+
+		services := response["services"].([]interface{})
+		Expect(services).To(HaveLen(1))
+		plans := services[0].(map[string]interface{})["plans"].([]interface{})
+		Expect(plans).To(HaveLen(1))
+		Expect(plans[0]).To(HaveKeyWithValue("id", "plan-id"))
+		Expect(plans[0]).To(HaveKeyWithValue("bindable", false))
+	})
+
+	It("Creates bindings", func() {
+		status, _ := send("PUT", "/v2/service_instances/instance-id/service_bindings/binding-id", `{"plan_id": "plan-id"}`)
+		Expect(status).To(Equal(http.StatusCreated))
+	})
+
+	It("Responds with 200 to bindings that exist with the same details", func() {
+		handler = api.New(boundBroker{broker}, lager.NewLogger("test"), brokerapi.BrokerCredentials{
+			Username: "user",
+			Password: "password",
+		})
+		status, response := send("PUT", "/v2/service_instances/instance-id/service_bindings/binding-id", `{"plan_id": "plan-id"}`)
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(response).To(HaveKey("credentials"))
+	})
+
+	It("Reports typed errors with their status and error code", func() {
+		broker.ProvisionError = brokererrors.NewConcurrencyError("another operation is in progress")
+		status, response := send("PUT", "/v2/service_instances/instance-id", `{}`)
+		Expect(status).To(Equal(422))
+		Expect(response).To(Equal(map[string]interface{}{
+			"error":       "ConcurrencyError",
+			"description": "another operation is in progress",
+		}))
+	})
+
+	It("Reports other errors as internal failures", func() {
+		broker.UpdateError = errors.New("cluster unavailable")
+		status, response := send("PATCH", "/v2/service_instances/instance-id", `{}`)
+		Expect(status).To(Equal(http.StatusInternalServerError))
+		Expect(response["description"]).To(Equal("cluster unavailable"))
+	})
+
+	It("Keeps the statuses brokerapi gives to its errors", func() {
+		broker.ProvisionError = brokerapi.ErrAsyncRequired
+		status, response := send("PUT", "/v2/service_instances/instance-id", `{}`)
+		Expect(status).To(Equal(422))
+		Expect(response["error"]).To(Equal("AsyncRequired"))
+	})
+
+	It("Responds with 410 to deprovisioning unknown instances", func() {
+		status, response := send("DELETE", "/v2/service_instances/unknown?service_id=s&plan_id=p", "")
+		Expect(status).To(Equal(http.StatusGone))
+		Expect(response).To(BeEmpty())
+	})
+
+	It("Rejects malformed request bodies", func() {
+		status, _ := send("PUT", "/v2/service_instances/instance-id", `{`)
+		Expect(status).To(Equal(422))
+	})
+
+	Context("Logging", func() {
+		var (
+			logger *lagertest.TestLogger
+			scoped *scopedBroker
+		)
+
+		BeforeEach(func() {
+			logger = lagertest.NewTestLogger("test")
+			scoped = &scopedBroker{FakeServiceBroker: broker}
+			handler = api.New(scoped, logger, brokerapi.BrokerCredentials{
+				Username: "user",
+				Password: "password",
+			})
+		})
+
+		requestLog := func() lager.LogFormat {
+			for _, log := range logger.Logs() {
+				if log.Message == "test.request" {
+					return log
+				}
+			}
+			Fail("no request was logged")
+			return lager.LogFormat{}
+		}
+
+		It("Logs requests with their status and correlation ID", func() {
+			send("PUT", "/v2/service_instances/instance-id", `{"plan_id": "plan-id"}`)
+
+			id := recorder.Header().Get(api.CorrelationIDHeader)
+			Expect(id).NotTo(BeEmpty())
+			log := requestLog()
+			Expect(log.Data).To(HaveKeyWithValue("correlation-id", id))
+			Expect(log.Data).To(HaveKeyWithValue("method", "PUT"))
+			Expect(log.Data).To(HaveKeyWithValue("path", "/v2/service_instances/instance-id"))
+			Expect(log.Data).To(HaveKeyWithValue("instance-id", "instance-id"))
+			Expect(log.Data).To(HaveKeyWithValue("status", float64(http.StatusCreated)))
+			Expect(log.Data).To(HaveKey("duration"))
+		})
+
+		It("Uses the request identity sent by the platform", func() {
+			headers.Set(api.RequestIdentityHeader, "platform-request")
+			send("GET", "/v2/catalog", "")
+
+			Expect(recorder.Header().Get(api.CorrelationIDHeader)).To(Equal("platform-request"))
+			Expect(requestLog().Data).To(HaveKeyWithValue("correlation-id", "platform-request"))
+		})
+
+		It("Logs rejected requests", func() {
+			req, err := http.NewRequest("GET", "/v2/catalog", nil)
+			Expect(err).NotTo(HaveOccurred())
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+			Expect(requestLog().Data).To(HaveKeyWithValue("status", float64(http.StatusUnauthorized)))
+		})
+
+		It("Processes requests with a logger carrying the correlation ID", func() {
+			headers.Set(api.CorrelationIDHeader, "correlation")
+			send("GET", "/v2/service_instances/instance-id/last_operation", "")
+
+			Expect(scoped.loggers).To(HaveLen(1))
+			scoped.loggers[0].Info("downstream")
+			logs := logger.Logs()
+			Expect(logs[len(logs)-1].Data).To(HaveKeyWithValue("correlation-id", "correlation"))
+		})
+	})
+	Context("Versions", func() {
+		It("Accepts the supported versions of the API", func() {
+			for _, version := range []string{"2.7", "2.13", "2.17"} {
+				headers.Set(api.APIVersionHeader, version)
+				status, _ := send("GET", "/v2/catalog", "")
+				Expect(status).To(Equal(http.StatusOK), version)
+			}
+		})
+
+		It("Rejects unsupported versions with 412", func() {
+			for _, version := range []string{"2.6", "1.0", "3.0", "two"} {
+				headers.Set(api.APIVersionHeader, version)
+				status, response := send("PUT", "/v2/service_instances/instance-id", `{}`)
+				Expect(status).To(Equal(http.StatusPreconditionFailed), version)
+				Expect(response["description"]).To(ContainSubstring("2.7"))
+			}
+			Expect(broker.ProvisionedInstanceIDs).To(BeEmpty())
+		})
+
+		It("Rejects requests without a version", func() {
+			req, err := http.NewRequest("GET", "/v2/catalog", nil)
+			Expect(err).NotTo(HaveOccurred())
+			req.SetBasicAuth("user", "password")
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+			Expect(recorder.Code).To(Equal(http.StatusPreconditionFailed))
+		})
+	})
+})
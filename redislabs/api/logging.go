@@ -0,0 +1,74 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/pivotal-golang/lager"
+)
+
+const (
+	// CorrelationIDHeader carries the ID that ties the log lines of a
+	// request together. The broker responds with it as well.
+	CorrelationIDHeader = "X-Correlation-ID"
+	// RequestIdentityHeader is the OSB header a platform may send to
+	// identify a request; it serves as the correlation ID if present.
+	RequestIdentityHeader = "X-Broker-API-Request-Identity"
+)
+
+var instancePath = regexp.MustCompile(`^/v2/service_instances/([^/]+)`)
+
+// statusRecorder remembers the status a handler responded with.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// logRequests logs every request together with the status of its response
+// and how long it took. It makes sure the request has a correlation ID so
+// that the handlers can add it to the log lines of the request.
+func logRequests(next http.Handler, logger lager.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		id := correlationID(req)
+		req.Header.Set(CorrelationIDHeader, id)
+		w.Header().Set(CorrelationIDHeader, id)
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		next.ServeHTTP(recorder, req)
+
+		data := lager.Data{
+			"correlation-id": id,
+			"method":         req.Method,
+			"path":           req.URL.Path,
+			"status":         recorder.status,
+			"duration":       time.Since(start).String(),
+		}
+		if match := instancePath.FindStringSubmatch(req.URL.Path); match != nil {
+			data["instance-id"] = match[1]
+		}
+		logger.Info("request", data)
+	})
+}
+
+func correlationID(req *http.Request) string {
+	if id := req.Header.Get(CorrelationIDHeader); id != "" {
+		return id
+	}
+	if id := req.Header.Get(RequestIdentityHeader); id != "" {
+		return id
+	}
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pivotal-golang/lager"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/brokererrors"
+)
+
+const (
+	// APIVersionHeader is the header the platform sends the version of
+	// the Open Service Broker API in.
+	APIVersionHeader = "X-Broker-API-Version"
+
+	// The broker supports the versions 2.MinAPIMinorVersion and later
+	// of the API. Asynchronous operations appeared in 2.7, and later
+	// minor versions stay compatible with it.
+	APIMajorVersion    = 2
+	MinAPIMinorVersion = 7
+)
+
+// checkAPIVersion rejects requests for versions of the API the broker does
+// not support with 412 Precondition Failed.
+func checkAPIVersion(next http.Handler, h *handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		version := req.Header.Get(APIVersionHeader)
+		if !supportedAPIVersion(version) {
+			logger := h.requestLogger(req).Session("check-api-version", lager.Data{"version": version})
+			h.fail(w, logger, brokererrors.NewPreconditionFailed(fmt.Sprintf(
+				"the broker supports versions %d.%d and later %d.x of the Open Service Broker API, the request has %s %q",
+				APIMajorVersion, MinAPIMinorVersion, APIMajorVersion, APIVersionHeader, version,
+			)))
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+func supportedAPIVersion(version string) bool {
+	parts := strings.Split(version, ".")
+	if len(parts) != 2 {
+		return false
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return false
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return false
+	}
+	return major == APIMajorVersion && minor >= MinAPIMinorVersion
+}
@@ -0,0 +1,210 @@
+package apiclient
+
+import (
+	"fmt"
+
+	"github.com/pivotal-golang/lager"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/cluster"
+)
+
+type redisACL struct {
+	UID  int    `json:"uid,omitempty"`
+	Name string `json:"name"`
+	ACL  string `json:"acl"`
+}
+
+type role struct {
+	UID        int    `json:"uid,omitempty"`
+	Name       string `json:"name"`
+	Management string `json:"management"`
+}
+
+type user struct {
+	UID        int    `json:"uid,omitempty"`
+	Name       string `json:"name"`
+	Password   string `json:"password,omitempty"`
+	RoleUIDs   []int  `json:"role_uids"`
+	AuthMethod string `json:"auth_method,omitempty"`
+}
+
+type rolePermission struct {
+	RoleUID     int `json:"role_uid"`
+	RedisACLUID int `json:"redis_acl_uid"`
+}
+
+type rolesPermissionsResponse struct {
+	RolesPermissions []rolePermission `json:"roles_permissions"`
+}
+
+// EnsureRedisACL returns the UID of the Redis ACL with the given name,
+// creating it with the given rules if it does not exist yet.
+func (c *apiClient) EnsureRedisACL(name string, acl string) (int, error) {
+	if err := c.Supports(cluster.ACLUsers); err != nil {
+		return 0, err
+	}
+	acls := []redisACL{}
+	if err := c.cachedGet("/v1/redis_acls", &acls); err != nil {
+		c.logger.Error("Failed to list the Redis ACLs", err)
+		return 0, err
+	}
+	for _, a := range acls {
+		if a.Name == name {
+			return a.UID, nil
+		}
+	}
+
+	created := redisACL{}
+	if err := c.call("POST", "/v1/redis_acls", redisACL{Name: name, ACL: acl}, &created); err != nil {
+		c.logger.Error("Failed to create a Redis ACL", err, lager.Data{"name": name})
+		return 0, err
+	}
+	c.cache.invalidate("/v1/redis_acls")
+	return created.UID, nil
+}
+
+// EnsureRole returns the UID of the role with the given name, creating it
+// without any management permissions if it does not exist yet.
+func (c *apiClient) EnsureRole(name string) (int, error) {
+	if err := c.Supports(cluster.ACLUsers); err != nil {
+		return 0, err
+	}
+	roles := []role{}
+	if err := c.cachedGet("/v1/roles", &roles); err != nil {
+		c.logger.Error("Failed to list the roles", err)
+		return 0, err
+	}
+	for _, r := range roles {
+		if r.Name == name {
+			return r.UID, nil
+		}
+	}
+
+	created := role{}
+	if err := c.call("POST", "/v1/roles", role{Name: name, Management: "none"}, &created); err != nil {
+		c.logger.Error("Failed to create a role", err, lager.Data{"name": name})
+		return 0, err
+	}
+	c.cache.invalidate("/v1/roles")
+	return created.UID, nil
+}
+
+// GrantRole lets the users of the given role access the database with
+// the permissions of the given Redis ACL.
+func (c *apiClient) GrantRole(UID int, roleUID int, aclUID int) error {
+	path := fmt.Sprintf("/v1/bdbs/%d", UID)
+	current := rolesPermissionsResponse{}
+	if err := c.call("GET", path, nil, &current); err != nil {
+		c.logger.Error("Failed to get the database permissions", err, lager.Data{"UID": UID})
+		return err
+	}
+	for _, p := range current.RolesPermissions {
+		if p.RoleUID == roleUID && p.RedisACLUID == aclUID {
+			return nil
+		}
+	}
+
+	current.RolesPermissions = append(current.RolesPermissions, rolePermission{
+		RoleUID:     roleUID,
+		RedisACLUID: aclUID,
+	})
+	if err := c.call("PUT", path, current, nil); err != nil {
+		c.logger.Error("Failed to update the database permissions", err, lager.Data{"UID": UID})
+		return err
+	}
+	return nil
+}
+
+// RevokeRole takes the access to the database away from the users of the
+// given role.
+func (c *apiClient) RevokeRole(UID int, roleUID int) error {
+	path := fmt.Sprintf("/v1/bdbs/%d", UID)
+	current := rolesPermissionsResponse{}
+	if err := c.call("GET", path, nil, &current); err != nil {
+		c.logger.Error("Failed to get the database permissions", err, lager.Data{"UID": UID})
+		return err
+	}
+	kept := []rolePermission{}
+	for _, p := range current.RolesPermissions {
+		if p.RoleUID != roleUID {
+			kept = append(kept, p)
+		}
+	}
+	if len(kept) == len(current.RolesPermissions) {
+		return nil
+	}
+
+	current.RolesPermissions = kept
+	if err := c.call("PUT", path, current, nil); err != nil {
+		c.logger.Error("Failed to update the database permissions", err, lager.Data{"UID": UID})
+		return err
+	}
+	return nil
+}
+
+// FindRole looks a role up by name.
+func (c *apiClient) FindRole(name string) (int, bool, error) {
+	roles := []role{}
+	if err := c.call("GET", "/v1/roles", nil, &roles); err != nil {
+		c.logger.Error("Failed to list the roles", err)
+		return 0, false, err
+	}
+	for _, r := range roles {
+		if r.Name == name {
+			return r.UID, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+func (c *apiClient) DeleteRole(roleUID int) error {
+	if err := c.call("DELETE", fmt.Sprintf("/v1/roles/%d", roleUID), nil, nil); err != nil {
+		c.logger.Error("Failed to delete a role", err, lager.Data{"role-uid": roleUID})
+		return err
+	}
+	c.cache.invalidate("/v1/roles")
+	return nil
+}
+
+// CreateUser creates a cluster user that authenticates against databases
+// with the given password and returns its UID.
+func (c *apiClient) CreateUser(name string, password string, roleUIDs []int) (int, error) {
+	if err := c.Supports(cluster.ACLUsers); err != nil {
+		return 0, err
+	}
+	created := user{}
+	payload := user{
+		Name:       name,
+		Password:   password,
+		RoleUIDs:   roleUIDs,
+		AuthMethod: "regular",
+	}
+	if err := c.call("POST", "/v1/users", payload, &created); err != nil {
+		c.logger.Error("Failed to create a user", err, lager.Data{"name": name})
+		return 0, err
+	}
+	return created.UID, nil
+}
+
+// FindUser looks a cluster user up by name.
+func (c *apiClient) FindUser(name string) (int, bool, error) {
+	users := []user{}
+	if err := c.call("GET", "/v1/users", nil, &users); err != nil {
+		c.logger.Error("Failed to list the users", err)
+		return 0, false, err
+	}
+	for _, u := range users {
+		if u.Name == name {
+			return u.UID, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+func (c *apiClient) DeleteUser(userUID int) error {
+	if err := c.call("DELETE", fmt.Sprintf("/v1/users/%d", userUID), nil, nil); err != nil {
+		c.logger.Error("Failed to delete a user", err, lager.Data{"user-uid": userUID})
+		return err
+	}
+	return nil
+}
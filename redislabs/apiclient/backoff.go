@@ -0,0 +1,71 @@
+package apiclient
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+)
+
+var (
+	DatabasePollingMaxInterval = 10000 // milliseconds
+	DatabasePollingMultiplier  = 2.0
+	DatabasePollingJitter      = 0.2
+)
+
+// backoff produces exponentially growing, jittered polling intervals.
+type backoff struct {
+	interval   time.Duration
+	max        time.Duration
+	multiplier float64
+	jitter     float64
+}
+
+func newBackoff(conf config.PollingConfig) *backoff {
+	b := &backoff{
+		interval:   time.Duration(DatabasePollingInterval) * time.Millisecond,
+		max:        time.Duration(DatabasePollingMaxInterval) * time.Millisecond,
+		multiplier: DatabasePollingMultiplier,
+		jitter:     DatabasePollingJitter,
+	}
+	if conf.InitialInterval > 0 {
+		b.interval = time.Duration(conf.InitialInterval) * time.Millisecond
+	}
+	if conf.MaxInterval > 0 {
+		b.max = time.Duration(conf.MaxInterval) * time.Millisecond
+	}
+	if conf.Multiplier >= 1 {
+		b.multiplier = conf.Multiplier
+	}
+	if conf.Jitter != nil && *conf.Jitter >= 0 && *conf.Jitter < 1 {
+		b.jitter = *conf.Jitter
+	}
+	if b.max < b.interval {
+		b.max = b.interval
+	}
+	return b
+}
+
+// next returns the interval to wait before the next request.
+func (b *backoff) next() time.Duration {
+	interval := b.interval
+
+	b.interval = time.Duration(float64(b.interval) * b.multiplier)
+	if b.interval > b.max {
+		b.interval = b.max
+	}
+
+	delta := b.jitter * float64(interval)
+	return interval + time.Duration(delta*(2*rand.Float64()-1))
+}
+
+// nextWithin is like next, but the interval is cut short to the remaining
+// time, so that the last request is made at a deadline rather than well
+// before it.
+func (b *backoff) nextWithin(remaining time.Duration) time.Duration {
+	interval := b.next()
+	if interval > remaining {
+		return remaining
+	}
+	return interval
+}
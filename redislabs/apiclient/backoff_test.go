@@ -0,0 +1,55 @@
+package apiclient_test
+
+import (
+	"time"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/apiclient"
+	brokerconfig "github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Polling backoff", func() {
+	noJitter := 0.0
+	conf := brokerconfig.PollingConfig{
+		InitialInterval: 500,
+		MaxInterval:     4000,
+		Multiplier:      2,
+		Jitter:          &noJitter,
+	}
+
+	It("Grows the intervals up to the maximum", func() {
+		Expect(apiclient.PollingSchedule(conf, 20*time.Second)).To(Equal([]time.Duration{
+			500 * time.Millisecond,
+			time.Second,
+			2 * time.Second,
+			4 * time.Second,
+			4 * time.Second,
+			4 * time.Second,
+			4 * time.Second,
+			500 * time.Millisecond,
+		}))
+	})
+
+	It("Polls at the deadline", func() {
+		longer := conf
+		longer.MaxInterval = 10000
+		schedule := apiclient.PollingSchedule(longer, 15*time.Second)
+		Expect(schedule).To(Equal([]time.Duration{
+			500 * time.Millisecond,
+			time.Second,
+			2 * time.Second,
+			4 * time.Second,
+			7500 * time.Millisecond,
+		}))
+	})
+
+	It("Jitters the intervals by default", func() {
+		schedule := apiclient.PollingSchedule(brokerconfig.PollingConfig{InitialInterval: 1000, MaxInterval: 1000}, time.Minute)
+		for _, interval := range schedule[:len(schedule)-1] {
+			Expect(interval).To(BeNumerically("~", time.Second, 200*time.Millisecond))
+		}
+		Expect(schedule).NotTo(ConsistOf(schedule[0]))
+	})
+})
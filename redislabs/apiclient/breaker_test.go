@@ -0,0 +1,41 @@
+package apiclient_test
+
+import (
+	"net/http"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/apiclient"
+	brokerconfig "github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/httpclient"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/testing"
+	"github.com/pivotal-golang/lager"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Failing cluster", func() {
+	It("Is not asked again once the circuit breaker opens", func() {
+		requests := 0
+		proxy := testing.NewHTTPProxy()
+		defer proxy.Close()
+		proxy.RegisterEndpointHandler("/v1/bdbs/1", func(w http.ResponseWriter, r *http.Request) interface{} {
+			requests++
+			w.WriteHeader(500)
+			return map[string]interface{}{"description": "internal error"}
+		})
+		client := apiclient.New(brokerconfig.Config{
+			Cluster: brokerconfig.ClusterConfig{
+				Address:        proxy.URL(),
+				CircuitBreaker: brokerconfig.CircuitBreakerConfig{Failures: 2, Cooldown: 60},
+			},
+		}, lager.NewLogger("test"))
+
+		for i := 0; i < 2; i++ {
+			_, err := client.GetDatabase(1)
+			Expect(err).To(Equal(apiclient.ErrAPIUnavailable))
+		}
+		_, err := client.GetDatabase(1)
+		Expect(err).To(Equal(httpclient.ErrCircuitOpen))
+		Expect(requests).To(Equal(2))
+	})
+})
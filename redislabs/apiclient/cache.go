@@ -0,0 +1,133 @@
+package apiclient
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/cluster"
+)
+
+// cache keeps the responses to requests for slowly changing cluster
+// documents for a while. A nil cache keeps nothing.
+type cache struct {
+	lock    sync.Mutex
+	ttl     time.Duration
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	body    []byte
+	expires time.Time
+}
+
+type clusterInfoResponse struct {
+	Name string `json:"name"`
+}
+
+type moduleResponse struct {
+	UID     string `json:"uid"`
+	Name    string `json:"module_name"`
+	Version string `json:"semantic_version"`
+}
+
+type nodeResponse struct {
+	UID         int    `json:"uid"`
+	Address     string `json:"addr"`
+	TotalMemory int64  `json:"total_memory"`
+	Status      string `json:"status"`
+}
+
+func newCache(ttl time.Duration) *cache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &cache{ttl: ttl, entries: map[string]cacheEntry{}}
+}
+
+func (c *cache) get(path string) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	entry, ok := c.entries[path]
+	if !ok || time.Now().After(entry.expires) {
+		delete(c.entries, path)
+		return nil, false
+	}
+	return entry.body, true
+}
+
+func (c *cache) set(path string, body []byte) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.entries[path] = cacheEntry{body: body, expires: time.Now().Add(c.ttl)}
+}
+
+func (c *cache) invalidate(path string) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.entries, path)
+}
+
+// cachedGet is like a GET call, but the response is served from the cache
+// while it is fresh.
+func (c *apiClient) cachedGet(path string, result interface{}) error {
+	if body, ok := c.cache.get(path); ok {
+		return json.Unmarshal(body, result)
+	}
+	var body json.RawMessage
+	if err := c.call("GET", path, nil, &body); err != nil {
+		return err
+	}
+	c.cache.set(path, body)
+	return json.Unmarshal(body, result)
+}
+
+// GetClusterInfo describes the cluster itself.
+func (c *apiClient) GetClusterInfo() (cluster.Info, error) {
+	info := clusterInfoResponse{}
+	if err := c.cachedGet("/v1/cluster", &info); err != nil {
+		c.logger.Error("Failed to get the cluster info", err)
+		return cluster.Info{}, err
+	}
+	return cluster.Info{Name: info.Name}, nil
+}
+
+// ListModules returns the Redis modules installed on the cluster.
+func (c *apiClient) ListModules() ([]cluster.Module, error) {
+	if err := c.Supports(cluster.Modules); err != nil {
+		return nil, err
+	}
+	payload := []moduleResponse{}
+	if err := c.cachedGet("/v1/modules", &payload); err != nil {
+		c.logger.Error("Failed to list the modules", err)
+		return nil, err
+	}
+	modules := []cluster.Module{}
+	for _, m := range payload {
+		modules = append(modules, cluster.Module{UID: m.UID, Name: m.Name, Version: m.Version})
+	}
+	return modules, nil
+}
+
+// ListNodes returns the nodes of the cluster.
+func (c *apiClient) ListNodes() ([]cluster.Node, error) {
+	payload := []nodeResponse{}
+	if err := c.cachedGet("/v1/nodes", &payload); err != nil {
+		c.logger.Error("Failed to list the nodes", err)
+		return nil, err
+	}
+	nodes := []cluster.Node{}
+	for _, n := range payload {
+		nodes = append(nodes, cluster.Node{UID: n.UID, Address: n.Address, TotalMemory: n.TotalMemory, Status: n.Status})
+	}
+	return nodes, nil
+}
@@ -0,0 +1,90 @@
+package apiclient_test
+
+import (
+	"net/http"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/apiclient"
+	brokerconfig "github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/testing"
+	"github.com/pivotal-golang/lager"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Caching cluster metadata", func() {
+	var (
+		proxy    testing.HTTPProxy
+		requests map[string]int
+		roles    []map[string]interface{}
+	)
+
+	newClient := func(ttl int) apiclient.Client {
+		return apiclient.New(brokerconfig.Config{
+			Cluster: brokerconfig.ClusterConfig{Address: proxy.URL(), CacheTTL: ttl},
+		}, lager.NewLogger("test"))
+	}
+
+	BeforeEach(func() {
+		requests = map[string]int{}
+		roles = []map[string]interface{}{}
+
+		proxy = testing.NewHTTPProxy()
+		proxy.RegisterEndpointHandler("/v1/cluster", func(w http.ResponseWriter, r *http.Request) interface{} {
+			requests[r.URL.Path]++
+			return map[string]interface{}{"name": "cluster.local"}
+		})
+		proxy.RegisterEndpointHandler("/v1/modules", func(w http.ResponseWriter, r *http.Request) interface{} {
+			requests[r.URL.Path]++
+			return []map[string]interface{}{{"uid": "abc", "module_name": "search", "semantic_version": "2.0.0"}}
+		})
+		proxy.RegisterEndpointHandler("/v1/roles", func(w http.ResponseWriter, r *http.Request) interface{} {
+			requests[r.Method+" "+r.URL.Path]++
+			if r.Method == "POST" {
+				roles = append(roles, map[string]interface{}{"uid": 3, "name": "cf-read-only"})
+				return roles[0]
+			}
+			return roles
+		})
+	})
+
+	AfterEach(func() {
+		proxy.Close()
+	})
+
+	It("Reuses fresh responses", func() {
+		client := newClient(60)
+		for i := 0; i < 2; i++ {
+			info, err := client.GetClusterInfo()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Name).To(Equal("cluster.local"))
+
+			modules, err := client.ListModules()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(modules).To(HaveLen(1))
+			Expect(modules[0].Name).To(Equal("search"))
+		}
+		Expect(requests["/v1/cluster"]).To(Equal(1))
+		Expect(requests["/v1/modules"]).To(Equal(1))
+	})
+
+	It("Does not cache unless configured to", func() {
+		client := newClient(0)
+		client.GetClusterInfo()
+		client.GetClusterInfo()
+		Expect(requests["/v1/cluster"]).To(Equal(2))
+	})
+
+	It("Drops a list once an item is added to it", func() {
+		client := newClient(60)
+		UID, err := client.EnsureRole("cf-read-only")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(UID).To(Equal(3))
+
+		UID, err = client.EnsureRole("cf-read-only")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(UID).To(Equal(3))
+		Expect(requests["POST /v1/roles"]).To(Equal(1))
+		Expect(requests["GET /v1/roles"]).To(Equal(2))
+	})
+})
@@ -6,8 +6,10 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"sync/atomic"
 	"time"
 
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/brokererrors"
 	"github.com/RedisLabs/cf-redislabs-broker/redislabs/cluster"
 	"github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
 	"github.com/RedisLabs/cf-redislabs-broker/redislabs/httpclient"
@@ -15,15 +17,50 @@ import (
 )
 
 type apiClient struct {
+	address    string
 	logger     lager.Logger
 	httpClient httpclient.HTTPClient
+	polling    config.PollingConfig
+	cache      *cache
 }
 
 type Client interface {
-	CreateDatabase(map[string]interface{}) (chan cluster.InstanceCredentials, error)
+	CreateDatabase(map[string]interface{}, <-chan struct{}) (int, chan cluster.InstanceCredentials, error)
+	WaitForDatabase(int, <-chan struct{}) chan cluster.InstanceCredentials
+	WaitForDeletion(UID int, timeout time.Duration) (bool, error)
 	UpdateDatabase(int, map[string]interface{}) error
 	DeleteDatabase(int) error
 	GetDatabase(int) (cluster.InstanceCredentials, error)
+	GetDatabaseStatus(int) (string, error)
+	GetDatabaseSettings(int) (map[string]interface{}, error)
+	ListDatabases() ([]cluster.InstanceCredentials, error)
+	ListDatabasesWith(ListOptions) ([]cluster.InstanceCredentials, error)
+	GetMemoryUsage(int) (cluster.MemoryUsage, error)
+	GetDatabaseStats(int) (cluster.DatabaseStats, error)
+	GetShardCount(int) (int, error)
+	GetDatabaseActions(int) ([]cluster.Action, error)
+	GetDatabaseProgress(int) (cluster.DatabaseProgress, error)
+	AddDatabasePassword(UID int, password string) error
+	SetDatabasePassword(UID int, password string) error
+	GetClusterInfo() (cluster.Info, error)
+	ListModules() ([]cluster.Module, error)
+	ListNodes() ([]cluster.Node, error)
+	DetectVersion() (cluster.Version, error)
+	Supports(cluster.Capability) error
+
+	EnsureRedisACL(name string, acl string) (int, error)
+	EnsureRole(name string) (int, error)
+	GrantRole(UID int, roleUID int, aclUID int) error
+	RevokeRole(UID int, roleUID int) error
+	FindRole(name string) (int, bool, error)
+	DeleteRole(roleUID int) error
+	CreateUser(name string, password string, roleUIDs []int) (int, error)
+	FindUser(name string) (int, bool, error)
+	DeleteUser(userUID int) error
+
+	// WithLogger returns a client sharing the connection and cache of
+	// this one that logs with the given logger.
+	WithLogger(lager.Logger) Client
 }
 
 type errorResponse struct {
@@ -32,22 +69,34 @@ type errorResponse struct {
 }
 
 type endpointResponse struct {
-        DNSName  string   `json:"dns_name"`
-        Port     int      `json:"port"`
-        AddrList []string `json:"addr"`
+	DNSName  string   `json:"dns_name"`
+	Port     int      `json:"port"`
+	AddrList []string `json:"addr"`
 }
 
 type statusResponse struct {
-	UID        int                `json:"uid"`
-	Password   string             `json:"authentication_redis_pass"`
-        Endpoints  []endpointResponse `json:"endpoints"`
-	Status     string             `json:"status"`
+	UID         int                `json:"uid"`
+	Name        string             `json:"name"`
+	Password    string             `json:"authentication_redis_pass"`
+	Endpoints   []endpointResponse `json:"endpoints"`
+	Status      string             `json:"status"`
+	SSL         bool               `json:"ssl"`
+	TLSMode     string             `json:"tls_mode"`
+	Replication bool               `json:"replication"`
 }
 
 var (
 	DatabasePollingInterval = 500 // milliseconds
 
-	errDbIsNotActive = errors.New("db is not active")
+	// ErrNotFound, ErrNotActive and ErrAPIUnavailable tell callers of
+	// GetDatabase and GetDatabaseStatus a removed database from one that
+	// is not ready yet and from a cluster that can not be asked. Errors
+	// of the circuit breaker are returned as they are.
+	ErrNotFound       = errors.New("db does not exist")
+	ErrNotActive      = errors.New("db is not active")
+	ErrAPIUnavailable = brokererrors.NewServiceUnavailable("the cluster API is unavailable")
+
+	activePolls int64
 )
 
 func New(conf config.Config, logger lager.Logger) Client {
@@ -56,18 +105,61 @@ func New(conf config.Config, logger lager.Logger) Client {
 		conf.Cluster.Auth.Password,
 		conf.Cluster.Address,
 		logger,
-	)
+	).WithRateLimiter(rateLimiter(conf.Cluster)).WithCircuitBreaker(circuitBreaker(conf.Cluster)).
+		WithCredentials(sharedCredentials(conf.Cluster))
 
 	return &apiClient{
+		address:    conf.Cluster.Address,
 		logger:     logger,
 		httpClient: httpClient,
+		polling:    conf.Cluster.Polling,
+		cache:      newCache(time.Duration(conf.Cluster.CacheTTL) * time.Second),
 	}
 }
 
-func (c *apiClient) CreateDatabase(settings map[string]interface{}) (chan cluster.InstanceCredentials, error) {
+// NewWithHTTPClient returns a client that sends its requests through the
+// given HTTP client rather than to the cluster of the config, e.g. a fake
+// of the HTTP client in tests.
+func NewWithHTTPClient(httpClient httpclient.HTTPClient, conf config.Config, logger lager.Logger) Client {
+	return &apiClient{
+		address:    conf.Cluster.Address,
+		logger:     logger,
+		httpClient: httpClient,
+		polling:    conf.Cluster.Polling,
+		cache:      newCache(time.Duration(conf.Cluster.CacheTTL) * time.Second),
+	}
+}
+
+// NewPlanClients returns clients authenticating with the credentials of the
+// plans that have cluster credentials of their own, by plan ID.
+func NewPlanClients(conf config.Config, logger lager.Logger) map[string]Client {
+	clients := map[string]Client{}
+	for _, plan := range conf.ServiceBroker.Plans {
+		if plan.Auth.Username == "" {
+			continue
+		}
+		planConf := conf
+		planConf.Cluster.Auth = plan.Auth
+		clients[plan.ID] = New(planConf, logger)
+	}
+	return clients
+}
+
+func (c *apiClient) WithLogger(logger lager.Logger) Client {
+	scoped := *c
+	scoped.logger = logger
+	return &scoped
+}
+
+// CreateDatabase schedules a database creation and returns the UID of the
+// new database together with a channel that delivers its credentials once
+// the database becomes active. The UID allows callers to clean the database
+// up if they give up waiting for it, and closing stop ends the polling.
+func (c *apiClient) CreateDatabase(settings map[string]interface{}, stop <-chan struct{}) (int, chan cluster.InstanceCredentials, error) {
+	c.compatibleSettings(settings)
 	bytes, err := json.Marshal(settings)
 	if err != nil {
-		return nil, err
+		return 0, nil, err
 	}
 
 	c.logger.Info("Sending a database creation request", lager.Data{
@@ -76,7 +168,7 @@ func (c *apiClient) CreateDatabase(settings map[string]interface{}) (chan cluste
 	res, err := c.httpClient.Post("/v1/bdbs", httpclient.HTTPPayload(bytes))
 	if err != nil {
 		c.logger.Error("Failed to perform a database creation request", err)
-		return nil, err
+		return 0, nil, err
 	}
 
 	var dbUid int
@@ -84,44 +176,99 @@ func (c *apiClient) CreateDatabase(settings map[string]interface{}) (chan cluste
 	if res.StatusCode != 200 {
 		payload, err := c.parseErrorResponse(res)
 		if err != nil {
-			return nil, err
+			return 0, nil, err
 		}
-		err = fmt.Errorf(payload.ErrorMessage)
+		err = errors.New(payload.ErrorMessage)
 		c.logger.Error("Failed to create a database", err)
-		return nil, err
+		return 0, nil, err
 	} else {
 		payload, err := c.parseStatusResponse(res)
 		if err != nil {
-			return nil, err
+			return 0, nil, err
 		}
 
 		dbUid = payload.UID
 	}
 
-	c.logger.Info("Database creation has been scheduled")
+	c.logger.Info("Database creation has been scheduled", lager.Data{
+		"UID": dbUid,
+	})
+
+	return dbUid, c.WaitForDatabase(dbUid, stop), nil
+}
 
-	ch := make(chan cluster.InstanceCredentials)
+// ActivePolls returns how many databases are being polled until they
+// become active.
+func ActivePolls() int64 {
+	return atomic.LoadInt64(&activePolls)
+}
+
+// WaitForDatabase returns a channel that delivers the credentials of the
+// database once it becomes active. The channel is closed if the database
+// gets removed in the meantime. Closing stop ends the polling, e.g. once
+// the caller has given up waiting.
+func (c *apiClient) WaitForDatabase(UID int, stop <-chan struct{}) chan cluster.InstanceCredentials {
+	// The channel is buffered so that the polling goroutine does not block
+	// forever if nobody is waiting for the credentials anymore.
+	ch := make(chan cluster.InstanceCredentials, 1)
 	go func() {
+		atomic.AddInt64(&activePolls, 1)
+		defer atomic.AddInt64(&activePolls, -1)
+
+		interval := newBackoff(c.polling)
 		for {
-			time.Sleep(time.Duration(DatabasePollingInterval) * time.Millisecond)
+			select {
+			case <-time.After(interval.next()):
+			case <-stop:
+				return
+			}
 
-			instanceCredentials, err := c.GetDatabase(dbUid)
+			instanceCredentials, err := c.GetDatabase(UID)
 			if err != nil {
-				if err == errDbIsNotActive {
+				if err == ErrNotActive {
 					c.logger.Info("Database is not active yet")
+				} else if err == ErrNotFound {
+					c.logger.Info("Database has been removed, stopped polling", lager.Data{
+						"UID": UID,
+					})
+					close(ch)
+					return
 				} else {
 					c.logger.Error("Failed to make a polling request", err)
 				}
 			} else {
 				ch <- instanceCredentials
-				break
+				return
 			}
 		}
 	}()
-	return ch, nil
+	return ch
+}
+
+// WaitForDeletion polls the database until the cluster has removed it and
+// reports whether it did so within the timeout.
+func (c *apiClient) WaitForDeletion(UID int, timeout time.Duration) (bool, error) {
+	deadline := time.Now().Add(timeout)
+	interval := newBackoff(c.polling)
+	for {
+		_, err := c.GetDatabaseStatus(UID)
+		if err == ErrNotFound {
+			return true, nil
+		}
+		if err != nil {
+			c.logger.Error("Failed to make a polling request", err)
+		}
+
+		remaining := deadline.Sub(time.Now())
+		if remaining <= 0 {
+			return false, err
+		}
+		time.Sleep(interval.nextWithin(remaining))
+	}
 }
 
 func (c *apiClient) UpdateDatabase(UID int, params map[string]interface{}) error {
+	c.compatibleSettings(params)
 	bytes, err := json.Marshal(params)
 	if err != nil {
 		c.logger.Error("Failed to serialize update parameters", err)
@@ -144,7 +291,7 @@ func (c *apiClient) UpdateDatabase(UID int, params map[string]interface{}) error
 		if err != nil {
 			return err
 		}
-		err = fmt.Errorf(payload.ErrorMessage)
+		err = errors.New(payload.ErrorMessage)
 		c.logger.Error("Failed to update the database", err, lager.Data{
 			"UID": UID,
 		})
@@ -157,35 +304,91 @@ func (c *apiClient) UpdateDatabase(UID int, params map[string]interface{}) error
 	return nil
 }
 
+// GetDatabase returns the credentials of the database once it is
+// active, ErrNotActive before.
 func (c *apiClient) GetDatabase(UID int) (cluster.InstanceCredentials, error) {
-	res, err := c.httpClient.Get(fmt.Sprintf("/v1/bdbs/%d", UID), httpclient.HTTPParams{})
+	payload, err := c.getStatus(UID)
 	if err != nil {
-		return cluster.InstanceCredentials{}, fmt.Errorf("failed to query API for db '%d' details: %s", UID, err)
+		return cluster.InstanceCredentials{}, err
 	}
 
-	payload, err := c.parseStatusResponse(res)
+	if payload.Status != "active" {
+		c.logger.Debug("Database is not active", lager.Data{
+			"UID":    UID,
+			"status": payload.Status,
+		})
+		return cluster.InstanceCredentials{}, ErrNotActive
+	}
+
+	if len(payload.Endpoints) < 1 {
+		return cluster.InstanceCredentials{}, fmt.Errorf("No endpoints created")
+	}
+
+	return payload.credentials(), nil
+}
+
+// GetDatabaseStatus returns the status of the database as reported by
+// the cluster, e.g. "active" or "pending".
+func (c *apiClient) GetDatabaseStatus(UID int) (string, error) {
+	payload, err := c.getStatus(UID)
 	if err != nil {
-		return cluster.InstanceCredentials{}, fmt.Errorf("failed to parse DB '%d' response: %s", UID, err)
+		return "", err
 	}
+	return payload.Status, nil
+}
 
-	if payload.Status != "active" {
-		fmt.Println("db statsus=", payload.Status)
-		return cluster.InstanceCredentials{}, errDbIsNotActive
+// getStatus queries the database. It returns ErrNotFound if the cluster
+// does not know it, and ErrAPIUnavailable if the cluster can not be
+// reached or fails to answer.
+func (c *apiClient) getStatus(UID int) (statusResponse, error) {
+	res, err := c.httpClient.Get(fmt.Sprintf("/v1/bdbs/%d", UID), httpclient.HTTPParams{})
+	if _, ok := err.(*brokererrors.Error); ok {
+		return statusResponse{}, err
+	}
+	if err != nil {
+		c.logger.Error("Failed to query the database", err, lager.Data{"UID": UID})
+		return statusResponse{}, ErrAPIUnavailable
 	}
 
-        if len(payload.Endpoints) < 1 {
-		return cluster.InstanceCredentials{}, fmt.Errorf("No endpoints created")
+	switch {
+	case res.StatusCode == 404:
+		res.Body.Close()
+		return statusResponse{}, ErrNotFound
+	case res.StatusCode >= 500:
+		res.Body.Close()
+		c.logger.Error("Failed to query the database", ErrAPIUnavailable, lager.Data{
+			"UID":    UID,
+			"status": res.StatusCode,
+		})
+		return statusResponse{}, ErrAPIUnavailable
+	case res.StatusCode != 200:
+		payload, err := c.parseErrorResponse(res)
+		if err != nil {
+			return statusResponse{}, err
+		}
+		return statusResponse{}, errors.New(payload.ErrorMessage)
 	}
 
-	return cluster.InstanceCredentials{
-		UID:      payload.UID,
-		Host:     payload.Endpoints[0].DNSName,
-		Port:     payload.Endpoints[0].Port,
-		IPList:   payload.Endpoints[0].AddrList,
-		Password: payload.Password,
-	}, nil
+	payload, err := c.parseStatusResponse(res)
+	if err != nil {
+		return statusResponse{}, fmt.Errorf("failed to parse DB '%d' response: %s", UID, err)
+	}
+	return payload, nil
 }
 
+// GetDatabaseSettings returns the database document of the cluster as
+// it is, so that its settings can be compared with the requested ones.
+func (c *apiClient) GetDatabaseSettings(UID int) (map[string]interface{}, error) {
+	settings := map[string]interface{}{}
+	if err := c.call("GET", fmt.Sprintf("/v1/bdbs/%d", UID), nil, &settings); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// DeleteDatabase schedules the removal of the database. A database that
+// is gone already counts as removed, so that an interrupted deletion can
+// be retried.
 func (c *apiClient) DeleteDatabase(UID int) error {
 	res, err := c.httpClient.Delete(fmt.Sprintf("/v1/bdbs/%d", UID))
 	if err != nil {
@@ -195,12 +398,17 @@ func (c *apiClient) DeleteDatabase(UID int) error {
 		return err
 	}
 
+	if res.StatusCode == 404 {
+		res.Body.Close()
+		return nil
+	}
+
 	if res.StatusCode != 200 {
 		payload, err := c.parseErrorResponse(res)
 		if err != nil {
 			return err
 		}
-		err = fmt.Errorf(payload.ErrorMessage)
+		err = errors.New(payload.ErrorMessage)
 		c.logger.Error("Failed to delete the database", err)
 		return err
 	}
@@ -211,6 +419,66 @@ func (c *apiClient) DeleteDatabase(UID int) error {
 	return nil
 }
 
+// requestError describes a failed request. Errors meant for the platform,
+// like the one of an open circuit breaker, are returned as they are.
+func requestError(err error, format string, args ...interface{}) error {
+	if _, ok := err.(*brokererrors.Error); ok {
+		return err
+	}
+	return fmt.Errorf(format+": %s", append(args, err)...)
+}
+
+// call performs a request to the cluster API. The payload, unless nil, is
+// sent as JSON and a successful response is decoded into the result, unless
+// it is nil.
+func (c *apiClient) call(verb string, path string, payload interface{}, result interface{}) error {
+	var (
+		res *http.Response
+		err error
+	)
+	switch verb {
+	case "GET":
+		res, err = c.httpClient.Get(path, httpclient.HTTPParams{})
+	case "DELETE":
+		res, err = c.httpClient.Delete(path)
+	default:
+		var bytes []byte
+		if bytes, err = json.Marshal(payload); err != nil {
+			return err
+		}
+		if verb == "POST" {
+			res, err = c.httpClient.Post(path, httpclient.HTTPPayload(bytes))
+		} else {
+			res, err = c.httpClient.Put(path, httpclient.HTTPPayload(bytes))
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		payload, err := c.parseErrorResponse(res)
+		if err != nil {
+			return err
+		}
+		return errors.New(payload.ErrorMessage)
+	}
+	defer res.Body.Close()
+	if result == nil {
+		return nil
+	}
+	bytes, err := ioutil.ReadAll(res.Body)
+	if err == nil {
+		err = json.Unmarshal(bytes, result)
+	}
+	if err != nil {
+		c.logger.Error("Failed to parse the response payload", err, lager.Data{
+			"path": path,
+		})
+	}
+	return err
+}
+
 func (c *apiClient) parseErrorResponse(res *http.Response) (errorResponse, error) {
 	payload := errorResponse{}
 	bytes, err := ioutil.ReadAll(res.Body)
@@ -228,15 +496,40 @@ func (c *apiClient) parseErrorResponse(res *http.Response) (errorResponse, error
 }
 
 func (c *apiClient) parseStatusResponse(res *http.Response) (statusResponse, error) {
-       payload := statusResponse{}
-       bytes, err := ioutil.ReadAll(res.Body)
-       defer res.Body.Close()
-       if err == nil {
-               err = json.Unmarshal(bytes, &payload)
-       }
-       if err != nil {
-               c.logger.Error("Failed to parse the status response payload", err)
-       }
-       return payload, err
+	payload := statusResponse{}
+	bytes, err := ioutil.ReadAll(res.Body)
+	defer res.Body.Close()
+	if err == nil {
+		err = json.Unmarshal(bytes, &payload)
+	}
+	if err != nil {
+		c.logger.Error("Failed to parse the status response payload", err)
+	}
+	return payload, err
 }
 
+func (s statusResponse) credentials() cluster.InstanceCredentials {
+	credentials := cluster.InstanceCredentials{
+		UID:      s.UID,
+		Name:     s.Name,
+		Password: s.Password,
+		TLS:      s.SSL || s.TLSMode == "enabled",
+	}
+	if len(s.Endpoints) > 0 {
+		credentials.Host = s.Endpoints[0].DNSName
+		credentials.Port = s.Endpoints[0].Port
+		credentials.IPList = s.Endpoints[0].AddrList
+	}
+	// With replication enabled the endpoints following the primary one
+	// serve the replica shards.
+	if s.Replication && len(s.Endpoints) > 1 {
+		for _, e := range s.Endpoints[1:] {
+			credentials.ReadEndpoints = append(credentials.ReadEndpoints, cluster.Endpoint{
+				Host:   e.DNSName,
+				Port:   e.Port,
+				IPList: e.AddrList,
+			})
+		}
+	}
+	return credentials
+}
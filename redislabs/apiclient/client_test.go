@@ -0,0 +1,141 @@
+package apiclient_test
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/apiclient"
+	brokerconfig "github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/fakes"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/httpclient"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/testing"
+	"github.com/pivotal-golang/lager"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Querying a database", func() {
+	var (
+		proxy  testing.HTTPProxy
+		client apiclient.Client
+		status int
+		body   map[string]interface{}
+	)
+
+	BeforeEach(func() {
+		status, body = 200, map[string]interface{}{"uid": 1, "status": "pending"}
+		proxy = testing.NewHTTPProxy()
+		proxy.RegisterEndpointHandler("/v1/bdbs/1", func(w http.ResponseWriter, r *http.Request) interface{} {
+			w.WriteHeader(status)
+			return body
+		})
+		client = apiclient.New(brokerconfig.Config{
+			Cluster: brokerconfig.ClusterConfig{Address: proxy.URL()},
+		}, lager.NewLogger("test"))
+	})
+
+	AfterEach(func() {
+		proxy.Close()
+	})
+
+	It("Tells a database that is not active yet", func() {
+		_, err := client.GetDatabase(1)
+		Expect(err).To(Equal(apiclient.ErrNotActive))
+	})
+
+	It("Tells a removed database", func() {
+		status, body = 404, map[string]interface{}{"description": "db does not exist"}
+		_, err := client.GetDatabase(1)
+		Expect(err).To(Equal(apiclient.ErrNotFound))
+		_, err = client.GetDatabaseStatus(1)
+		Expect(err).To(Equal(apiclient.ErrNotFound))
+	})
+
+	It("Tells a cluster that fails to answer", func() {
+		status, body = 503, map[string]interface{}{"description": "unavailable"}
+		_, err := client.GetDatabaseStatus(1)
+		Expect(err).To(Equal(apiclient.ErrAPIUnavailable))
+
+		proxy.Close()
+		_, err = client.GetDatabaseStatus(1)
+		Expect(err).To(Equal(apiclient.ErrAPIUnavailable))
+	})
+})
+
+var _ = Describe("Querying a database through a fake HTTP client", func() {
+	var (
+		httpClient *fakes.FakeHTTPClient
+		client     apiclient.Client
+	)
+
+	BeforeEach(func() {
+		httpClient = &fakes.FakeHTTPClient{}
+		client = apiclient.NewWithHTTPClient(httpClient, brokerconfig.Config{}, lager.NewLogger("test"))
+	})
+
+	It("Requests the database", func() {
+		httpClient.GetReturns(&http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewBufferString(`{"uid": 1, "status": "active"}`)),
+		}, nil)
+		status, err := client.GetDatabaseStatus(1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status).To(Equal("active"))
+		Expect(httpClient.GetCallCount()).To(Equal(1))
+		endpoint, _ := httpClient.GetArgsForCall(0)
+		Expect(endpoint).To(Equal("/v1/bdbs/1"))
+	})
+
+	It("Tells a cluster that can not be reached", func() {
+		httpClient.GetReturns(nil, errors.New("connection refused"))
+		_, err := client.GetDatabaseStatus(1)
+		Expect(err).To(Equal(apiclient.ErrAPIUnavailable))
+	})
+})
+
+var _ = Describe("Waiting for a database", func() {
+	var (
+		httpClient *fakes.FakeHTTPClient
+		client     apiclient.Client
+		status     int
+	)
+
+	BeforeEach(func() {
+		status = 200
+		httpClient = &fakes.FakeHTTPClient{}
+		httpClient.GetStub = func(string, httpclient.HTTPParams) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: status,
+				Body:       ioutil.NopCloser(bytes.NewBufferString(`{"uid": 1, "status": "pending"}`)),
+			}, nil
+		}
+		client = apiclient.NewWithHTTPClient(httpClient, brokerconfig.Config{
+			Cluster: brokerconfig.ClusterConfig{
+				Polling: brokerconfig.PollingConfig{InitialInterval: 10, MaxInterval: 20},
+			},
+		}, lager.NewLogger("test"))
+	})
+
+	It("Closes the channel once the database is removed", func() {
+		status = 404
+		ch := client.WaitForDatabase(1, make(chan struct{}))
+		Eventually(ch).Should(BeClosed())
+	})
+
+	It("Stops polling once the caller gives up", func() {
+		status = 503
+		stop := make(chan struct{})
+		client.WaitForDatabase(1, stop)
+		Eventually(httpClient.GetCallCount).Should(BeNumerically(">", 1))
+		close(stop)
+
+		// A poll may be under way while the polling stops.
+		time.Sleep(50 * time.Millisecond)
+		polls := httpClient.GetCallCount()
+		Consistently(httpClient.GetCallCount, "100ms").Should(Equal(polls))
+	})
+})
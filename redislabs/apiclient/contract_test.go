@@ -0,0 +1,165 @@
+package apiclient_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/apiclient"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/cluster"
+	brokerconfig "github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/testing"
+	"github.com/pivotal-golang/lager"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// The client is expected to behave the same with every recorded version of
+// the cluster API. A new version is supported once its recordings are
+// added under redislabs/testing/recordings and these specs pass.
+var _ = Describe("The contract with the cluster API", func() {
+	recordings := filepath.Join("..", "testing", "recordings")
+	versions, err := testing.RecordingVersions(recordings)
+	if err != nil {
+		panic(err)
+	}
+
+	for _, version := range versions {
+		version := version // escape the closure
+
+		Context("of version "+version, func() {
+			var (
+				api    *testing.RecordedAPI
+				client apiclient.Client
+			)
+
+			replay := func(scenario string) {
+				recording, err := testing.LoadRecording(recordings, version, scenario)
+				Expect(err).NotTo(HaveOccurred())
+				api = testing.NewRecordedAPI(recording)
+				client = apiclient.New(brokerconfig.Config{
+					Cluster: brokerconfig.ClusterConfig{
+						Address: api.URL(),
+						Polling: brokerconfig.PollingConfig{InitialInterval: 10, MaxInterval: 20},
+					},
+				}, lager.NewLogger("test"))
+			}
+
+			AfterEach(func() {
+				api.Close()
+				Expect(api.Unmatched()).To(BeEmpty())
+				Expect(api.Unplayed()).To(BeEmpty())
+			})
+
+			It("Creates a database", func() {
+				replay("create_database")
+				stop := make(chan struct{})
+				defer close(stop)
+				UID, ch, err := client.CreateDatabase(map[string]interface{}{
+					"name":        "cf-instance",
+					"memory_size": 104857600,
+					"replication": false,
+				}, stop)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(UID).To(Equal(1))
+
+				var credentials cluster.InstanceCredentials
+				Eventually(ch).Should(Receive(&credentials))
+				Expect(credentials).To(Equal(cluster.InstanceCredentials{
+					UID:      1,
+					Name:     "cf-instance",
+					Host:     "redis-12001.cluster.example.com",
+					Port:     12001,
+					IPList:   []string{"10.0.0.1"},
+					Password: "secret-1",
+				}))
+			})
+
+			It("Reports the progress of a database creation", func() {
+				replay("database_progress")
+				progress, err := client.GetDatabaseProgress(1)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(progress).To(Equal(cluster.DatabaseProgress{
+					Status:       "pending",
+					Shards:       1,
+					ShardsWanted: 2,
+				}))
+			})
+
+			It("Lists the databases page by page", func() {
+				pageSize := apiclient.DatabasePageSize
+				apiclient.DatabasePageSize = 2
+				defer func() { apiclient.DatabasePageSize = pageSize }()
+
+				replay("list_databases")
+				databases, err := client.ListDatabases()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(databases).To(HaveLen(2))
+				Expect(databases[0].Name).To(Equal("cf-instance"))
+				Expect(databases[0].TLS).To(BeTrue())
+				Expect(databases[1].Name).To(Equal("cf-other"))
+				Expect(databases[1].TLS).To(BeFalse())
+			})
+
+			It("Updates a database", func() {
+				replay("update_database")
+				Expect(client.UpdateDatabase(1, map[string]interface{}{"memory_size": 209715200})).To(Succeed())
+				Expect(client.UpdateDatabase(1, map[string]interface{}{"memory_size": -1})).NotTo(Succeed())
+			})
+
+			It("Deletes a database", func() {
+				replay("delete_database")
+				Expect(client.DeleteDatabase(1)).To(Succeed())
+				deleted, err := client.WaitForDeletion(1, time.Second)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(deleted).To(BeTrue())
+			})
+
+			It("Describes the cluster", func() {
+				replay("cluster")
+				info, err := client.GetClusterInfo()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(info.Name).To(Equal("cluster.example.com"))
+
+				modules, err := client.ListModules()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(modules).NotTo(BeEmpty())
+				Expect(modules[0].Name).To(Equal("ReJSON"))
+
+				nodes, err := client.ListNodes()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(nodes).To(Equal([]cluster.Node{
+					{UID: 1, Address: "10.0.0.1", TotalMemory: 17179869184, Status: "active"},
+					{UID: 2, Address: "10.0.0.2", TotalMemory: 8589934592, Status: "active"},
+				}))
+			})
+
+			It("Detects the version of the cluster", func() {
+				replay("version")
+				detected, err := client.DetectVersion()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fmt.Sprintf("%d.%d", detected.Major, detected.Minor)).To(Equal(version))
+			})
+
+			It("Reports the utilization of a database", func() {
+				replay("database_stats")
+				stats, err := client.GetDatabaseStats(1)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(stats).To(Equal(cluster.DatabaseStats{
+					MemoryLimit: 104857600,
+					UsedMemory:  2097152,
+					OpsPerSec:   150.5,
+					Connections: 3,
+					Keys:        42,
+				}))
+
+				actions, err := client.GetDatabaseActions(1)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(actions).To(HaveLen(1))
+				Expect(actions[0].Name).To(Equal("reshard"))
+				Expect(actions[0].Progress).To(Equal(50.0))
+			})
+		})
+	}
+})
@@ -0,0 +1,35 @@
+package apiclient
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/pivotal-golang/lager"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/httpclient"
+)
+
+var ErrCredentialsRejected = errors.New("the cluster rejected the credentials")
+
+// ChangeCredentials switches all the clients of the cluster to new API
+// credentials, so that they can be rotated without restarting the broker.
+// The credentials are only switched once the cluster accepted them. The
+// clients keep the configured credentials otherwise.
+func ChangeCredentials(conf config.ClusterConfig, username string, password string, logger lager.Logger) error {
+	res, err := httpclient.New(username, password, conf.Address, logger).Get("/v1/cluster", httpclient.HTTPParams{})
+	if err != nil {
+		return requestError(err, "failed to check the credentials")
+	}
+	res.Body.Close()
+	if res.StatusCode == 401 || res.StatusCode == 403 {
+		return ErrCredentialsRejected
+	}
+	if res.StatusCode != 200 {
+		return fmt.Errorf("failed to check the credentials: the cluster responded with status %d", res.StatusCode)
+	}
+
+	sharedCredentials(conf).Set(username, password)
+	logger.Info("Changed the cluster API credentials", lager.Data{"username": username})
+	return nil
+}
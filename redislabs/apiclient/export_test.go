@@ -0,0 +1,20 @@
+package apiclient
+
+import (
+	"time"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+)
+
+// PollingSchedule returns the intervals between the polls of a database
+// until the deadline, for the tests of the backoff.
+func PollingSchedule(conf config.PollingConfig, deadline time.Duration) []time.Duration {
+	schedule := []time.Duration{}
+	b := newBackoff(conf)
+	for elapsed := time.Duration(0); elapsed < deadline; {
+		interval := b.nextWithin(deadline - elapsed)
+		schedule = append(schedule, interval)
+		elapsed += interval
+	}
+	return schedule
+}
@@ -0,0 +1,116 @@
+package apiclient
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/cluster"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/httpclient"
+)
+
+var (
+	// DatabasePageSize is the number of databases requested at once.
+	DatabasePageSize = 100
+
+	// databaseFields are the fields of the database documents the broker
+	// reads, see statusResponse.
+	databaseFields = []string{
+		"uid", "name", "authentication_redis_pass", "endpoints", "status", "ssl", "tls_mode", "replication",
+	}
+)
+
+// ListOptions narrow down a list request, so that the cluster does not
+// have to send every document in full.
+type ListOptions struct {
+	// Fields limits the documents to the given fields.
+	Fields []string
+	Limit  int
+	Offset int
+	// Filter is passed as query parameters, e.g. {"name": "db"}.
+	Filter map[string]string
+}
+
+func (o ListOptions) params() httpclient.HTTPParams {
+	params := httpclient.HTTPParams{}
+	for key, value := range o.Filter {
+		params[key] = value
+	}
+	if len(o.Fields) > 0 {
+		params["fields"] = strings.Join(o.Fields, ",")
+	}
+	if o.Limit > 0 {
+		params["limit"] = strconv.Itoa(o.Limit)
+	}
+	if o.Offset > 0 {
+		params["offset"] = strconv.Itoa(o.Offset)
+	}
+	return params
+}
+
+// ListDatabases returns all the databases present on the cluster. Databases
+// that are not active yet are listed as well; their connection details may
+// be empty. The databases are requested page by page.
+func (c *apiClient) ListDatabases() ([]cluster.InstanceCredentials, error) {
+	databases := []cluster.InstanceCredentials{}
+	seen := map[int]bool{}
+	for offset := 0; ; offset += DatabasePageSize {
+		page, err := c.ListDatabasesWith(ListOptions{
+			Fields: databaseFields,
+			Limit:  DatabasePageSize,
+			Offset: offset,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, db := range page {
+			// Clusters that do not support paging return every database
+			// on every page.
+			if seen[db.UID] {
+				return databases, nil
+			}
+			seen[db.UID] = true
+			databases = append(databases, db)
+		}
+		if len(page) < DatabasePageSize {
+			return databases, nil
+		}
+	}
+}
+
+// ListDatabasesWith returns the databases matching the options.
+func (c *apiClient) ListDatabasesWith(options ListOptions) ([]cluster.InstanceCredentials, error) {
+	res, err := c.httpClient.Get("/v1/bdbs", options.params())
+	if err != nil {
+		return nil, requestError(err, "failed to query API for the list of dbs")
+	}
+
+	if res.StatusCode != 200 {
+		payload, err := c.parseErrorResponse(res)
+		if err != nil {
+			return nil, err
+		}
+		err = errors.New(payload.ErrorMessage)
+		c.logger.Error("Failed to list the databases", err)
+		return nil, err
+	}
+
+	payload := []statusResponse{}
+	bytes, err := ioutil.ReadAll(res.Body)
+	defer res.Body.Close()
+	if err == nil {
+		err = json.Unmarshal(bytes, &payload)
+	}
+	if err != nil {
+		c.logger.Error("Failed to parse the list of databases", err)
+		return nil, err
+	}
+
+	databases := []cluster.InstanceCredentials{}
+	for _, db := range payload {
+		databases = append(databases, db.credentials())
+	}
+	return databases, nil
+}
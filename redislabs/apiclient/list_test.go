@@ -0,0 +1,86 @@
+package apiclient_test
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/apiclient"
+	brokerconfig "github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/testing"
+	"github.com/pivotal-golang/lager"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Listing databases", func() {
+	var (
+		client   apiclient.Client
+		proxy    testing.HTTPProxy
+		pageSize int
+		queries  []string
+		paging   bool
+	)
+
+	BeforeEach(func() {
+		pageSize = apiclient.DatabasePageSize
+		apiclient.DatabasePageSize = 2
+		queries = []string{}
+		paging = true
+
+		proxy = testing.NewHTTPProxy()
+		proxy.RegisterEndpointHandler("/v1/bdbs", func(w http.ResponseWriter, r *http.Request) interface{} {
+			queries = append(queries, r.URL.RawQuery)
+			databases := []map[string]interface{}{}
+			for uid := 1; uid <= 3; uid++ {
+				databases = append(databases, map[string]interface{}{"uid": uid, "name": "db" + strconv.Itoa(uid)})
+			}
+			if !paging {
+				return databases
+			}
+			offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+			limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+			if offset > len(databases) {
+				offset = len(databases)
+			}
+			if offset+limit > len(databases) {
+				limit = len(databases) - offset
+			}
+			return databases[offset : offset+limit]
+		})
+		client = apiclient.New(brokerconfig.Config{
+			Cluster: brokerconfig.ClusterConfig{Address: proxy.URL()},
+		}, lager.NewLogger("test"))
+	})
+
+	AfterEach(func() {
+		apiclient.DatabasePageSize = pageSize
+		proxy.Close()
+	})
+
+	It("Requests the databases page by page", func() {
+		databases, err := client.ListDatabases()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(databases).To(HaveLen(3))
+		Expect(databases[2].Name).To(Equal("db3"))
+		Expect(queries).To(HaveLen(2))
+		Expect(queries[0]).To(ContainSubstring("fields=uid%2Cname%2C"))
+		Expect(queries[1]).To(ContainSubstring("offset=2"))
+	})
+
+	It("Copes with clusters that do not support paging", func() {
+		paging = false
+		databases, err := client.ListDatabases()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(databases).To(HaveLen(3))
+	})
+
+	It("Passes filters to the cluster", func() {
+		_, err := client.ListDatabasesWith(apiclient.ListOptions{
+			Fields: []string{"uid", "name"},
+			Filter: map[string]string{"name": "db1"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(queries).To(Equal([]string{"fields=uid%2Cname&name=db1"}))
+	})
+})
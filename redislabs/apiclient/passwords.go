@@ -0,0 +1,19 @@
+package apiclient
+
+import "fmt"
+
+type passwordRequest struct {
+	Password string `json:"password"`
+}
+
+// AddDatabasePassword makes an additional password valid for the
+// database, the existing ones stay valid.
+func (c *apiClient) AddDatabasePassword(UID int, password string) error {
+	return c.call("POST", fmt.Sprintf("/v1/bdbs/%d/passwords", UID), passwordRequest{Password: password}, nil)
+}
+
+// SetDatabasePassword makes the password the only valid password of
+// the database.
+func (c *apiClient) SetDatabasePassword(UID int, password string) error {
+	return c.call("PUT", fmt.Sprintf("/v1/bdbs/%d/passwords", UID), passwordRequest{Password: password}, nil)
+}
@@ -0,0 +1,80 @@
+package apiclient
+
+import (
+	"sync"
+	"time"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/cluster"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/httpclient"
+)
+
+// The rate limiters and circuit breakers are shared by all the clients of
+// a cluster, so that they work for the broker as a whole. So are the
+// credentials, so that they can be changed for all the clients at once,
+// and the version of the cluster once it has been detected.
+var (
+	sharedLock  sync.Mutex
+	limiters    = map[string]*httpclient.RateLimiter{}
+	breakers    = map[string]*httpclient.CircuitBreaker{}
+	credentials = map[string]*httpclient.Credentials{}
+	versions    = map[string]cluster.Version{}
+)
+
+func sharedVersion(address string) (cluster.Version, bool) {
+	sharedLock.Lock()
+	defer sharedLock.Unlock()
+	version, ok := versions[address]
+	return version, ok
+}
+
+func setSharedVersion(address string, version cluster.Version) {
+	sharedLock.Lock()
+	defer sharedLock.Unlock()
+	versions[address] = version
+}
+
+// sharedCredentials returns the credentials of the clients of the cluster,
+// the configured ones unless they have been changed since.
+func sharedCredentials(conf config.ClusterConfig) *httpclient.Credentials {
+	sharedLock.Lock()
+	defer sharedLock.Unlock()
+	key := conf.Address + " " + conf.Auth.Username + " " + conf.Auth.Password
+	c, ok := credentials[key]
+	if !ok {
+		c = httpclient.NewCredentials(conf.Auth.Username, conf.Auth.Password)
+		credentials[key] = c
+	}
+	return c
+}
+
+func rateLimiter(conf config.ClusterConfig) *httpclient.RateLimiter {
+	if conf.RateLimit.RequestsPerSecond <= 0 {
+		return nil
+	}
+
+	sharedLock.Lock()
+	defer sharedLock.Unlock()
+	limiter, ok := limiters[conf.Address]
+	if !ok {
+		limiter = httpclient.NewRateLimiter(conf.RateLimit.RequestsPerSecond, conf.RateLimit.Burst)
+		limiters[conf.Address] = limiter
+	}
+	return limiter
+}
+
+func circuitBreaker(conf config.ClusterConfig) *httpclient.CircuitBreaker {
+	if conf.CircuitBreaker.Failures <= 0 {
+		return nil
+	}
+
+	sharedLock.Lock()
+	defer sharedLock.Unlock()
+	breaker, ok := breakers[conf.Address]
+	if !ok {
+		cooldown := time.Duration(conf.CircuitBreaker.Cooldown) * time.Second
+		breaker = httpclient.NewCircuitBreaker(conf.CircuitBreaker.Failures, cooldown)
+		breakers[conf.Address] = breaker
+	}
+	return breaker
+}
@@ -0,0 +1,126 @@
+package apiclient
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/cluster"
+)
+
+type memoryLimitResponse struct {
+	MemorySize      int64  `json:"memory_size"`
+	DataPersistence string `json:"data_persistence"`
+}
+
+type shardCountResponse struct {
+	ShardsCount int `json:"shards_count"`
+}
+
+type progressResponse struct {
+	Status      string        `json:"status"`
+	ShardsCount int           `json:"shards_count"`
+	Replication bool          `json:"replication"`
+	ShardList   []int         `json:"shard_list"`
+	Endpoints   []interface{} `json:"endpoints"`
+}
+
+type actionResponse struct {
+	UID      string  `json:"action_uid"`
+	Name     string  `json:"name"`
+	Status   string  `json:"status"`
+	Progress float64 `json:"progress"`
+}
+
+type statsResponse struct {
+	UsedMemory  float64 `json:"used_memory"`
+	TotalReq    float64 `json:"total_req"`
+	Connections float64 `json:"conns"`
+	Keys        float64 `json:"no_of_keys"`
+}
+
+// GetMemoryUsage returns the memory limit of the database together with
+// the memory in use according to the latest stats of the cluster.
+func (c *apiClient) GetMemoryUsage(UID int) (cluster.MemoryUsage, error) {
+	stats, err := c.GetDatabaseStats(UID)
+	if err != nil {
+		return cluster.MemoryUsage{}, err
+	}
+	return cluster.MemoryUsage{
+		Limit: stats.MemoryLimit,
+		Used:  stats.UsedMemory,
+	}, nil
+}
+
+// GetDatabaseStats returns the latest stats of the database the cluster
+// has collected.
+func (c *apiClient) GetDatabaseStats(UID int) (cluster.DatabaseStats, error) {
+	limit := memoryLimitResponse{}
+	if err := c.call("GET", fmt.Sprintf("/v1/bdbs/%d", UID), nil, &limit); err != nil {
+		return cluster.DatabaseStats{}, err
+	}
+
+	stats := map[string]statsResponse{}
+	if err := c.call("GET", fmt.Sprintf("/v1/bdbs/stats/last/%d", UID), nil, &stats); err != nil {
+		return cluster.DatabaseStats{}, err
+	}
+	last, ok := stats[strconv.Itoa(UID)]
+	if !ok {
+		return cluster.DatabaseStats{}, fmt.Errorf("no stats of db '%d'", UID)
+	}
+
+	return cluster.DatabaseStats{
+		MemoryLimit: limit.MemorySize,
+		UsedMemory:  int64(last.UsedMemory),
+		OpsPerSec:   last.TotalReq,
+		Connections: int64(last.Connections),
+		Keys:        int64(last.Keys),
+		Persistence: limit.DataPersistence,
+	}, nil
+}
+
+// GetShardCount returns the number of shards of the database.
+func (c *apiClient) GetShardCount(UID int) (int, error) {
+	res := shardCountResponse{}
+	if err := c.call("GET", fmt.Sprintf("/v1/bdbs/%d", UID), nil, &res); err != nil {
+		return 0, err
+	}
+	return res.ShardsCount, nil
+}
+
+// GetDatabaseProgress reports how far the cluster got creating the
+// database, from the shards it placed and the endpoints it created.
+func (c *apiClient) GetDatabaseProgress(UID int) (cluster.DatabaseProgress, error) {
+	res := progressResponse{}
+	if err := c.call("GET", fmt.Sprintf("/v1/bdbs/%d", UID), nil, &res); err != nil {
+		return cluster.DatabaseProgress{}, err
+	}
+	wanted := res.ShardsCount
+	if res.Replication {
+		wanted *= 2
+	}
+	return cluster.DatabaseProgress{
+		Status:       res.Status,
+		Shards:       len(res.ShardList),
+		ShardsWanted: wanted,
+		Endpoints:    len(res.Endpoints),
+	}, nil
+}
+
+// GetDatabaseActions returns the actions the cluster runs or has run on
+// the database.
+func (c *apiClient) GetDatabaseActions(UID int) ([]cluster.Action, error) {
+	res := []actionResponse{}
+	if err := c.call("GET", fmt.Sprintf("/v1/actions/bdb/%d", UID), nil, &res); err != nil {
+		return nil, err
+	}
+	actions := []cluster.Action{}
+	for _, a := range res {
+		actions = append(actions, cluster.Action{
+			UID:      a.UID,
+			Name:     a.Name,
+			Status:   a.Status,
+			Progress: a.Progress,
+		})
+	}
+	return actions, nil
+}
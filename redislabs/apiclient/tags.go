@@ -0,0 +1,30 @@
+package apiclient
+
+// DeletedAtTag marks the databases retained after their instance was
+// deprovisioned with the time of the deprovisioning, so that they are not
+// taken for databases in use.
+const DeletedAtTag = "cf_deleted_at"
+
+// SetDatabaseTag sets the tag of the database to the value, or removes the
+// tag if the value is empty. The other tags of the database are kept.
+func SetDatabaseTag(client Client, UID int, key string, value string) error {
+	settings, err := client.GetDatabaseSettings(UID)
+	if err != nil {
+		return err
+	}
+	tags := []map[string]string{}
+	current, _ := settings["tags"].([]interface{})
+	for _, tag := range current {
+		tag, ok := tag.(map[string]interface{})
+		if !ok || tag["key"] == key {
+			continue
+		}
+		tagKey, _ := tag["key"].(string)
+		tagValue, _ := tag["value"].(string)
+		tags = append(tags, map[string]string{"key": tagKey, "value": tagValue})
+	}
+	if value != "" {
+		tags = append(tags, map[string]string{"key": key, "value": value})
+	}
+	return client.UpdateDatabase(UID, map[string]interface{}{"tags": tags})
+}
@@ -0,0 +1,73 @@
+package apiclient
+
+import (
+	"fmt"
+
+	"github.com/pivotal-golang/lager"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/brokererrors"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/cluster"
+)
+
+type nodeVersionResponse struct {
+	UID             int    `json:"uid"`
+	SoftwareVersion string `json:"software_version"`
+}
+
+// DetectVersion asks the cluster for its version and remembers it for all
+// the clients of the cluster, see Supports. The version of the cluster is
+// the lowest version of its nodes, since the nodes are upgraded one by one.
+func (c *apiClient) DetectVersion() (cluster.Version, error) {
+	payload := []nodeVersionResponse{}
+	if err := c.call("GET", "/v1/nodes", nil, &payload); err != nil {
+		c.logger.Error("Failed to detect the cluster version", err)
+		return cluster.Version{}, err
+	}
+
+	var lowest *cluster.Version
+	for _, node := range payload {
+		version, err := cluster.ParseVersion(node.SoftwareVersion)
+		if err != nil {
+			c.logger.Error("Failed to parse the version of a node", err, lager.Data{"node-uid": node.UID})
+			return cluster.Version{}, err
+		}
+		if lowest == nil || !version.AtLeast(*lowest) {
+			lowest = &version
+		}
+	}
+	if lowest == nil {
+		return cluster.Version{}, fmt.Errorf("the cluster has no nodes")
+	}
+
+	setSharedVersion(c.address, *lowest)
+	c.logger.Info("Detected the cluster version", lager.Data{"version": lowest.String()})
+	return *lowest, nil
+}
+
+// compatibleSettings rewrites the database settings of later cluster
+// versions the cluster does not support into their earlier equivalents.
+// Clusters without TLS modes have the ssl setting instead, which requires
+// client certificates if some are given.
+func (c *apiClient) compatibleSettings(settings map[string]interface{}) {
+	mode, ok := settings["tls_mode"].(string)
+	if !ok || c.Supports(cluster.TLSModes) == nil {
+		return
+	}
+	settings["ssl"] = mode == "enabled"
+	delete(settings, "tls_mode")
+	delete(settings, "enforce_client_authentication")
+}
+
+// Supports returns an error naming the version of the cluster if the
+// cluster lacks the capability. Capabilities are not checked until the
+// version has been detected.
+func (c *apiClient) Supports(capability cluster.Capability) error {
+	version, ok := sharedVersion(c.address)
+	if !ok || version.AtLeast(capability.Since) {
+		return nil
+	}
+	return brokererrors.NewUnprocessableEntity("", fmt.Sprintf(
+		"%s are not supported by cluster version %s, they need version %d.%d or later",
+		capability.Name, version, capability.Since.Major, capability.Since.Minor,
+	))
+}
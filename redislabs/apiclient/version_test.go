@@ -0,0 +1,116 @@
+package apiclient_test
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/apiclient"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/brokererrors"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/cluster"
+	brokerconfig "github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/testing"
+	"github.com/pivotal-golang/lager"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Cluster versions", func() {
+	var (
+		proxy    testing.HTTPProxy
+		client   apiclient.Client
+		versions []string
+		requests map[string]int
+	)
+
+	BeforeEach(func() {
+		versions = []string{"6.0.20-97", "5.4.14-28"}
+		requests = map[string]int{}
+		proxy = testing.NewHTTPProxy()
+		proxy.RegisterEndpointHandler("/v1/nodes", func(w http.ResponseWriter, r *http.Request) interface{} {
+			nodes := []map[string]interface{}{}
+			for i, version := range versions {
+				nodes = append(nodes, map[string]interface{}{"uid": i + 1, "software_version": version})
+			}
+			return nodes
+		})
+		proxy.RegisterEndpointHandler("/v1/redis_acls", func(w http.ResponseWriter, r *http.Request) interface{} {
+			requests[r.URL.Path]++
+			if r.Method == "POST" {
+				return map[string]interface{}{"uid": 1}
+			}
+			return []interface{}{}
+		})
+		client = apiclient.New(brokerconfig.Config{
+			Cluster: brokerconfig.ClusterConfig{Address: proxy.URL()},
+		}, lager.NewLogger("test"))
+	})
+
+	AfterEach(func() {
+		proxy.Close()
+	})
+
+	It("Parses versions", func() {
+		version, err := cluster.ParseVersion("6.0.20-97")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(version).To(Equal(cluster.Version{Major: 6, Minor: 0, Patch: 20, Build: "97"}))
+		Expect(version.String()).To(Equal("6.0.20-97"))
+		Expect(version.AtLeast(cluster.Version{Major: 6})).To(BeTrue())
+		Expect(version.AtLeast(cluster.Version{Major: 6, Minor: 2})).To(BeFalse())
+
+		_, err = cluster.ParseVersion("six")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Takes the lowest version of the nodes", func() {
+		version, err := client.DetectVersion()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(version.String()).To(Equal("5.4.14-28"))
+	})
+
+	It("Rejects the features a cluster does not support", func() {
+		_, err := client.DetectVersion()
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(client.Supports(cluster.Modules)).To(Succeed())
+		_, err = client.EnsureRedisACL("read-only", "+@read")
+		Expect(err).To(MatchError("ACL users are not supported by cluster version 5.4.14-28, they need version 6.0 or later"))
+		Expect(brokererrors.From(err).StatusCode).To(Equal(422))
+		Expect(requests["/v1/redis_acls"]).To(Equal(0))
+	})
+
+	It("Allows the features of a cluster that supports them", func() {
+		versions = []string{"6.0.20-97"}
+		_, err := client.DetectVersion()
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(client.Supports(cluster.ACLUsers)).To(Succeed())
+		_, err = client.EnsureRedisACL("read-only", "+@read")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(requests["/v1/redis_acls"]).To(Equal(2))
+	})
+
+	It("Sends the ssl setting to clusters without TLS modes", func() {
+		var sent map[string]interface{}
+		proxy.RegisterEndpointHandler("/v1/bdbs/1", func(w http.ResponseWriter, r *http.Request) interface{} {
+			Expect(json.NewDecoder(r.Body).Decode(&sent)).To(Succeed())
+			return map[string]interface{}{"uid": 1}
+		})
+		_, err := client.DetectVersion()
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(client.UpdateDatabase(1, map[string]interface{}{
+			"tls_mode":                        "enabled",
+			"enforce_client_authentication":   "enabled",
+			"authentication_ssl_client_certs": []map[string]string{{"client_cert": "PEM"}},
+		})).To(Succeed())
+		Expect(sent).To(Equal(map[string]interface{}{
+			"ssl":                             true,
+			"authentication_ssl_client_certs": []interface{}{map[string]interface{}{"client_cert": "PEM"}},
+		}))
+	})
+
+	It("Allows every feature until the version is detected", func() {
+		Expect(client.Supports(cluster.ACLUsers)).To(Succeed())
+	})
+})
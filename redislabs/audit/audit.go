@@ -0,0 +1,150 @@
+// Package audit emits the security events of the broker, like
+// authentication failures, credential rotations and the use of the admin
+// API, in the Common Event Format (CEF) of SIEMs.
+package audit
+
+import (
+	"fmt"
+	"io"
+	"log/syslog"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+)
+
+// Signature IDs of the events.
+const (
+	AuthenticationFailed = "authentication-failed"
+	CredentialsRotated   = "credentials-rotated"
+	AdminAPIUsed         = "admin-api-used"
+)
+
+var (
+	// ProductVersion is the device version of the events. It may be set
+	// at build time with -ldflags "-X ...audit.ProductVersion=1.2.3".
+	ProductVersion = "1.0"
+
+	names = map[string]string{
+		AuthenticationFailed: "Authentication failed",
+		CredentialsRotated:   "Credentials rotated",
+		AdminAPIUsed:         "Admin API used",
+	}
+	// severities range from 0 to 10, the most severe.
+	severities = map[string]int{
+		AuthenticationFailed: 5,
+		CredentialsRotated:   4,
+		AdminAPIUsed:         3,
+	}
+
+	headerEscaper    = strings.NewReplacer(`\`, `\\`, `|`, `\|`)
+	extensionEscaper = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`)
+)
+
+// Event is a security event. Its extension holds CEF keys like src, suser
+// or request.
+type Event struct {
+	SignatureID string
+	Time        time.Time
+	Extension   map[string]string
+}
+
+// Format returns the event as a CEF line.
+func (e Event) Format() string {
+	keys := []string{}
+	for key, value := range e.Extension {
+		if value != "" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	extension := []string{"rt=" + strconv.FormatInt(e.Time.UnixNano()/int64(time.Millisecond), 10)}
+	for _, key := range keys {
+		extension = append(extension, key+"="+extensionEscaper.Replace(e.Extension[key]))
+	}
+	return fmt.Sprintf("CEF:0|Redis Labs|cf-redislabs-broker|%s|%s|%s|%d|%s",
+		headerEscaper.Replace(ProductVersion),
+		headerEscaper.Replace(e.SignatureID),
+		headerEscaper.Replace(names[e.SignatureID]),
+		severities[e.SignatureID],
+		strings.Join(extension, " "))
+}
+
+// Emitter sends the events to their destination.
+type Emitter interface {
+	Emit(event Event)
+}
+
+var (
+	lock    sync.RWMutex
+	emitter Emitter = discard{}
+)
+
+// SetEmitter makes Emit send the events to the emitter.
+func SetEmitter(e Emitter) {
+	lock.Lock()
+	defer lock.Unlock()
+	emitter = e
+}
+
+// Configure makes Emit send the events to the syslog server of the config.
+// The events are discarded unless the config enables them.
+func Configure(conf config.SecurityEventsConfig) error {
+	if !conf.Enabled {
+		SetEmitter(discard{})
+		return nil
+	}
+	tag := conf.Tag
+	if tag == "" {
+		tag = "redislabs-service-broker"
+	}
+	writer, err := syslog.Dial(conf.Network, conf.Address, syslog.LOG_NOTICE|syslog.LOG_AUTH, tag)
+	if err != nil {
+		return fmt.Errorf("failed to connect to syslog: %s", err)
+	}
+	SetEmitter(&syslogEmitter{writer: writer})
+	return nil
+}
+
+// Emit sends an event with the given signature ID and extension.
+func Emit(signatureID string, extension map[string]string) {
+	lock.RLock()
+	defer lock.RUnlock()
+	emitter.Emit(Event{SignatureID: signatureID, Time: time.Now(), Extension: extension})
+}
+
+// NewWriterEmitter returns an emitter writing the events as CEF lines to
+// the writer.
+func NewWriterEmitter(writer io.Writer) Emitter {
+	return &writerEmitter{writer: writer}
+}
+
+type writerEmitter struct {
+	lock   sync.Mutex
+	writer io.Writer
+}
+
+func (e *writerEmitter) Emit(event Event) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	io.WriteString(e.writer, event.Format()+"\n")
+}
+
+type syslogEmitter struct {
+	writer *syslog.Writer
+}
+
+func (e *syslogEmitter) Emit(event Event) {
+	if severities[event.SignatureID] >= 5 {
+		e.writer.Warning(event.Format())
+	} else {
+		e.writer.Notice(event.Format())
+	}
+}
+
+type discard struct{}
+
+func (discard) Emit(Event) {}
@@ -0,0 +1,84 @@
+package audit_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/audit"
+	brokerconfig "github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+	"github.com/pivotal-cf/brokerapi/auth"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Security events", func() {
+	var output *bytes.Buffer
+
+	lines := func() []string {
+		return strings.Split(strings.TrimSpace(output.String()), "\n")
+	}
+
+	BeforeEach(func() {
+		output = &bytes.Buffer{}
+		audit.SetEmitter(audit.NewWriterEmitter(output))
+	})
+
+	AfterEach(func() {
+		Expect(audit.Configure(brokerconfig.SecurityEventsConfig{})).To(Succeed())
+	})
+
+	It("Formats the events as CEF with escaped values", func() {
+		event := audit.Event{
+			SignatureID: audit.CredentialsRotated,
+			Time:        time.Unix(1500000000, 0),
+			Extension:   map[string]string{"suser": "admin", "msg": "a=b\\c\nd", "duser": ""},
+		}
+		Expect(event.Format()).To(Equal(
+			`CEF:0|Redis Labs|cf-redislabs-broker|1.0|credentials-rotated|Credentials rotated|4|rt=1500000000000 msg=a\=b\\c\nd suser=admin`))
+	})
+
+	Describe("Watching requests", func() {
+		var handler http.Handler
+
+		send := func(handler http.Handler, username string, password string) {
+			req, err := http.NewRequest("GET", "/admin/instances", nil)
+			Expect(err).NotTo(HaveOccurred())
+			req.SetBasicAuth(username, password)
+			req.RemoteAddr = "10.0.0.1:51234"
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+		}
+
+		BeforeEach(func() {
+			handler = auth.NewWrapper("admin", "secret").Wrap(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+		})
+
+		It("Reports authentication failures", func() {
+			watched := audit.WatchAuthentication(handler, "broker")
+			send(watched, "admin", "secret")
+			Expect(output.String()).To(BeEmpty())
+
+			send(watched, "mallory", "guess")
+			Expect(lines()).To(HaveLen(1))
+			Expect(lines()[0]).To(HavePrefix("CEF:0|Redis Labs|cf-redislabs-broker|1.0|authentication-failed|Authentication failed|5|"))
+			Expect(lines()[0]).To(ContainSubstring(" cs1=broker "))
+			Expect(lines()[0]).To(ContainSubstring(" outcome=failure "))
+			Expect(lines()[0]).To(ContainSubstring(" src=10.0.0.1 suser=mallory"))
+		})
+
+		It("Reports every use of the admin API", func() {
+			watched := audit.WatchAdmin(handler)
+			send(watched, "admin", "secret")
+			send(watched, "admin", "wrong")
+			Expect(lines()).To(HaveLen(2))
+			Expect(lines()[0]).To(ContainSubstring("|admin-api-used|Admin API used|3|"))
+			Expect(lines()[0]).To(ContainSubstring(" outcome=success request=/admin/instances requestMethod=GET "))
+			Expect(lines()[1]).To(ContainSubstring("|authentication-failed|"))
+		})
+	})
+})
@@ -0,0 +1,78 @@
+package audit
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// statusRecorder remembers the status a handler responded with.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// WatchAuthentication emits an event for every request the handler
+// rejected with 401 Unauthorized. The realm tells the APIs apart, e.g.
+// broker or usage.
+func WatchAuthentication(next http.Handler, realm string) http.Handler {
+	return watch(next, realm, false)
+}
+
+// WatchAdmin emits an event for every request to the admin API, and for
+// every one it rejected with 401 Unauthorized.
+func WatchAdmin(next http.Handler) http.Handler {
+	return watch(next, "admin", true)
+}
+
+func watch(next http.Handler, realm string, admin bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, req)
+
+		unauthorized := recorder.status == http.StatusUnauthorized
+		if !unauthorized && !admin {
+			return
+		}
+		username, _, _ := req.BasicAuth()
+		outcome := "success"
+		if recorder.status >= 400 {
+			outcome = "failure"
+		}
+		extension := map[string]string{
+			"src":           sourceAddress(req),
+			"suser":         username,
+			"request":       req.URL.Path,
+			"requestMethod": req.Method,
+			"outcome":       outcome,
+			"cs1Label":      "realm",
+			"cs1":           realm,
+			"cn1Label":      "status",
+			"cn1":           strconv.Itoa(recorder.status),
+		}
+		if unauthorized {
+			Emit(AuthenticationFailed, extension)
+		} else {
+			Emit(AdminAPIUsed, extension)
+		}
+	})
+}
+
+// sourceAddress returns the address of the client, as forwarded by the
+// router in front of the broker if any.
+func sourceAddress(req *http.Request) string {
+	if forwarded := req.Header.Get("X-Forwarded-For"); forwarded != "" {
+		return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
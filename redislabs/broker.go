@@ -2,42 +2,116 @@ package redislabs
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"math"
-	"strconv"
+	"strings"
 
 	"github.com/pivotal-cf/brokerapi"
 	"github.com/pivotal-golang/lager"
 
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/audit"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/brokererrors"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/cluster"
 	"github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/events"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/hooks"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/params"
 	"github.com/RedisLabs/cf-redislabs-broker/redislabs/passwords"
 	"github.com/RedisLabs/cf-redislabs-broker/redislabs/persisters"
+	dbsettings "github.com/RedisLabs/cf-redislabs-broker/redislabs/settings"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/workers"
 )
 
 type ServiceInstanceManager interface {
-	Create(instanceID string, settings map[string]interface{}, persister persisters.StatePersister) error
-	Update(instanceID string, params map[string]interface{}, persister persisters.StatePersister) error
+	// Create creates a database with the given settings and saves the
+	// instance with its credentials.
+	Create(instance persisters.ServiceInstance, settings map[string]interface{}, asyncAllowed bool, persister persisters.StatePersister) (bool, error)
+	// Update applies the settings to the database of the instance and
+	// records its new plan (if any) and parameters. It returns true if
+	// the update completes asynchronously.
+	Update(instance persisters.ServiceInstance, settings map[string]interface{}, asyncAllowed bool, persister persisters.StatePersister) (bool, error)
 	Destroy(instanceID string, persister persisters.StatePersister) error
+	// Detach forgets the instance without deleting its database.
+	Detach(instanceID string, persister persisters.StatePersister) error
+	// InstanceExists, Get and List read the instances recorded in the
+	// state, Status asks the cluster for the status of the database of
+	// an instance.
 	InstanceExists(instanceID string, persister persisters.StatePersister) (bool, error)
+	Get(instanceID string, persister persisters.StatePersister) (persisters.ServiceInstance, error)
+	List(persister persisters.StatePersister) ([]persisters.ServiceInstance, error)
+	Status(instanceID string, persister persisters.StatePersister) (string, error)
+	LastOperation(instanceID string, persister persisters.StatePersister) (brokerapi.LastOperation, error)
+	RotatePassword(instanceID string, password string, persister persisters.StatePersister) error
 }
 
 type ServiceInstanceBinder interface {
-	Bind(instanceID string, bindingID string, persister persisters.StatePersister) (interface{}, error)
+	// Bind returns the credentials for the binding and records it. A
+	// binding that exists already with the same parameters gets its
+	// credentials again, and existed is true.
+	Bind(instanceID string, bindingID string, appGUID string, params map[string]interface{}, persister persisters.StatePersister) (credentials interface{}, existed bool, err error)
 	Unbind(instanceID string, bindingID string, persister persisters.StatePersister) error
 	InstanceExists(instanceID string, persister persisters.StatePersister) (bool, error)
 }
 
+// creationNotifier is implemented by the managers that tell when they
+// recorded an instance, which happens after Create returned if the
+// creation is asynchronous.
+type creationNotifier interface {
+	OnCreated(fn func(persisters.ServiceInstance))
+}
+
 type serviceBroker struct {
 	InstanceManager ServiceInstanceManager
 	InstanceBinder  ServiceInstanceBinder
 	StatePersister  persisters.StatePersister
 	Config          config.Config
 	Logger          lager.Logger
+	Workers         *workers.Pool
+	// Hooks run before and after instances are provisioned or
+	// deprovisioned. Hooks of code embedding the broker may be added to
+	// the ones of the config.
+	Hooks hooks.Hooks
+	// Events publishes the lifecycle events of the instances and bindings.
+	Events events.Publisher
+
+	// settingsByPlanID caches the settings of the plans, see planSettings.
+	settingsByPlanID map[string]map[string]interface{}
+
+	// Scope, if set, returns the manager and binder to process a single
+	// request with, logging with the logger of the request.
+	Scope func(lager.Logger) (ServiceInstanceManager, ServiceInstanceBinder)
 }
 
 var (
+	DefaultMaxConcurrentOperations = 10
+
 	RedisPasswordLength     = 48
-	RedisDatabaseNameLength = 63
+	RedisDatabaseNameLength = cluster.MaxDatabaseNameLength
+
+	// DefaultDatabaseNameTemplate is used unless the config says otherwise.
+	// The following placeholders are supported: {name} (the name parameter,
+	// "cf" by default), {org}, {space}, {instance_id} and {instance_id_short}.
+	DefaultDatabaseNameTemplate = "{name}-{instance_id}"
+
+	// rejections are the errors of requests the broker refused rather
+	// than failed to process, like the errors of the brokererrors package.
+	// They are not published as failed operations.
+	rejections = map[error]bool{
+		brokerapi.ErrInstanceAlreadyExists:  true,
+		brokerapi.ErrInstanceDoesNotExist:   true,
+		brokerapi.ErrBindingAlreadyExists:   true,
+		brokerapi.ErrBindingDoesNotExist:    true,
+		brokerapi.ErrAsyncRequired:          true,
+		brokerapi.ErrPlanChangeNotSupported: true,
+		brokerapi.ErrRawParamsInvalid:       true,
+	}
+
+	// brokerParameters are handled by the broker itself rather than
+	// passed to the cluster.
+	brokerParameters = map[string]bool{
+		"deletion_protection": true,
+		"retain_database":     true,
+	}
 )
 
 func NewServiceBroker(
@@ -47,37 +121,37 @@ func NewServiceBroker(
 	conf config.Config,
 	logger lager.Logger) *serviceBroker {
 
-	return &serviceBroker{
-		InstanceManager: instanceManager,
-		InstanceBinder:  instanceBinder,
-		StatePersister:  statePersister,
-		Config:          conf,
-		Logger:          logger,
+	poolSize := conf.ServiceBroker.MaxConcurrentOperations
+	if poolSize <= 0 {
+		poolSize = DefaultMaxConcurrentOperations
+	}
+
+	broker := &serviceBroker{
+		InstanceManager:  instanceManager,
+		InstanceBinder:   instanceBinder,
+		StatePersister:   statePersister,
+		Config:           conf,
+		Logger:           logger,
+		Workers:          workers.NewPool(poolSize),
+		Hooks:            hooks.New(conf.ServiceBroker.Hooks, logger),
+		Events:           events.New(conf.ServiceBroker.Webhooks, logger),
+		settingsByPlanID: dbsettings.ForPlans(conf.ServiceBroker.Plans),
+	}
+	if notifier, ok := instanceManager.(creationNotifier); ok {
+		notifier.OnCreated(broker.provisioned)
 	}
+	return broker
 }
 
-func (b *serviceBroker) Services() []brokerapi.Service {
-	planList := []brokerapi.ServicePlan{}
-	for _, p := range b.planDescriptions() {
-		planList = append(planList, *p)
-	}
-	b.Logger.Info("Serving a catalog request")
-	return []brokerapi.Service{
-		brokerapi.Service{
-			ID:            b.Config.ServiceBroker.ServiceID,
-			Name:          b.Config.ServiceBroker.Name,
-			Description:   b.Config.ServiceBroker.Description,
-			Bindable:      true,
-			Tags:          []string{"redislabs"},
-			Plans:         planList,
-			PlanUpdatable: true,
-			Metadata: &brokerapi.ServiceMetadata{
-				DisplayName:         b.Config.ServiceBroker.Metadata.DisplayName,
-				ImageUrl:            b.Config.ServiceBroker.Metadata.Image,
-				ProviderDisplayName: b.Config.ServiceBroker.Metadata.ProviderDisplayName,
-			},
-		},
+// WithLogger returns a broker that processes a request with the given
+// logger, so that the log lines of the request share its data.
+func (b *serviceBroker) WithLogger(logger lager.Logger) brokerapi.ServiceBroker {
+	scoped := *b
+	scoped.Logger = logger
+	if b.Scope != nil {
+		scoped.InstanceManager, scoped.InstanceBinder = b.Scope(logger)
 	}
+	return &scoped
 }
 
 func (b *serviceBroker) Provision(instanceID string, details brokerapi.ProvisionDetails, asyncAllowed bool) (brokerapi.ProvisionedServiceSpec, error) {
@@ -89,6 +163,9 @@ func (b *serviceBroker) Provision(instanceID string, details brokerapi.Provision
 		return brokerapi.ProvisionedServiceSpec{IsAsync: false}, ErrPlanDoesNotExist
 	}
 	planSettings := settingsByID[details.PlanID]
+	if !b.planAllowedForOrg(details.PlanID, details.OrganizationGUID) {
+		return brokerapi.ProvisionedServiceSpec{IsAsync: false}, ErrPlanNotAllowedForOrg
+	}
 
 	// Unmarhal raw parameters
 	var provisionParameters map[string]interface{}
@@ -98,29 +175,39 @@ func (b *serviceBroker) Provision(instanceID string, details brokerapi.Provision
 			return brokerapi.ProvisionedServiceSpec{IsAsync: false}, brokerapi.ErrRawParamsInvalid
 		}
 	}
+	provisionParameters, err := params.Validate(provisionParameters, b.parameterRanges(details.PlanID))
+	if err != nil {
+		return brokerapi.ProvisionedServiceSpec{IsAsync: false}, err
+	}
+	if err = params.CheckAllowed(provisionParameters, b.allowedParameters(details.PlanID)); err != nil {
+		return brokerapi.ProvisionedServiceSpec{IsAsync: false}, err
+	}
+	// Pinning the UID of a database, e.g. to keep it when migrating
+	// databases between clusters, is up to operators.
+	if _, ok := provisionParameters["uid"]; ok && !b.planListsParameter(details.PlanID, "uid") {
+		return brokerapi.ProvisionedServiceSpec{IsAsync: false}, ErrUIDNotAllowed
+	}
+	if _, ok := provisionParameters["rotate_password"]; ok {
+		return brokerapi.ProvisionedServiceSpec{IsAsync: false}, ErrRotateOnProvision
+	}
 
-	name, err := b.readDatabaseName(instanceID, provisionParameters)
+	name, err := b.readDatabaseName(instanceID, details, provisionParameters)
 	if err != nil {
 		b.Logger.Error("No database name was set", err)
 		return brokerapi.ProvisionedServiceSpec{IsAsync: false}, err
 	}
 
-	settings := map[string]interface{}{
-		"name": name,
-	}
-	// Record values coming from the plan.
-	for param, value := range planSettings {
-		settings[param] = value
-	}
+	// The parameters override the plan, except for the name that
+	// follows the template.
+	settings := dbsettings.Merge(planSettings, provisionParameters, brokerParameters)
+	settings["name"] = name
 
-	// Record additional values. The name is excluded since we have
-	// set it already.
-	for param, value := range provisionParameters {
-		settings[param] = castValue(value)
+	if b.Config.ServiceBroker.CFContextTags {
+		settings["tags"] = cfContextTags(instanceID, details)
 	}
 
 	if _, ok := settings["authentication_redis_pass"]; !ok {
-		password, err := passwords.Generate(RedisPasswordLength)
+		password, err := b.generatePassword()
 		if err != nil {
 			b.Logger.Error("Failed to generate a password", err)
 			return brokerapi.ProvisionedServiceSpec{IsAsync: false}, err
@@ -128,7 +215,35 @@ func (b *serviceBroker) Provision(instanceID string, details brokerapi.Provision
 		settings["authentication_redis_pass"] = password
 	}
 
-	return brokerapi.ProvisionedServiceSpec{IsAsync: false}, b.InstanceManager.Create(instanceID, settings, b.StatePersister)
+	instance := persisters.ServiceInstance{
+		ID:               instanceID,
+		PlanID:           details.PlanID,
+		ServiceID:        details.ServiceID,
+		OrganizationGUID: details.OrganizationGUID,
+		SpaceGUID:        details.SpaceGUID,
+		Parameters:       provisionParameters,
+	}
+	if err = b.Hooks.Before(hookEvent(hooks.Provision, instance)); err != nil {
+		b.Logger.Error("A hook rejected the provisioning", err, lager.Data{"instance-id": instanceID})
+		return brokerapi.ProvisionedServiceSpec{IsAsync: false}, brokererrors.NewUnprocessableEntity("", err.Error())
+	}
+	isAsync := false
+	err = b.Workers.Do(instanceID, func() error {
+		var err error
+		isAsync, err = b.InstanceManager.Create(instance, settings, asyncAllowed, b.StatePersister)
+		return err
+	})
+	if err != nil {
+		b.publishFailure("provision", instance, "", err)
+		return brokerapi.ProvisionedServiceSpec{IsAsync: isAsync}, err
+	}
+	// The managers telling when they recorded an instance have run the
+	// post hooks and published it already, or will once the database is
+	// active.
+	if _, notifies := b.InstanceManager.(creationNotifier); !notifies && !isAsync {
+		b.provisioned(b.storedInstance(instanceID))
+	}
+	return brokerapi.ProvisionedServiceSpec{IsAsync: isAsync}, nil
 }
 
 func (b *serviceBroker) Update(instanceID string, updateDetails brokerapi.UpdateDetails, asyncAllowed bool) (brokerapi.IsAsync, error) {
@@ -136,101 +251,311 @@ func (b *serviceBroker) Update(instanceID string, updateDetails brokerapi.Update
 		return false, ErrServiceDoesNotExist
 	}
 
-	settings := b.planSettings()
-	params := map[string]interface{}{}
+	stored := b.storedInstance(instanceID)
+	planID := updateDetails.PlanID
+	if planID == "" {
+		planID = stored.PlanID
+	}
+	updateParameters, err := params.Validate(updateDetails.Parameters, b.parameterRanges(planID))
+	if err != nil {
+		return brokerapi.IsAsync(false), err
+	}
+	if err = params.CheckAllowed(updateParameters, b.allowedParameters(planID)); err != nil {
+		return brokerapi.IsAsync(false), err
+	}
+	if _, ok := updateParameters["uid"]; ok {
+		return brokerapi.IsAsync(false), ErrUIDImmutable
+	}
+
+	// Rotating the password is an action rather than a setting to keep.
+	rotatePassword, _ := updateParameters["rotate_password"].(bool)
+	delete(updateParameters, "rotate_password")
 
-	if updateDetails.PlanID != updateDetails.PreviousValues.PlanID {
+	settingsByID := b.planSettings()
+	planSettings := map[string]interface{}{}
+
+	previousPlanID := updateDetails.PreviousValues.PlanID
+	if previousPlanID == "" {
+		previousPlanID = stored.PlanID
+	}
+	if planID != previousPlanID {
 		// If there is a request for a plan check whether it exists.
-		plan, ok := settings[updateDetails.PlanID]
+		plan, ok := settingsByID[planID]
 		if !ok {
 			return brokerapi.IsAsync(false), ErrPlanDoesNotExist
 		}
-		// Record parameters coming from the plan change.
-		for param, value := range plan {
-			params[param] = value
+		if previousPlanID != "" && !b.planUpdateable(previousPlanID) {
+			return brokerapi.IsAsync(false), brokerapi.ErrPlanChangeNotSupported
 		}
+		if !b.planAllowedForOrg(planID, stored.OrganizationGUID) {
+			return brokerapi.IsAsync(false), ErrPlanNotAllowedForOrg
+		}
+		// A plan change applies the settings of the new plan.
+		planSettings = plan
+	}
+	settings := dbsettings.Merge(planSettings, updateParameters, brokerParameters)
+
+	// A new name is subject to the same template as on provisioning.
+	if _, ok := updateParameters["name"]; ok {
+		settings["name"], _ = b.readDatabaseName(instanceID, brokerapi.ProvisionDetails{
+			OrganizationGUID: stored.OrganizationGUID,
+			SpaceGUID:        stored.SpaceGUID,
+		}, updateParameters)
 	}
 
-	// Record additional parameters.
-	for param, value := range updateDetails.Parameters {
-		params[param] = castValue(value)
+	instance := persisters.ServiceInstance{
+		ID:         instanceID,
+		PlanID:     planID,
+		Parameters: updateParameters,
 	}
+	isAsync := false
+	err = b.Workers.Do(instanceID, func() error {
+		var err error
+		isAsync, err = b.InstanceManager.Update(instance, settings, asyncAllowed, b.StatePersister)
+		if err != nil || !rotatePassword {
+			return err
+		}
 
-	return brokerapi.IsAsync(false), b.InstanceManager.Update(instanceID, params, b.StatePersister)
+		password, err := b.generatePassword()
+		if err != nil {
+			b.Logger.Error("Failed to generate a password", err)
+			return err
+		}
+		if err := b.InstanceManager.RotatePassword(instanceID, password, b.StatePersister); err != nil {
+			return err
+		}
+		audit.Emit(audit.CredentialsRotated, map[string]string{
+			"msg":      "database password rotated",
+			"cs2Label": "instanceId",
+			"cs2":      instanceID,
+		})
+		return nil
+	})
+	if err != nil {
+		b.publishFailure("update", stored, "", err)
+	} else {
+		b.publish(events.InstanceUpdated, b.storedInstance(instanceID), "")
+	}
+	return brokerapi.IsAsync(isAsync), err
 }
 
 func (b *serviceBroker) Deprovision(instanceID string, details brokerapi.DeprovisionDetails, asyncAllowed bool) (brokerapi.IsAsync, error) {
-	return false, b.InstanceManager.Destroy(instanceID, b.StatePersister)
+	var stored persisters.ServiceInstance
+	err := b.Workers.Do(instanceID, func() error {
+		stored = b.storedInstance(instanceID)
+		if protected, _ := stored.Parameters["deletion_protection"].(bool); protected {
+			return ErrDeletionProtected
+		}
+		if b.Config.ServiceBroker.RejectDeprovisionWithBindings {
+			state, _, err := b.StatePersister.Load()
+			if err != nil {
+				return err
+			}
+			if len(state.InstanceBindings(instanceID)) > 0 {
+				return ErrInstanceHasBindings
+			}
+		}
+		if stored.ID != "" {
+			if err := b.Hooks.Before(hookEvent(hooks.Deprovision, stored)); err != nil {
+				b.Logger.Error("A hook rejected the deprovisioning", err, lager.Data{"instance-id": instanceID})
+				return brokererrors.NewUnprocessableEntity("", err.Error())
+			}
+		}
+		if retain, _ := stored.Parameters["retain_database"].(bool); retain {
+			return b.InstanceManager.Detach(instanceID, b.StatePersister)
+		}
+		return b.InstanceManager.Destroy(instanceID, b.StatePersister)
+	})
+	if err != nil {
+		b.publishFailure("deprovision", stored, "", err)
+	} else if stored.ID != "" {
+		b.Hooks.After(hookEvent(hooks.Deprovision, stored))
+		b.publish(events.InstanceDeleted, stored, "")
+	}
+	return false, err
 }
 
 func (b *serviceBroker) Bind(instanceID, bindingID string, details brokerapi.BindDetails) (brokerapi.Binding, error) {
+	binding, _, err := b.BindOrGet(instanceID, bindingID, details)
+	return binding, err
+}
+
+// BindOrGet is Bind telling whether the binding existed already with the
+// same details, in which case the binding is not published again.
+func (b *serviceBroker) BindOrGet(instanceID, bindingID string, details brokerapi.BindDetails) (brokerapi.Binding, bool, error) {
 	b.Logger.Info("Looking for the service credentials", lager.Data{
 		"instance-id": instanceID,
 		"binding-id":  bindingID,
 		"details":     details,
 	})
-	creds, err := b.InstanceBinder.Bind(instanceID, bindingID, b.StatePersister)
-	return brokerapi.Binding{Credentials: creds}, err
+	planID := b.storedInstance(instanceID).PlanID
+	if planID == "" {
+		planID = details.PlanID
+	}
+	if !b.planBindable(planID) {
+		return brokerapi.Binding{}, false, ErrPlanNotBindable
+	}
+	// Bindings to instances shared from another space may only name the
+	// app in the bind resource.
+	appGUID := details.AppGUID
+	if appGUID == "" && details.BindResource != nil {
+		appGUID = details.BindResource.AppGuid
+	}
+	creds, existed, err := b.InstanceBinder.Bind(instanceID, bindingID, appGUID, details.Parameters, b.StatePersister)
+	if err != nil {
+		b.publishFailure("bind", b.storedInstance(instanceID), bindingID, err)
+	} else if !existed {
+		b.publish(events.BindingCreated, b.storedInstance(instanceID), bindingID)
+	}
+	return brokerapi.Binding{Credentials: creds}, existed, err
 }
 
-// Redis Labs cluster does not support multitenancy within a single
-// database. Therefore, the only goal of unbinding is to remove
-// credentials from the application environment. Unbind exists as a part
-// of the brokerapi.ServiceBroker interface and does not have to do
-// any specific job in this context.
+// Bindings share the database credentials unless they were created with
+// the read-only role. Therefore, the only job of unbinding is to remove
+// the users of read-only bindings.
 func (b *serviceBroker) Unbind(instanceID, bindingID string, details brokerapi.UnbindDetails) error {
-	return nil
+	err := b.InstanceBinder.Unbind(instanceID, bindingID, b.StatePersister)
+	if err != nil {
+		b.publishFailure("unbind", b.storedInstance(instanceID), bindingID, err)
+	} else {
+		b.publish(events.BindingDeleted, b.storedInstance(instanceID), bindingID)
+	}
+	return err
 }
 
+// LastOperation publishes the failures of asynchronous operations, as
+// reported to the platform. The platform stops polling once an operation
+// failed.
 func (b *serviceBroker) LastOperation(instanceID string) (brokerapi.LastOperation, error) {
-	return brokerapi.LastOperation{}, nil
+	operation, err := b.InstanceManager.LastOperation(instanceID, b.StatePersister)
+	if err == nil && operation.State == brokerapi.Failed {
+		// Instances are only recorded once their database was created.
+		stored, name := b.storedInstance(instanceID), "update"
+		if stored.ID == "" {
+			stored.ID, name = instanceID, "provision"
+		}
+		b.publishFailure(name, stored, "", errors.New(operation.Description))
+	}
+	return operation, err
 }
 
-func (b *serviceBroker) planDescriptions() map[string]*brokerapi.ServicePlan {
-	plansByID := map[string]*brokerapi.ServicePlan{}
+// planSettings returns the settings of the databases of every plan by plan
+// ID. The plans are mapped once, when they are first needed.
+func (b *serviceBroker) planSettings() map[string]map[string]interface{} {
+	if b.settingsByPlanID == nil {
+		b.settingsByPlanID = dbsettings.ForPlans(b.Config.ServiceBroker.Plans)
+	}
+	return b.settingsByPlanID
+}
+
+// parameterRanges narrows the ranges of the parameters to the ones
+// the plan allows.
+func (b *serviceBroker) parameterRanges(planID string) map[string]params.Range {
 	for _, plan := range b.Config.ServiceBroker.Plans {
-		plansByID[plan.ID] = &brokerapi.ServicePlan{
-			ID:          plan.ID,
-			Name:        plan.Name,
-			Description: plan.Description,
-			Metadata: &brokerapi.ServicePlanMetadata{
-				Bullets: plan.Metadata.Bullets,
-			},
+		if plan.ID == planID {
+			return map[string]params.Range{
+				"memory_size": {
+					Min: plan.ServiceInstanceConfig.MinMemoryLimit,
+					Max: plan.ServiceInstanceConfig.MaxMemoryLimit,
+				},
+				"port": {
+					Min: int64(plan.ServiceInstanceConfig.PortRange.Min),
+					Max: int64(plan.ServiceInstanceConfig.PortRange.Max),
+				},
+				"max_connections": {
+					Max: plan.ServiceInstanceConfig.MaxConnections,
+				},
+			}
 		}
 	}
-	return plansByID
+	return nil
 }
 
-func (b *serviceBroker) planSettings() map[string]map[string]interface{} {
-	settingsByID := map[string]map[string]interface{}{}
+// allowedParameters returns the parameters developers may set on
+// instances of the plan, nil if all are allowed.
+func (b *serviceBroker) allowedParameters(planID string) []string {
 	for _, plan := range b.Config.ServiceBroker.Plans {
-		config := plan.ServiceInstanceConfig
-		settings := map[string]interface{}{
-			"memory_size":        config.MemoryLimit,
-			"replication":        config.Replication,
-			"shards_count":       config.ShardCount,
-			"sharding":           config.ShardCount > 1,
-			"implicit_shard_key": config.ShardCount > 1,
-			"data_persistence":   config.Persistence,
+		if plan.ID == planID {
+			return plan.AllowedParameters
 		}
-		if config.ShardCount > 1 {
-			settings["shard_key_regex"] = []map[string]string{
-				{"regex": `.*\{(?<tag>.*)\}.*`},
-				{"regex": `(?<tag>.*)`},
-			}
-		}
-		if config.Persistence == "snapshot" {
-			settings["snapshot_policy"] = []map[string]int{{
-				"writes": config.Snapshot.Writes,
-				"secs":   config.Snapshot.Secs,
-			}}
+	}
+	return nil
+}
+
+// planListsParameter tells whether the allowed_parameters of the plan
+// list the parameter explicitly.
+func (b *serviceBroker) planListsParameter(planID string, name string) bool {
+	for _, allowed := range b.allowedParameters(planID) {
+		if allowed == name {
+			return true
 		}
-		settingsByID[plan.ID] = settings
 	}
-	return settingsByID
+	return false
 }
 
-func (b *serviceBroker) readDatabaseName(instanceID string, params map[string]interface{}) (string, error) {
+// provisioned runs the post hooks of an instance whose database was
+// created and publishes it.
+func (b *serviceBroker) provisioned(instance persisters.ServiceInstance) {
+	b.Hooks.After(hookEvent(hooks.Provision, instance))
+	b.publish(events.InstanceCreated, instance, "")
+}
+
+// hookEvent describes an instance to the hooks.
+func hookEvent(action string, instance persisters.ServiceInstance) hooks.Event {
+	return hooks.Event{
+		Action:           action,
+		InstanceID:       instance.ID,
+		PlanID:           instance.PlanID,
+		ServiceID:        instance.ServiceID,
+		OrganizationGUID: instance.OrganizationGUID,
+		SpaceGUID:        instance.SpaceGUID,
+		DatabaseUID:      instance.Credentials.UID,
+	}
+}
+
+// publish sends an event about an instance or one of its bindings.
+func (b *serviceBroker) publish(eventType string, instance persisters.ServiceInstance, bindingID string) {
+	b.Events.Publish(events.Event{
+		Type:             eventType,
+		InstanceID:       instance.ID,
+		BindingID:        bindingID,
+		PlanID:           instance.PlanID,
+		OrganizationGUID: instance.OrganizationGUID,
+		SpaceGUID:        instance.SpaceGUID,
+		DatabaseUID:      instance.Credentials.UID,
+	})
+}
+
+// publishFailure sends an event about an operation that failed, unless
+// the request was rejected.
+func (b *serviceBroker) publishFailure(operation string, instance persisters.ServiceInstance, bindingID string, err error) {
+	if _, rejected := err.(*brokererrors.Error); rejected || rejections[err] {
+		return
+	}
+	b.Events.Publish(events.Event{
+		Type:             events.OperationFailed,
+		InstanceID:       instance.ID,
+		BindingID:        bindingID,
+		PlanID:           instance.PlanID,
+		OrganizationGUID: instance.OrganizationGUID,
+		SpaceGUID:        instance.SpaceGUID,
+		DatabaseUID:      instance.Credentials.UID,
+		Operation:        operation,
+		Error:            err.Error(),
+	})
+}
+
+// storedInstance returns the instance recorded in the state, or an empty
+// instance if there is none.
+func (b *serviceBroker) storedInstance(instanceID string) persisters.ServiceInstance {
+	instance, err := b.InstanceManager.Get(instanceID, b.StatePersister)
+	if err != nil {
+		return persisters.ServiceInstance{}
+	}
+	return instance
+}
+
+func (b *serviceBroker) readDatabaseName(instanceID string, details brokerapi.ProvisionDetails, params map[string]interface{}) (string, error) {
 	var nameParam interface{}
 
 	nameParam, ok := params["name"]
@@ -238,7 +563,22 @@ func (b *serviceBroker) readDatabaseName(instanceID string, params map[string]in
 		nameParam = "cf"
 	}
 
-	name := fmt.Sprintf("%s-%s", nameParam, instanceID)
+	template := b.Config.ServiceBroker.DatabaseNameTemplate
+	if template == "" {
+		template = DefaultDatabaseNameTemplate
+	}
+	shortID := instanceID
+	if len(shortID) > 8 {
+		shortID = shortID[:8]
+	}
+	name := strings.NewReplacer(
+		"{name}", fmt.Sprintf("%s", nameParam),
+		"{org}", details.OrganizationGUID,
+		"{space}", details.SpaceGUID,
+		"{instance_id}", instanceID,
+		"{instance_id_short}", shortID,
+	).Replace(template)
+
 	if len(name) > RedisDatabaseNameLength {
 		name = name[:RedisDatabaseNameLength]
 	}
@@ -246,30 +586,32 @@ func (b *serviceBroker) readDatabaseName(instanceID string, params map[string]in
 	return name, nil
 }
 
-func castValue(value interface{}) interface{} {
-	switch v := value.(type) {
-	case string:
-		// try int
-		intValue, err := strconv.ParseInt(v, 10, 32)
-		if err == nil {
-			return intValue
-		}
-
-		// try float
-		floatValue, err := strconv.ParseFloat(v, 64)
-		if err == nil {
-			return floatValue
+// cfContextTags describes where a database belongs in Cloud Foundry,
+// so that cluster admins can attribute it to an org and a space.
+func cfContextTags(instanceID string, details brokerapi.ProvisionDetails) []map[string]string {
+	tags := []map[string]string{}
+	for _, tag := range []struct{ key, value string }{
+		{"cf_instance_id", instanceID},
+		{"cf_organization_guid", details.OrganizationGUID},
+		{"cf_space_guid", details.SpaceGUID},
+		{"cf_plan_id", details.PlanID},
+	} {
+		if tag.value != "" {
+			tags = append(tags, map[string]string{"key": tag.key, "value": tag.value})
 		}
+	}
+	return tags
+}
 
-		// try bool
-		boolVal, err := strconv.ParseBool(v)
-		if err == nil {
-			return boolVal
-		}
-	case float64:
-		if (v - math.Ceil(v)) == 0 {
-			return int64(v)
-		}
+// generatePassword returns a database password following the configured
+// policy.
+func (b *serviceBroker) generatePassword() (string, error) {
+	policy := passwords.Policy{
+		Length:  b.Config.ServiceBroker.PasswordPolicy.Length,
+		Classes: b.Config.ServiceBroker.PasswordPolicy.CharacterClasses,
+	}
+	if policy.Length == 0 {
+		policy.Length = RedisPasswordLength
 	}
-	return value
+	return policy.Generate()
 }
@@ -2,14 +2,22 @@ package redislabs_test
 
 import (
 	"encoding/json"
+	"errors"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/RedisLabs/cf-redislabs-broker/redislabs"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/api"
 	"github.com/RedisLabs/cf-redislabs-broker/redislabs/cluster"
 	brokerconfig "github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/events"
 	"github.com/RedisLabs/cf-redislabs-broker/redislabs/instancebinders"
 	"github.com/RedisLabs/cf-redislabs-broker/redislabs/instancemanagers"
 	"github.com/RedisLabs/cf-redislabs-broker/redislabs/persisters"
@@ -123,13 +131,20 @@ var _ = Describe("Broker", func() {
 
 			Context("Valid settings", func() {
 				var (
-					tmpStateDir string
-					proxy       testing.HTTPProxy
-					err         error
-					settings    map[string]interface{}
+					tmpStateDir    string
+					proxy          testing.HTTPProxy
+					err            error
+					settings       map[string]interface{}
+					databaseStatus string
+					deletedPaths   []string
+					takenNames     []string
 				)
 
 				BeforeEach(func() {
+					settings = nil
+					databaseStatus = "active"
+					deletedPaths = []string{}
+					takenNames = []string{}
 					details = brokerapi.ProvisionDetails{
 						ServiceID:        serviceID,
 						PlanID:           planID,
@@ -152,13 +167,35 @@ var _ = Describe("Broker", func() {
 								"uid":    1,
 								"status": "pending",
 							}
+						} else if r.Method == "DELETE" {
+							deletedPaths = append(deletedPaths, r.URL.Path)
+							databaseStatus = "deleted"
+							return nil
+						} else if r.URL.Path == "/v1/bdbs" {
+							databases := []map[string]interface{}{}
+							for i, name := range takenNames {
+								databases = append(databases, map[string]interface{}{
+									"uid":  i + 10,
+									"name": name,
+								})
+							}
+							return databases
 						} else {
+							if databaseStatus == "deleted" {
+								w.WriteHeader(404)
+								return map[string]interface{}{
+									"description": "db does not exist",
+								}
+							}
 							return map[string]interface{}{
-								"uid": 1,
+								"uid":                       1,
 								"authentication_redis_pass": "pass",
-								"endpoint_ip":               []string{"10.0.2.4"},
-								"dns_address_master":        "domain.com:11909",
-								"status":                    "active",
+								"endpoints": []map[string]interface{}{{
+									"dns_name": "domain.com",
+									"port":     11909,
+									"addr":     []string{"10.0.2.4"},
+								}},
+								"status": databaseStatus,
 							}
 						}
 					})
@@ -201,7 +238,7 @@ var _ = Describe("Broker", func() {
 					_, err := broker.Provision("some-id", details, false)
 					Expect(err).ToNot(HaveOccurred())
 
-					state, err := persister.Load()
+					state, _, err := persister.Load()
 					Expect(err).ToNot(HaveOccurred())
 					Expect(len(state.AvailableInstances)).To(Equal(1))
 					s := state.AvailableInstances[0]
@@ -215,12 +252,290 @@ var _ = Describe("Broker", func() {
 					}))
 				})
 
+				It("Creates the database asynchronously if allowed", func() {
+					spec, err := broker.Provision("some-id", details, true)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(spec.IsAsync).To(BeTrue())
+
+					Eventually(func() brokerapi.LastOperationState {
+						operation, err := broker.LastOperation("some-id")
+						Expect(err).ToNot(HaveOccurred())
+						return operation.State
+					}, 5).Should(Equal(brokerapi.Succeeded))
+
+					state, _, err := persister.Load()
+					Expect(err).ToNot(HaveOccurred())
+					Expect(state.AvailableInstances).To(HaveLen(1))
+					Expect(state.AvailableInstances[0].Credentials.Host).To(Equal("domain.com"))
+					Expect(state.Tasks).To(BeEmpty())
+				})
+
+				Context("And the database does not become active in time", func() {
+					var timeout int
+
+					BeforeEach(func() {
+						databaseStatus = "pending"
+						timeout = instancemanagers.WaitingForDatabaseTimeout
+						instancemanagers.WaitingForDatabaseTimeout = 1
+						config.ServiceBroker.AsyncCreationTimeout = 1
+					})
+
+					AfterEach(func() {
+						instancemanagers.WaitingForDatabaseTimeout = timeout
+						config.ServiceBroker.AsyncCreationTimeout = 0
+					})
+
+					It("Removes the orphaned database", func() {
+						_, err := broker.Provision("some-id", details, false)
+						Expect(err).To(Equal(instancemanagers.ErrCreateDatabaseTimeoutExpired))
+						Expect(deletedPaths).To(Equal([]string{"/v1/bdbs/1"}))
+
+						state, _, err := persister.Load()
+						Expect(err).ToNot(HaveOccurred())
+						Expect(state.AvailableInstances).To(BeEmpty())
+					})
+
+					It("Reports the failure of an asynchronous creation once", func() {
+						spec, err := broker.Provision("some-id", details, true)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(spec.IsAsync).To(BeTrue())
+
+						operation, err := broker.LastOperation("some-id")
+						Expect(err).ToNot(HaveOccurred())
+						Expect(operation.State).To(Equal(brokerapi.InProgress))
+
+						Eventually(func() brokerapi.LastOperationState {
+							operation, err := broker.LastOperation("some-id")
+							Expect(err).ToNot(HaveOccurred())
+							return operation.State
+						}, 5).Should(Equal(brokerapi.Failed))
+						Expect(deletedPaths).To(Equal([]string{"/v1/bdbs/1"}))
+
+						_, err = broker.LastOperation("some-id")
+						Expect(err).To(Equal(brokerapi.ErrInstanceDoesNotExist))
+					})
+
+					Context("And asynchronous creations may take longer", func() {
+						BeforeEach(func() {
+							config.ServiceBroker.AsyncCreationTimeout = 60
+						})
+
+						It("Keeps the database and reports the creation in progress", func() {
+							spec, err := broker.Provision("some-id", details, true)
+							Expect(err).ToNot(HaveOccurred())
+							Expect(spec.IsAsync).To(BeTrue())
+
+							Consistently(func() brokerapi.LastOperationState {
+								operation, err := broker.LastOperation("some-id")
+								Expect(err).ToNot(HaveOccurred())
+								return operation.State
+							}, 2).Should(Equal(brokerapi.InProgress))
+							Expect(deletedPaths).To(BeEmpty())
+
+							_, err = broker.Deprovision("some-id", brokerapi.DeprovisionDetails{}, true)
+							Expect(err).ToNot(HaveOccurred())
+						})
+					})
+
+					It("Rejects updates while the database is being created", func() {
+						_, err := broker.Provision("some-id", details, true)
+						Expect(err).ToNot(HaveOccurred())
+
+						_, err = broker.Update("some-id", brokerapi.UpdateDetails{
+							ServiceID:  serviceID,
+							Parameters: map[string]interface{}{"memory_size": 2048},
+						}, true)
+						Expect(err).To(Equal(instancemanagers.ErrOperationInProgress))
+
+						Eventually(func() brokerapi.LastOperationState {
+							operation, _ := broker.LastOperation("some-id")
+							return operation.State
+						}, 5).Should(Equal(brokerapi.Failed))
+					})
+				})
+
+				Context("And the broker state cannot be saved", func() {
+					JustBeforeEach(func() {
+						broker = redislabs.NewServiceBroker(
+							instancemanagers.NewDefault(config, logger),
+							instancebinders.NewDefault(config, logger),
+							failingPersister{persister},
+							config,
+							logger,
+						)
+					})
+
+					It("Removes the orphaned database", func() {
+						_, err := broker.Provision("some-id", details, false)
+						Expect(err).To(Equal(instancemanagers.ErrFailedToSaveState))
+						Expect(deletedPaths).To(Equal([]string{"/v1/bdbs/1"}))
+					})
+				})
+
+				Context("And a database name template", func() {
+					BeforeEach(func() {
+						config.ServiceBroker.DatabaseNameTemplate = "cf-{org}-{space}-{instance_id_short}"
+						details.OrganizationGUID = "org"
+						details.SpaceGUID = "space"
+					})
+
+					It("Names the database accordingly", func() {
+						_, err := broker.Provision("0123456789abcdef", details, false)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(settings["name"]).To(Equal("cf-org-space-01234567"))
+					})
+
+					It("Appends a suffix when the name is taken", func() {
+						takenNames = []string{"cf-org-space-01234567", "cf-org-space-01234567-2"}
+						_, err := broker.Provision("0123456789abcdef", details, false)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(settings["name"]).To(Equal("cf-org-space-01234567-3"))
+					})
+				})
+
+				Context("And provisioning hooks are configured", func() {
+					var rejecting bool
+					BeforeEach(func() {
+						rejecting = false
+						details.OrganizationGUID = "org"
+						config.ServiceBroker.Hooks = []brokerconfig.HookConfig{
+							{Name: "approval", Command: "/bin/sh", Args: []string{"-c", "test ! -e " + tmpStateDir + "/reject || (echo not approved; exit 1)"}, Phase: "pre"},
+							{Name: "cmdb", Command: "/bin/sh", Args: []string{"-c", "cat > " + tmpStateDir + "/event.json"}, Phase: "post"},
+						}
+					})
+					JustBeforeEach(func() {
+						if rejecting {
+							Expect(ioutil.WriteFile(path.Join(tmpStateDir, "reject"), nil, 0644)).To(Succeed())
+						}
+					})
+					AfterEach(func() {
+						config.ServiceBroker.Hooks = nil
+					})
+
+					It("Passes the created instance to the post hooks", func() {
+						_, err := broker.Provision("some-id", details, false)
+						Expect(err).ToNot(HaveOccurred())
+
+						var event map[string]interface{}
+						contents, err := ioutil.ReadFile(path.Join(tmpStateDir, "event.json"))
+						Expect(err).ToNot(HaveOccurred())
+						Expect(json.Unmarshal(contents, &event)).To(Succeed())
+						Expect(event).To(HaveKeyWithValue("action", "provision"))
+						Expect(event).To(HaveKeyWithValue("instance_id", "some-id"))
+						Expect(event).To(HaveKeyWithValue("organization_guid", "org"))
+						Expect(event).To(HaveKeyWithValue("database_uid", BeEquivalentTo(1)))
+					})
+
+					It("Runs the post hooks once an asynchronous creation is done", func() {
+						spec, err := broker.Provision("some-id", details, true)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(spec.IsAsync).To(BeTrue())
+
+						event := map[string]interface{}{}
+						Eventually(func() map[string]interface{} {
+							contents, _ := ioutil.ReadFile(path.Join(tmpStateDir, "event.json"))
+							json.Unmarshal(contents, &event)
+							return event
+						}, 5).Should(HaveKey("database_uid"))
+						Expect(event).To(HaveKeyWithValue("instance_id", "some-id"))
+						Expect(event).To(HaveKeyWithValue("organization_guid", "org"))
+						Expect(event).To(HaveKeyWithValue("database_uid", BeEquivalentTo(1)))
+					})
+
+					Context("And a pre hook fails", func() {
+						BeforeEach(func() {
+							rejecting = true
+						})
+
+						It("Rejects the provisioning with the output of the hook", func() {
+							_, err := broker.Provision("some-id", details, false)
+							Expect(err).To(MatchError("hook approval failed: not approved"))
+							Expect(settings).To(BeNil())
+							Expect(path.Join(tmpStateDir, "event.json")).NotTo(BeAnExistingFile())
+						})
+					})
+				})
+
+				Context("And a webhook is configured", func() {
+					var receiver *webhookReceiver
+					BeforeEach(func() {
+						receiver = newWebhookReceiver()
+						config.ServiceBroker.Webhooks = []brokerconfig.WebhookConfig{{URL: receiver.URL, Secret: "secret"}}
+					})
+					AfterEach(func() {
+						receiver.Close()
+						config.ServiceBroker.Webhooks = nil
+					})
+
+					It("Publishes the created instance", func() {
+						details.OrganizationGUID = "org"
+						_, err := broker.Provision("some-id", details, false)
+						Expect(err).ToNot(HaveOccurred())
+						Eventually(receiver.received).Should(ConsistOf(SatisfyAll(
+							HaveKeyWithValue("type", "instance.created"),
+							HaveKeyWithValue("instance_id", "some-id"),
+							HaveKeyWithValue("organization_guid", "org"),
+							HaveKeyWithValue("database_uid", BeEquivalentTo(1)),
+						)))
+					})
+
+					It("Publishes an asynchronously created instance once its database is active", func() {
+						details.OrganizationGUID = "org"
+						spec, err := broker.Provision("some-id", details, true)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(spec.IsAsync).To(BeTrue())
+						Eventually(receiver.received, 5).Should(ConsistOf(SatisfyAll(
+							HaveKeyWithValue("type", "instance.created"),
+							HaveKeyWithValue("instance_id", "some-id"),
+							HaveKeyWithValue("organization_guid", "org"),
+							HaveKeyWithValue("database_uid", BeEquivalentTo(1)),
+						)))
+					})
+
+					It("Does not publish rejected requests", func() {
+						broker.Provision("some-id", details, false)
+						_, err := broker.Provision("some-id", details, false)
+						Expect(err).To(HaveOccurred())
+						Eventually(receiver.received).Should(HaveLen(1))
+						Consistently(receiver.received, 0.2).Should(HaveLen(1))
+					})
+				})
+
+				Context("And CF context tags are enabled", func() {
+					BeforeEach(func() {
+						config.ServiceBroker.CFContextTags = true
+						details.OrganizationGUID = "org-guid"
+						details.SpaceGUID = "space-guid"
+					})
+
+					It("Tags the database with the org and the space", func() {
+						_, err := broker.Provision("some-id", details, false)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(settings["tags"]).To(ConsistOf(
+							map[string]interface{}{"key": "cf_instance_id", "value": "some-id"},
+							map[string]interface{}{"key": "cf_organization_guid", "value": "org-guid"},
+							map[string]interface{}{"key": "cf_space_guid", "value": "space-guid"},
+							map[string]interface{}{"key": "cf_plan_id", "value": planID},
+						))
+					})
+				})
+
 				Context("When optional attributues given", func() {
 					Context("name", func() {
 						It("works", func() {
 							details.RawParameters = []byte(`{"name": "mydb"}`)
 							_, err := broker.Provision("some-id", details, false)
 							Expect(err).ToNot(HaveOccurred())
+							Expect(settings["name"]).To(Equal("mydb-some-id"))
+						})
+					})
+
+					Context("source_ips", func() {
+						It("restricts the networks that may connect", func() {
+							details.RawParameters = []byte(`{"source_ips": ["10.0.0.0/16"]}`)
+							_, err := broker.Provision("some-id", details, false)
+							Expect(err).ToNot(HaveOccurred())
+							Expect(settings["source_ips"]).To(Equal([]interface{}{"10.0.0.0/16"}))
 						})
 					})
 
@@ -235,8 +550,73 @@ var _ = Describe("Broker", func() {
 							details.RawParameters = []byte(`{"memory_size": "1024"}`)
 							_, err := broker.Provision("some-id", details, false)
 							Expect(err).ToNot(HaveOccurred())
+							Expect(settings["memory_size"]).To(Equal(float64(1024)))
+						})
+
+						Context("when the plan bounds it", func() {
+							BeforeEach(func() {
+								config.ServiceBroker.Plans[0].ServiceInstanceConfig.MaxMemoryLimit = 2048
+							})
+							It("is rejected outside of the bounds", func() {
+								details.RawParameters = []byte(`{"memory_size": 4096}`)
+								_, err := broker.Provision("some-id", details, false)
+								Expect(err).To(MatchError(ContainSubstring(`parameter "memory_size" must be at most 2048`)))
+								Expect(settings).To(BeNil())
+							})
 						})
 					})
+
+					Context("max_connections", func() {
+						It("limits the connections", func() {
+							details.RawParameters = []byte(`{"max_connections": 100}`)
+							_, err := broker.Provision("some-id", details, false)
+							Expect(err).ToNot(HaveOccurred())
+							Expect(settings["max_connections"]).To(Equal(float64(100)))
+						})
+
+						Context("when the plan limits the connections", func() {
+							BeforeEach(func() {
+								config.ServiceBroker.Plans[0].ServiceInstanceConfig.MaxConnections = 500
+							})
+							It("applies the limit of the plan", func() {
+								_, err := broker.Provision("some-id", details, false)
+								Expect(err).ToNot(HaveOccurred())
+								Expect(settings["max_connections"]).To(Equal(float64(500)))
+							})
+							It("rejects a higher limit", func() {
+								details.RawParameters = []byte(`{"max_connections": 1000}`)
+								_, err := broker.Provision("some-id", details, false)
+								Expect(err).To(MatchError(ContainSubstring(`parameter "max_connections" must be at most 500`)))
+								Expect(settings).To(BeNil())
+							})
+						})
+					})
+
+					Context("unknown parameters", func() {
+						It("are rejected before reaching the cluster", func() {
+							details.RawParameters = []byte(`{"memory": 1024, "replication": "maybe"}`)
+							_, err := broker.Provision("some-id", details, false)
+							Expect(err).To(MatchError(`invalid parameters: unknown parameter "memory"; parameter "replication" must be true or false`))
+							Expect(settings).To(BeNil())
+						})
+					})
+				})
+
+				Context("And the plan is restricted to some organizations", func() {
+					BeforeEach(func() {
+						config.ServiceBroker.Plans[0].AllowedOrgs = []string{"allowed-org"}
+					})
+					It("Provisions instances for them", func() {
+						details.OrganizationGUID = "allowed-org"
+						_, err := broker.Provision("some-id", details, false)
+						Expect(err).NotTo(HaveOccurred())
+					})
+					It("Rejects other organizations", func() {
+						details.OrganizationGUID = "other-org"
+						_, err := broker.Provision("some-id", details, false)
+						Expect(err).To(Equal(redislabs.ErrPlanNotAllowedForOrg))
+						Expect(settings).To(BeNil())
+					})
 				})
 
 				Context("And when requested for more than one shard", func() {
@@ -265,13 +645,168 @@ var _ = Describe("Broker", func() {
 					})
 				})
 
+				Context("And when requested for rack awareness", func() {
+					BeforeEach(func() {
+						config.ServiceBroker.Plans[0].ServiceInstanceConfig = brokerconfig.ServiceInstanceConfig{
+							Replication:     true,
+							RackAware:       true,
+							ShardsPlacement: "sparse",
+						}
+					})
+					It("Places the shards accordingly", func() {
+						_, err := broker.Provision("some-id", details, false)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(settings["rack_aware"]).To(Equal(true))
+						Expect(settings["shards_placement"]).To(Equal("sparse"))
+					})
+				})
+
+				Context("And when the plan is pinned to some nodes", func() {
+					BeforeEach(func() {
+						config.ServiceBroker.Plans[0].ServiceInstanceConfig = brokerconfig.ServiceInstanceConfig{
+							MemoryLimit: 1024,
+							Nodes:       []int64{1, 2},
+						}
+						proxy.RegisterEndpoints([]testing.Endpoint{{
+							URL:      "/v1/nodes",
+							Response: []map[string]interface{}{{"uid": 1}, {"uid": 2}, {"uid": 3}},
+						}})
+					})
+					It("Avoids the other nodes", func() {
+						_, err := broker.Provision("some-id", details, false)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(settings).NotTo(HaveKey("nodes"))
+						Expect(settings["avoid_nodes"]).To(Equal([]interface{}{"3"}))
+					})
+					It("Lets developers pick the nodes", func() {
+						details.RawParameters = []byte(`{"nodes": [3]}`)
+						_, err := broker.Provision("some-id", details, false)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(settings["avoid_nodes"]).To(Equal([]interface{}{"1", "2"}))
+					})
+					It("Rejects nodes that are not part of the cluster", func() {
+						details.RawParameters = []byte(`{"nodes": [4]}`)
+						_, err := broker.Provision("some-id", details, false)
+						Expect(err).To(MatchError(ContainSubstring("node 4 is not part of the cluster")))
+					})
+				})
+
+				Context("And when the plan has an ACL", func() {
+					BeforeEach(func() {
+						config.ServiceBroker.Plans[0].ACL = brokerconfig.PlanACLConfig{Role: "cf-app", Rules: "+@all -flushall ~*"}
+						proxy.RegisterEndpoints([]testing.Endpoint{
+							{URL: "/v1/redis_acls", Response: []map[string]interface{}{{"uid": 5, "name": "cf-app"}}},
+						})
+					})
+					AfterEach(func() {
+						config.ServiceBroker.Plans[0].ACL = brokerconfig.PlanACLConfig{}
+					})
+					It("Disables the unrestricted default user of the database", func() {
+						_, err := broker.Provision("some-id", details, false)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(settings["default_user"]).To(Equal(false))
+						Expect(settings).NotTo(HaveKey("roles_permissions"))
+					})
+				})
+
+				Context("And when the plan has a port range", func() {
+					BeforeEach(func() {
+						config.ServiceBroker.Plans[0].ServiceInstanceConfig = brokerconfig.ServiceInstanceConfig{
+							MemoryLimit: 1024,
+							PortRange:   brokerconfig.PortRange{Min: 12000, Max: 12001},
+						}
+						proxy.RegisterEndpointHandler("/v1/bdbs", func(w http.ResponseWriter, r *http.Request) interface{} {
+							if r.Method == "POST" {
+								json.NewDecoder(r.Body).Decode(&settings)
+								return map[string]interface{}{"uid": 1, "status": "pending"}
+							}
+							return []map[string]interface{}{{
+								"uid":       10,
+								"name":      "taken",
+								"endpoints": []map[string]interface{}{{"port": 12000}},
+							}}
+						})
+					})
+					It("Picks a free port of the range", func() {
+						_, err := broker.Provision("some-id", details, false)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(settings["port"]).To(Equal(float64(12001)))
+					})
+					It("Rejects ports out of the range", func() {
+						details.RawParameters = []byte(`{"port": 13000}`)
+						_, err := broker.Provision("some-id", details, false)
+						Expect(err).To(MatchError(ContainSubstring(`parameter "port" must be at most 12001`)))
+					})
+				})
+
+				Context("And when the plan has a static port", func() {
+					BeforeEach(func() {
+						config.ServiceBroker.Plans[0].ServiceInstanceConfig = brokerconfig.ServiceInstanceConfig{
+							MemoryLimit: 1024,
+							Port:        12345,
+						}
+					})
+					It("Requests the port", func() {
+						_, err := broker.Provision("some-id", details, false)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(settings["port"]).To(Equal(float64(12345)))
+					})
+				})
+
+				It("Rejects rotating the password of a new database", func() {
+					details.RawParameters = []byte(`{"rotate_password": true}`)
+					_, err := broker.Provision("some-id", details, false)
+					Expect(err).To(Equal(redislabs.ErrRotateOnProvision))
+					Expect(settings).NotTo(HaveKey("rotate_password"))
+				})
+
+				Context("And when a database UID is requested", func() {
+					BeforeEach(func() {
+						details.RawParameters = []byte(`{"uid": 42}`)
+					})
+					AfterEach(func() {
+						config.ServiceBroker.Plans[0].AllowedParameters = nil
+					})
+					It("Rejects it unless the plan lists it", func() {
+						_, err := broker.Provision("some-id", details, false)
+						Expect(err).To(Equal(redislabs.ErrUIDNotAllowed))
+					})
+					Context("And the plan lists it", func() {
+						BeforeEach(func() {
+							config.ServiceBroker.Plans[0].AllowedParameters = []string{"uid"}
+						})
+						It("Requests the UID", func() {
+							_, err := broker.Provision("some-id", details, false)
+							Expect(err).NotTo(HaveOccurred())
+							Expect(settings["uid"]).To(Equal(float64(42)))
+						})
+					})
+				})
+
+				Context("And when a password policy is configured", func() {
+					BeforeEach(func() {
+						config.ServiceBroker.PasswordPolicy = brokerconfig.PasswordPolicyConfig{
+							Length:           20,
+							CharacterClasses: []string{"lowercase", "digits"},
+						}
+					})
+					AfterEach(func() {
+						config.ServiceBroker.PasswordPolicy = brokerconfig.PasswordPolicyConfig{}
+					})
+					It("Generates the database password accordingly", func() {
+						_, err := broker.Provision("some-id", details, false)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(settings["authentication_redis_pass"]).To(MatchRegexp(`^[a-z0-9]{20}$`))
+					})
+				})
+
 				Context("And when requested for snapshots", func() {
 					BeforeEach(func() {
 						config.ServiceBroker.Plans[0].ServiceInstanceConfig = brokerconfig.ServiceInstanceConfig{
 							Persistence: "snapshot",
-							Snapshot: brokerconfig.Snapshot{
-								Writes: 10,
-								Secs:   12,
+							Snapshot: brokerconfig.SnapshotPolicy{
+								{Writes: 10, Secs: 12},
+								{Writes: 1, Secs: 3600},
 							},
 						}
 					})
@@ -281,10 +816,13 @@ var _ = Describe("Broker", func() {
 						Expect(settings).To(HaveKey("data_persistence"))
 						Expect(settings["data_persistence"]).To(Equal("snapshot"))
 						Expect(settings).To(HaveKey("snapshot_policy"))
-						Expect(len(settings["snapshot_policy"].([]interface{}))).To(Equal(1))
+						Expect(len(settings["snapshot_policy"].([]interface{}))).To(Equal(2))
 						policy := settings["snapshot_policy"].([]interface{})[0].(map[string]interface{})
 						Expect(policy["writes"]).To(BeEquivalentTo(10))
 						Expect(policy["secs"]).To(BeEquivalentTo(12))
+						policy = settings["snapshot_policy"].([]interface{})[1].(map[string]interface{})
+						Expect(policy["writes"]).To(BeEquivalentTo(1))
+						Expect(policy["secs"]).To(BeEquivalentTo(3600))
 					})
 				})
 			})
@@ -327,6 +865,7 @@ var _ = Describe("Broker", func() {
 							ID: "test-instance",
 							Credentials: cluster.InstanceCredentials{
 								UID:      1,
+								Name:     "test-db",
 								Host:     "example.com",
 								Port:     11909,
 								IPList:   []string{"10.0.2.5"},
@@ -335,22 +874,515 @@ var _ = Describe("Broker", func() {
 						},
 					},
 				}
-				if err = persister.Save(state); err != nil {
+				if _, err = persister.Save(state, persisters.AnyRevision); err != nil {
 					panic(err)
 				}
 			})
-			AfterEach(func() {
-				os.RemoveAll(tmpStateDir)
+			AfterEach(func() {
+				os.RemoveAll(tmpStateDir)
+			})
+			It("Successfully retrieves the credentials", func() {
+				brokerapiBinding, err := broker.Bind("test-instance", "test-binding", details)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(brokerapiBinding.Credentials).To(Equal(map[string]interface{}{
+					"host":     "example.com",
+					"port":     11909,
+					"ip_list":  []string{"10.0.2.5"},
+					"password": "pass",
+					"name":     "test-db",
+					"uri":      "redis://:pass@example.com:11909",
+				}))
+			})
+			Context("And its database has been removed from the cluster", func() {
+				var proxy testing.HTTPProxy
+				BeforeEach(func() {
+					proxy = testing.NewHTTPProxy()
+					proxy.RegisterEndpointHandler("/v1/bdbs/1", func(w http.ResponseWriter, r *http.Request) interface{} {
+						w.WriteHeader(404)
+						return map[string]interface{}{"description": "db does not exist"}
+					})
+					config.Cluster.Address = proxy.URL()
+				})
+				AfterEach(func() {
+					proxy.Close()
+				})
+				It("Rejects to bind it", func() {
+					_, err := broker.Bind("test-instance", "test-binding", details)
+					Expect(err).To(Equal(instancebinders.ErrDatabaseNotFound))
+
+					state, _, err := persister.Load()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(state.Bindings).To(BeEmpty())
+				})
+			})
+			Context("And the endpoints of its database have moved", func() {
+				var proxy testing.HTTPProxy
+				BeforeEach(func() {
+					proxy = testing.NewHTTPProxy()
+					proxy.RegisterEndpointHandler("/v1/bdbs/1", func(w http.ResponseWriter, r *http.Request) interface{} {
+						return map[string]interface{}{
+							"uid":                       1,
+							"name":                      "test-db",
+							"status":                    "active",
+							"authentication_redis_pass": "pass",
+							"endpoints": []map[string]interface{}{
+								{"dns_name": "moved.example.com", "port": 12000, "addr": []string{"10.0.3.7"}},
+							},
+						}
+					})
+					config.Cluster.Address = proxy.URL()
+				})
+				AfterEach(func() {
+					proxy.Close()
+					config.ServiceBroker.RefreshEndpointsOnBind = false
+				})
+				It("Returns the recorded endpoints by default", func() {
+					brokerapiBinding, err := broker.Bind("test-instance", "test-binding", details)
+					Expect(err).NotTo(HaveOccurred())
+					credentials := brokerapiBinding.Credentials.(map[string]interface{})
+					Expect(credentials["host"]).To(Equal("example.com"))
+				})
+				Context("And the broker refreshes the endpoints", func() {
+					BeforeEach(func() {
+						config.ServiceBroker.RefreshEndpointsOnBind = true
+					})
+					It("Returns and records the new endpoints", func() {
+						brokerapiBinding, err := broker.Bind("test-instance", "test-binding", details)
+						Expect(err).NotTo(HaveOccurred())
+						credentials := brokerapiBinding.Credentials.(map[string]interface{})
+						Expect(credentials["host"]).To(Equal("moved.example.com"))
+						Expect(credentials["port"]).To(Equal(12000))
+						Expect(credentials["uri"]).To(Equal("redis://:pass@moved.example.com:12000"))
+
+						state, _, err := persister.Load()
+						Expect(err).NotTo(HaveOccurred())
+						Expect(state.AvailableInstances[0].Credentials.Host).To(Equal("moved.example.com"))
+						Expect(state.AvailableInstances[0].Credentials.IPList).To(Equal([]string{"10.0.3.7"}))
+						Expect(state.AvailableInstances[0].Credentials.Password).To(Equal("pass"))
+					})
+				})
+			})
+			It("Records the app of a binding from another space", func() {
+				details.BindResource = &brokerapi.BindResource{AppGuid: "shared-app-guid"}
+				_, err := broker.Bind("test-instance", "test-binding", details)
+				Expect(err).NotTo(HaveOccurred())
+
+				state, _, err := persister.Load()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(state.Bindings).To(HaveLen(1))
+				Expect(state.Bindings[0].AppGUID).To(Equal("shared-app-guid"))
+			})
+			It("Records the binding", func() {
+				details.AppGUID = "app-guid"
+				brokerapiBinding, err := broker.Bind("test-instance", "test-binding", details)
+				Expect(err).NotTo(HaveOccurred())
+
+				state, _, err := persister.Load()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(state.Bindings).To(HaveLen(1))
+				binding := state.Bindings[0]
+				Expect(binding.ID).To(Equal("test-binding"))
+				Expect(binding.InstanceID).To(Equal("test-instance"))
+				Expect(binding.AppGUID).To(Equal("app-guid"))
+				Expect(binding.CreatedAt).To(BeTemporally("~", time.Now(), 5*time.Second))
+				Expect(binding.CredentialsFingerprint).NotTo(BeEmpty())
+				encoded, _ := json.Marshal(brokerapiBinding.Credentials)
+				Expect(string(encoded)).NotTo(ContainSubstring(binding.CredentialsFingerprint))
+			})
+			It("Records concurrent bindings", func() {
+				var wg sync.WaitGroup
+				for _, bindingID := range []string{"first-binding", "second-binding"} {
+					wg.Add(1)
+					go func(bindingID string) {
+						defer GinkgoRecover()
+						defer wg.Done()
+						_, err := broker.Bind("test-instance", bindingID, details)
+						Expect(err).NotTo(HaveOccurred())
+					}(bindingID)
+				}
+				wg.Wait()
+
+				state, _, err := persister.Load()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(state.Bindings).To(HaveLen(2))
+			})
+			It("Returns the same credentials to the same binding again", func() {
+				first, err := broker.Bind("test-instance", "test-binding", details)
+				Expect(err).NotTo(HaveOccurred())
+				second, existed, err := broker.(interface {
+					BindOrGet(string, string, brokerapi.BindDetails) (brokerapi.Binding, bool, error)
+				}).BindOrGet("test-instance", "test-binding", details)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(existed).To(BeTrue())
+				Expect(second).To(Equal(first))
+
+				state, _, err := persister.Load()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(state.Bindings).To(HaveLen(1))
+			})
+			It("Rejects to bind the same binding again with other parameters", func() {
+				_, err := broker.Bind("test-instance", "test-binding", details)
+				Expect(err).NotTo(HaveOccurred())
+				details.Parameters = map[string]interface{}{"role": "read-only"}
+				_, err = broker.Bind("test-instance", "test-binding", details)
+				Expect(err).To(Equal(brokerapi.ErrBindingAlreadyExists))
+			})
+			Context("And the credentials should address the database by IP", func() {
+				var previous brokerconfig.Config
+				BeforeEach(func() {
+					previous = config
+					config = brokerconfig.Config{
+						Cluster: brokerconfig.ClusterConfig{EndpointAddress: "ip"},
+						ServiceBroker: brokerconfig.ServiceBrokerConfig{
+							Plans: []brokerconfig.ServicePlanConfig{{ID: "test-plan", EndpointAddress: "both"}},
+						},
+					}
+				})
+				AfterEach(func() {
+					config = previous
+				})
+				It("Returns the IP address as the host", func() {
+					brokerapiBinding, err := broker.Bind("test-instance", "test-binding", details)
+					Expect(err).NotTo(HaveOccurred())
+					credentials := brokerapiBinding.Credentials.(map[string]interface{})
+					Expect(credentials["host"]).To(Equal("10.0.2.5"))
+					Expect(credentials["uri"]).To(Equal("redis://:pass@10.0.2.5:11909"))
+				})
+				It("Returns both addresses if the plan says so", func() {
+					state.AvailableInstances[0].PlanID = "test-plan"
+					_, err = persister.Save(state, persisters.AnyRevision)
+					Expect(err).NotTo(HaveOccurred())
+
+					brokerapiBinding, err := broker.Bind("test-instance", "test-binding", details)
+					Expect(err).NotTo(HaveOccurred())
+					credentials := brokerapiBinding.Credentials.(map[string]interface{})
+					Expect(credentials["host"]).To(Equal("example.com"))
+					Expect(credentials["ip"]).To(Equal("10.0.2.5"))
+					Expect(credentials["ip_uri"]).To(Equal("redis://:pass@10.0.2.5:11909"))
+				})
+			})
+			Context("And its plan enables the discovery service", func() {
+				var previous brokerconfig.Config
+				BeforeEach(func() {
+					previous = config
+					config = brokerconfig.Config{
+						ServiceBroker: brokerconfig.ServiceBrokerConfig{
+							Plans: []brokerconfig.ServicePlanConfig{{ID: "test-plan", Sentinel: true}},
+						},
+					}
+					state.AvailableInstances[0].PlanID = "test-plan"
+					state.AvailableInstances[0].Credentials.Host = "redis-11909.cluster.example.com"
+					if _, err = persister.Save(state, persisters.AnyRevision); err != nil {
+						panic(err)
+					}
+				})
+				AfterEach(func() {
+					config = previous
+				})
+				It("Adds the sentinel address to the credentials", func() {
+					brokerapiBinding, err := broker.Bind("test-instance", "test-binding", details)
+					Expect(err).NotTo(HaveOccurred())
+					credentials := brokerapiBinding.Credentials.(map[string]interface{})
+					Expect(credentials["sentinel_host"]).To(Equal("cluster.example.com"))
+					Expect(credentials["sentinel_port"]).To(Equal(8001))
+					Expect(credentials["sentinel_master_name"]).To(Equal("test-db"))
+					Expect(credentials).NotTo(HaveKey("tls_client_certificate_required"))
+				})
+			})
+			Context("And its plan requires client certificates", func() {
+				var previous brokerconfig.Config
+				BeforeEach(func() {
+					previous = config
+					config = brokerconfig.Config{
+						ServiceBroker: brokerconfig.ServiceBrokerConfig{
+							Plans: []brokerconfig.ServicePlanConfig{{
+								ID: "test-plan",
+								ServiceInstanceConfig: brokerconfig.ServiceInstanceConfig{
+									TLS:      true,
+									ClientCA: "-----BEGIN CERTIFICATE-----",
+								},
+							}},
+						},
+					}
+					state.AvailableInstances[0].PlanID = "test-plan"
+					state.AvailableInstances[0].Credentials.TLS = true
+					if _, err = persister.Save(state, persisters.AnyRevision); err != nil {
+						panic(err)
+					}
+				})
+				AfterEach(func() {
+					config = previous
+				})
+				It("Tells the apps to present a certificate", func() {
+					brokerapiBinding, err := broker.Bind("test-instance", "test-binding", details)
+					Expect(err).NotTo(HaveOccurred())
+					credentials := brokerapiBinding.Credentials.(map[string]interface{})
+					Expect(credentials["tls_client_certificate_required"]).To(BeTrue())
+					Expect(credentials["uri"]).To(HavePrefix("rediss://"))
+				})
+			})
+			Context("And its plan does not support bindings", func() {
+				var previous brokerconfig.Config
+				BeforeEach(func() {
+					previous = config
+					notBindable := false
+					config = brokerconfig.Config{
+						ServiceBroker: brokerconfig.ServiceBrokerConfig{
+							Plans: []brokerconfig.ServicePlanConfig{
+								{ID: "test-plan", Bindable: &notBindable},
+							},
+						},
+					}
+				})
+				AfterEach(func() {
+					config = previous
+				})
+				It("Rejects to bind it", func() {
+					_, err := broker.Bind("test-instance", "test-binding", details)
+					Expect(err).To(Equal(redislabs.ErrPlanNotBindable))
+				})
+			})
+			Context("And read-only credentials are requested", func() {
+				var (
+					proxy    testing.HTTPProxy
+					requests []string
+					// The fake cluster keeps its roles, users and the
+					// permissions of the databases.
+					lock        sync.Mutex
+					roles       map[float64]string
+					users       map[float64]map[string]interface{}
+					permissions map[string][]interface{}
+					createdUser map[string]interface{}
+					nextUID     float64
+				)
+				// canReach tells whether a role of the user is granted
+				// access to the database.
+				canReach := func(username string, UID string) bool {
+					lock.Lock()
+					defer lock.Unlock()
+					for _, user := range users {
+						if user["name"] != username {
+							continue
+						}
+						for _, roleUID := range user["role_uids"].([]interface{}) {
+							for _, permission := range permissions[UID] {
+								if permission.(map[string]interface{})["role_uid"] == roleUID {
+									return true
+								}
+							}
+						}
+					}
+					return false
+				}
+				BeforeEach(func() {
+					requests = []string{}
+					roles = map[float64]string{}
+					users = map[float64]map[string]interface{}{}
+					permissions = map[string][]interface{}{}
+					nextUID = 7
+					details.Parameters = map[string]interface{}{"role": "read-only"}
+
+					proxy = testing.NewHTTPProxy()
+					proxy.RegisterEndpointHandler("/", func(w http.ResponseWriter, r *http.Request) interface{} {
+						lock.Lock()
+						defer lock.Unlock()
+						requests = append(requests, r.Method+" "+r.URL.Path)
+						var body map[string]interface{}
+						json.NewDecoder(r.Body).Decode(&body)
+						segments := strings.Split(r.URL.Path, "/")
+						id := segments[len(segments)-1]
+						switch r.Method + " " + strings.Join(segments[:3], "/") {
+						case "GET /v1/redis_acls":
+							return []interface{}{}
+						case "POST /v1/redis_acls":
+							return map[string]interface{}{"uid": 5, "name": body["name"]}
+						case "GET /v1/roles":
+							list := []interface{}{}
+							for uid, name := range roles {
+								list = append(list, map[string]interface{}{"uid": uid, "name": name})
+							}
+							return list
+						case "POST /v1/roles":
+							roles[nextUID] = body["name"].(string)
+							nextUID++
+							return map[string]interface{}{"uid": nextUID - 1, "name": body["name"]}
+						case "DELETE /v1/roles":
+							uid, _ := strconv.ParseFloat(id, 64)
+							delete(roles, uid)
+						case "GET /v1/bdbs":
+							return map[string]interface{}{"uid": id, "roles_permissions": permissions[id]}
+						case "PUT /v1/bdbs":
+							permissions[id] = body["roles_permissions"].([]interface{})
+						case "POST /v1/users":
+							createdUser = body
+							body["uid"] = nextUID
+							users[nextUID] = body
+							nextUID++
+							return map[string]interface{}{"uid": body["uid"]}
+						case "GET /v1/users":
+							list := []interface{}{}
+							for _, user := range users {
+								list = append(list, user)
+							}
+							return list
+						case "DELETE /v1/users":
+							uid, _ := strconv.ParseFloat(id, 64)
+							delete(users, uid)
+						}
+						return map[string]interface{}{}
+					})
+					config.Cluster.Address = proxy.URL()
+				})
+				AfterEach(func() {
+					proxy.Close()
+				})
+				It("Creates a restricted user and returns its credentials", func() {
+					brokerapiBinding, err := broker.Bind("test-instance", "test-binding", details)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(roles).To(Equal(map[float64]string{7: "cf-test-binding"}))
+					Expect(permissions["1"]).To(Equal([]interface{}{
+						map[string]interface{}{"role_uid": float64(7), "redis_acl_uid": float64(5)},
+					}))
+					Expect(createdUser["name"]).To(Equal("cf-test-binding"))
+					Expect(createdUser["role_uids"]).To(Equal([]interface{}{float64(7)}))
+
+					credentials := brokerapiBinding.Credentials.(map[string]interface{})
+					Expect(credentials["role"]).To(Equal("read-only"))
+					Expect(credentials["username"]).To(Equal("cf-test-binding"))
+					Expect(credentials["password"]).To(Equal(createdUser["password"]))
+					Expect(credentials["password"]).NotTo(Equal("pass"))
+				})
+				It("Returns the same user to the same binding again", func() {
+					first, err := broker.Bind("test-instance", "test-binding", details)
+					Expect(err).NotTo(HaveOccurred())
+					second, err := broker.Bind("test-instance", "test-binding", details)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(second).To(Equal(first))
+					Expect(users).To(HaveLen(1))
+				})
+				It("Does not let the users of a database into other databases", func() {
+					state.AvailableInstances = append(state.AvailableInstances, persisters.ServiceInstance{
+						ID:          "other-instance",
+						Credentials: cluster.InstanceCredentials{UID: 2, Host: "other.example.com", Port: 11910},
+					})
+					_, err = persister.Save(state, persisters.AnyRevision)
+					Expect(err).NotTo(HaveOccurred())
+
+					_, err := broker.Bind("test-instance", "first-binding", details)
+					Expect(err).NotTo(HaveOccurred())
+					_, err = broker.Bind("other-instance", "second-binding", details)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(canReach("cf-first-binding", "1")).To(BeTrue())
+					Expect(canReach("cf-first-binding", "2")).To(BeFalse())
+					Expect(canReach("cf-second-binding", "2")).To(BeTrue())
+					Expect(canReach("cf-second-binding", "1")).To(BeFalse())
+				})
+				Context("And the plan of the instance has an ACL", func() {
+					var previous brokerconfig.Config
+					BeforeEach(func() {
+						previous = config
+						config = brokerconfig.Config{
+							Cluster: previous.Cluster,
+							ServiceBroker: brokerconfig.ServiceBrokerConfig{
+								Plans: []brokerconfig.ServicePlanConfig{{
+									ID:  "test-plan",
+									ACL: brokerconfig.PlanACLConfig{Role: "cf-app", Rules: "+@all -flushall ~*"},
+								}},
+							},
+						}
+						state.AvailableInstances[0].PlanID = "test-plan"
+						if _, err = persister.Save(state, persisters.AnyRevision); err != nil {
+							panic(err)
+						}
+					})
+					AfterEach(func() {
+						config = previous
+					})
+					It("Creates a user with the plan ACL for bindings without a role", func() {
+						details.Parameters = nil
+						brokerapiBinding, err := broker.Bind("test-instance", "test-binding", details)
+						Expect(err).NotTo(HaveOccurred())
+
+						Expect(requests).To(ContainElement("POST /v1/redis_acls"))
+						Expect(canReach("cf-test-binding", "1")).To(BeTrue())
+						credentials := brokerapiBinding.Credentials.(map[string]interface{})
+						Expect(credentials["role"]).To(Equal("cf-app"))
+						Expect(credentials["username"]).To(Equal("cf-test-binding"))
+					})
+					It("Still creates read-only users on request", func() {
+						brokerapiBinding, err := broker.Bind("test-instance", "test-binding", details)
+						Expect(err).NotTo(HaveOccurred())
+						credentials := brokerapiBinding.Credentials.(map[string]interface{})
+						Expect(credentials["role"]).To(Equal("read-only"))
+					})
+				})
+				It("Removes the user and its access when unbinding", func() {
+					_, err := broker.Bind("test-instance", "test-binding", details)
+					Expect(err).NotTo(HaveOccurred())
+					err = broker.Unbind("test-instance", "test-binding", brokerapi.UnbindDetails{})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(requests).To(ContainElement("DELETE /v1/users/8"))
+					Expect(users).To(BeEmpty())
+					Expect(roles).To(BeEmpty())
+					Expect(permissions["1"]).To(BeEmpty())
+				})
+				It("Forgets the binding when unbinding", func() {
+					_, err := broker.Bind("test-instance", "test-binding", details)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(broker.Unbind("test-instance", "test-binding", brokerapi.UnbindDetails{})).To(Succeed())
+
+					state, _, err := persister.Load()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(state.Bindings).To(BeEmpty())
+					Expect(broker.Unbind("test-instance", "test-binding", brokerapi.UnbindDetails{})).To(Equal(brokerapi.ErrBindingDoesNotExist))
+				})
+				It("Removes the user of a binding that was not recorded", func() {
+					users[9] = map[string]interface{}{"uid": 9, "name": "cf-test-binding", "role_uids": []interface{}{}}
+					err := broker.Unbind("test-instance", "test-binding", brokerapi.UnbindDetails{})
+					Expect(err).To(Equal(brokerapi.ErrBindingDoesNotExist))
+					Expect(requests).To(ContainElement("DELETE /v1/users/9"))
+				})
+				It("Rejects unknown roles", func() {
+					details.Parameters = map[string]interface{}{"role": "admin"}
+					_, err := broker.Bind("test-instance", "test-binding", details)
+					Expect(err).To(Equal(instancebinders.ErrUnsupportedRole))
+				})
+			})
+			Context("And the database has replica endpoints", func() {
+				BeforeEach(func() {
+					state.AvailableInstances[0].Credentials.ReadEndpoints = []cluster.Endpoint{
+						{Host: "replica.example.com", Port: 11910, IPList: []string{"10.0.2.6"}},
+					}
+					if _, err = persister.Save(state, persisters.AnyRevision); err != nil {
+						panic(err)
+					}
+				})
+				It("Exposes them separately", func() {
+					brokerapiBinding, err := broker.Bind("test-instance", "test-binding", details)
+					Expect(err).NotTo(HaveOccurred())
+					credentials := brokerapiBinding.Credentials.(map[string]interface{})
+					Expect(credentials["host"]).To(Equal("example.com"))
+					Expect(credentials["read_host"]).To(Equal("replica.example.com"))
+					Expect(credentials["read_port"]).To(Equal(11910))
+					Expect(credentials["read_endpoints"]).To(HaveLen(1))
+				})
 			})
-			It("Successfully retrieves the credentials", func() {
-				brokerapiBinding, err := broker.Bind("test-instance", "test-binding", details)
-				Expect(err).NotTo(HaveOccurred())
-				Expect(brokerapiBinding.Credentials).To(Equal(map[string]interface{}{
-					"host":     "example.com",
-					"port":     11909,
-					"ip_list":  []string{"10.0.2.5"},
-					"password": "pass",
-				}))
+			Context("And the database requires TLS", func() {
+				BeforeEach(func() {
+					state.AvailableInstances[0].Credentials.TLS = true
+					state.AvailableInstances[0].Credentials.Password = "p@ss/word"
+					if _, err = persister.Save(state, persisters.AnyRevision); err != nil {
+						panic(err)
+					}
+				})
+				It("Composes a rediss:// URI with an escaped password", func() {
+					brokerapiBinding, err := broker.Bind("test-instance", "test-binding", details)
+					Expect(err).NotTo(HaveOccurred())
+					credentials := brokerapiBinding.Credentials.(map[string]interface{})
+					Expect(credentials["uri"]).To(Equal("rediss://:p%40ss%2Fword@example.com:11909"))
+				})
 			})
 		})
 	})
@@ -368,9 +1400,11 @@ var _ = Describe("Broker", func() {
 		})
 		Context("When a provisioned instance exists", func() {
 			var (
-				tmpStateDir string
-				state       *persisters.State
-				proxy       testing.HTTPProxy
+				tmpStateDir  string
+				state        *persisters.State
+				proxy        testing.HTTPProxy
+				deleted      bool
+				keepDatabase bool
 			)
 			BeforeEach(func() {
 				tmpStateDir, err = ioutil.TempDir("", "redislabs-state-test")
@@ -386,12 +1420,23 @@ var _ = Describe("Broker", func() {
 						},
 					},
 				}
-				if err = persister.Save(state); err != nil {
+				if _, err = persister.Save(state, persisters.AnyRevision); err != nil {
 					panic(err)
 				}
 
+				deleted, keepDatabase = false, false
 				proxy = testing.NewHTTPProxy()
-				proxy.RegisterEndpoints([]testing.Endpoint{{"/", ""}})
+				proxy.RegisterEndpointHandler("/", func(w http.ResponseWriter, r *http.Request) interface{} {
+					if r.Method == "DELETE" {
+						deleted = !keepDatabase
+					} else if deleted {
+						w.WriteHeader(404)
+						return map[string]interface{}{"description": "db does not exist"}
+					} else if r.URL.Path == "/v1/bdbs/0" {
+						return map[string]interface{}{"uid": 0, "status": "active"}
+					}
+					return ""
+				})
 				config.Cluster.Address = proxy.URL()
 			})
 			AfterEach(func() {
@@ -404,6 +1449,181 @@ var _ = Describe("Broker", func() {
 				_, err = broker.Deprovision("test-instance", brokerapi.DeprovisionDetails{}, false)
 				Expect(err).To(HaveOccurred())
 			})
+			Context("And the cluster takes too long to delete the database", func() {
+				var timeout int
+				BeforeEach(func() {
+					keepDatabase = true
+					timeout = instancemanagers.WaitingForDeletionTimeout
+					instancemanagers.WaitingForDeletionTimeout = 1
+				})
+				AfterEach(func() {
+					instancemanagers.WaitingForDeletionTimeout = timeout
+				})
+				It("Keeps the instance so that the deletion can be retried", func() {
+					_, err = broker.Deprovision("test-instance", brokerapi.DeprovisionDetails{}, false)
+					Expect(err).To(Equal(instancemanagers.ErrDeleteDatabaseTimeoutExpired))
+					state, _, err = persister.Load()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(state.AvailableInstances).To(HaveLen(1))
+				})
+				Context("And a webhook is configured", func() {
+					var receiver *webhookReceiver
+					BeforeEach(func() {
+						receiver = newWebhookReceiver()
+						config.ServiceBroker.Webhooks = []brokerconfig.WebhookConfig{{URL: receiver.URL, Secret: "secret"}}
+					})
+					AfterEach(func() {
+						receiver.Close()
+						config.ServiceBroker.Webhooks = nil
+					})
+					It("Publishes the failure", func() {
+						_, err = broker.Deprovision("test-instance", brokerapi.DeprovisionDetails{}, false)
+						Expect(err).To(HaveOccurred())
+						Eventually(receiver.received).Should(ConsistOf(SatisfyAll(
+							HaveKeyWithValue("type", "operation.failed"),
+							HaveKeyWithValue("operation", "deprovision"),
+							HaveKeyWithValue("instance_id", "test-instance"),
+							HaveKeyWithValue("error", instancemanagers.ErrDeleteDatabaseTimeoutExpired.Error()),
+						)))
+					})
+				})
+			})
+			Context("And deleted databases are retained", func() {
+				var tags []interface{}
+				BeforeEach(func() {
+					config.ServiceBroker.DeletionRetentionPeriod = 3600
+					tags = nil
+					proxy.RegisterEndpointHandler("/v1/bdbs/0", func(w http.ResponseWriter, r *http.Request) interface{} {
+						if r.Method == "PUT" {
+							var settings map[string]interface{}
+							Expect(json.NewDecoder(r.Body).Decode(&settings)).To(Succeed())
+							tags, _ = settings["tags"].([]interface{})
+						}
+						return map[string]interface{}{"uid": 0, "tags": []map[string]string{{"key": "cf_instance_id", "value": "test-instance"}}}
+					})
+				})
+				AfterEach(func() {
+					config.ServiceBroker.DeletionRetentionPeriod = 0
+				})
+				It("Keeps the database for the reaper", func() {
+					_, err = broker.Deprovision("test-instance", brokerapi.DeprovisionDetails{}, false)
+					Expect(err).NotTo(HaveOccurred())
+					state, _, err = persister.Load()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(state.AvailableInstances).To(BeEmpty())
+					Expect(state.DeletedInstances).To(HaveLen(1))
+					Expect(state.DeletedInstances[0].ID).To(Equal("test-instance"))
+					Expect(state.DeletedInstances[0].DeletedAt.IsZero()).To(BeFalse())
+					Expect(deleted).To(BeFalse())
+				})
+				It("Tags the database with the time of the deletion", func() {
+					_, err = broker.Deprovision("test-instance", brokerapi.DeprovisionDetails{}, false)
+					Expect(err).NotTo(HaveOccurred())
+					state, _, err = persister.Load()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(tags).To(ConsistOf(
+						map[string]interface{}{"key": "cf_instance_id", "value": "test-instance"},
+						map[string]interface{}{"key": "cf_deleted_at", "value": state.DeletedInstances[0].DeletedAt.Format(time.RFC3339)},
+					))
+				})
+			})
+			Context("And it has bindings", func() {
+				BeforeEach(func() {
+					state.Bindings = []persisters.Binding{{ID: "test-binding", InstanceID: "test-instance"}}
+					if _, err = persister.Save(state, persisters.AnyRevision); err != nil {
+						panic(err)
+					}
+				})
+				It("Deletes it with the bindings by default", func() {
+					_, err = broker.Deprovision("test-instance", brokerapi.DeprovisionDetails{}, false)
+					Expect(err).NotTo(HaveOccurred())
+					state, _, err = persister.Load()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(state.AvailableInstances).To(BeEmpty())
+					Expect(state.Bindings).To(BeEmpty())
+				})
+				Context("And deprovisioning such instances is rejected", func() {
+					BeforeEach(func() {
+						config.ServiceBroker.RejectDeprovisionWithBindings = true
+					})
+					AfterEach(func() {
+						config.ServiceBroker.RejectDeprovisionWithBindings = false
+					})
+					It("Refuses to delete it", func() {
+						_, err = broker.Deprovision("test-instance", brokerapi.DeprovisionDetails{}, false)
+						Expect(err).To(Equal(redislabs.ErrInstanceHasBindings))
+						state, _, err = persister.Load()
+						Expect(err).NotTo(HaveOccurred())
+						Expect(state.AvailableInstances).To(HaveLen(1))
+					})
+				})
+			})
+			Context("And it is protected from deletion", func() {
+				BeforeEach(func() {
+					state.AvailableInstances[0].Parameters = map[string]interface{}{"deletion_protection": true}
+					if _, err = persister.Save(state, persisters.AnyRevision); err != nil {
+						panic(err)
+					}
+				})
+				It("Refuses to delete it", func() {
+					_, err = broker.Deprovision("test-instance", brokerapi.DeprovisionDetails{}, false)
+					Expect(err).To(Equal(redislabs.ErrDeletionProtected))
+					state, _, err = persister.Load()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(state.AvailableInstances).To(HaveLen(1))
+				})
+			})
+			Context("And deprovisioning hooks are configured", func() {
+				BeforeEach(func() {
+					config.ServiceBroker.Hooks = []brokerconfig.HookConfig{
+						{Name: "cmdb", Command: "/bin/sh", Args: []string{"-c", "echo -n $REDISLABS_HOOK_INSTANCE_ID > " + tmpStateDir + "/deleted"}, Phase: "post", Actions: []string{"deprovision"}},
+					}
+				})
+				AfterEach(func() {
+					config.ServiceBroker.Hooks = nil
+				})
+				It("Runs the post hooks once the instance is deleted", func() {
+					_, err = broker.Deprovision("test-instance", brokerapi.DeprovisionDetails{}, false)
+					Expect(err).NotTo(HaveOccurred())
+					contents, err := ioutil.ReadFile(path.Join(tmpStateDir, "deleted"))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(contents)).To(Equal("test-instance"))
+				})
+				Context("And a pre hook fails", func() {
+					BeforeEach(func() {
+						config.ServiceBroker.Hooks = append(config.ServiceBroker.Hooks, brokerconfig.HookConfig{
+							Name: "approval", Command: "/bin/sh", Args: []string{"-c", "exit 1"}, Phase: "pre",
+						})
+					})
+					It("Keeps the instance", func() {
+						_, err = broker.Deprovision("test-instance", brokerapi.DeprovisionDetails{}, false)
+						Expect(err).To(MatchError("hook approval failed: exit status 1"))
+						state, _, err = persister.Load()
+						Expect(err).NotTo(HaveOccurred())
+						Expect(state.AvailableInstances).To(HaveLen(1))
+						Expect(path.Join(tmpStateDir, "deleted")).NotTo(BeAnExistingFile())
+					})
+				})
+			})
+			Context("And its database is to be retained", func() {
+				BeforeEach(func() {
+					state.AvailableInstances[0].Parameters = map[string]interface{}{"retain_database": true}
+					state.Bindings = []persisters.Binding{{ID: "test-binding", InstanceID: "test-instance"}}
+					if _, err = persister.Save(state, persisters.AnyRevision); err != nil {
+						panic(err)
+					}
+				})
+				It("Forgets the instance and keeps the database", func() {
+					_, err = broker.Deprovision("test-instance", brokerapi.DeprovisionDetails{}, false)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(deleted).To(BeFalse())
+					state, _, err = persister.Load()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(state.AvailableInstances).To(BeEmpty())
+					Expect(state.DeletedInstances).To(BeEmpty())
+					Expect(state.Bindings).To(BeEmpty())
+				})
+			})
 		})
 	})
 
@@ -436,8 +1656,19 @@ var _ = Describe("Broker", func() {
 				err         error
 
 				updateSettings map[string]interface{}
+				deleted        bool
+				usedMemory     int
+				actions        []map[string]interface{}
+				passwordCalls  []string
+				databases      []map[string]interface{}
 			)
 			BeforeEach(func() {
+				updateSettings = nil
+				deleted = false
+				passwordCalls = []string{}
+				databases = []map[string]interface{}{}
+				usedMemory = 100000000
+				actions = []map[string]interface{}{}
 				tmpStateDir, err = ioutil.TempDir("", "redislabs-state-test")
 				if err != nil {
 					panic(err)
@@ -445,25 +1676,36 @@ var _ = Describe("Broker", func() {
 				persister = persisters.NewLocalPersister(path.Join(tmpStateDir, "state.json"))
 
 				proxy = testing.NewHTTPProxy()
-				proxy.RegisterEndpoints([]testing.Endpoint{
-					{"/v1/bdbs", map[string]interface{}{
-						"uid": 1,
+				proxy.RegisterEndpointHandler("/v1/bdbs", func(w http.ResponseWriter, r *http.Request) interface{} {
+					if r.Method == "GET" {
+						return databases
+					}
+					return map[string]interface{}{
+						"uid":                       1,
 						"authentication_redis_pass": "pass",
-						"endpoint_ip":               []string{"10.0.2.4"},
-						"dns_address_master":        "domain.com:11909",
 						"status":                    "pending",
-					}},
+					}
 				})
 				proxy.RegisterEndpointHandler("/v1/bdbs/1", func(w http.ResponseWriter, r *http.Request) interface{} {
-					if r.Method == "GET" {
+					if r.Method == "DELETE" {
+						deleted = true
+					} else if r.Method == "GET" && deleted {
+						w.WriteHeader(404)
+						return map[string]interface{}{"description": "db does not exist"}
+					} else if r.Method == "GET" {
 						return map[string]interface{}{
-							"uid": 1,
+							"uid":                       1,
 							"authentication_redis_pass": "pass",
-							"endpoint_ip":               []string{"10.0.2.4"},
-							"dns_address_master":        "domain.com:11909",
-							"status":                    "active",
+							"endpoints": []map[string]interface{}{{
+								"dns_name": "domain.com",
+								"port":     11909,
+								"addr":     []string{"10.0.2.4"},
+							}},
+							"status":       "active",
+							"memory_size":  200000000,
+							"shards_count": 1,
 						}
-					} else {
+					} else if r.Method == "PUT" {
 						bytes, err := ioutil.ReadAll(r.Body)
 						if err != nil {
 							panic(err)
@@ -478,6 +1720,22 @@ var _ = Describe("Broker", func() {
 
 					return nil
 				})
+				proxy.RegisterEndpointHandler("/v1/bdbs/1/passwords", func(w http.ResponseWriter, r *http.Request) interface{} {
+					var body map[string]string
+					if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+						panic(err)
+					}
+					passwordCalls = append(passwordCalls, r.Method+" "+body["password"])
+					return nil
+				})
+				proxy.RegisterEndpointHandler("/v1/actions/bdb/1", func(w http.ResponseWriter, r *http.Request) interface{} {
+					return actions
+				})
+				proxy.RegisterEndpointHandler("/v1/bdbs/stats/last/1", func(w http.ResponseWriter, r *http.Request) interface{} {
+					return map[string]interface{}{
+						"1": map[string]interface{}{"used_memory": usedMemory},
+					}
+				})
 
 				config = brokerconfig.Config{
 					ServiceBroker: brokerconfig.ServiceBrokerConfig{
@@ -501,9 +1759,8 @@ var _ = Describe("Broker", func() {
 									Replication: true,
 									ShardCount:  2,
 									Persistence: "snapshot",
-									Snapshot: brokerconfig.Snapshot{
-										Writes: 100,
-										Secs:   10,
+									Snapshot: brokerconfig.SnapshotPolicy{
+										{Writes: 100, Secs: 10},
 									},
 								},
 							},
@@ -541,6 +1798,26 @@ var _ = Describe("Broker", func() {
 				Expect(updateSettings).To(HaveKey("memory_size"))
 				Expect(updateSettings["memory_size"]).To(BeEquivalentTo(400000000))
 			})
+			It("Only sends the settings that change", func() {
+				_, err = broker.Update("test-instance", brokerapi.UpdateDetails{
+					ServiceID: "test-service",
+					Parameters: map[string]interface{}{
+						"memory_size":  400000000,
+						"shards_count": 1,
+					},
+				}, false)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(updateSettings).To(HaveKey("memory_size"))
+				Expect(updateSettings).NotTo(HaveKey("shards_count"))
+			})
+			It("Does not send an update that changes nothing", func() {
+				_, err = broker.Update("test-instance", brokerapi.UpdateDetails{
+					ServiceID:  "test-service",
+					Parameters: map[string]interface{}{"memory_size": 200000000},
+				}, false)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(updateSettings).To(BeNil())
+			})
 			It("Updates its plan", func() {
 				_, err = broker.Update("test-instance", brokerapi.UpdateDetails{
 					ServiceID: "test-service",
@@ -589,6 +1866,312 @@ var _ = Describe("Broker", func() {
 				Expect(updateSettings).To(HaveKey("data_persistence"))
 				Expect(updateSettings["data_persistence"]).To(BeEquivalentTo("aof"))
 			})
+			It("Records the plan and parameters in the state", func() {
+				state, _, err := persister.Load()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(state.AvailableInstances).To(HaveLen(1))
+				instance := state.AvailableInstances[0]
+				Expect(instance.PlanID).To(Equal("test-plan-1"))
+				Expect(instance.ServiceID).To(Equal("test-service"))
+				Expect(instance.Parameters).To(Equal(map[string]interface{}{"name": "test"}))
+				Expect(instance.CreatedAt.IsZero()).To(BeFalse())
+
+				_, err = broker.Update("test-instance", brokerapi.UpdateDetails{
+					ServiceID: "test-service",
+					PlanID:    "test-plan-2",
+					Parameters: map[string]interface{}{
+						"data_persistence": "aof",
+					},
+				}, false)
+				Expect(err).NotTo(HaveOccurred())
+
+				state, _, err = persister.Load()
+				Expect(err).NotTo(HaveOccurred())
+				instance = state.AvailableInstances[0]
+				Expect(instance.PlanID).To(Equal("test-plan-2"))
+				Expect(instance.Parameters).To(Equal(map[string]interface{}{
+					"name":             "test",
+					"data_persistence": "aof",
+				}))
+				Expect(instance.UpdatedAt).NotTo(BeTemporally("<", instance.CreatedAt))
+			})
+			It("Keeps the plan when only the previous plan is given", func() {
+				_, err := broker.Update("test-instance", brokerapi.UpdateDetails{
+					ServiceID:      "test-service",
+					PreviousValues: brokerapi.PreviousValues{PlanID: "test-plan-1"},
+					Parameters:     map[string]interface{}{"data_persistence": "aof"},
+				}, false)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(updateSettings).To(Equal(map[string]interface{}{"data_persistence": "aof"}))
+
+				state, _, err := persister.Load()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(state.AvailableInstances[0].PlanID).To(Equal("test-plan-1"))
+			})
+			Context("And the shard count changes", func() {
+				It("Updates it synchronously unless asynchronous operations are allowed", func() {
+					isAsync, err := broker.Update("test-instance", brokerapi.UpdateDetails{
+						ServiceID: "test-service",
+						PlanID:    "test-plan-2",
+					}, false)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(bool(isAsync)).To(BeFalse())
+				})
+				It("Tracks the resharding as the last operation", func() {
+					actions = append(actions, map[string]interface{}{
+						"action_uid": "old", "name": "SMUpdateBDB", "status": "failed",
+					})
+					isAsync, err := broker.Update("test-instance", brokerapi.UpdateDetails{
+						ServiceID: "test-service",
+						PlanID:    "test-plan-2",
+					}, true)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(bool(isAsync)).To(BeTrue())
+					Expect(updateSettings["shards_count"]).To(BeEquivalentTo(2))
+
+					// The cluster has not listed the resharding yet.
+					operation, err := broker.LastOperation("test-instance")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(operation.State).To(Equal(brokerapi.InProgress))
+					Expect(operation.Description).To(ContainSubstring("waiting for the cluster to start"))
+
+					actions = append(actions, map[string]interface{}{
+						"action_uid": "new", "name": "SMUpdateBDB", "status": "running", "progress": 40,
+					})
+					operation, err = broker.LastOperation("test-instance")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(operation.State).To(Equal(brokerapi.InProgress))
+					Expect(operation.Description).To(ContainSubstring("40% done"))
+
+					actions[1]["status"] = "completed"
+					operation, err = broker.LastOperation("test-instance")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(operation.State).To(Equal(brokerapi.Succeeded))
+
+					state, _, err := persister.Load()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(state.AvailableInstances[0].LastOperation.State).To(Equal("succeeded"))
+				})
+				It("Reports a failed resharding", func() {
+					_, err := broker.Update("test-instance", brokerapi.UpdateDetails{
+						ServiceID: "test-service",
+						PlanID:    "test-plan-2",
+					}, true)
+					Expect(err).NotTo(HaveOccurred())
+
+					actions = append(actions, map[string]interface{}{
+						"action_uid": "new", "name": "SMUpdateBDB", "status": "failed",
+					})
+					operation, err := broker.LastOperation("test-instance")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(operation.State).To(Equal(brokerapi.Failed))
+				})
+				It("Takes a resharding the cluster no longer lists once started as done", func() {
+					_, err := broker.Update("test-instance", brokerapi.UpdateDetails{
+						ServiceID: "test-service",
+						PlanID:    "test-plan-2",
+					}, true)
+					Expect(err).NotTo(HaveOccurred())
+
+					actions = append(actions, map[string]interface{}{
+						"action_uid": "new", "name": "SMUpdateBDB", "status": "running", "progress": 90,
+					})
+					operation, err := broker.LastOperation("test-instance")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(operation.State).To(Equal(brokerapi.InProgress))
+
+					actions = actions[:0]
+					operation, err = broker.LastOperation("test-instance")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(operation.State).To(Equal(brokerapi.Succeeded))
+				})
+				Context("And the cluster does not start resharding in time", func() {
+					var timeout int
+					BeforeEach(func() {
+						timeout = instancemanagers.WaitingForActionTimeout
+						instancemanagers.WaitingForActionTimeout = 0
+					})
+					AfterEach(func() {
+						instancemanagers.WaitingForActionTimeout = timeout
+					})
+					It("Reports the resharding as failed", func() {
+						_, err := broker.Update("test-instance", brokerapi.UpdateDetails{
+							ServiceID: "test-service",
+							PlanID:    "test-plan-2",
+						}, true)
+						Expect(err).NotTo(HaveOccurred())
+
+						operation, err := broker.LastOperation("test-instance")
+						Expect(err).NotTo(HaveOccurred())
+						Expect(operation.State).To(Equal(brokerapi.Failed))
+						Expect(operation.Description).To(ContainSubstring("has not started it in time"))
+					})
+				})
+			})
+			It("Rejects a memory size below the memory in use", func() {
+				usedMemory = 300000000
+				_, err = broker.Update("test-instance", brokerapi.UpdateDetails{
+					ServiceID:  "test-service",
+					Parameters: map[string]interface{}{"memory_size": 250000000},
+				}, false)
+				Expect(err).To(MatchError("memory_size 250000000 is below the 300000000 bytes the database uses"))
+				Expect(updateSettings).To(BeNil())
+			})
+			Context("And the plan denies shrinking the memory", func() {
+				BeforeEach(func() {
+					config.ServiceBroker.Plans[0].ServiceInstanceConfig.DenyMemoryShrink = true
+				})
+				It("Rejects a memory size below the current one", func() {
+					_, err = broker.Update("test-instance", brokerapi.UpdateDetails{
+						ServiceID:  "test-service",
+						Parameters: map[string]interface{}{"memory_size": 150000000},
+					}, false)
+					Expect(err).To(MatchError(ContainSubstring("below the current size 200000000")))
+					Expect(updateSettings).To(BeNil())
+				})
+				It("Allows growing the memory", func() {
+					_, err = broker.Update("test-instance", brokerapi.UpdateDetails{
+						ServiceID:  "test-service",
+						Parameters: map[string]interface{}{"memory_size": 400000000},
+					}, false)
+					Expect(err).NotTo(HaveOccurred())
+				})
+			})
+			Context("And the plan restricts the parameters", func() {
+				BeforeEach(func() {
+					config.ServiceBroker.Plans[0].AllowedParameters = []string{"name", "memory_size"}
+				})
+				It("Updates the allowed ones", func() {
+					_, err = broker.Update("test-instance", brokerapi.UpdateDetails{
+						ServiceID:  "test-service",
+						Parameters: map[string]interface{}{"memory_size": 400000000},
+					}, false)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(updateSettings["memory_size"]).To(BeEquivalentTo(400000000))
+				})
+				It("Rejects the others", func() {
+					_, err = broker.Update("test-instance", brokerapi.UpdateDetails{
+						ServiceID: "test-service",
+						Parameters: map[string]interface{}{
+							"memory_size":      400000000,
+							"data_persistence": "aof",
+						},
+					}, false)
+					Expect(err).To(MatchError(`the plan does not allow to set "data_persistence"`))
+					Expect(updateSettings).To(BeNil())
+				})
+			})
+			It("Does not change the UID of the database", func() {
+				_, err = broker.Update("test-instance", brokerapi.UpdateDetails{
+					ServiceID:  "test-service",
+					Parameters: map[string]interface{}{"uid": 2},
+				}, false)
+				Expect(err).To(Equal(redislabs.ErrUIDImmutable))
+				Expect(updateSettings).To(BeNil())
+			})
+			It("Keeps the deletion protection to itself", func() {
+				_, err = broker.Update("test-instance", brokerapi.UpdateDetails{
+					ServiceID:  "test-service",
+					Parameters: map[string]interface{}{"deletion_protection": true},
+				}, false)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(updateSettings).NotTo(HaveKey("deletion_protection"))
+
+				_, err = broker.Deprovision("test-instance", brokerapi.DeprovisionDetails{}, false)
+				Expect(err).To(Equal(redislabs.ErrDeletionProtected))
+
+				_, err = broker.Update("test-instance", brokerapi.UpdateDetails{
+					ServiceID:  "test-service",
+					Parameters: map[string]interface{}{"deletion_protection": false},
+				}, false)
+				Expect(err).NotTo(HaveOccurred())
+				_, err = broker.Deprovision("test-instance", brokerapi.DeprovisionDetails{}, false)
+				Expect(err).NotTo(HaveOccurred())
+			})
+			Context("And it is renamed", func() {
+				It("Renames the database following the name template", func() {
+					_, err = broker.Update("test-instance", brokerapi.UpdateDetails{
+						ServiceID:  "test-service",
+						Parameters: map[string]interface{}{"name": "renamed"},
+					}, false)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(updateSettings["name"]).To(Equal("renamed-test-instance"))
+
+					state, _, err := persister.Load()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(state.AvailableInstances[0].Parameters["name"]).To(Equal("renamed"))
+				})
+				It("Rejects a name another database uses", func() {
+					databases = append(databases, map[string]interface{}{"uid": 2, "name": "renamed-test-instance"})
+					_, err = broker.Update("test-instance", brokerapi.UpdateDetails{
+						ServiceID:  "test-service",
+						Parameters: map[string]interface{}{"name": "renamed"},
+					}, false)
+					Expect(err).To(MatchError(`the database name "renamed-test-instance" is taken`))
+					Expect(updateSettings).To(BeNil())
+				})
+				It("Rejects a name the cluster does not accept", func() {
+					_, err = broker.Update("test-instance", brokerapi.UpdateDetails{
+						ServiceID:  "test-service",
+						Parameters: map[string]interface{}{"name": "my db"},
+					}, false)
+					Expect(err).To(MatchError(ContainSubstring(`parameter "name" must match`)))
+					Expect(updateSettings).To(BeNil())
+				})
+			})
+			Context("And the password is rotated", func() {
+				rotate := func() persisters.ServiceInstance {
+					_, err := broker.Update("test-instance", brokerapi.UpdateDetails{
+						ServiceID:  "test-service",
+						Parameters: map[string]interface{}{"rotate_password": true},
+					}, false)
+					Expect(err).NotTo(HaveOccurred())
+					state, _, err := persister.Load()
+					Expect(err).NotTo(HaveOccurred())
+					return state.AvailableInstances[0]
+				}
+				It("Replaces the database password", func() {
+					instance := rotate()
+					Expect(instance.Credentials.Password).NotTo(Equal("pass"))
+					Expect(passwordCalls).To(Equal([]string{"PUT " + instance.Credentials.Password}))
+					Expect(instance.ExpiringPasswords).To(BeEmpty())
+					Expect(instance.Parameters).NotTo(HaveKey("rotate_password"))
+					Expect(updateSettings).NotTo(HaveKey("rotate_password"))
+				})
+				Context("with a grace period", func() {
+					BeforeEach(func() {
+						config.ServiceBroker.PasswordRotationGracePeriod = 60
+					})
+					It("Keeps the old password valid until it expires", func() {
+						instance := rotate()
+						Expect(passwordCalls).To(Equal([]string{"POST " + instance.Credentials.Password}))
+						Expect(instance.ExpiringPasswords).To(HaveLen(1))
+						Expect(instance.ExpiringPasswords[0].Password).To(Equal("pass"))
+						Expect(instance.ExpiringPasswords[0].ExpiresAt).To(BeTemporally("~", time.Now().Add(time.Minute), time.Second*5))
+					})
+				})
+			})
+			Context("And its plan does not support plan changes", func() {
+				BeforeEach(func() {
+					notUpdateable := false
+					config.ServiceBroker.Plans[0].PlanUpdateable = &notUpdateable
+				})
+				It("Rejects to change the plan", func() {
+					_, err = broker.Update("test-instance", brokerapi.UpdateDetails{
+						ServiceID: "test-service",
+						PlanID:    "test-plan-2",
+					}, false)
+					Expect(err).To(Equal(brokerapi.ErrPlanChangeNotSupported))
+					Expect(updateSettings).To(BeNil())
+				})
+				It("Still updates the parameters", func() {
+					_, err = broker.Update("test-instance", brokerapi.UpdateDetails{
+						ServiceID:  "test-service",
+						Parameters: map[string]interface{}{"memory_size": 400000000},
+					}, false)
+					Expect(err).NotTo(HaveOccurred())
+				})
+			})
 			It("Rejects to update it to an unknown plan", func() {
 				_, err = broker.Update("test-instance", brokerapi.UpdateDetails{
 					ServiceID: "test-service",
@@ -636,6 +2219,18 @@ var _ = Describe("Broker", func() {
 					Metadata:    &brokerapi.ServicePlanMetadata{},
 				}))
 			})
+			It("Lets instances be shared by default", func() {
+				encoded, err := json.Marshal(broker.(api.Catalog).Catalog()[0])
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(encoded)).To(ContainSubstring(`"shareable":true`))
+			})
+			It("Does not let instances be shared if so configured", func() {
+				config.ServiceBroker.Metadata.Shareable = new(bool)
+				broker = redislabs.NewServiceBroker(nil, nil, persister, config, logger)
+				encoded, err := json.Marshal(broker.(api.Catalog).Catalog()[0])
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(encoded)).To(ContainSubstring(`"shareable":false`))
+			})
 			It("Assigns a tag", func() {
 				services := broker.Services()
 				Expect(len(services)).To(Equal(1))
@@ -644,6 +2239,11 @@ var _ = Describe("Broker", func() {
 				Expect(len(service.Tags)).To(Equal(1))
 				Expect(service.Tags[0]).To(Equal("redislabs"))
 			})
+			It("Assigns the configured tags instead", func() {
+				config.ServiceBroker.Tags = []string{"redis", "key-value"}
+				broker = redislabs.NewServiceBroker(nil, nil, persister, config, logger)
+				Expect(broker.Services()[0].Tags).To(Equal([]string{"redis", "key-value"}))
+			})
 			It("Says that it is bindable", func() {
 				services := broker.Services()
 				Expect(len(services)).To(Equal(1))
@@ -658,6 +2258,97 @@ var _ = Describe("Broker", func() {
 
 				Expect(service.PlanUpdatable).To(Equal(true))
 			})
+			Context("And plans with their own flags", func() {
+				BeforeEach(func() {
+					yes, no := true, false
+					config.ServiceBroker.PlanUpdateable = &no
+					config.ServiceBroker.Plans = append(config.ServiceBroker.Plans, brokerconfig.ServicePlanConfig{
+						ID:             "plan-2",
+						Name:           "trial",
+						Free:           &yes,
+						Bindable:       &no,
+						PlanUpdateable: &yes,
+						AllowedOrgs:    []string{"org-guid"},
+						Metadata: brokerconfig.ServicePlanMetadata{
+							DisplayName: "Trial",
+							Bullets:     []string{"100MB"},
+							Costs: []brokerconfig.ServicePlanCost{
+								{Amount: map[string]float64{"usd": 0}, Unit: "MONTHLY"},
+							},
+						},
+					})
+				})
+				It("Publishes the flags in the catalog", func() {
+					services := broker.(api.Catalog).Catalog()
+					Expect(services).To(HaveLen(1))
+					Expect(services[0].Bindable).To(BeTrue())
+					Expect(services[0].PlanUpdatable).To(BeFalse())
+
+					plans := services[0].Plans
+					Expect(plans).To(HaveLen(2))
+					Expect(plans[0].ID).To(Equal("plan-1"))
+					Expect(plans[0].Free).To(BeNil())
+					Expect(plans[0].Bindable).To(BeNil())
+					Expect(plans[1].ID).To(Equal("plan-2"))
+					Expect(*plans[1].Free).To(BeTrue())
+					Expect(*plans[1].Bindable).To(BeFalse())
+					Expect(*plans[1].PlanUpdateable).To(BeTrue())
+					Expect(plans[1].Metadata.ServicePlanMetadata).To(Equal(brokerapi.ServicePlanMetadata{
+						DisplayName: "Trial",
+						Bullets:     []string{"100MB"},
+						Costs: []brokerapi.ServiceCost{
+							{Amount: map[string]float64{"usd": 0}, Unit: "MONTHLY"},
+						},
+					}))
+					Expect(plans[1].Metadata.AllowedOrganizations).To(Equal([]string{"org-guid"}))
+				})
+				It("Serves them in the JSON of the API", func() {
+					encoded, err := json.Marshal(broker.(api.Catalog).Catalog()[0])
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(encoded)).To(ContainSubstring(`"plan_updateable":false`))
+					Expect(string(encoded)).To(ContainSubstring(`"free":true,"metadata":{"displayName":"Trial","bullets":["100MB"],"costs":[{"amount":{"usd":0},"unit":"MONTHLY"}],"allowedOrganizations":["org-guid"]},"bindable":false,"plan_updateable":true`))
+				})
+			})
 		})
 	})
 })
+
+// failingPersister loads the state of the wrapped persister but never manages
+// to save it.
+type failingPersister struct {
+	persisters.StatePersister
+}
+
+func (p failingPersister) Save(s *persisters.State, revision persisters.Revision) (persisters.Revision, error) {
+	return persisters.AnyRevision, errors.New("disk is full")
+}
+
+// webhookReceiver records the events of a webhook with the secret
+// "secret".
+type webhookReceiver struct {
+	*httptest.Server
+	lock   sync.Mutex
+	events []map[string]interface{}
+}
+
+func newWebhookReceiver() *webhookReceiver {
+	r := &webhookReceiver{}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		var event map[string]interface{}
+		if req.Header.Get(events.SignatureHeader) != events.Sign(req.Header.Get(events.TimestampHeader), body, "secret") || json.Unmarshal(body, &event) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		r.lock.Lock()
+		defer r.lock.Unlock()
+		r.events = append(r.events, event)
+	}))
+	return r
+}
+
+func (r *webhookReceiver) received() []map[string]interface{} {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]map[string]interface{}{}, r.events...)
+}
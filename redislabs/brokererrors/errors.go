@@ -0,0 +1,103 @@
+package brokererrors
+
+import "net/http"
+
+const statusUnprocessableEntity = 422
+
+// Error codes the Open Service Broker API defines for the "error"
+// field of failure responses. The platform reacts to them, e.g. it
+// retries a request with accepts_incomplete=true on AsyncRequired.
+const (
+	AsyncRequired           = "AsyncRequired"
+	ConcurrencyError        = "ConcurrencyError"
+	RequiresApp             = "RequiresApp"
+	MaintenanceInfoConflict = "MaintenanceInfoConflict"
+	PlanChangeNotSupported  = "PlanChangeNotSupported"
+)
+
+// Error is an error the platform has to show to the developer. It
+// carries the HTTP status and, if the API defines one, the error code
+// of the response. Other errors are reported as internal failures.
+type Error struct {
+	StatusCode  int
+	Code        string
+	Description string
+}
+
+func (e *Error) Error() string {
+	return e.Description
+}
+
+func New(statusCode int, code string, description string) *Error {
+	return &Error{
+		StatusCode:  statusCode,
+		Code:        code,
+		Description: description,
+	}
+}
+
+// NewBadRequest reports a malformed request or invalid parameters.
+func NewBadRequest(description string) *Error {
+	return New(http.StatusBadRequest, "", description)
+}
+
+// NewNotFound reports a missing resource that is not being deleted.
+func NewNotFound(description string) *Error {
+	return New(http.StatusNotFound, "", description)
+}
+
+// NewConflict reports a resource that exists with other attributes.
+func NewConflict(description string) *Error {
+	return New(http.StatusConflict, "", description)
+}
+
+// NewGone reports a resource that is already deleted.
+func NewGone(description string) *Error {
+	return New(http.StatusGone, "", description)
+}
+
+// NewUnprocessableEntity reports a valid request the broker can not
+// fulfil, with an optional error code.
+func NewUnprocessableEntity(code string, description string) *Error {
+	return New(statusUnprocessableEntity, code, description)
+}
+
+func NewAsyncRequired(description string) *Error {
+	return NewUnprocessableEntity(AsyncRequired, description)
+}
+
+// NewConcurrencyError reports that another operation on the same
+// resource is in progress.
+func NewConcurrencyError(description string) *Error {
+	return NewUnprocessableEntity(ConcurrencyError, description)
+}
+
+func NewRequiresApp(description string) *Error {
+	return NewUnprocessableEntity(RequiresApp, description)
+}
+
+// NewPreconditionFailed reports a request for a version of the API the
+// broker does not support.
+func NewPreconditionFailed(description string) *Error {
+	return New(http.StatusPreconditionFailed, "", description)
+}
+
+// NewInternal reports a failure that is not caused by the request.
+func NewInternal(description string) *Error {
+	return New(http.StatusInternalServerError, "", description)
+}
+
+// NewServiceUnavailable reports that the broker can not process requests
+// for the time being.
+func NewServiceUnavailable(description string) *Error {
+	return New(http.StatusServiceUnavailable, "", description)
+}
+
+// From returns err as an Error. Errors that are not of this package
+// become internal errors with the same description.
+func From(err error) *Error {
+	if e, ok := err.(*Error); ok {
+		return e
+	}
+	return NewInternal(err.Error())
+}
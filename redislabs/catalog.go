@@ -0,0 +1,141 @@
+package redislabs
+
+import (
+	"github.com/pivotal-cf/brokerapi"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/api"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+)
+
+// Catalog returns the service with its plans in the order of the config.
+func (b *serviceBroker) Catalog() []api.Service {
+	b.Logger.Info("Serving a catalog request")
+
+	conf := b.Config.ServiceBroker
+	plans := []api.ServicePlan{}
+	for _, plan := range conf.Plans {
+		plans = append(plans, api.ServicePlan{
+			ServicePlan: brokerapi.ServicePlan{
+				ID:          plan.ID,
+				Name:        plan.Name,
+				Description: plan.Description,
+				Free:        plan.Free,
+			},
+			Metadata:       planMetadata(plan),
+			Bindable:       plan.Bindable,
+			PlanUpdateable: plan.PlanUpdateable,
+		})
+	}
+
+	return []api.Service{{
+		Service: brokerapi.Service{
+			ID:            conf.ServiceID,
+			Name:          conf.Name,
+			Description:   conf.Description,
+			Bindable:      flag(conf.Bindable),
+			Tags:          b.serviceTags(),
+			PlanUpdatable: flag(conf.PlanUpdateable),
+		},
+		Metadata: &api.ServiceMetadata{
+			ServiceMetadata: brokerapi.ServiceMetadata{
+				DisplayName:         conf.Metadata.DisplayName,
+				ImageUrl:            conf.Metadata.Image,
+				ProviderDisplayName: conf.Metadata.ProviderDisplayName,
+			},
+			Shareable: flag(conf.Metadata.Shareable),
+		},
+		Plans: plans,
+	}}
+}
+
+func planMetadata(plan config.ServicePlanConfig) *api.ServicePlanMetadata {
+	metadata := plan.Metadata
+	var costs []brokerapi.ServiceCost
+	for _, cost := range metadata.Costs {
+		costs = append(costs, brokerapi.ServiceCost{
+			Amount: cost.Amount,
+			Unit:   cost.Unit,
+		})
+	}
+	return &api.ServicePlanMetadata{
+		ServicePlanMetadata: brokerapi.ServicePlanMetadata{
+			DisplayName: metadata.DisplayName,
+			Bullets:     metadata.Bullets,
+			Costs:       costs,
+		},
+		AllowedOrganizations: plan.AllowedOrgs,
+	}
+}
+
+// Services returns the catalog without the fields brokerapi lacks.
+func (b *serviceBroker) Services() []brokerapi.Service {
+	services := []brokerapi.Service{}
+	for _, service := range b.Catalog() {
+		service.Service.Metadata = &service.Metadata.ServiceMetadata
+		service.Service.Plans = []brokerapi.ServicePlan{}
+		for _, plan := range service.Plans {
+			plan.ServicePlan.Metadata = &plan.Metadata.ServicePlanMetadata
+			service.Service.Plans = append(service.Service.Plans, plan.ServicePlan)
+		}
+		services = append(services, service.Service)
+	}
+	return services
+}
+
+// DefaultServiceTags are advertised unless the config lists tags.
+var DefaultServiceTags = []string{"redislabs"}
+
+func (b *serviceBroker) serviceTags() []string {
+	if len(b.Config.ServiceBroker.Tags) > 0 {
+		return b.Config.ServiceBroker.Tags
+	}
+	return DefaultServiceTags
+}
+
+// planBindable tells whether instances of the plan can be bound.
+func (b *serviceBroker) planBindable(planID string) bool {
+	plan, ok := b.planConfig(planID)
+	if ok && plan.Bindable != nil {
+		return *plan.Bindable
+	}
+	return flag(b.Config.ServiceBroker.Bindable)
+}
+
+// planUpdateable tells whether instances of the plan can change their
+// plan.
+func (b *serviceBroker) planUpdateable(planID string) bool {
+	plan, ok := b.planConfig(planID)
+	if ok && plan.PlanUpdateable != nil {
+		return *plan.PlanUpdateable
+	}
+	return flag(b.Config.ServiceBroker.PlanUpdateable)
+}
+
+// planAllowedForOrg tells whether the organization may create instances
+// of the plan.
+func (b *serviceBroker) planAllowedForOrg(planID string, organizationGUID string) bool {
+	plan, _ := b.planConfig(planID)
+	if len(plan.AllowedOrgs) == 0 {
+		return true
+	}
+	for _, guid := range plan.AllowedOrgs {
+		if guid == organizationGUID {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *serviceBroker) planConfig(planID string) (config.ServicePlanConfig, bool) {
+	for _, plan := range b.Config.ServiceBroker.Plans {
+		if plan.ID == planID {
+			return plan, true
+		}
+	}
+	return config.ServicePlanConfig{}, false
+}
+
+// flag returns the value of an optional setting that is true by default.
+func flag(value *bool) bool {
+	return value == nil || *value
+}
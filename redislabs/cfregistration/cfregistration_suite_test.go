@@ -0,0 +1,13 @@
+package cfregistration_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestCfregistration(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "CF Registration Suite")
+}
@@ -0,0 +1,7 @@
+package cfregistration
+
+import "errors"
+
+var (
+	ErrNoTokenEndpoint = errors.New("the Cloud Controller did not name a token endpoint")
+)
@@ -0,0 +1,261 @@
+// Package cfregistration registers the broker with Cloud Foundry and
+// enables access to its plans via the v2 Cloud Controller API.
+package cfregistration
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pivotal-golang/lager"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+)
+
+// UAAClientID is the UAA client the cf CLI logs in with.
+var UAAClientID = "cf"
+
+// Registrar creates or updates the service broker in Cloud Foundry and
+// makes its plans visible, to the organizations a plan is restricted to
+// or to everybody otherwise.
+type Registrar struct {
+	conf     config.Config
+	api      string
+	username string
+	password string
+	client   *http.Client
+	token    string
+	out      io.Writer
+	logger   lager.Logger
+}
+
+type resources struct {
+	Resources []struct {
+		Metadata struct {
+			GUID string `json:"guid"`
+		} `json:"metadata"`
+	} `json:"resources"`
+}
+
+func (r resources) guids() []string {
+	guids := []string{}
+	for _, resource := range r.Resources {
+		guids = append(guids, resource.Metadata.GUID)
+	}
+	return guids
+}
+
+// NewRegistrar creates a registrar that logs in to the Cloud Controller
+// at api as the given CF user and reports what it does to out.
+func NewRegistrar(conf config.Config, api string, username string, password string, skipSSLValidation bool, out io.Writer, logger lager.Logger) *Registrar {
+	return &Registrar{
+		conf:     conf,
+		api:      strings.TrimRight(api, "/"),
+		username: username,
+		password: password,
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: skipSSLValidation},
+				Proxy:           http.ProxyFromEnvironment,
+			},
+		},
+		out:    out,
+		logger: logger,
+	}
+}
+
+// Register registers the broker under the given name and URL, updating
+// an existing registration of that name, and enables access to the plans
+// of the config.
+func (r *Registrar) Register(brokerName string, brokerURL string) error {
+	if err := r.login(); err != nil {
+		return err
+	}
+
+	brokerGUID, err := r.upsertBroker(brokerName, brokerURL)
+	if err != nil {
+		return err
+	}
+	for _, plan := range r.conf.ServiceBroker.Plans {
+		if err = r.enablePlan(brokerGUID, plan); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// login fetches an access token from the UAA of the Cloud Controller.
+func (r *Registrar) login() error {
+	var info struct {
+		TokenEndpoint string `json:"token_endpoint"`
+	}
+	if err := r.call("GET", r.api+"/v2/info", nil, &info); err != nil {
+		return err
+	}
+	if info.TokenEndpoint == "" {
+		return ErrNoTokenEndpoint
+	}
+
+	form := url.Values{
+		"grant_type": {"password"},
+		"username":   {r.username},
+		"password":   {r.password},
+	}
+	req, err := http.NewRequest("POST", strings.TrimRight(info.TokenEndpoint, "/")+"/oauth/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(UAAClientID, "")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err = r.do(req, &token); err != nil {
+		return fmt.Errorf("failed to log in to Cloud Foundry: %s", err)
+	}
+	r.token = token.AccessToken
+	return nil
+}
+
+func (r *Registrar) upsertBroker(name string, brokerURL string) (string, error) {
+	body := map[string]string{
+		"name":          name,
+		"broker_url":    brokerURL,
+		"auth_username": r.conf.ServiceBroker.Auth.Username,
+		"auth_password": r.conf.ServiceBroker.Auth.Password,
+	}
+	existing, err := r.find("/v2/service_brokers", "name:"+name)
+	if err != nil {
+		return "", err
+	}
+
+	var broker struct {
+		Metadata struct {
+			GUID string `json:"guid"`
+		} `json:"metadata"`
+	}
+	if len(existing) > 0 {
+		err = r.call("PUT", r.api+"/v2/service_brokers/"+existing[0], body, &broker)
+		if err == nil {
+			fmt.Fprintf(r.out, "Updated the service broker %s\n", name)
+		}
+	} else {
+		err = r.call("POST", r.api+"/v2/service_brokers", body, &broker)
+		if err == nil {
+			fmt.Fprintf(r.out, "Created the service broker %s\n", name)
+		}
+	}
+	return broker.Metadata.GUID, err
+}
+
+func (r *Registrar) enablePlan(brokerGUID string, plan config.ServicePlanConfig) error {
+	planGUIDs, err := r.find("/v2/service_plans", "unique_id:"+plan.ID, "service_broker_guid:"+brokerGUID)
+	if err != nil {
+		return err
+	}
+	if len(planGUIDs) == 0 {
+		return fmt.Errorf("plan %s was not found in Cloud Foundry", plan.Name)
+	}
+	planGUID := planGUIDs[0]
+
+	public := len(plan.AllowedOrgs) == 0
+	if err = r.call("PUT", r.api+"/v2/service_plans/"+planGUID, map[string]bool{"public": public}, nil); err != nil {
+		return err
+	}
+	if public {
+		fmt.Fprintf(r.out, "Enabled access to the plan %s for all organizations\n", plan.Name)
+		return nil
+	}
+
+	for _, org := range plan.AllowedOrgs {
+		visibilities, err := r.find("/v2/service_plan_visibilities", "service_plan_guid:"+planGUID, "organization_guid:"+org)
+		if err != nil {
+			return err
+		}
+		if len(visibilities) == 0 {
+			err = r.call("POST", r.api+"/v2/service_plan_visibilities", map[string]string{
+				"service_plan_guid": planGUID,
+				"organization_guid": org,
+			}, nil)
+			if err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(r.out, "Enabled access to the plan %s for the organization %s\n", plan.Name, org)
+	}
+	return nil
+}
+
+// find returns the GUIDs of the resources at path that match all the
+// filters.
+func (r *Registrar) find(path string, filters ...string) ([]string, error) {
+	query := url.Values{"q": filters}
+	var found resources
+	if err := r.call("GET", r.api+path+"?"+query.Encode(), nil, &found); err != nil {
+		return nil, err
+	}
+	return found.guids(), nil
+}
+
+func (r *Registrar) call(verb string, endpoint string, payload interface{}, result interface{}) error {
+	var body io.Reader
+	if payload != nil {
+		encoded, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequest(verb, endpoint, body)
+	if err != nil {
+		return err
+	}
+	if r.token != "" {
+		req.Header.Set("Authorization", "bearer "+r.token)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return r.do(req, result)
+}
+
+func (r *Registrar) do(req *http.Request, result interface{}) error {
+	r.logger.Info("Calling the Cloud Foundry API", lager.Data{
+		"verb": req.Method,
+		"url":  req.URL.String(),
+	})
+	res, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		var cfError struct {
+			Description string `json:"description"`
+		}
+		json.Unmarshal(body, &cfError)
+		if cfError.Description == "" {
+			cfError.Description = strings.TrimSpace(string(body))
+		}
+		return fmt.Errorf("%s %s failed with status %d: %s", req.Method, req.URL.Path, res.StatusCode, cfError.Description)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(body, result)
+}
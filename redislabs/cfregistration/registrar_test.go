@@ -0,0 +1,159 @@
+package cfregistration_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/cfregistration"
+	brokerconfig "github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/testing"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/pivotal-golang/lager"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type call struct {
+	Verb  string
+	Path  string
+	Query []string
+	Body  map[string]interface{}
+}
+
+var _ = Describe("Registrar", func() {
+	var (
+		proxy     testing.HTTPProxy
+		conf      brokerconfig.Config
+		out       *gbytes.Buffer
+		calls     []call
+		brokers   []string
+		authorize string
+	)
+
+	resources := func(guids ...string) interface{} {
+		list := []map[string]interface{}{}
+		for _, guid := range guids {
+			list = append(list, map[string]interface{}{"metadata": map[string]string{"guid": guid}})
+		}
+		return map[string]interface{}{"resources": list}
+	}
+	record := func(r *http.Request) {
+		c := call{Verb: r.Method, Path: r.URL.Path, Query: r.URL.Query()["q"]}
+		if body, _ := ioutil.ReadAll(r.Body); len(body) > 0 {
+			json.Unmarshal(body, &c.Body)
+		}
+		if r.URL.Path != "/v2/info" && r.URL.Path != "/oauth/token" {
+			Expect(r.Header.Get("Authorization")).To(Equal("bearer access-token"))
+		}
+		calls = append(calls, c)
+	}
+
+	BeforeEach(func() {
+		calls = nil
+		brokers = nil
+		out = gbytes.NewBuffer()
+		conf = brokerconfig.Config{
+			ServiceBroker: brokerconfig.ServiceBrokerConfig{
+				Auth: brokerconfig.AuthConfig{Username: "broker", Password: "broker-password"},
+				Plans: []brokerconfig.ServicePlanConfig{
+					{ID: "public-plan-id", Name: "public"},
+					{ID: "private-plan-id", Name: "private", AllowedOrgs: []string{"org-guid"}},
+				},
+			},
+		}
+
+		proxy = testing.NewHTTPProxy()
+		proxy.RegisterEndpointHandler("/v2/info", func(w http.ResponseWriter, r *http.Request) interface{} {
+			return map[string]string{"token_endpoint": proxy.URL()}
+		})
+		proxy.RegisterEndpointHandler("/oauth/token", func(w http.ResponseWriter, r *http.Request) interface{} {
+			authorize, _, _ = r.BasicAuth()
+			r.ParseForm()
+			if r.Form.Get("password") != "cf-password" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return map[string]string{"error": "unauthorized"}
+			}
+			return map[string]string{"access_token": "access-token"}
+		})
+		proxy.RegisterEndpointHandler("/v2/service_brokers", func(w http.ResponseWriter, r *http.Request) interface{} {
+			record(r)
+			if r.Method == "GET" {
+				return resources(brokers...)
+			}
+			w.WriteHeader(http.StatusCreated)
+			return map[string]interface{}{"metadata": map[string]string{"guid": "new-broker-guid"}}
+		})
+		proxy.RegisterEndpointHandler("/v2/service_brokers/", func(w http.ResponseWriter, r *http.Request) interface{} {
+			record(r)
+			return map[string]interface{}{"metadata": map[string]string{"guid": strings.TrimPrefix(r.URL.Path, "/v2/service_brokers/")}}
+		})
+		proxy.RegisterEndpointHandler("/v2/service_plans", func(w http.ResponseWriter, r *http.Request) interface{} {
+			record(r)
+			return resources(strings.TrimPrefix(r.URL.Query()["q"][0], "unique_id:") + "-guid")
+		})
+		proxy.RegisterEndpointHandler("/v2/service_plans/", func(w http.ResponseWriter, r *http.Request) interface{} {
+			record(r)
+			return map[string]interface{}{}
+		})
+		proxy.RegisterEndpointHandler("/v2/service_plan_visibilities", func(w http.ResponseWriter, r *http.Request) interface{} {
+			record(r)
+			if r.Method == "GET" {
+				return resources()
+			}
+			w.WriteHeader(http.StatusCreated)
+			return map[string]interface{}{}
+		})
+	})
+
+	AfterEach(func() {
+		proxy.Close()
+	})
+
+	register := func(password string) error {
+		registrar := cfregistration.NewRegistrar(conf, proxy.URL(), "admin", password, false, out, lager.NewLogger("test"))
+		return registrar.Register("redislabs", "https://broker.example.com")
+	}
+
+	It("creates the broker and enables access to its plans", func() {
+		Expect(register("cf-password")).To(Succeed())
+		Expect(authorize).To(Equal("cf"))
+		Expect(calls).To(ContainElement(call{Verb: "POST", Path: "/v2/service_brokers", Body: map[string]interface{}{
+			"name":          "redislabs",
+			"broker_url":    "https://broker.example.com",
+			"auth_username": "broker",
+			"auth_password": "broker-password",
+		}}))
+		Expect(calls).To(ContainElement(call{Verb: "GET", Path: "/v2/service_plans",
+			Query: []string{"unique_id:public-plan-id", "service_broker_guid:new-broker-guid"}}))
+		Expect(calls).To(ContainElement(call{Verb: "PUT", Path: "/v2/service_plans/public-plan-id-guid",
+			Body: map[string]interface{}{"public": true}}))
+		Expect(calls).To(ContainElement(call{Verb: "PUT", Path: "/v2/service_plans/private-plan-id-guid",
+			Body: map[string]interface{}{"public": false}}))
+		Expect(calls).To(ContainElement(call{Verb: "POST", Path: "/v2/service_plan_visibilities", Body: map[string]interface{}{
+			"service_plan_guid": "private-plan-id-guid",
+			"organization_guid": "org-guid",
+		}}))
+		Expect(out).To(gbytes.Say("Created the service broker redislabs"))
+	})
+
+	It("updates an existing broker", func() {
+		brokers = []string{"broker-guid"}
+		Expect(register("cf-password")).To(Succeed())
+		Expect(calls).To(ContainElement(call{Verb: "PUT", Path: "/v2/service_brokers/broker-guid", Body: map[string]interface{}{
+			"name":          "redislabs",
+			"broker_url":    "https://broker.example.com",
+			"auth_username": "broker",
+			"auth_password": "broker-password",
+		}}))
+		Expect(out).To(gbytes.Say("Updated the service broker redislabs"))
+	})
+
+	It("fails when the login fails", func() {
+		err := register("wrong")
+		Expect(err).To(MatchError(ContainSubstring("failed to log in to Cloud Foundry")))
+		Expect(calls).To(BeEmpty())
+	})
+})
@@ -1,11 +1,85 @@
 package cluster
 
+// MaxDatabaseNameLength is the longest database name the cluster accepts.
+const MaxDatabaseNameLength = 63
+
 // InstanceCredentials contains properties necessary for identifying a
 // cluster instance (database) and connecting to it.
 type InstanceCredentials struct {
 	UID      int
+	Name     string
 	Host     string
 	Port     int
 	IPList   []string
 	Password string
+	TLS      bool
+	// ReadEndpoints lists the endpoints serving replica shards, if any.
+	ReadEndpoints []Endpoint
+}
+
+// Endpoint is an additional address a database can be reached at.
+type Endpoint struct {
+	Host   string
+	Port   int
+	IPList []string
+}
+
+// MemoryUsage describes the memory of a database in bytes.
+type MemoryUsage struct {
+	Limit int64
+	Used  int64
+}
+
+// Action is a long running operation of the cluster on a database,
+// e.g. resharding. Status is one of "queued", "starting", "running",
+// "completed", "failed" or "cancelled".
+type Action struct {
+	UID      string
+	Name     string
+	Status   string
+	Progress float64
+}
+
+// DatabaseProgress describes how far the cluster got creating a database.
+type DatabaseProgress struct {
+	Status string
+	// Shards is the number of shards placed on the nodes so far, out of
+	// ShardsWanted, which counts the replica shards as well.
+	Shards       int
+	ShardsWanted int
+	Endpoints    int
+}
+
+// DatabaseStats describes the latest utilization of a database.
+type DatabaseStats struct {
+	MemoryLimit int64 // bytes
+	UsedMemory  int64 // bytes
+	OpsPerSec   float64
+	Connections int64
+	Keys        int64
+	// Persistence is disabled, aof or snapshot.
+	Persistence string
+}
+
+// Info describes the cluster.
+type Info struct {
+	Name string
+}
+
+// Module is a Redis module installed on the cluster.
+type Module struct {
+	UID     string
+	Name    string
+	Version string
+}
+
+// Node is a node of the cluster.
+type Node struct {
+	UID     int
+	Address string
+	// TotalMemory is the memory of the node in bytes.
+	TotalMemory int64
+	// Status is active, or provisioning, decommissioning or down while
+	// the node is under maintenance or failed.
+	Status string
 }
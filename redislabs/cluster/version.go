@@ -0,0 +1,75 @@
+package cluster
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a version of Redis Enterprise, e.g. 6.0.20-97.
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+	// Build is the rest of the version as the cluster reports it.
+	Build string
+}
+
+// Capability is a feature of the cluster the broker relies on.
+type Capability struct {
+	Name  string
+	Since Version
+}
+
+var (
+	// ACLUsers are the Redis ACLs, roles and users the bindings of plans
+	// with an ACL and read-only bindings authenticate with.
+	ACLUsers = Capability{Name: "ACL users", Since: Version{Major: 6}}
+	// Modules are the Redis modules installed on the cluster.
+	Modules = Capability{Name: "modules", Since: Version{Major: 5}}
+	// TLSModes are the tls_mode and enforce_client_authentication
+	// database settings, which replace the ssl setting.
+	TLSModes = Capability{Name: "TLS modes", Since: Version{Major: 5, Minor: 6}}
+)
+
+// ParseVersion parses versions like 6.0.20-97 or 5.4.
+func ParseVersion(version string) (Version, error) {
+	v := Version{}
+	numbers := version
+	if i := strings.IndexAny(version, "-+ "); i >= 0 {
+		numbers, v.Build = version[:i], version[i+1:]
+	}
+	parts := strings.Split(numbers, ".")
+	if len(parts) > 3 {
+		return v, fmt.Errorf("version %q is malformed", version)
+	}
+	fields := []*int{&v.Major, &v.Minor, &v.Patch}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return v, fmt.Errorf("version %q is malformed", version)
+		}
+		*fields[i] = n
+	}
+	return v, nil
+}
+
+// AtLeast tells whether the version is the other one or a later one. The
+// builds are not compared.
+func (v Version) AtLeast(other Version) bool {
+	if v.Major != other.Major {
+		return v.Major > other.Major
+	}
+	if v.Minor != other.Minor {
+		return v.Minor > other.Minor
+	}
+	return v.Patch >= other.Patch
+}
+
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Build != "" {
+		s += "-" + v.Build
+	}
+	return s
+}
@@ -1,7 +1,7 @@
 package config
 
 import (
-	"os"
+	"io/ioutil"
 
 	"github.com/cloudfoundry-incubator/candiedyaml"
 )
@@ -12,18 +12,235 @@ type Config struct {
 }
 
 type ClusterConfig struct {
-	Auth    AuthConfig `yaml:"auth"`
-	Address string     `yaml:"address"`
+	Auth    AuthConfig    `yaml:"auth"`
+	Address string        `yaml:"address"`
+	Polling PollingConfig `yaml:"polling"`
+	// CacheTTL is how many seconds responses for slowly changing cluster
+	// documents, like the Redis ACLs and roles, are reused. They are not
+	// cached if it is 0.
+	CacheTTL       int                  `yaml:"cache_ttl"`
+	RateLimit      RateLimitConfig      `yaml:"rate_limit"`
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuit_breaker"`
+	// SkipMaintenanceCheck lets databases be created, updated and deleted
+	// while nodes of the cluster are not active, e.g. in a cluster that
+	// runs degraded on purpose.
+	SkipMaintenanceCheck bool `yaml:"skip_maintenance_check"`
+	// EndpointAddress is what the binding credentials give as the host
+	// of a database: "dns" for the DNS name of its endpoint (the
+	// default), "ip" for the first endpoint IP address, or "both" for
+	// the DNS name along with an ip and an ip_uri. Plans may override it.
+	EndpointAddress string `yaml:"endpoint_address"`
+}
+
+// CircuitBreakerConfig makes the broker stop sending requests to the
+// cluster API for Cooldown seconds after Failures failed requests in a
+// row. It is disabled if Failures is 0.
+type CircuitBreakerConfig struct {
+	Failures int `yaml:"failures"`
+	Cooldown int `yaml:"cooldown"`
+}
+
+// RateLimitConfig limits the requests the broker sends to the cluster API.
+// Requests are not limited if RequestsPerSecond is 0.
+type RateLimitConfig struct {
+	RequestsPerSecond float64 `yaml:"requests_per_second"`
+	Burst             int     `yaml:"burst"`
+}
+
+// PollingConfig controls how often the cluster is asked whether a database
+// has become active. The interval between the requests starts at
+// InitialInterval and is multiplied by Multiplier after every request until
+// it reaches MaxInterval. Each interval is randomly shortened or extended
+// by up to Jitter (a fraction of the interval) so that concurrent
+// provisions do not poll in lockstep. Zero values fall back to defaults,
+// but for a Jitter of 0, which polls at exact intervals.
+type PollingConfig struct {
+	InitialInterval int      `yaml:"initial_interval"` // milliseconds
+	MaxInterval     int      `yaml:"max_interval"`     // milliseconds
+	Multiplier      float64  `yaml:"multiplier"`
+	Jitter          *float64 `yaml:"jitter"` // 0.2 if omitted
 }
 
 type ServiceBrokerConfig struct {
-	Auth        AuthConfig          `yaml:"auth"`
-	Plans       []ServicePlanConfig `yaml:"plans"`
-	ServiceID   string              `yaml:"service_id"`
-	Port        int                 `yaml:"port"`
-	Name        string              `yaml:"name"`
-	Description string              `yaml:"description"`
-	Metadata    ServiceMetadata     `yaml:"metadata"`
+	Auth                 AuthConfig          `yaml:"auth"`
+	Plans                []ServicePlanConfig `yaml:"plans"`
+	ServiceID            string              `yaml:"service_id"`
+	Port                 int                 `yaml:"port"`
+	Name                 string              `yaml:"name"`
+	Description          string              `yaml:"description"`
+	Metadata             ServiceMetadata     `yaml:"metadata"`
+	OrphanCheckInterval  int                 `yaml:"orphan_check_interval"` // seconds, 0 disables the check
+	Admin                AdminConfig         `yaml:"admin"`
+	DatabaseNameTemplate string              `yaml:"database_name_template"`
+	CFContextTags        bool                `yaml:"cf_context_tags"`
+	// MaxConcurrentOperations limits how many provisions, updates and
+	// deprovisions are processed at the same time.
+	MaxConcurrentOperations int `yaml:"max_concurrent_operations"`
+	// PasswordPolicy controls the database passwords the broker
+	// generates.
+	PasswordPolicy PasswordPolicyConfig `yaml:"password_policy"`
+	// PasswordRotationGracePeriod keeps the old password of a database
+	// valid for this many seconds after a rotation, so that apps can be
+	// rebound in the meantime.
+	PasswordRotationGracePeriod int `yaml:"password_rotation_grace_period"`
+	// DeletionRetentionPeriod keeps the databases of deprovisioned
+	// instances for this many seconds, so that operators can restore
+	// them. Databases are deleted right away if it is 0.
+	DeletionRetentionPeriod int `yaml:"deletion_retention_period"`
+	// AsyncCreationTimeout is how many seconds the database of an
+	// instance provisioned asynchronously may take to become active
+	// before it is deleted, an hour if it is 0. Synchronous provisions
+	// wait 15 seconds at most.
+	AsyncCreationTimeout int `yaml:"async_creation_timeout"`
+	// RejectDeprovisionWithBindings refuses to delete instances that
+	// still have bindings recorded in the state.
+	RejectDeprovisionWithBindings bool `yaml:"reject_deprovision_with_bindings"`
+	// RefreshEndpointsOnBind asks the cluster for the endpoints of a
+	// database on every binding and records them if they moved, rather
+	// than returning the ones recorded on provisioning.
+	RefreshEndpointsOnBind bool `yaml:"refresh_endpoints_on_bind"`
+	// CredentialRefreshInterval is how many seconds pass between the
+	// refreshes of the recorded credentials from the cluster. They are
+	// not refreshed if it is 0.
+	CredentialRefreshInterval int `yaml:"credential_refresh_interval"`
+	// UsageAPI enables the API that shows developers the utilization
+	// of their service instances.
+	UsageAPI bool `yaml:"usage_api"`
+	// Log controls what the broker logs and where to.
+	Log LogConfig `yaml:"log"`
+	// Bindable and PlanUpdateable are the defaults for the plans of the
+	// service, true if omitted.
+	Bindable       *bool `yaml:"bindable"`
+	PlanUpdateable *bool `yaml:"plan_updateable"`
+	// Tags are advertised with the service, ["redislabs"] if omitted.
+	Tags []string `yaml:"tags"`
+	// StatePersister selects where the broker state is kept.
+	StatePersister StatePersisterConfig `yaml:"state_persister"`
+	// Hooks are run before and after service instances are created or
+	// deleted.
+	Hooks []HookConfig `yaml:"hooks"`
+	// Webhooks are notified of the lifecycle events of the instances and
+	// bindings.
+	Webhooks []WebhookConfig `yaml:"webhooks"`
+	// SecurityEvents sends the security events of the broker to syslog.
+	SecurityEvents SecurityEventsConfig `yaml:"security_events"`
+	// Metrics forwards the stats of the databases to the metrics system
+	// of the platform.
+	Metrics MetricsConfig `yaml:"metrics"`
+}
+
+// HookConfig is a command the broker runs when it provisions or
+// deprovisions an instance, e.g. to register the database in a CMDB. The
+// command gets the instance as JSON on its stdin.
+type HookConfig struct {
+	Name    string   `yaml:"name"`
+	Command string   `yaml:"command"`
+	Args    []string `yaml:"args"`
+	// Phase is pre to run the command before the operation, a failing
+	// command then rejects it, or post to run it after the operation
+	// succeeded.
+	Phase string `yaml:"phase"`
+	// Actions are provision, deprovision or both, the default.
+	Actions []string `yaml:"actions"`
+	Timeout int      `yaml:"timeout"` // seconds, 30 by default
+}
+
+// StatePersisterConfig selects where the broker state is kept: in a local
+// file by default, or in a Redis database that several brokers behind
+// one route can share. Brokers sharing a state elect a leader that runs
+// the background tasks.
+type StatePersisterConfig struct {
+	Type string `yaml:"type"` // local or redis
+	// File overrides the path of the local state file.
+	File  string           `yaml:"file"`
+	Redis RedisStateConfig `yaml:"redis"`
+	// LeaseTTL is how many seconds the leader stays the leader without
+	// renewing its lease, 30 by default.
+	LeaseTTL int `yaml:"lease_ttl"`
+}
+
+type RedisStateConfig struct {
+	Address  string `yaml:"address"` // host:port
+	Password string `yaml:"password"`
+	TLS      bool   `yaml:"tls"`
+	// KeyPrefix is prepended to the keys of the broker, so that several
+	// brokers can use the same database. "redislabs-broker:" by default.
+	KeyPrefix string `yaml:"key_prefix"`
+}
+
+// WebhookConfig is an endpoint the broker POSTs its events to as JSON,
+// signed with the secret so that the endpoint can check where they come
+// from.
+type WebhookConfig struct {
+	URL    string `yaml:"url"`
+	Secret string `yaml:"secret"`
+	// Events are the types of the events sent, e.g. instance.created,
+	// all of them by default.
+	Events            []string `yaml:"events"`
+	Timeout           int      `yaml:"timeout"` // seconds, 10 by default
+	SkipSSLValidation bool     `yaml:"skip_ssl_validation"`
+}
+
+// SecurityEventsConfig sends authentication failures, credential
+// rotations and the use of the admin API as CEF lines to a syslog
+// server, e.g. the one of a SIEM.
+type SecurityEventsConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Network and Address select the syslog server, e.g. tcp and
+	// siem.example.com:514, the local syslog if they are omitted.
+	Network string `yaml:"network"`
+	Address string `yaml:"address"`
+	Tag     string `yaml:"tag"` // redislabs-service-broker by default
+}
+
+// MetricsConfig forwards the stats of the databases as StatsD gauges,
+// e.g. to the statsd injector next to the metron agent, so that developers
+// see them alongside the metrics of their apps.
+type MetricsConfig struct {
+	// Interval is how many seconds pass between the forwards. The stats
+	// are not forwarded if it is 0.
+	Interval int    `yaml:"interval"`
+	Address  string `yaml:"address"` // localhost:8125 by default
+	Prefix   string `yaml:"prefix"`  // redislabs by default
+	// Tags sends the instance ID, plan and GUIDs of the organization and
+	// space as DogStatsD tags, rather than the instance ID in the names of
+	// the gauges.
+	Tags bool `yaml:"tags"`
+}
+
+// LogConfig selects the log level, the format of the log lines and the
+// sinks they are written to. By default everything is logged as JSON to
+// stdout.
+type LogConfig struct {
+	Level  string          `yaml:"level"`  // debug, info or error
+	Format string          `yaml:"format"` // json or human
+	Sinks  []LogSinkConfig `yaml:"sinks"`
+	// LogSensitive logs passwords, secrets and tokens as they are. They
+	// are redacted by default.
+	LogSensitive bool `yaml:"log_sensitive"`
+}
+
+// LogSinkConfig is a destination of the log lines. Its Type is stdout,
+// file or syslog.
+type LogSinkConfig struct {
+	Type string `yaml:"type"`
+	// Path is the file to log to. Once it grows beyond MaxSize
+	// megabytes, it is rotated and MaxBackups earlier files are kept.
+	// It is never rotated if MaxSize is 0.
+	Path       string `yaml:"path"`
+	MaxSize    int    `yaml:"max_size"`
+	MaxBackups int    `yaml:"max_backups"`
+	// Network and Address locate the syslog server, the local one if
+	// they are empty. Tag is the program name in the messages.
+	Network string `yaml:"network"`
+	Address string `yaml:"address"`
+	Tag     string `yaml:"tag"`
+}
+
+// AdminConfig configures the operator facing API. The API is disabled
+// unless credentials are given.
+type AdminConfig struct {
+	Auth AuthConfig `yaml:"auth"`
 }
 
 type AuthConfig struct {
@@ -31,47 +248,181 @@ type AuthConfig struct {
 	Username string `yaml:"username"`
 }
 
+type PasswordPolicyConfig struct {
+	Length int `yaml:"length"` // 48 by default
+	// CharacterClasses are some of lowercase, uppercase, digits and
+	// symbols, all of them by default.
+	CharacterClasses []string `yaml:"character_classes"`
+}
+
 type ServicePlanConfig struct {
-	ID                    string                `yaml:"id"`
-	Name                  string                `yaml:"name"`
+	ID   string `yaml:"id"`
+	Name string `yaml:"name"`
+	// Extends names a plan whose settings, metadata and other keys this
+	// plan gets unless it sets them itself, e.g. to only change the
+	// memory of a base plan. The id and name are not inherited.
+	Extends               string                `yaml:"extends"`
 	Description           string                `yaml:"description"`
 	Metadata              ServicePlanMetadata   `yaml:"metadata"`
 	ServiceInstanceConfig ServiceInstanceConfig `yaml:"settings"`
+	// AllowedParameters lists the parameters developers may set on
+	// provision and update. All the parameters are allowed if omitted.
+	AllowedParameters []string `yaml:"allowed_parameters"`
+	// Free, Bindable and PlanUpdateable are published in the catalog.
+	// Bindable and PlanUpdateable default to the settings of the
+	// service.
+	Free           *bool `yaml:"free"`
+	Bindable       *bool `yaml:"bindable"`
+	PlanUpdateable *bool `yaml:"plan_updateable"`
+	// AllowedOrgs lists the GUIDs of the organizations that may create
+	// instances of the plan. All organizations may if omitted.
+	AllowedOrgs []string `yaml:"allowed_orgs"`
+	// ACL grants a cluster role Redis ACL rules on the databases of the
+	// plan. Bindings without a role get users of this role instead of
+	// the database password.
+	ACL PlanACLConfig `yaml:"acl"`
+	// EndpointAddress overrides the one of the cluster.
+	EndpointAddress string `yaml:"endpoint_address"`
+	// Sentinel adds the address of the sentinel compatible discovery
+	// service of the cluster to the binding credentials.
+	Sentinel bool `yaml:"sentinel"`
+	// Auth are the cluster API credentials the databases of the plan are
+	// managed with, e.g. of a user that may only manage those databases.
+	// The credentials of the cluster are used if omitted.
+	Auth AuthConfig `yaml:"auth"`
+}
+
+// PlanACLConfig is the Redis ACL the apps bound to the databases of a
+// plan get, e.g. the rules "+@all -flushall -flushdb -keys ~*" deny
+// wiping and scanning the databases. The role is given to the apps in the
+// binding credentials, the ACL is named after it unless Name is set.
+type PlanACLConfig struct {
+	Role  string `yaml:"role"`
+	Name  string `yaml:"name"`
+	Rules string `yaml:"rules"`
 }
 
 type ServicePlanMetadata struct {
-	Bullets []string `yaml:"bullets"`
+	DisplayName string            `yaml:"display_name"`
+	Bullets     []string          `yaml:"bullets"`
+	Costs       []ServicePlanCost `yaml:"costs"`
+}
+
+// ServicePlanCost is a price of a plan, e.g. an amount of {usd: 99.0} per
+// unit "MONTHLY".
+type ServicePlanCost struct {
+	Amount map[string]float64 `yaml:"amount"`
+	Unit   string             `yaml:"unit"`
 }
 
 type ServiceInstanceConfig struct {
-	MemoryLimit int64    `yaml:"memory"`
-	Replication bool     `yaml:"replication"`
-	ShardCount  int64    `yaml:"shard_count"`
-	Persistence string   `yaml:"persistence"`
-	Snapshot    Snapshot `yaml:"snapshot"`
+	MemoryLimit int64  `yaml:"memory"`
+	Replication bool   `yaml:"replication"`
+	ShardCount  int64  `yaml:"shard_count"`
+	Persistence string `yaml:"persistence"`
+	// Snapshot lists the rules of the snapshot persistence, either a
+	// single {writes, secs} rule or a list of them.
+	Snapshot SnapshotPolicy `yaml:"snapshot"`
+	// MinMemoryLimit and MaxMemoryLimit bound the memory_size developers
+	// may request. Zero values are not checked.
+	MinMemoryLimit int64 `yaml:"min_memory"`
+	MaxMemoryLimit int64 `yaml:"max_memory"`
+	// RackAware places the master and replica shards of a database in
+	// different racks or zones. It requires replication and a rack-zone
+	// aware cluster.
+	RackAware bool `yaml:"rack_aware"`
+	// ShardsPlacement is either "dense" (shards on as few nodes as
+	// possible) or "sparse" (shards spread across the nodes). The cluster
+	// default applies if empty.
+	ShardsPlacement string `yaml:"shards_placement"`
+	// Port is the endpoint port of the databases, which the cluster
+	// picks if zero. A port in PortRange is picked otherwise, if set.
+	// Developers may request a port within the range.
+	Port      int       `yaml:"port"`
+	PortRange PortRange `yaml:"port_range"`
+	// Nodes lists the UIDs of the cluster nodes that may host the
+	// shards and endpoints of the databases, all nodes may if empty.
+	Nodes []int64 `yaml:"nodes"`
+	// DenyMemoryShrink rejects updates to this plan that would reduce
+	// the memory of a database. Reducing it below the memory in use is
+	// always rejected.
+	DenyMemoryShrink bool `yaml:"deny_memory_shrink"`
+	// MaxConnections limits the client connections of each database
+	// endpoint. Developers may request a lower limit. The databases
+	// accept as many connections as the cluster allows if zero.
+	MaxConnections int64 `yaml:"max_connections"`
+	// TLS requires TLS connections to the databases.
+	TLS bool `yaml:"tls"`
+	// ClientCA is the PEM certificate of the CA that signs the client
+	// certificates of the apps, e.g. the instance identity CA of the
+	// platform. The databases then only accept TLS connections with a
+	// certificate it signed. It requires TLS.
+	ClientCA string `yaml:"client_ca"`
 }
 
+// PortRange is an inclusive range of endpoint ports.
+type PortRange struct {
+	Min int `yaml:"min"`
+	Max int `yaml:"max"`
+}
+
+// Snapshot is a rule of the snapshot persistence: a snapshot is taken
+// Secs seconds after Writes writes.
 type Snapshot struct {
 	Writes int `yaml:"writes"`
 	Secs   int `yaml:"secs"`
 }
 
+// SnapshotPolicy is the list of snapshot rules of a plan, a snapshot is
+// taken as soon as any of them applies.
+type SnapshotPolicy []Snapshot
+
+// UnmarshalYAML reads a list of rules as well as the single rule of older
+// configs.
+func (p *SnapshotPolicy) UnmarshalYAML(tag string, value interface{}) error {
+	bytes, err := candiedyaml.Marshal(value)
+	if err != nil {
+		return err
+	}
+	if _, ok := value.([]interface{}); ok {
+		rules := []Snapshot{}
+		if err := candiedyaml.Unmarshal(bytes, &rules); err != nil {
+			return err
+		}
+		*p = rules
+		return nil
+	}
+	rule := Snapshot{}
+	if err := candiedyaml.Unmarshal(bytes, &rule); err != nil {
+		return err
+	}
+	*p = SnapshotPolicy{rule}
+	return nil
+}
+
 type ServiceMetadata struct {
 	DisplayName         string `yaml:"display_name"`
 	Image               string `yaml:"image"`
 	ProviderDisplayName string `yaml:"provider_display_name"`
+	// Shareable lets developers share instances with other spaces. It
+	// is true by default.
+	Shareable *bool `yaml:"shareable"`
 }
 
 func LoadFromFile(path string) (Config, error) {
-	file, err := os.Open(path)
+	contents, err := ioutil.ReadFile(path)
 	if err != nil {
 		return Config{}, err
 	}
 
 	var config Config
-	if err := candiedyaml.NewDecoder(file).Decode(&config); err != nil {
+	if err := candiedyaml.Unmarshal(contents, &config); err != nil {
+		return Config{}, err
+	}
+	if err := resolveExtends(contents, &config); err != nil {
 		return Config{}, err
 	}
-	// TODO: add validations here
+	// The config is checked by Validate, so that the validate command
+	// can list all of its problems.
 	return config, nil
 }
@@ -2,8 +2,10 @@ package config_test
 
 import (
 	brokerconfig "github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+	"github.com/cloudfoundry-incubator/candiedyaml"
 
-	// "os"
+	"io/ioutil"
+	"os"
 	"path"
 	"path/filepath"
 
@@ -45,7 +47,11 @@ var _ = Describe("Config", func() {
 			Ω(config.ServiceBroker.Metadata.ProviderDisplayName).To(Equal("RedisLabs"))
 		})
 		It("loads service broker plans", func() {
-			Ω(config.ServiceBroker.Plans).To(Equal("redislabs-service-broker-0b814f"))
+			plans := config.ServiceBroker.Plans
+			Ω(plans).To(HaveLen(3))
+			Ω(plans[0].ID).To(Equal("rlec-minimal-plan-4fc771"))
+			Ω(plans[1].Name).To(Equal("medium"))
+			Ω(plans[2].Description).To(Equal("3 shard, with HA, no snapshots, 20gb of memory"))
 		})
 	})
 
@@ -55,7 +61,7 @@ var _ = Describe("Config", func() {
 		})
 
 		It("returns an error", func() {
-			Ω(parseConfigErr).Should(MatchError(ContainSubstring("not found")))
+			Ω(os.IsNotExist(parseConfigErr)).Should(BeTrue())
 		})
 	})
 
@@ -68,4 +74,149 @@ var _ = Describe("Config", func() {
 		})
 	})
 
+	Context("when plans extend other plans", func() {
+		BeforeEach(func() {
+			configPath = "extending_config.yml"
+		})
+		It("merges them with the plans they extend", func() {
+			Ω(parseConfigErr).NotTo(HaveOccurred())
+			plans := config.ServiceBroker.Plans
+			Ω(plans).To(HaveLen(3))
+
+			Ω(plans[1].ID).To(Equal("large-plan"))
+			Ω(plans[1].Extends).To(Equal("base"))
+			Ω(plans[1].Metadata.DisplayName).To(Equal("100"))
+			Ω(plans[1].Metadata.Bullets).To(Equal([]string{"With HA"}))
+			Ω(plans[1].AllowedParameters).To(Equal([]string{"name", "memory_size"}))
+			settings := plans[1].ServiceInstanceConfig
+			Ω(settings.MemoryLimit).To(Equal(int64(21474836480)))
+			Ω(settings.ShardCount).To(Equal(int64(4)))
+			Ω(settings.Replication).To(BeTrue())
+			Ω(settings.Snapshot).To(Equal(brokerconfig.SnapshotPolicy{{Writes: 1, Secs: 3600}}))
+
+			Ω(plans[2].Name).To(Equal("larger"))
+			Ω(plans[2].Description).To(Equal("4 shards, with HA, 20gb of memory"))
+			Ω(plans[2].ServiceInstanceConfig.ShardCount).To(Equal(int64(4)))
+			Ω(plans[2].ServiceInstanceConfig.Replication).To(BeFalse())
+		})
+		It("rejects unknown and circular plans", func() {
+			dir, err := ioutil.TempDir("", "config")
+			Ω(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(dir)
+			load := func(plans string) error {
+				file := path.Join(dir, "config.yml")
+				Ω(ioutil.WriteFile(file, []byte("broker:\n  plans:\n"+plans), 0600)).To(Succeed())
+				_, err := brokerconfig.LoadFromFile(file)
+				return err
+			}
+			Ω(load("  - {name: a, extends: b}\n")).To(MatchError(`plan "a" extends the unknown plan "b"`))
+			Ω(load("  - {name: a, extends: b}\n  - {name: b, extends: a}\n")).To(MatchError(`plan "b" extends itself through plan "a"`))
+		})
+	})
+
+	Describe("Validate", func() {
+		var valid brokerconfig.Config
+
+		BeforeEach(func() {
+			valid = brokerconfig.Config{
+				Cluster: brokerconfig.ClusterConfig{
+					Address: "https://cluster:9443",
+					Auth:    brokerconfig.AuthConfig{Username: "admin", Password: "secret"},
+				},
+				ServiceBroker: brokerconfig.ServiceBrokerConfig{
+					ServiceID: "service-id",
+					Name:      "redislabs",
+					Port:      8080,
+					Auth:      brokerconfig.AuthConfig{Username: "broker", Password: "secret"},
+					Plans: []brokerconfig.ServicePlanConfig{{
+						ID:                    "plan-id",
+						Name:                  "plan",
+						ServiceInstanceConfig: brokerconfig.ServiceInstanceConfig{MemoryLimit: 1024},
+					}},
+				},
+			}
+		})
+
+		It("accepts a complete config", func() {
+			Ω(valid.Validate()).To(BeEmpty())
+		})
+
+		It("reports missing credentials", func() {
+			valid.Cluster.Auth.Password = ""
+			Ω(valid.Validate()).To(ConsistOf(MatchError("cluster.auth needs a username and a password")))
+		})
+
+		It("reports duplicate plans", func() {
+			valid.ServiceBroker.Plans = append(valid.ServiceBroker.Plans, valid.ServiceBroker.Plans[0])
+			Ω(valid.Validate()).To(ConsistOf(
+				MatchError(`plan id "plan-id" is used more than once`),
+				MatchError(`plan name "plan" is used more than once`),
+			))
+		})
+
+		It("reports unknown plan settings", func() {
+			valid.ServiceBroker.Plans[0].ServiceInstanceConfig.Persistence = "always"
+			Ω(valid.Validate()).To(HaveLen(1))
+		})
+
+		It("reports client certificates without TLS", func() {
+			valid.ServiceBroker.Plans[0].ServiceInstanceConfig.ClientCA = "not a certificate"
+			Ω(valid.Validate()).To(ConsistOf(
+				MatchError(`plan "plan" needs tls for its client_ca`),
+				MatchError(`plan "plan" has a client_ca that is not a PEM certificate`),
+			))
+		})
+
+		It("reports snapshot rules that never apply", func() {
+			valid.ServiceBroker.Plans[0].ServiceInstanceConfig.Snapshot = brokerconfig.SnapshotPolicy{{Writes: 1}}
+			Ω(valid.Validate()).To(ConsistOf(MatchError(`plan "plan" has a snapshot rule without positive writes and secs`)))
+		})
+
+		It("reports hooks that would never run", func() {
+			valid.ServiceBroker.Hooks = []brokerconfig.HookConfig{
+				{Name: "cmdb", Command: "/bin/register", Phase: "post", Actions: []string{"provision"}},
+				{Name: "slack", Phase: "after", Actions: []string{"bind"}},
+			}
+			Ω(valid.Validate()).To(ConsistOf(
+				MatchError(`hook "slack" has no command`),
+				MatchError(`hook "slack" has an unknown phase "after", use pre or post`),
+				MatchError(`hook "slack" has an unknown action "bind", use provision or deprovision`),
+			))
+		})
+
+		It("reports webhooks events can not be sent to", func() {
+			valid.ServiceBroker.Webhooks = []brokerconfig.WebhookConfig{
+				{URL: "https://events.example.com/broker", Secret: "secret", Events: []string{"instance.created"}},
+				{URL: "events.example.com", Events: []string{"instance.moved"}},
+			}
+			Ω(valid.Validate()).To(ConsistOf(
+				MatchError(`webhook 1 has no http or https url`),
+				MatchError(`webhook 1 has no secret to sign the events with`),
+				MatchError(`webhook 1 has an unknown event "instance.moved"`),
+			))
+		})
+
+		It("reports metrics that can not be forwarded", func() {
+			valid.ServiceBroker.Metrics = brokerconfig.MetricsConfig{Interval: -1, Address: "localhost"}
+			Ω(valid.Validate()).To(ConsistOf(
+				MatchError("broker.metrics.interval is negative"),
+				MatchError(`broker.metrics.address "localhost" is not a host:port`),
+			))
+		})
+	})
+
+	Describe("Snapshot policies", func() {
+		It("load a list of rules", func() {
+			var settings brokerconfig.ServiceInstanceConfig
+			err := candiedyaml.Unmarshal([]byte("snapshot:\n- {writes: 1, secs: 3600}\n- {writes: 100, secs: 60}\n"), &settings)
+			Ω(err).NotTo(HaveOccurred())
+			Ω(settings.Snapshot).To(Equal(brokerconfig.SnapshotPolicy{{Writes: 1, Secs: 3600}, {Writes: 100, Secs: 60}}))
+		})
+		It("load the single rule of older configs", func() {
+			var settings brokerconfig.ServiceInstanceConfig
+			err := candiedyaml.Unmarshal([]byte("snapshot:\n  writes: 1\n  secs: 3600\n"), &settings)
+			Ω(err).NotTo(HaveOccurred())
+			Ω(settings.Snapshot).To(Equal(brokerconfig.SnapshotPolicy{{Writes: 1, Secs: 3600}}))
+		})
+	})
 })
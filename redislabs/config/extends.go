@@ -0,0 +1,131 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/cloudfoundry-incubator/candiedyaml"
+)
+
+// notInherited are the keys of a plan that a plan extending it does not
+// get.
+var notInherited = map[interface{}]bool{"id": true, "name": true, "extends": true}
+
+// resolvePlans merges every plan of the document, as decoded into plain
+// maps and lists, that extends another plan with that plan, so that the
+// Config it decodes to has complete plans. The settings of the extending
+// plan win, maps like its settings are merged key by key. It returns
+// false if no plan extends another.
+func resolvePlans(document interface{}) (bool, error) {
+	root, _ := document.(map[interface{}]interface{})
+	broker, _ := root["broker"].(map[interface{}]interface{})
+	plans, _ := broker["plans"].([]interface{})
+
+	byName := map[string]map[interface{}]interface{}{}
+	extending := false
+	for _, plan := range plans {
+		plan, ok := plan.(map[interface{}]interface{})
+		if !ok {
+			continue
+		}
+		if name, ok := plan["name"].(string); ok {
+			byName[name] = plan
+		}
+		if _, ok := plan["extends"]; ok {
+			extending = true
+		}
+	}
+	if !extending {
+		return false, nil
+	}
+
+	resolved := map[string]map[interface{}]interface{}{}
+	var resolve func(name string, plan map[interface{}]interface{}, seen map[string]bool) (map[interface{}]interface{}, error)
+	resolve = func(name string, plan map[interface{}]interface{}, seen map[string]bool) (map[interface{}]interface{}, error) {
+		if merged, ok := resolved[name]; ok && name != "" {
+			return merged, nil
+		}
+		parentName, ok := plan["extends"].(string)
+		if !ok {
+			if _, ok := plan["extends"]; ok {
+				return nil, fmt.Errorf("plan %q must extend a plan name", name)
+			}
+			return plan, nil
+		}
+		if seen[parentName] {
+			return nil, fmt.Errorf("plan %q extends itself through plan %q", name, parentName)
+		}
+		parent, ok := byName[parentName]
+		if !ok {
+			return nil, fmt.Errorf("plan %q extends the unknown plan %q", name, parentName)
+		}
+		seen[parentName] = true
+		base, err := resolve(parentName, parent, seen)
+		if err != nil {
+			return nil, err
+		}
+		merged := map[interface{}]interface{}{}
+		for key, value := range base {
+			if !notInherited[key] {
+				merged[key] = value
+			}
+		}
+		for key, value := range plan {
+			merged[key] = mergeValues(merged[key], value)
+		}
+		if name != "" {
+			resolved[name] = merged
+		}
+		return merged, nil
+	}
+
+	for i, plan := range plans {
+		plan, ok := plan.(map[interface{}]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := plan["name"].(string)
+		merged, err := resolve(name, plan, map[string]bool{name: true})
+		if err != nil {
+			return false, err
+		}
+		plans[i] = merged
+	}
+	return true, nil
+}
+
+// mergeValues returns the value of an extending plan merged into the one
+// of the plan it extends: maps are merged, other values replaced.
+func mergeValues(base interface{}, value interface{}) interface{} {
+	baseMap, ok := base.(map[interface{}]interface{})
+	valueMap, ok2 := value.(map[interface{}]interface{})
+	if !ok || !ok2 {
+		return value
+	}
+	merged := map[interface{}]interface{}{}
+	for key, v := range baseMap {
+		merged[key] = v
+	}
+	for key, v := range valueMap {
+		merged[key] = mergeValues(merged[key], v)
+	}
+	return merged
+}
+
+// resolveExtends decodes the config again from its YAML if some of its
+// plans extend other plans, with the plans merged.
+func resolveExtends(contents []byte, config *Config) error {
+	var document interface{}
+	if err := candiedyaml.Unmarshal(contents, &document); err != nil {
+		return err
+	}
+	extending, err := resolvePlans(document)
+	if err != nil || !extending {
+		return err
+	}
+	merged, err := candiedyaml.Marshal(document)
+	if err != nil {
+		return err
+	}
+	*config = Config{}
+	return candiedyaml.Unmarshal(merged, config)
+}
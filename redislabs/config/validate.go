@@ -0,0 +1,189 @@
+package config
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"net/url"
+)
+
+var (
+	persistenceModes  = map[string]bool{"": true, "disabled": true, "aof": true, "snapshot": true}
+	shardsPlacements  = map[string]bool{"": true, "dense": true, "sparse": true}
+	endpointAddresses = map[string]bool{"": true, "dns": true, "ip": true, "both": true}
+	hookPhases        = map[string]bool{"pre": true, "post": true}
+	hookActions       = map[string]bool{"provision": true, "deprovision": true}
+	webhookEvents     = map[string]bool{
+		"instance.created": true, "instance.updated": true, "instance.deleted": true,
+		"binding.created": true, "binding.deleted": true, "operation.failed": true,
+	}
+)
+
+// Validate returns the problems of the config that would keep the broker
+// from working, none if it is fine. It does not contact the cluster.
+func (c Config) Validate() []error {
+	problems := []error{}
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Errorf(format, args...))
+	}
+
+	if c.Cluster.Address == "" {
+		problem("cluster.address is missing")
+	}
+	if c.Cluster.Auth.Username == "" || c.Cluster.Auth.Password == "" {
+		problem("cluster.auth needs a username and a password")
+	}
+	if !endpointAddresses[c.Cluster.EndpointAddress] {
+		problem("cluster.endpoint_address %q is unknown, use dns, ip or both", c.Cluster.EndpointAddress)
+	}
+
+	broker := c.ServiceBroker
+	if broker.ServiceID == "" {
+		problem("broker.service_id is missing")
+	}
+	if broker.Name == "" {
+		problem("broker.name is missing")
+	}
+	if broker.Port <= 0 || broker.Port > 65535 {
+		problem("broker.port %d is not a valid port", broker.Port)
+	}
+	if broker.Auth.Username == "" || broker.Auth.Password == "" {
+		problem("broker.auth needs a username and a password")
+	}
+	if broker.AsyncCreationTimeout < 0 {
+		problem("broker.async_creation_timeout is negative")
+	}
+	admin := broker.Admin.Auth
+	if (admin.Username == "") != (admin.Password == "") {
+		problem("broker.admin.auth needs both a username and a password")
+	}
+
+	switch persister := broker.StatePersister; persister.Type {
+	case "", "local":
+	case "redis":
+		if persister.Redis.Address == "" {
+			problem("broker.state_persister.redis.address is missing")
+		}
+	default:
+		problem("broker.state_persister.type %q is unknown, use local or redis", persister.Type)
+	}
+
+	for i, hook := range broker.Hooks {
+		name := hook.Name
+		if name == "" {
+			name = fmt.Sprintf("%d", i)
+		}
+		if hook.Command == "" {
+			problem("hook %q has no command", name)
+		}
+		if !hookPhases[hook.Phase] {
+			problem("hook %q has an unknown phase %q, use pre or post", name, hook.Phase)
+		}
+		for _, action := range hook.Actions {
+			if !hookActions[action] {
+				problem("hook %q has an unknown action %q, use provision or deprovision", name, action)
+			}
+		}
+		if hook.Timeout < 0 {
+			problem("hook %q has a negative timeout", name)
+		}
+	}
+
+	for i, webhook := range broker.Webhooks {
+		if u, err := url.Parse(webhook.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problem("webhook %d has no http or https url", i)
+		}
+		if webhook.Secret == "" {
+			problem("webhook %d has no secret to sign the events with", i)
+		}
+		for _, event := range webhook.Events {
+			if !webhookEvents[event] {
+				problem("webhook %d has an unknown event %q", i, event)
+			}
+		}
+		if webhook.Timeout < 0 {
+			problem("webhook %d has a negative timeout", i)
+		}
+	}
+
+	if broker.Metrics.Interval < 0 {
+		problem("broker.metrics.interval is negative")
+	}
+	if address := broker.Metrics.Address; address != "" {
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			problem("broker.metrics.address %q is not a host:port", address)
+		}
+	}
+
+	if len(broker.Plans) == 0 {
+		problem("broker.plans is empty")
+	}
+	ids, names := map[string]bool{}, map[string]bool{}
+	for i, plan := range broker.Plans {
+		if plan.ID == "" {
+			problem("plan %d has no id", i)
+		} else if ids[plan.ID] {
+			problem("plan id %q is used more than once", plan.ID)
+		}
+		if plan.Name == "" {
+			problem("plan %d has no name", i)
+		} else if names[plan.Name] {
+			problem("plan name %q is used more than once", plan.Name)
+		}
+		ids[plan.ID], names[plan.Name] = true, true
+
+		settings := plan.ServiceInstanceConfig
+		if settings.MemoryLimit <= 0 {
+			problem("plan %q has no memory", plan.Name)
+		}
+		if settings.MaxMemoryLimit > 0 && settings.MinMemoryLimit > settings.MaxMemoryLimit {
+			problem("plan %q has a min_memory above its max_memory", plan.Name)
+		}
+		if !persistenceModes[settings.Persistence] {
+			problem("plan %q has an unknown persistence %q, use disabled, aof or snapshot", plan.Name, settings.Persistence)
+		}
+		for _, rule := range settings.Snapshot {
+			if rule.Writes <= 0 || rule.Secs <= 0 {
+				problem("plan %q has a snapshot rule without positive writes and secs", plan.Name)
+			}
+		}
+		if settings.ClientCA != "" {
+			if !settings.TLS {
+				problem("plan %q needs tls for its client_ca", plan.Name)
+			}
+			if block, _ := pem.Decode([]byte(settings.ClientCA)); block == nil || block.Type != "CERTIFICATE" {
+				problem("plan %q has a client_ca that is not a PEM certificate", plan.Name)
+			} else if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+				problem("plan %q has an invalid client_ca: %s", plan.Name, err)
+			}
+		}
+		if !shardsPlacements[settings.ShardsPlacement] {
+			problem("plan %q has an unknown shards_placement %q, use dense or sparse", plan.Name, settings.ShardsPlacement)
+		}
+		if ports := settings.PortRange; ports.Min > ports.Max || (ports.Max > 0 && ports.Min <= 0) {
+			problem("plan %q has an invalid port_range %d-%d", plan.Name, ports.Min, ports.Max)
+		}
+		if settings.MaxConnections < 0 {
+			problem("plan %q has a negative max_connections", plan.Name)
+		}
+		if settings.Port < 0 || settings.Port > 65535 {
+			problem("plan %q has an invalid port %d", plan.Name, settings.Port)
+		}
+		if !endpointAddresses[plan.EndpointAddress] {
+			problem("plan %q has an unknown endpoint_address %q, use dns, ip or both", plan.Name, plan.EndpointAddress)
+		}
+		if (plan.Auth.Username == "") != (plan.Auth.Password == "") {
+			problem("plan %q needs both a username and a password in its auth", plan.Name)
+		}
+		if (plan.ACL.Role == "") != (plan.ACL.Rules == "") {
+			problem("plan %q needs both an acl role and acl rules", plan.Name)
+		}
+		for _, node := range settings.Nodes {
+			if node <= 0 {
+				problem("plan %q has an invalid node %d", plan.Name, node)
+			}
+		}
+	}
+	return problems
+}
@@ -1,8 +1,20 @@
 package redislabs
 
-import "errors"
+import "github.com/RedisLabs/cf-redislabs-broker/redislabs/brokererrors"
 
 var (
-	ErrPlanDoesNotExist    = errors.New("plan does not exist")
-	ErrServiceDoesNotExist = errors.New("service does not exist")
+	ErrPlanDoesNotExist     = brokererrors.NewBadRequest("plan does not exist")
+	ErrServiceDoesNotExist  = brokererrors.NewBadRequest("service does not exist")
+	ErrPlanNotBindable      = brokererrors.NewBadRequest("the plan of the instance does not support bindings")
+	ErrPlanNotAllowedForOrg = brokererrors.NewUnprocessableEntity("",
+		"the plan is not available to the organization of the instance")
+	ErrDeletionProtected = brokererrors.NewUnprocessableEntity("",
+		`the instance is protected from deletion, update it with {"deletion_protection": false} first`)
+	ErrInstanceHasBindings = brokererrors.NewUnprocessableEntity("",
+		"the instance still has bindings, unbind the apps first")
+	ErrRotateOnProvision = brokererrors.NewBadRequest(
+		`"rotate_password" applies to updates, a new database gets a new password anyway`)
+	ErrUIDNotAllowed = brokererrors.NewBadRequest(
+		`the plan does not allow to set "uid", it has to be listed in the allowed_parameters of the plan`)
+	ErrUIDImmutable = brokererrors.NewBadRequest(`the "uid" of a database can not be changed`)
 )
@@ -0,0 +1,66 @@
+// Package events notifies external systems of the lifecycle of service
+// instances and bindings, e.g. to keep an inventory of the databases up
+// to date.
+package events
+
+import (
+	"time"
+
+	"github.com/pivotal-golang/lager"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+)
+
+// Types of the events.
+const (
+	InstanceCreated = "instance.created"
+	InstanceUpdated = "instance.updated"
+	InstanceDeleted = "instance.deleted"
+	BindingCreated  = "binding.created"
+	BindingDeleted  = "binding.deleted"
+	OperationFailed = "operation.failed"
+)
+
+// Event is something that happened to an instance or a binding.
+type Event struct {
+	Type             string `json:"type"`
+	Time             string `json:"time"`
+	InstanceID       string `json:"instance_id"`
+	BindingID        string `json:"binding_id,omitempty"`
+	PlanID           string `json:"plan_id,omitempty"`
+	OrganizationGUID string `json:"organization_guid,omitempty"`
+	SpaceGUID        string `json:"space_guid,omitempty"`
+	DatabaseUID      int    `json:"database_uid,omitempty"`
+	// Operation and Error describe failed operations, the operation is
+	// provision, update, deprovision, bind or unbind.
+	Operation string `json:"operation,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Sink receives the events. It must not block the operation the event is
+// about.
+type Sink interface {
+	Send(event Event)
+}
+
+// Publisher sends events to all of its sinks.
+type Publisher []Sink
+
+// New returns a publisher sending the events to the webhooks of the
+// config.
+func New(confs []config.WebhookConfig, logger lager.Logger) Publisher {
+	publisher := Publisher{}
+	for _, conf := range confs {
+		publisher = append(publisher, NewWebhook(conf, logger))
+	}
+	return publisher
+}
+
+// Publish stamps the event with the current time and sends it to the
+// sinks.
+func (p Publisher) Publish(event Event) {
+	event.Time = time.Now().UTC().Format(time.RFC3339)
+	for _, sink := range p {
+		sink.Send(event)
+	}
+}
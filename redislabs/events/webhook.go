@@ -0,0 +1,145 @@
+package events
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pivotal-golang/lager"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+)
+
+// Headers of the requests of webhooks. The timestamp is the Unix time the
+// request was sent at. The signature is the hex encoded HMAC-SHA256 of the
+// timestamp, a dot and the body with the secret of the webhook, prefixed
+// with "sha256=", so that endpoints can drop the requests replayed later.
+const (
+	EventHeader     = "X-Broker-Event"
+	TimestampHeader = "X-Broker-Timestamp"
+	SignatureHeader = "X-Broker-Signature"
+)
+
+var (
+	// DefaultWebhookTimeout bounds the requests of webhooks whose config
+	// has no timeout.
+	DefaultWebhookTimeout = 10 * time.Second
+	// WebhookAttempts is how many times an event is sent before it is
+	// given up, WebhookRetryDelay is the delay before the first retry;
+	// it doubles with every retry.
+	WebhookAttempts   = 3
+	WebhookRetryDelay = time.Second
+)
+
+// Webhook POSTs the events as JSON to an endpoint. Events are sent in the
+// background and retried on failures; the ones that can not be delivered
+// are logged.
+type Webhook struct {
+	conf   config.WebhookConfig
+	events map[string]bool
+	client *http.Client
+	logger lager.Logger
+}
+
+func NewWebhook(conf config.WebhookConfig, logger lager.Logger) *Webhook {
+	var events map[string]bool
+	if len(conf.Events) > 0 {
+		events = map[string]bool{}
+		for _, event := range conf.Events {
+			events[event] = true
+		}
+	}
+	timeout := time.Duration(conf.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = DefaultWebhookTimeout
+	}
+	return &Webhook{
+		conf:   conf,
+		events: events,
+		client: &http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: conf.SkipSSLValidation},
+				Proxy:           http.ProxyFromEnvironment,
+			},
+		},
+		logger: logger.Session("webhook", lager.Data{"url": conf.URL}),
+	}
+}
+
+// Send delivers the event in the background unless the webhook is not
+// interested in events of its type.
+func (w *Webhook) Send(event Event) {
+	if w.events != nil && !w.events[event.Type] {
+		return
+	}
+	go func() {
+		if err := w.Deliver(event); err != nil {
+			w.logger.Error("Failed to deliver an event", err, lager.Data{
+				"type":        event.Type,
+				"instance-id": event.InstanceID,
+			})
+		}
+	}()
+}
+
+// Deliver sends the event and waits until the endpoint accepted it or
+// all attempts failed.
+func (w *Webhook) Deliver(event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	delay := WebhookRetryDelay
+	for attempt := 1; ; attempt++ {
+		err = w.post(event.Type, body)
+		if err == nil || attempt >= WebhookAttempts {
+			return err
+		}
+		w.logger.Info("Retrying to deliver an event", lager.Data{
+			"type":    event.Type,
+			"attempt": attempt,
+			"error":   err.Error(),
+		})
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func (w *Webhook) post(eventType string, body []byte) error {
+	req, err := http.NewRequest("POST", w.conf.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, eventType)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(timestamp, body, w.conf.Secret))
+
+	res, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("the webhook responded with status %d", res.StatusCode)
+	}
+	return nil
+}
+
+// Sign returns the signature of a body sent at the timestamp, as endpoints
+// compute it to check the events.
+func Sign(timestamp string, body []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,121 @@
+package events_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"time"
+
+	brokerconfig "github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/events"
+	"github.com/pivotal-golang/lager"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Webhooks", func() {
+	var (
+		server *httptest.Server
+		logger = lager.NewLogger("test")
+		lock   sync.Mutex
+		// received are the bodies of the requests with a valid signature.
+		received []map[string]interface{}
+		failures int
+		delay    time.Duration
+	)
+
+	receivedEvents := func() []map[string]interface{} {
+		lock.Lock()
+		defer lock.Unlock()
+		return append([]map[string]interface{}{}, received...)
+	}
+
+	BeforeEach(func() {
+		received, failures = nil, 0
+		delay = events.WebhookRetryDelay
+		events.WebhookRetryDelay = time.Millisecond
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			lock.Lock()
+			defer lock.Unlock()
+			body, _ := ioutil.ReadAll(r.Body)
+			if failures > 0 {
+				failures--
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			if r.Header.Get(events.SignatureHeader) != events.Sign(r.Header.Get(events.TimestampHeader), body, "secret") {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			var event map[string]interface{}
+			Expect(json.Unmarshal(body, &event)).To(Succeed())
+			Expect(r.Header.Get(events.EventHeader)).To(Equal(event["type"]))
+			received = append(received, event)
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+		events.WebhookRetryDelay = delay
+	})
+
+	It("Sends signed events", func() {
+		publisher := events.New([]brokerconfig.WebhookConfig{{URL: server.URL, Secret: "secret"}}, logger)
+		publisher.Publish(events.Event{Type: events.InstanceCreated, InstanceID: "instance-id", DatabaseUID: 7})
+
+		Eventually(receivedEvents).Should(HaveLen(1))
+		event := receivedEvents()[0]
+		Expect(event).To(HaveKeyWithValue("type", "instance.created"))
+		Expect(event).To(HaveKeyWithValue("instance_id", "instance-id"))
+		Expect(event).To(HaveKeyWithValue("database_uid", BeEquivalentTo(7)))
+		Expect(event).To(HaveKey("time"))
+	})
+
+	It("Signs the time the events are sent at", func() {
+		var headers http.Header
+		signed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			headers = r.Header
+		}))
+		defer signed.Close()
+		webhook := events.NewWebhook(brokerconfig.WebhookConfig{URL: signed.URL, Secret: "secret"}, logger)
+		Expect(webhook.Deliver(events.Event{Type: events.InstanceCreated, InstanceID: "instance-id"})).To(Succeed())
+
+		timestamp, err := strconv.ParseInt(headers.Get(events.TimestampHeader), 10, 64)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(time.Unix(timestamp, 0)).To(BeTemporally("~", time.Now(), 5*time.Second))
+		body, err := json.Marshal(events.Event{Type: events.InstanceCreated, InstanceID: "instance-id"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(headers.Get(events.SignatureHeader)).To(Equal(events.Sign(headers.Get(events.TimestampHeader), body, "secret")))
+		Expect(headers.Get(events.SignatureHeader)).NotTo(Equal(events.Sign("0", body, "secret")))
+	})
+
+	It("Only sends the events the webhook is interested in", func() {
+		publisher := events.New([]brokerconfig.WebhookConfig{
+			{URL: server.URL, Secret: "secret", Events: []string{events.OperationFailed}},
+		}, logger)
+		publisher.Publish(events.Event{Type: events.InstanceCreated, InstanceID: "instance-id"})
+		publisher.Publish(events.Event{Type: events.OperationFailed, InstanceID: "instance-id", Operation: "bind"})
+
+		Eventually(receivedEvents).Should(HaveLen(1))
+		Consistently(receivedEvents, 0.1).Should(HaveLen(1))
+		Expect(receivedEvents()[0]).To(HaveKeyWithValue("operation", "bind"))
+	})
+
+	It("Retries the events the endpoint failed to accept", func() {
+		failures = 2
+		webhook := events.NewWebhook(brokerconfig.WebhookConfig{URL: server.URL, Secret: "secret"}, logger)
+		Expect(webhook.Deliver(events.Event{Type: events.InstanceDeleted})).To(Succeed())
+		Expect(receivedEvents()).To(HaveLen(1))
+	})
+
+	It("Gives up after the last attempt", func() {
+		failures = events.WebhookAttempts
+		webhook := events.NewWebhook(brokerconfig.WebhookConfig{URL: server.URL, Secret: "secret"}, logger)
+		Expect(webhook.Deliver(events.Event{Type: events.InstanceDeleted})).To(MatchError("the webhook responded with status 503"))
+		Expect(receivedEvents()).To(BeEmpty())
+	})
+})
@@ -0,0 +1,1296 @@
+// Package fakes provides fakes of the clients of the cluster API, so that
+// tests can stub the behavior of the cluster without serving its API.
+// Every method of a fake records its arguments and returns what its Stub
+// function returns, or else what was set with its Returns method.
+package fakes
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pivotal-golang/lager"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/apiclient"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/cluster"
+)
+
+// FakeClient is a fake apiclient.Client. Unless told otherwise, its
+// WithLogger returns the fake itself, so that the calls of scoped clients
+// are recorded by the fake under test.
+type FakeClient struct {
+	CreateDatabaseStub        func(map[string]interface{}, <-chan struct{}) (int, chan cluster.InstanceCredentials, error)
+	createDatabaseMutex       sync.RWMutex
+	createDatabaseArgsForCall []struct {
+		arg1 map[string]interface{}
+		arg2 <-chan struct{}
+	}
+	createDatabaseReturns struct {
+		result1 int
+		result2 chan cluster.InstanceCredentials
+		result3 error
+	}
+	WaitForDatabaseStub        func(int, <-chan struct{}) chan cluster.InstanceCredentials
+	waitForDatabaseMutex       sync.RWMutex
+	waitForDatabaseArgsForCall []struct {
+		arg1 int
+		arg2 <-chan struct{}
+	}
+	waitForDatabaseReturns struct {
+		result1 chan cluster.InstanceCredentials
+	}
+	WaitForDeletionStub        func(int, time.Duration) (bool, error)
+	waitForDeletionMutex       sync.RWMutex
+	waitForDeletionArgsForCall []struct {
+		arg1 int
+		arg2 time.Duration
+	}
+	waitForDeletionReturns struct {
+		result1 bool
+		result2 error
+	}
+	UpdateDatabaseStub        func(int, map[string]interface{}) error
+	updateDatabaseMutex       sync.RWMutex
+	updateDatabaseArgsForCall []struct {
+		arg1 int
+		arg2 map[string]interface{}
+	}
+	updateDatabaseReturns struct {
+		result1 error
+	}
+	DeleteDatabaseStub        func(int) error
+	deleteDatabaseMutex       sync.RWMutex
+	deleteDatabaseArgsForCall []struct {
+		arg1 int
+	}
+	deleteDatabaseReturns struct {
+		result1 error
+	}
+	GetDatabaseStub        func(int) (cluster.InstanceCredentials, error)
+	getDatabaseMutex       sync.RWMutex
+	getDatabaseArgsForCall []struct {
+		arg1 int
+	}
+	getDatabaseReturns struct {
+		result1 cluster.InstanceCredentials
+		result2 error
+	}
+	GetDatabaseStatusStub        func(int) (string, error)
+	getDatabaseStatusMutex       sync.RWMutex
+	getDatabaseStatusArgsForCall []struct {
+		arg1 int
+	}
+	getDatabaseStatusReturns struct {
+		result1 string
+		result2 error
+	}
+	GetDatabaseSettingsStub        func(int) (map[string]interface{}, error)
+	getDatabaseSettingsMutex       sync.RWMutex
+	getDatabaseSettingsArgsForCall []struct {
+		arg1 int
+	}
+	getDatabaseSettingsReturns struct {
+		result1 map[string]interface{}
+		result2 error
+	}
+	ListDatabasesStub        func() ([]cluster.InstanceCredentials, error)
+	listDatabasesMutex       sync.RWMutex
+	listDatabasesArgsForCall []struct{}
+	listDatabasesReturns     struct {
+		result1 []cluster.InstanceCredentials
+		result2 error
+	}
+	ListDatabasesWithStub        func(apiclient.ListOptions) ([]cluster.InstanceCredentials, error)
+	listDatabasesWithMutex       sync.RWMutex
+	listDatabasesWithArgsForCall []struct {
+		arg1 apiclient.ListOptions
+	}
+	listDatabasesWithReturns struct {
+		result1 []cluster.InstanceCredentials
+		result2 error
+	}
+	GetMemoryUsageStub        func(int) (cluster.MemoryUsage, error)
+	getMemoryUsageMutex       sync.RWMutex
+	getMemoryUsageArgsForCall []struct {
+		arg1 int
+	}
+	getMemoryUsageReturns struct {
+		result1 cluster.MemoryUsage
+		result2 error
+	}
+	GetDatabaseStatsStub        func(int) (cluster.DatabaseStats, error)
+	getDatabaseStatsMutex       sync.RWMutex
+	getDatabaseStatsArgsForCall []struct {
+		arg1 int
+	}
+	getDatabaseStatsReturns struct {
+		result1 cluster.DatabaseStats
+		result2 error
+	}
+	GetShardCountStub        func(int) (int, error)
+	getShardCountMutex       sync.RWMutex
+	getShardCountArgsForCall []struct {
+		arg1 int
+	}
+	getShardCountReturns struct {
+		result1 int
+		result2 error
+	}
+	GetDatabaseActionsStub        func(int) ([]cluster.Action, error)
+	getDatabaseActionsMutex       sync.RWMutex
+	getDatabaseActionsArgsForCall []struct {
+		arg1 int
+	}
+	getDatabaseActionsReturns struct {
+		result1 []cluster.Action
+		result2 error
+	}
+	GetDatabaseProgressStub        func(int) (cluster.DatabaseProgress, error)
+	getDatabaseProgressMutex       sync.RWMutex
+	getDatabaseProgressArgsForCall []struct {
+		arg1 int
+	}
+	getDatabaseProgressReturns struct {
+		result1 cluster.DatabaseProgress
+		result2 error
+	}
+	AddDatabasePasswordStub        func(int, string) error
+	addDatabasePasswordMutex       sync.RWMutex
+	addDatabasePasswordArgsForCall []struct {
+		arg1 int
+		arg2 string
+	}
+	addDatabasePasswordReturns struct {
+		result1 error
+	}
+	SetDatabasePasswordStub        func(int, string) error
+	setDatabasePasswordMutex       sync.RWMutex
+	setDatabasePasswordArgsForCall []struct {
+		arg1 int
+		arg2 string
+	}
+	setDatabasePasswordReturns struct {
+		result1 error
+	}
+	GetClusterInfoStub        func() (cluster.Info, error)
+	getClusterInfoMutex       sync.RWMutex
+	getClusterInfoArgsForCall []struct{}
+	getClusterInfoReturns     struct {
+		result1 cluster.Info
+		result2 error
+	}
+	ListModulesStub        func() ([]cluster.Module, error)
+	listModulesMutex       sync.RWMutex
+	listModulesArgsForCall []struct{}
+	listModulesReturns     struct {
+		result1 []cluster.Module
+		result2 error
+	}
+	ListNodesStub        func() ([]cluster.Node, error)
+	listNodesMutex       sync.RWMutex
+	listNodesArgsForCall []struct{}
+	listNodesReturns     struct {
+		result1 []cluster.Node
+		result2 error
+	}
+	DetectVersionStub        func() (cluster.Version, error)
+	detectVersionMutex       sync.RWMutex
+	detectVersionArgsForCall []struct{}
+	detectVersionReturns     struct {
+		result1 cluster.Version
+		result2 error
+	}
+	SupportsStub        func(cluster.Capability) error
+	supportsMutex       sync.RWMutex
+	supportsArgsForCall []struct {
+		arg1 cluster.Capability
+	}
+	supportsReturns struct {
+		result1 error
+	}
+	EnsureRedisACLStub        func(string, string) (int, error)
+	ensureRedisACLMutex       sync.RWMutex
+	ensureRedisACLArgsForCall []struct {
+		arg1 string
+		arg2 string
+	}
+	ensureRedisACLReturns struct {
+		result1 int
+		result2 error
+	}
+	EnsureRoleStub        func(string) (int, error)
+	ensureRoleMutex       sync.RWMutex
+	ensureRoleArgsForCall []struct {
+		arg1 string
+	}
+	ensureRoleReturns struct {
+		result1 int
+		result2 error
+	}
+	GrantRoleStub        func(int, int, int) error
+	grantRoleMutex       sync.RWMutex
+	grantRoleArgsForCall []struct {
+		arg1 int
+		arg2 int
+		arg3 int
+	}
+	grantRoleReturns struct {
+		result1 error
+	}
+	RevokeRoleStub        func(int, int) error
+	revokeRoleMutex       sync.RWMutex
+	revokeRoleArgsForCall []struct {
+		arg1 int
+		arg2 int
+	}
+	revokeRoleReturns struct {
+		result1 error
+	}
+	FindRoleStub        func(string) (int, bool, error)
+	findRoleMutex       sync.RWMutex
+	findRoleArgsForCall []struct {
+		arg1 string
+	}
+	findRoleReturns struct {
+		result1 int
+		result2 bool
+		result3 error
+	}
+	DeleteRoleStub        func(int) error
+	deleteRoleMutex       sync.RWMutex
+	deleteRoleArgsForCall []struct {
+		arg1 int
+	}
+	deleteRoleReturns struct {
+		result1 error
+	}
+	CreateUserStub        func(string, string, []int) (int, error)
+	createUserMutex       sync.RWMutex
+	createUserArgsForCall []struct {
+		arg1 string
+		arg2 string
+		arg3 []int
+	}
+	createUserReturns struct {
+		result1 int
+		result2 error
+	}
+	FindUserStub        func(string) (int, bool, error)
+	findUserMutex       sync.RWMutex
+	findUserArgsForCall []struct {
+		arg1 string
+	}
+	findUserReturns struct {
+		result1 int
+		result2 bool
+		result3 error
+	}
+	DeleteUserStub        func(int) error
+	deleteUserMutex       sync.RWMutex
+	deleteUserArgsForCall []struct {
+		arg1 int
+	}
+	deleteUserReturns struct {
+		result1 error
+	}
+	WithLoggerStub        func(lager.Logger) apiclient.Client
+	withLoggerMutex       sync.RWMutex
+	withLoggerArgsForCall []struct {
+		arg1 lager.Logger
+	}
+	withLoggerReturns struct {
+		result1 apiclient.Client
+	}
+}
+
+func (fake *FakeClient) CreateDatabase(arg1 map[string]interface{}, arg2 <-chan struct{}) (int, chan cluster.InstanceCredentials, error) {
+	fake.createDatabaseMutex.Lock()
+	fake.createDatabaseArgsForCall = append(fake.createDatabaseArgsForCall, struct {
+		arg1 map[string]interface{}
+		arg2 <-chan struct{}
+	}{arg1, arg2})
+	fake.createDatabaseMutex.Unlock()
+	if fake.CreateDatabaseStub != nil {
+		return fake.CreateDatabaseStub(arg1, arg2)
+	}
+	return fake.createDatabaseReturns.result1, fake.createDatabaseReturns.result2, fake.createDatabaseReturns.result3
+}
+
+func (fake *FakeClient) CreateDatabaseCallCount() int {
+	fake.createDatabaseMutex.RLock()
+	defer fake.createDatabaseMutex.RUnlock()
+	return len(fake.createDatabaseArgsForCall)
+}
+
+func (fake *FakeClient) CreateDatabaseArgsForCall(i int) (map[string]interface{}, <-chan struct{}) {
+	fake.createDatabaseMutex.RLock()
+	defer fake.createDatabaseMutex.RUnlock()
+	return fake.createDatabaseArgsForCall[i].arg1, fake.createDatabaseArgsForCall[i].arg2
+}
+
+func (fake *FakeClient) CreateDatabaseReturns(result1 int, result2 chan cluster.InstanceCredentials, result3 error) {
+	fake.CreateDatabaseStub = nil
+	fake.createDatabaseReturns = struct {
+		result1 int
+		result2 chan cluster.InstanceCredentials
+		result3 error
+	}{result1, result2, result3}
+}
+
+func (fake *FakeClient) WaitForDatabase(arg1 int, arg2 <-chan struct{}) chan cluster.InstanceCredentials {
+	fake.waitForDatabaseMutex.Lock()
+	fake.waitForDatabaseArgsForCall = append(fake.waitForDatabaseArgsForCall, struct {
+		arg1 int
+		arg2 <-chan struct{}
+	}{arg1, arg2})
+	fake.waitForDatabaseMutex.Unlock()
+	if fake.WaitForDatabaseStub != nil {
+		return fake.WaitForDatabaseStub(arg1, arg2)
+	}
+	return fake.waitForDatabaseReturns.result1
+}
+
+func (fake *FakeClient) WaitForDatabaseCallCount() int {
+	fake.waitForDatabaseMutex.RLock()
+	defer fake.waitForDatabaseMutex.RUnlock()
+	return len(fake.waitForDatabaseArgsForCall)
+}
+
+func (fake *FakeClient) WaitForDatabaseArgsForCall(i int) (int, <-chan struct{}) {
+	fake.waitForDatabaseMutex.RLock()
+	defer fake.waitForDatabaseMutex.RUnlock()
+	return fake.waitForDatabaseArgsForCall[i].arg1, fake.waitForDatabaseArgsForCall[i].arg2
+}
+
+func (fake *FakeClient) WaitForDatabaseReturns(result1 chan cluster.InstanceCredentials) {
+	fake.WaitForDatabaseStub = nil
+	fake.waitForDatabaseReturns = struct {
+		result1 chan cluster.InstanceCredentials
+	}{result1}
+}
+
+func (fake *FakeClient) WaitForDeletion(arg1 int, arg2 time.Duration) (bool, error) {
+	fake.waitForDeletionMutex.Lock()
+	fake.waitForDeletionArgsForCall = append(fake.waitForDeletionArgsForCall, struct {
+		arg1 int
+		arg2 time.Duration
+	}{arg1, arg2})
+	fake.waitForDeletionMutex.Unlock()
+	if fake.WaitForDeletionStub != nil {
+		return fake.WaitForDeletionStub(arg1, arg2)
+	}
+	return fake.waitForDeletionReturns.result1, fake.waitForDeletionReturns.result2
+}
+
+func (fake *FakeClient) WaitForDeletionCallCount() int {
+	fake.waitForDeletionMutex.RLock()
+	defer fake.waitForDeletionMutex.RUnlock()
+	return len(fake.waitForDeletionArgsForCall)
+}
+
+func (fake *FakeClient) WaitForDeletionArgsForCall(i int) (int, time.Duration) {
+	fake.waitForDeletionMutex.RLock()
+	defer fake.waitForDeletionMutex.RUnlock()
+	return fake.waitForDeletionArgsForCall[i].arg1, fake.waitForDeletionArgsForCall[i].arg2
+}
+
+func (fake *FakeClient) WaitForDeletionReturns(result1 bool, result2 error) {
+	fake.WaitForDeletionStub = nil
+	fake.waitForDeletionReturns = struct {
+		result1 bool
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeClient) UpdateDatabase(arg1 int, arg2 map[string]interface{}) error {
+	fake.updateDatabaseMutex.Lock()
+	fake.updateDatabaseArgsForCall = append(fake.updateDatabaseArgsForCall, struct {
+		arg1 int
+		arg2 map[string]interface{}
+	}{arg1, arg2})
+	fake.updateDatabaseMutex.Unlock()
+	if fake.UpdateDatabaseStub != nil {
+		return fake.UpdateDatabaseStub(arg1, arg2)
+	}
+	return fake.updateDatabaseReturns.result1
+}
+
+func (fake *FakeClient) UpdateDatabaseCallCount() int {
+	fake.updateDatabaseMutex.RLock()
+	defer fake.updateDatabaseMutex.RUnlock()
+	return len(fake.updateDatabaseArgsForCall)
+}
+
+func (fake *FakeClient) UpdateDatabaseArgsForCall(i int) (int, map[string]interface{}) {
+	fake.updateDatabaseMutex.RLock()
+	defer fake.updateDatabaseMutex.RUnlock()
+	return fake.updateDatabaseArgsForCall[i].arg1, fake.updateDatabaseArgsForCall[i].arg2
+}
+
+func (fake *FakeClient) UpdateDatabaseReturns(result1 error) {
+	fake.UpdateDatabaseStub = nil
+	fake.updateDatabaseReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeClient) DeleteDatabase(arg1 int) error {
+	fake.deleteDatabaseMutex.Lock()
+	fake.deleteDatabaseArgsForCall = append(fake.deleteDatabaseArgsForCall, struct {
+		arg1 int
+	}{arg1})
+	fake.deleteDatabaseMutex.Unlock()
+	if fake.DeleteDatabaseStub != nil {
+		return fake.DeleteDatabaseStub(arg1)
+	}
+	return fake.deleteDatabaseReturns.result1
+}
+
+func (fake *FakeClient) DeleteDatabaseCallCount() int {
+	fake.deleteDatabaseMutex.RLock()
+	defer fake.deleteDatabaseMutex.RUnlock()
+	return len(fake.deleteDatabaseArgsForCall)
+}
+
+func (fake *FakeClient) DeleteDatabaseArgsForCall(i int) int {
+	fake.deleteDatabaseMutex.RLock()
+	defer fake.deleteDatabaseMutex.RUnlock()
+	return fake.deleteDatabaseArgsForCall[i].arg1
+}
+
+func (fake *FakeClient) DeleteDatabaseReturns(result1 error) {
+	fake.DeleteDatabaseStub = nil
+	fake.deleteDatabaseReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeClient) GetDatabase(arg1 int) (cluster.InstanceCredentials, error) {
+	fake.getDatabaseMutex.Lock()
+	fake.getDatabaseArgsForCall = append(fake.getDatabaseArgsForCall, struct {
+		arg1 int
+	}{arg1})
+	fake.getDatabaseMutex.Unlock()
+	if fake.GetDatabaseStub != nil {
+		return fake.GetDatabaseStub(arg1)
+	}
+	return fake.getDatabaseReturns.result1, fake.getDatabaseReturns.result2
+}
+
+func (fake *FakeClient) GetDatabaseCallCount() int {
+	fake.getDatabaseMutex.RLock()
+	defer fake.getDatabaseMutex.RUnlock()
+	return len(fake.getDatabaseArgsForCall)
+}
+
+func (fake *FakeClient) GetDatabaseArgsForCall(i int) int {
+	fake.getDatabaseMutex.RLock()
+	defer fake.getDatabaseMutex.RUnlock()
+	return fake.getDatabaseArgsForCall[i].arg1
+}
+
+func (fake *FakeClient) GetDatabaseReturns(result1 cluster.InstanceCredentials, result2 error) {
+	fake.GetDatabaseStub = nil
+	fake.getDatabaseReturns = struct {
+		result1 cluster.InstanceCredentials
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeClient) GetDatabaseStatus(arg1 int) (string, error) {
+	fake.getDatabaseStatusMutex.Lock()
+	fake.getDatabaseStatusArgsForCall = append(fake.getDatabaseStatusArgsForCall, struct {
+		arg1 int
+	}{arg1})
+	fake.getDatabaseStatusMutex.Unlock()
+	if fake.GetDatabaseStatusStub != nil {
+		return fake.GetDatabaseStatusStub(arg1)
+	}
+	return fake.getDatabaseStatusReturns.result1, fake.getDatabaseStatusReturns.result2
+}
+
+func (fake *FakeClient) GetDatabaseStatusCallCount() int {
+	fake.getDatabaseStatusMutex.RLock()
+	defer fake.getDatabaseStatusMutex.RUnlock()
+	return len(fake.getDatabaseStatusArgsForCall)
+}
+
+func (fake *FakeClient) GetDatabaseStatusArgsForCall(i int) int {
+	fake.getDatabaseStatusMutex.RLock()
+	defer fake.getDatabaseStatusMutex.RUnlock()
+	return fake.getDatabaseStatusArgsForCall[i].arg1
+}
+
+func (fake *FakeClient) GetDatabaseStatusReturns(result1 string, result2 error) {
+	fake.GetDatabaseStatusStub = nil
+	fake.getDatabaseStatusReturns = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeClient) GetDatabaseSettings(arg1 int) (map[string]interface{}, error) {
+	fake.getDatabaseSettingsMutex.Lock()
+	fake.getDatabaseSettingsArgsForCall = append(fake.getDatabaseSettingsArgsForCall, struct {
+		arg1 int
+	}{arg1})
+	fake.getDatabaseSettingsMutex.Unlock()
+	if fake.GetDatabaseSettingsStub != nil {
+		return fake.GetDatabaseSettingsStub(arg1)
+	}
+	return fake.getDatabaseSettingsReturns.result1, fake.getDatabaseSettingsReturns.result2
+}
+
+func (fake *FakeClient) GetDatabaseSettingsCallCount() int {
+	fake.getDatabaseSettingsMutex.RLock()
+	defer fake.getDatabaseSettingsMutex.RUnlock()
+	return len(fake.getDatabaseSettingsArgsForCall)
+}
+
+func (fake *FakeClient) GetDatabaseSettingsArgsForCall(i int) int {
+	fake.getDatabaseSettingsMutex.RLock()
+	defer fake.getDatabaseSettingsMutex.RUnlock()
+	return fake.getDatabaseSettingsArgsForCall[i].arg1
+}
+
+func (fake *FakeClient) GetDatabaseSettingsReturns(result1 map[string]interface{}, result2 error) {
+	fake.GetDatabaseSettingsStub = nil
+	fake.getDatabaseSettingsReturns = struct {
+		result1 map[string]interface{}
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeClient) ListDatabases() ([]cluster.InstanceCredentials, error) {
+	fake.listDatabasesMutex.Lock()
+	fake.listDatabasesArgsForCall = append(fake.listDatabasesArgsForCall, struct{}{})
+	fake.listDatabasesMutex.Unlock()
+	if fake.ListDatabasesStub != nil {
+		return fake.ListDatabasesStub()
+	}
+	return fake.listDatabasesReturns.result1, fake.listDatabasesReturns.result2
+}
+
+func (fake *FakeClient) ListDatabasesCallCount() int {
+	fake.listDatabasesMutex.RLock()
+	defer fake.listDatabasesMutex.RUnlock()
+	return len(fake.listDatabasesArgsForCall)
+}
+
+func (fake *FakeClient) ListDatabasesReturns(result1 []cluster.InstanceCredentials, result2 error) {
+	fake.ListDatabasesStub = nil
+	fake.listDatabasesReturns = struct {
+		result1 []cluster.InstanceCredentials
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeClient) ListDatabasesWith(arg1 apiclient.ListOptions) ([]cluster.InstanceCredentials, error) {
+	fake.listDatabasesWithMutex.Lock()
+	fake.listDatabasesWithArgsForCall = append(fake.listDatabasesWithArgsForCall, struct {
+		arg1 apiclient.ListOptions
+	}{arg1})
+	fake.listDatabasesWithMutex.Unlock()
+	if fake.ListDatabasesWithStub != nil {
+		return fake.ListDatabasesWithStub(arg1)
+	}
+	return fake.listDatabasesWithReturns.result1, fake.listDatabasesWithReturns.result2
+}
+
+func (fake *FakeClient) ListDatabasesWithCallCount() int {
+	fake.listDatabasesWithMutex.RLock()
+	defer fake.listDatabasesWithMutex.RUnlock()
+	return len(fake.listDatabasesWithArgsForCall)
+}
+
+func (fake *FakeClient) ListDatabasesWithArgsForCall(i int) apiclient.ListOptions {
+	fake.listDatabasesWithMutex.RLock()
+	defer fake.listDatabasesWithMutex.RUnlock()
+	return fake.listDatabasesWithArgsForCall[i].arg1
+}
+
+func (fake *FakeClient) ListDatabasesWithReturns(result1 []cluster.InstanceCredentials, result2 error) {
+	fake.ListDatabasesWithStub = nil
+	fake.listDatabasesWithReturns = struct {
+		result1 []cluster.InstanceCredentials
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeClient) GetMemoryUsage(arg1 int) (cluster.MemoryUsage, error) {
+	fake.getMemoryUsageMutex.Lock()
+	fake.getMemoryUsageArgsForCall = append(fake.getMemoryUsageArgsForCall, struct {
+		arg1 int
+	}{arg1})
+	fake.getMemoryUsageMutex.Unlock()
+	if fake.GetMemoryUsageStub != nil {
+		return fake.GetMemoryUsageStub(arg1)
+	}
+	return fake.getMemoryUsageReturns.result1, fake.getMemoryUsageReturns.result2
+}
+
+func (fake *FakeClient) GetMemoryUsageCallCount() int {
+	fake.getMemoryUsageMutex.RLock()
+	defer fake.getMemoryUsageMutex.RUnlock()
+	return len(fake.getMemoryUsageArgsForCall)
+}
+
+func (fake *FakeClient) GetMemoryUsageArgsForCall(i int) int {
+	fake.getMemoryUsageMutex.RLock()
+	defer fake.getMemoryUsageMutex.RUnlock()
+	return fake.getMemoryUsageArgsForCall[i].arg1
+}
+
+func (fake *FakeClient) GetMemoryUsageReturns(result1 cluster.MemoryUsage, result2 error) {
+	fake.GetMemoryUsageStub = nil
+	fake.getMemoryUsageReturns = struct {
+		result1 cluster.MemoryUsage
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeClient) GetDatabaseStats(arg1 int) (cluster.DatabaseStats, error) {
+	fake.getDatabaseStatsMutex.Lock()
+	fake.getDatabaseStatsArgsForCall = append(fake.getDatabaseStatsArgsForCall, struct {
+		arg1 int
+	}{arg1})
+	fake.getDatabaseStatsMutex.Unlock()
+	if fake.GetDatabaseStatsStub != nil {
+		return fake.GetDatabaseStatsStub(arg1)
+	}
+	return fake.getDatabaseStatsReturns.result1, fake.getDatabaseStatsReturns.result2
+}
+
+func (fake *FakeClient) GetDatabaseStatsCallCount() int {
+	fake.getDatabaseStatsMutex.RLock()
+	defer fake.getDatabaseStatsMutex.RUnlock()
+	return len(fake.getDatabaseStatsArgsForCall)
+}
+
+func (fake *FakeClient) GetDatabaseStatsArgsForCall(i int) int {
+	fake.getDatabaseStatsMutex.RLock()
+	defer fake.getDatabaseStatsMutex.RUnlock()
+	return fake.getDatabaseStatsArgsForCall[i].arg1
+}
+
+func (fake *FakeClient) GetDatabaseStatsReturns(result1 cluster.DatabaseStats, result2 error) {
+	fake.GetDatabaseStatsStub = nil
+	fake.getDatabaseStatsReturns = struct {
+		result1 cluster.DatabaseStats
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeClient) GetShardCount(arg1 int) (int, error) {
+	fake.getShardCountMutex.Lock()
+	fake.getShardCountArgsForCall = append(fake.getShardCountArgsForCall, struct {
+		arg1 int
+	}{arg1})
+	fake.getShardCountMutex.Unlock()
+	if fake.GetShardCountStub != nil {
+		return fake.GetShardCountStub(arg1)
+	}
+	return fake.getShardCountReturns.result1, fake.getShardCountReturns.result2
+}
+
+func (fake *FakeClient) GetShardCountCallCount() int {
+	fake.getShardCountMutex.RLock()
+	defer fake.getShardCountMutex.RUnlock()
+	return len(fake.getShardCountArgsForCall)
+}
+
+func (fake *FakeClient) GetShardCountArgsForCall(i int) int {
+	fake.getShardCountMutex.RLock()
+	defer fake.getShardCountMutex.RUnlock()
+	return fake.getShardCountArgsForCall[i].arg1
+}
+
+func (fake *FakeClient) GetShardCountReturns(result1 int, result2 error) {
+	fake.GetShardCountStub = nil
+	fake.getShardCountReturns = struct {
+		result1 int
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeClient) GetDatabaseActions(arg1 int) ([]cluster.Action, error) {
+	fake.getDatabaseActionsMutex.Lock()
+	fake.getDatabaseActionsArgsForCall = append(fake.getDatabaseActionsArgsForCall, struct {
+		arg1 int
+	}{arg1})
+	fake.getDatabaseActionsMutex.Unlock()
+	if fake.GetDatabaseActionsStub != nil {
+		return fake.GetDatabaseActionsStub(arg1)
+	}
+	return fake.getDatabaseActionsReturns.result1, fake.getDatabaseActionsReturns.result2
+}
+
+func (fake *FakeClient) GetDatabaseActionsCallCount() int {
+	fake.getDatabaseActionsMutex.RLock()
+	defer fake.getDatabaseActionsMutex.RUnlock()
+	return len(fake.getDatabaseActionsArgsForCall)
+}
+
+func (fake *FakeClient) GetDatabaseActionsArgsForCall(i int) int {
+	fake.getDatabaseActionsMutex.RLock()
+	defer fake.getDatabaseActionsMutex.RUnlock()
+	return fake.getDatabaseActionsArgsForCall[i].arg1
+}
+
+func (fake *FakeClient) GetDatabaseActionsReturns(result1 []cluster.Action, result2 error) {
+	fake.GetDatabaseActionsStub = nil
+	fake.getDatabaseActionsReturns = struct {
+		result1 []cluster.Action
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeClient) GetDatabaseProgress(arg1 int) (cluster.DatabaseProgress, error) {
+	fake.getDatabaseProgressMutex.Lock()
+	fake.getDatabaseProgressArgsForCall = append(fake.getDatabaseProgressArgsForCall, struct {
+		arg1 int
+	}{arg1})
+	fake.getDatabaseProgressMutex.Unlock()
+	if fake.GetDatabaseProgressStub != nil {
+		return fake.GetDatabaseProgressStub(arg1)
+	}
+	return fake.getDatabaseProgressReturns.result1, fake.getDatabaseProgressReturns.result2
+}
+
+func (fake *FakeClient) GetDatabaseProgressCallCount() int {
+	fake.getDatabaseProgressMutex.RLock()
+	defer fake.getDatabaseProgressMutex.RUnlock()
+	return len(fake.getDatabaseProgressArgsForCall)
+}
+
+func (fake *FakeClient) GetDatabaseProgressArgsForCall(i int) int {
+	fake.getDatabaseProgressMutex.RLock()
+	defer fake.getDatabaseProgressMutex.RUnlock()
+	return fake.getDatabaseProgressArgsForCall[i].arg1
+}
+
+func (fake *FakeClient) GetDatabaseProgressReturns(result1 cluster.DatabaseProgress, result2 error) {
+	fake.GetDatabaseProgressStub = nil
+	fake.getDatabaseProgressReturns = struct {
+		result1 cluster.DatabaseProgress
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeClient) AddDatabasePassword(arg1 int, arg2 string) error {
+	fake.addDatabasePasswordMutex.Lock()
+	fake.addDatabasePasswordArgsForCall = append(fake.addDatabasePasswordArgsForCall, struct {
+		arg1 int
+		arg2 string
+	}{arg1, arg2})
+	fake.addDatabasePasswordMutex.Unlock()
+	if fake.AddDatabasePasswordStub != nil {
+		return fake.AddDatabasePasswordStub(arg1, arg2)
+	}
+	return fake.addDatabasePasswordReturns.result1
+}
+
+func (fake *FakeClient) AddDatabasePasswordCallCount() int {
+	fake.addDatabasePasswordMutex.RLock()
+	defer fake.addDatabasePasswordMutex.RUnlock()
+	return len(fake.addDatabasePasswordArgsForCall)
+}
+
+func (fake *FakeClient) AddDatabasePasswordArgsForCall(i int) (int, string) {
+	fake.addDatabasePasswordMutex.RLock()
+	defer fake.addDatabasePasswordMutex.RUnlock()
+	return fake.addDatabasePasswordArgsForCall[i].arg1, fake.addDatabasePasswordArgsForCall[i].arg2
+}
+
+func (fake *FakeClient) AddDatabasePasswordReturns(result1 error) {
+	fake.AddDatabasePasswordStub = nil
+	fake.addDatabasePasswordReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeClient) SetDatabasePassword(arg1 int, arg2 string) error {
+	fake.setDatabasePasswordMutex.Lock()
+	fake.setDatabasePasswordArgsForCall = append(fake.setDatabasePasswordArgsForCall, struct {
+		arg1 int
+		arg2 string
+	}{arg1, arg2})
+	fake.setDatabasePasswordMutex.Unlock()
+	if fake.SetDatabasePasswordStub != nil {
+		return fake.SetDatabasePasswordStub(arg1, arg2)
+	}
+	return fake.setDatabasePasswordReturns.result1
+}
+
+func (fake *FakeClient) SetDatabasePasswordCallCount() int {
+	fake.setDatabasePasswordMutex.RLock()
+	defer fake.setDatabasePasswordMutex.RUnlock()
+	return len(fake.setDatabasePasswordArgsForCall)
+}
+
+func (fake *FakeClient) SetDatabasePasswordArgsForCall(i int) (int, string) {
+	fake.setDatabasePasswordMutex.RLock()
+	defer fake.setDatabasePasswordMutex.RUnlock()
+	return fake.setDatabasePasswordArgsForCall[i].arg1, fake.setDatabasePasswordArgsForCall[i].arg2
+}
+
+func (fake *FakeClient) SetDatabasePasswordReturns(result1 error) {
+	fake.SetDatabasePasswordStub = nil
+	fake.setDatabasePasswordReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeClient) GetClusterInfo() (cluster.Info, error) {
+	fake.getClusterInfoMutex.Lock()
+	fake.getClusterInfoArgsForCall = append(fake.getClusterInfoArgsForCall, struct{}{})
+	fake.getClusterInfoMutex.Unlock()
+	if fake.GetClusterInfoStub != nil {
+		return fake.GetClusterInfoStub()
+	}
+	return fake.getClusterInfoReturns.result1, fake.getClusterInfoReturns.result2
+}
+
+func (fake *FakeClient) GetClusterInfoCallCount() int {
+	fake.getClusterInfoMutex.RLock()
+	defer fake.getClusterInfoMutex.RUnlock()
+	return len(fake.getClusterInfoArgsForCall)
+}
+
+func (fake *FakeClient) GetClusterInfoReturns(result1 cluster.Info, result2 error) {
+	fake.GetClusterInfoStub = nil
+	fake.getClusterInfoReturns = struct {
+		result1 cluster.Info
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeClient) ListModules() ([]cluster.Module, error) {
+	fake.listModulesMutex.Lock()
+	fake.listModulesArgsForCall = append(fake.listModulesArgsForCall, struct{}{})
+	fake.listModulesMutex.Unlock()
+	if fake.ListModulesStub != nil {
+		return fake.ListModulesStub()
+	}
+	return fake.listModulesReturns.result1, fake.listModulesReturns.result2
+}
+
+func (fake *FakeClient) ListModulesCallCount() int {
+	fake.listModulesMutex.RLock()
+	defer fake.listModulesMutex.RUnlock()
+	return len(fake.listModulesArgsForCall)
+}
+
+func (fake *FakeClient) ListModulesReturns(result1 []cluster.Module, result2 error) {
+	fake.ListModulesStub = nil
+	fake.listModulesReturns = struct {
+		result1 []cluster.Module
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeClient) ListNodes() ([]cluster.Node, error) {
+	fake.listNodesMutex.Lock()
+	fake.listNodesArgsForCall = append(fake.listNodesArgsForCall, struct{}{})
+	fake.listNodesMutex.Unlock()
+	if fake.ListNodesStub != nil {
+		return fake.ListNodesStub()
+	}
+	return fake.listNodesReturns.result1, fake.listNodesReturns.result2
+}
+
+func (fake *FakeClient) ListNodesCallCount() int {
+	fake.listNodesMutex.RLock()
+	defer fake.listNodesMutex.RUnlock()
+	return len(fake.listNodesArgsForCall)
+}
+
+func (fake *FakeClient) ListNodesReturns(result1 []cluster.Node, result2 error) {
+	fake.ListNodesStub = nil
+	fake.listNodesReturns = struct {
+		result1 []cluster.Node
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeClient) DetectVersion() (cluster.Version, error) {
+	fake.detectVersionMutex.Lock()
+	fake.detectVersionArgsForCall = append(fake.detectVersionArgsForCall, struct{}{})
+	fake.detectVersionMutex.Unlock()
+	if fake.DetectVersionStub != nil {
+		return fake.DetectVersionStub()
+	}
+	return fake.detectVersionReturns.result1, fake.detectVersionReturns.result2
+}
+
+func (fake *FakeClient) DetectVersionCallCount() int {
+	fake.detectVersionMutex.RLock()
+	defer fake.detectVersionMutex.RUnlock()
+	return len(fake.detectVersionArgsForCall)
+}
+
+func (fake *FakeClient) DetectVersionReturns(result1 cluster.Version, result2 error) {
+	fake.DetectVersionStub = nil
+	fake.detectVersionReturns = struct {
+		result1 cluster.Version
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeClient) Supports(arg1 cluster.Capability) error {
+	fake.supportsMutex.Lock()
+	fake.supportsArgsForCall = append(fake.supportsArgsForCall, struct {
+		arg1 cluster.Capability
+	}{arg1})
+	fake.supportsMutex.Unlock()
+	if fake.SupportsStub != nil {
+		return fake.SupportsStub(arg1)
+	}
+	return fake.supportsReturns.result1
+}
+
+func (fake *FakeClient) SupportsCallCount() int {
+	fake.supportsMutex.RLock()
+	defer fake.supportsMutex.RUnlock()
+	return len(fake.supportsArgsForCall)
+}
+
+func (fake *FakeClient) SupportsArgsForCall(i int) cluster.Capability {
+	fake.supportsMutex.RLock()
+	defer fake.supportsMutex.RUnlock()
+	return fake.supportsArgsForCall[i].arg1
+}
+
+func (fake *FakeClient) SupportsReturns(result1 error) {
+	fake.SupportsStub = nil
+	fake.supportsReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeClient) EnsureRedisACL(arg1 string, arg2 string) (int, error) {
+	fake.ensureRedisACLMutex.Lock()
+	fake.ensureRedisACLArgsForCall = append(fake.ensureRedisACLArgsForCall, struct {
+		arg1 string
+		arg2 string
+	}{arg1, arg2})
+	fake.ensureRedisACLMutex.Unlock()
+	if fake.EnsureRedisACLStub != nil {
+		return fake.EnsureRedisACLStub(arg1, arg2)
+	}
+	return fake.ensureRedisACLReturns.result1, fake.ensureRedisACLReturns.result2
+}
+
+func (fake *FakeClient) EnsureRedisACLCallCount() int {
+	fake.ensureRedisACLMutex.RLock()
+	defer fake.ensureRedisACLMutex.RUnlock()
+	return len(fake.ensureRedisACLArgsForCall)
+}
+
+func (fake *FakeClient) EnsureRedisACLArgsForCall(i int) (string, string) {
+	fake.ensureRedisACLMutex.RLock()
+	defer fake.ensureRedisACLMutex.RUnlock()
+	return fake.ensureRedisACLArgsForCall[i].arg1, fake.ensureRedisACLArgsForCall[i].arg2
+}
+
+func (fake *FakeClient) EnsureRedisACLReturns(result1 int, result2 error) {
+	fake.EnsureRedisACLStub = nil
+	fake.ensureRedisACLReturns = struct {
+		result1 int
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeClient) EnsureRole(arg1 string) (int, error) {
+	fake.ensureRoleMutex.Lock()
+	fake.ensureRoleArgsForCall = append(fake.ensureRoleArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	fake.ensureRoleMutex.Unlock()
+	if fake.EnsureRoleStub != nil {
+		return fake.EnsureRoleStub(arg1)
+	}
+	return fake.ensureRoleReturns.result1, fake.ensureRoleReturns.result2
+}
+
+func (fake *FakeClient) EnsureRoleCallCount() int {
+	fake.ensureRoleMutex.RLock()
+	defer fake.ensureRoleMutex.RUnlock()
+	return len(fake.ensureRoleArgsForCall)
+}
+
+func (fake *FakeClient) EnsureRoleArgsForCall(i int) string {
+	fake.ensureRoleMutex.RLock()
+	defer fake.ensureRoleMutex.RUnlock()
+	return fake.ensureRoleArgsForCall[i].arg1
+}
+
+func (fake *FakeClient) EnsureRoleReturns(result1 int, result2 error) {
+	fake.EnsureRoleStub = nil
+	fake.ensureRoleReturns = struct {
+		result1 int
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeClient) GrantRole(arg1 int, arg2 int, arg3 int) error {
+	fake.grantRoleMutex.Lock()
+	fake.grantRoleArgsForCall = append(fake.grantRoleArgsForCall, struct {
+		arg1 int
+		arg2 int
+		arg3 int
+	}{arg1, arg2, arg3})
+	fake.grantRoleMutex.Unlock()
+	if fake.GrantRoleStub != nil {
+		return fake.GrantRoleStub(arg1, arg2, arg3)
+	}
+	return fake.grantRoleReturns.result1
+}
+
+func (fake *FakeClient) GrantRoleCallCount() int {
+	fake.grantRoleMutex.RLock()
+	defer fake.grantRoleMutex.RUnlock()
+	return len(fake.grantRoleArgsForCall)
+}
+
+func (fake *FakeClient) GrantRoleArgsForCall(i int) (int, int, int) {
+	fake.grantRoleMutex.RLock()
+	defer fake.grantRoleMutex.RUnlock()
+	return fake.grantRoleArgsForCall[i].arg1, fake.grantRoleArgsForCall[i].arg2, fake.grantRoleArgsForCall[i].arg3
+}
+
+func (fake *FakeClient) GrantRoleReturns(result1 error) {
+	fake.GrantRoleStub = nil
+	fake.grantRoleReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeClient) RevokeRole(arg1 int, arg2 int) error {
+	fake.revokeRoleMutex.Lock()
+	fake.revokeRoleArgsForCall = append(fake.revokeRoleArgsForCall, struct {
+		arg1 int
+		arg2 int
+	}{arg1, arg2})
+	fake.revokeRoleMutex.Unlock()
+	if fake.RevokeRoleStub != nil {
+		return fake.RevokeRoleStub(arg1, arg2)
+	}
+	return fake.revokeRoleReturns.result1
+}
+
+func (fake *FakeClient) RevokeRoleCallCount() int {
+	fake.revokeRoleMutex.RLock()
+	defer fake.revokeRoleMutex.RUnlock()
+	return len(fake.revokeRoleArgsForCall)
+}
+
+func (fake *FakeClient) RevokeRoleArgsForCall(i int) (int, int) {
+	fake.revokeRoleMutex.RLock()
+	defer fake.revokeRoleMutex.RUnlock()
+	return fake.revokeRoleArgsForCall[i].arg1, fake.revokeRoleArgsForCall[i].arg2
+}
+
+func (fake *FakeClient) RevokeRoleReturns(result1 error) {
+	fake.RevokeRoleStub = nil
+	fake.revokeRoleReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeClient) FindRole(arg1 string) (int, bool, error) {
+	fake.findRoleMutex.Lock()
+	fake.findRoleArgsForCall = append(fake.findRoleArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	fake.findRoleMutex.Unlock()
+	if fake.FindRoleStub != nil {
+		return fake.FindRoleStub(arg1)
+	}
+	return fake.findRoleReturns.result1, fake.findRoleReturns.result2, fake.findRoleReturns.result3
+}
+
+func (fake *FakeClient) FindRoleCallCount() int {
+	fake.findRoleMutex.RLock()
+	defer fake.findRoleMutex.RUnlock()
+	return len(fake.findRoleArgsForCall)
+}
+
+func (fake *FakeClient) FindRoleArgsForCall(i int) string {
+	fake.findRoleMutex.RLock()
+	defer fake.findRoleMutex.RUnlock()
+	return fake.findRoleArgsForCall[i].arg1
+}
+
+func (fake *FakeClient) FindRoleReturns(result1 int, result2 bool, result3 error) {
+	fake.FindRoleStub = nil
+	fake.findRoleReturns = struct {
+		result1 int
+		result2 bool
+		result3 error
+	}{result1, result2, result3}
+}
+
+func (fake *FakeClient) DeleteRole(arg1 int) error {
+	fake.deleteRoleMutex.Lock()
+	fake.deleteRoleArgsForCall = append(fake.deleteRoleArgsForCall, struct {
+		arg1 int
+	}{arg1})
+	fake.deleteRoleMutex.Unlock()
+	if fake.DeleteRoleStub != nil {
+		return fake.DeleteRoleStub(arg1)
+	}
+	return fake.deleteRoleReturns.result1
+}
+
+func (fake *FakeClient) DeleteRoleCallCount() int {
+	fake.deleteRoleMutex.RLock()
+	defer fake.deleteRoleMutex.RUnlock()
+	return len(fake.deleteRoleArgsForCall)
+}
+
+func (fake *FakeClient) DeleteRoleArgsForCall(i int) int {
+	fake.deleteRoleMutex.RLock()
+	defer fake.deleteRoleMutex.RUnlock()
+	return fake.deleteRoleArgsForCall[i].arg1
+}
+
+func (fake *FakeClient) DeleteRoleReturns(result1 error) {
+	fake.DeleteRoleStub = nil
+	fake.deleteRoleReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeClient) CreateUser(arg1 string, arg2 string, arg3 []int) (int, error) {
+	fake.createUserMutex.Lock()
+	fake.createUserArgsForCall = append(fake.createUserArgsForCall, struct {
+		arg1 string
+		arg2 string
+		arg3 []int
+	}{arg1, arg2, arg3})
+	fake.createUserMutex.Unlock()
+	if fake.CreateUserStub != nil {
+		return fake.CreateUserStub(arg1, arg2, arg3)
+	}
+	return fake.createUserReturns.result1, fake.createUserReturns.result2
+}
+
+func (fake *FakeClient) CreateUserCallCount() int {
+	fake.createUserMutex.RLock()
+	defer fake.createUserMutex.RUnlock()
+	return len(fake.createUserArgsForCall)
+}
+
+func (fake *FakeClient) CreateUserArgsForCall(i int) (string, string, []int) {
+	fake.createUserMutex.RLock()
+	defer fake.createUserMutex.RUnlock()
+	return fake.createUserArgsForCall[i].arg1, fake.createUserArgsForCall[i].arg2, fake.createUserArgsForCall[i].arg3
+}
+
+func (fake *FakeClient) CreateUserReturns(result1 int, result2 error) {
+	fake.CreateUserStub = nil
+	fake.createUserReturns = struct {
+		result1 int
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeClient) FindUser(arg1 string) (int, bool, error) {
+	fake.findUserMutex.Lock()
+	fake.findUserArgsForCall = append(fake.findUserArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	fake.findUserMutex.Unlock()
+	if fake.FindUserStub != nil {
+		return fake.FindUserStub(arg1)
+	}
+	return fake.findUserReturns.result1, fake.findUserReturns.result2, fake.findUserReturns.result3
+}
+
+func (fake *FakeClient) FindUserCallCount() int {
+	fake.findUserMutex.RLock()
+	defer fake.findUserMutex.RUnlock()
+	return len(fake.findUserArgsForCall)
+}
+
+func (fake *FakeClient) FindUserArgsForCall(i int) string {
+	fake.findUserMutex.RLock()
+	defer fake.findUserMutex.RUnlock()
+	return fake.findUserArgsForCall[i].arg1
+}
+
+func (fake *FakeClient) FindUserReturns(result1 int, result2 bool, result3 error) {
+	fake.FindUserStub = nil
+	fake.findUserReturns = struct {
+		result1 int
+		result2 bool
+		result3 error
+	}{result1, result2, result3}
+}
+
+func (fake *FakeClient) DeleteUser(arg1 int) error {
+	fake.deleteUserMutex.Lock()
+	fake.deleteUserArgsForCall = append(fake.deleteUserArgsForCall, struct {
+		arg1 int
+	}{arg1})
+	fake.deleteUserMutex.Unlock()
+	if fake.DeleteUserStub != nil {
+		return fake.DeleteUserStub(arg1)
+	}
+	return fake.deleteUserReturns.result1
+}
+
+func (fake *FakeClient) DeleteUserCallCount() int {
+	fake.deleteUserMutex.RLock()
+	defer fake.deleteUserMutex.RUnlock()
+	return len(fake.deleteUserArgsForCall)
+}
+
+func (fake *FakeClient) DeleteUserArgsForCall(i int) int {
+	fake.deleteUserMutex.RLock()
+	defer fake.deleteUserMutex.RUnlock()
+	return fake.deleteUserArgsForCall[i].arg1
+}
+
+func (fake *FakeClient) DeleteUserReturns(result1 error) {
+	fake.DeleteUserStub = nil
+	fake.deleteUserReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeClient) WithLogger(arg1 lager.Logger) apiclient.Client {
+	fake.withLoggerMutex.Lock()
+	fake.withLoggerArgsForCall = append(fake.withLoggerArgsForCall, struct {
+		arg1 lager.Logger
+	}{arg1})
+	fake.withLoggerMutex.Unlock()
+	if fake.WithLoggerStub != nil {
+		return fake.WithLoggerStub(arg1)
+	}
+	if fake.withLoggerReturns.result1 == nil {
+		return fake
+	}
+	return fake.withLoggerReturns.result1
+}
+
+func (fake *FakeClient) WithLoggerCallCount() int {
+	fake.withLoggerMutex.RLock()
+	defer fake.withLoggerMutex.RUnlock()
+	return len(fake.withLoggerArgsForCall)
+}
+
+func (fake *FakeClient) WithLoggerArgsForCall(i int) lager.Logger {
+	fake.withLoggerMutex.RLock()
+	defer fake.withLoggerMutex.RUnlock()
+	return fake.withLoggerArgsForCall[i].arg1
+}
+
+func (fake *FakeClient) WithLoggerReturns(result1 apiclient.Client) {
+	fake.WithLoggerStub = nil
+	fake.withLoggerReturns = struct {
+		result1 apiclient.Client
+	}{result1}
+}
+
+var _ apiclient.Client = new(FakeClient)
@@ -0,0 +1,184 @@
+package fakes
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/httpclient"
+)
+
+// FakeHTTPClient is a fake httpclient.HTTPClient.
+type FakeHTTPClient struct {
+	GetStub        func(string, httpclient.HTTPParams) (*http.Response, error)
+	getMutex       sync.RWMutex
+	getArgsForCall []struct {
+		arg1 string
+		arg2 httpclient.HTTPParams
+	}
+	getReturns struct {
+		result1 *http.Response
+		result2 error
+	}
+	PostStub        func(string, httpclient.HTTPPayload) (*http.Response, error)
+	postMutex       sync.RWMutex
+	postArgsForCall []struct {
+		arg1 string
+		arg2 httpclient.HTTPPayload
+	}
+	postReturns struct {
+		result1 *http.Response
+		result2 error
+	}
+	PutStub        func(string, httpclient.HTTPPayload) (*http.Response, error)
+	putMutex       sync.RWMutex
+	putArgsForCall []struct {
+		arg1 string
+		arg2 httpclient.HTTPPayload
+	}
+	putReturns struct {
+		result1 *http.Response
+		result2 error
+	}
+	DeleteStub        func(string) (*http.Response, error)
+	deleteMutex       sync.RWMutex
+	deleteArgsForCall []struct {
+		arg1 string
+	}
+	deleteReturns struct {
+		result1 *http.Response
+		result2 error
+	}
+}
+
+func (fake *FakeHTTPClient) Get(arg1 string, arg2 httpclient.HTTPParams) (*http.Response, error) {
+	fake.getMutex.Lock()
+	fake.getArgsForCall = append(fake.getArgsForCall, struct {
+		arg1 string
+		arg2 httpclient.HTTPParams
+	}{arg1, arg2})
+	fake.getMutex.Unlock()
+	if fake.GetStub != nil {
+		return fake.GetStub(arg1, arg2)
+	}
+	return fake.getReturns.result1, fake.getReturns.result2
+}
+
+func (fake *FakeHTTPClient) GetCallCount() int {
+	fake.getMutex.RLock()
+	defer fake.getMutex.RUnlock()
+	return len(fake.getArgsForCall)
+}
+
+func (fake *FakeHTTPClient) GetArgsForCall(i int) (string, httpclient.HTTPParams) {
+	fake.getMutex.RLock()
+	defer fake.getMutex.RUnlock()
+	return fake.getArgsForCall[i].arg1, fake.getArgsForCall[i].arg2
+}
+
+func (fake *FakeHTTPClient) GetReturns(result1 *http.Response, result2 error) {
+	fake.GetStub = nil
+	fake.getReturns = struct {
+		result1 *http.Response
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeHTTPClient) Post(arg1 string, arg2 httpclient.HTTPPayload) (*http.Response, error) {
+	fake.postMutex.Lock()
+	fake.postArgsForCall = append(fake.postArgsForCall, struct {
+		arg1 string
+		arg2 httpclient.HTTPPayload
+	}{arg1, arg2})
+	fake.postMutex.Unlock()
+	if fake.PostStub != nil {
+		return fake.PostStub(arg1, arg2)
+	}
+	return fake.postReturns.result1, fake.postReturns.result2
+}
+
+func (fake *FakeHTTPClient) PostCallCount() int {
+	fake.postMutex.RLock()
+	defer fake.postMutex.RUnlock()
+	return len(fake.postArgsForCall)
+}
+
+func (fake *FakeHTTPClient) PostArgsForCall(i int) (string, httpclient.HTTPPayload) {
+	fake.postMutex.RLock()
+	defer fake.postMutex.RUnlock()
+	return fake.postArgsForCall[i].arg1, fake.postArgsForCall[i].arg2
+}
+
+func (fake *FakeHTTPClient) PostReturns(result1 *http.Response, result2 error) {
+	fake.PostStub = nil
+	fake.postReturns = struct {
+		result1 *http.Response
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeHTTPClient) Put(arg1 string, arg2 httpclient.HTTPPayload) (*http.Response, error) {
+	fake.putMutex.Lock()
+	fake.putArgsForCall = append(fake.putArgsForCall, struct {
+		arg1 string
+		arg2 httpclient.HTTPPayload
+	}{arg1, arg2})
+	fake.putMutex.Unlock()
+	if fake.PutStub != nil {
+		return fake.PutStub(arg1, arg2)
+	}
+	return fake.putReturns.result1, fake.putReturns.result2
+}
+
+func (fake *FakeHTTPClient) PutCallCount() int {
+	fake.putMutex.RLock()
+	defer fake.putMutex.RUnlock()
+	return len(fake.putArgsForCall)
+}
+
+func (fake *FakeHTTPClient) PutArgsForCall(i int) (string, httpclient.HTTPPayload) {
+	fake.putMutex.RLock()
+	defer fake.putMutex.RUnlock()
+	return fake.putArgsForCall[i].arg1, fake.putArgsForCall[i].arg2
+}
+
+func (fake *FakeHTTPClient) PutReturns(result1 *http.Response, result2 error) {
+	fake.PutStub = nil
+	fake.putReturns = struct {
+		result1 *http.Response
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeHTTPClient) Delete(arg1 string) (*http.Response, error) {
+	fake.deleteMutex.Lock()
+	fake.deleteArgsForCall = append(fake.deleteArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	fake.deleteMutex.Unlock()
+	if fake.DeleteStub != nil {
+		return fake.DeleteStub(arg1)
+	}
+	return fake.deleteReturns.result1, fake.deleteReturns.result2
+}
+
+func (fake *FakeHTTPClient) DeleteCallCount() int {
+	fake.deleteMutex.RLock()
+	defer fake.deleteMutex.RUnlock()
+	return len(fake.deleteArgsForCall)
+}
+
+func (fake *FakeHTTPClient) DeleteArgsForCall(i int) string {
+	fake.deleteMutex.RLock()
+	defer fake.deleteMutex.RUnlock()
+	return fake.deleteArgsForCall[i].arg1
+}
+
+func (fake *FakeHTTPClient) DeleteReturns(result1 *http.Response, result2 error) {
+	fake.DeleteStub = nil
+	fake.deleteReturns = struct {
+		result1 *http.Response
+		result2 error
+	}{result1, result2}
+}
+
+var _ httpclient.HTTPClient = new(FakeHTTPClient)
@@ -0,0 +1,120 @@
+package hooks
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pivotal-golang/lager"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+)
+
+// DefaultTimeout bounds the commands whose config has no timeout.
+var DefaultTimeout = 30 * time.Second
+
+// Exec is a hook running a command. The command gets the event as JSON on
+// its stdin and in REDISLABS_HOOK_* environment variables. Its output is
+// logged, and is the error of a failing pre hook.
+type Exec struct {
+	conf    config.HookConfig
+	actions map[string]bool
+	logger  lager.Logger
+}
+
+func NewExec(conf config.HookConfig, logger lager.Logger) *Exec {
+	actions := map[string]bool{}
+	for _, action := range conf.Actions {
+		actions[action] = true
+	}
+	if len(actions) == 0 {
+		actions = map[string]bool{Provision: true, Deprovision: true}
+	}
+	return &Exec{
+		conf:    conf,
+		actions: actions,
+		logger:  logger.Session("hook", lager.Data{"hook": conf.Name}),
+	}
+}
+
+func (e *Exec) Before(event Event) error {
+	if !e.actions[event.Action] {
+		return nil
+	}
+	return e.run(event)
+}
+
+func (e *Exec) After(event Event) {
+	if !e.actions[event.Action] {
+		return
+	}
+	if err := e.run(event); err != nil {
+		e.logger.Error("The hook failed after the operation", err, lager.Data{
+			"instance-id": event.InstanceID,
+			"action":      event.Action,
+		})
+	}
+}
+
+func (e *Exec) run(event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	output := &bytes.Buffer{}
+	cmd := exec.Command(e.conf.Command, e.conf.Args...)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Stdout, cmd.Stderr = output, output
+	// The command gets a process group of its own, so that the processes
+	// it started are stopped with it on a timeout.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Env = append(os.Environ(),
+		"REDISLABS_HOOK_ACTION="+event.Action,
+		"REDISLABS_HOOK_PHASE="+event.Phase,
+		"REDISLABS_HOOK_INSTANCE_ID="+event.InstanceID,
+		"REDISLABS_HOOK_PLAN_ID="+event.PlanID,
+		"REDISLABS_HOOK_ORGANIZATION_GUID="+event.OrganizationGUID,
+		"REDISLABS_HOOK_SPACE_GUID="+event.SpaceGUID,
+		"REDISLABS_HOOK_DATABASE_UID="+strconv.Itoa(event.DatabaseUID),
+	)
+
+	timeout := time.Duration(e.conf.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("hook %s failed to start: %s", e.name(), err)
+	}
+	timer := time.AfterFunc(timeout, func() { syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL) })
+	err = cmd.Wait()
+	timedOut := !timer.Stop()
+
+	e.logger.Info("Ran the hook", lager.Data{
+		"instance-id": event.InstanceID,
+		"action":      event.Action,
+		"phase":       event.Phase,
+		"output":      output.String(),
+	})
+	switch {
+	case timedOut:
+		return fmt.Errorf("hook %s timed out after %s", e.name(), timeout)
+	case err != nil && output.Len() > 0:
+		return fmt.Errorf("hook %s failed: %s", e.name(), strings.TrimSpace(output.String()))
+	case err != nil:
+		return fmt.Errorf("hook %s failed: %s", e.name(), err)
+	}
+	return nil
+}
+
+func (e *Exec) name() string {
+	if e.conf.Name != "" {
+		return e.conf.Name
+	}
+	return e.conf.Command
+}
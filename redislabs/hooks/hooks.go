@@ -0,0 +1,83 @@
+// Package hooks runs custom logic of operators before and after service
+// instances are provisioned or deprovisioned, e.g. to register databases
+// in a CMDB or to notify a chat channel.
+package hooks
+
+import (
+	"github.com/pivotal-golang/lager"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+)
+
+// Actions and phases of the events.
+const (
+	Provision   = "provision"
+	Deprovision = "deprovision"
+
+	Pre  = "pre"
+	Post = "post"
+)
+
+// Event describes the instance an operation is about.
+type Event struct {
+	Action           string `json:"action"`
+	Phase            string `json:"phase"`
+	InstanceID       string `json:"instance_id"`
+	PlanID           string `json:"plan_id,omitempty"`
+	ServiceID        string `json:"service_id,omitempty"`
+	OrganizationGUID string `json:"organization_guid,omitempty"`
+	SpaceGUID        string `json:"space_guid,omitempty"`
+	// DatabaseUID is unknown to pre-provision hooks.
+	DatabaseUID int `json:"database_uid,omitempty"`
+}
+
+// PreHook runs before an instance is provisioned or deprovisioned. An
+// error rejects the operation and is shown to the developer.
+type PreHook interface {
+	Before(event Event) error
+}
+
+// PostHook runs after an instance was provisioned or deprovisioned. It
+// has to deal with its own failures, since the operation is done.
+type PostHook interface {
+	After(event Event)
+}
+
+// Hooks are the hooks of a broker, run in order.
+type Hooks struct {
+	Pre  []PreHook
+	Post []PostHook
+}
+
+// New returns the commands of the config as hooks.
+func New(confs []config.HookConfig, logger lager.Logger) Hooks {
+	hooks := Hooks{}
+	for _, conf := range confs {
+		hook := NewExec(conf, logger)
+		if conf.Phase == Pre {
+			hooks.Pre = append(hooks.Pre, hook)
+		} else {
+			hooks.Post = append(hooks.Post, hook)
+		}
+	}
+	return hooks
+}
+
+// Before runs the pre hooks until one of them fails.
+func (h Hooks) Before(event Event) error {
+	event.Phase = Pre
+	for _, hook := range h.Pre {
+		if err := hook.Before(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// After runs all the post hooks.
+func (h Hooks) After(event Event) {
+	event.Phase = Post
+	for _, hook := range h.Post {
+		hook.After(event)
+	}
+}
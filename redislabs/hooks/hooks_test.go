@@ -0,0 +1,106 @@
+package hooks_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	brokerconfig "github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/hooks"
+	"github.com/pivotal-golang/lager"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Hooks", func() {
+	var (
+		tmpDir string
+		logger = lager.NewLogger("test")
+		event  = hooks.Event{
+			Action:           hooks.Provision,
+			InstanceID:       "instance-id",
+			PlanID:           "plan-id",
+			OrganizationGUID: "org-guid",
+			DatabaseUID:      7,
+		}
+	)
+
+	// script returns a hook running a shell script in the temp dir.
+	script := func(phase string, body string, actions ...string) brokerconfig.HookConfig {
+		return brokerconfig.HookConfig{
+			Name:    "test",
+			Command: "/bin/sh",
+			Args:    []string{"-c", "cd " + tmpDir + " && " + body},
+			Phase:   phase,
+			Actions: actions,
+		}
+	}
+	read := func(name string) string {
+		contents, err := ioutil.ReadFile(path.Join(tmpDir, name))
+		if err != nil {
+			return ""
+		}
+		return string(contents)
+	}
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "redislabs-hooks-test")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	It("Passes the event on the stdin and in the environment", func() {
+		h := hooks.New([]brokerconfig.HookConfig{
+			script("post", `cat > event.json && echo -n "$REDISLABS_HOOK_PHASE $REDISLABS_HOOK_DATABASE_UID" > env`),
+		}, logger)
+		h.After(event)
+
+		var passed map[string]interface{}
+		Expect(json.Unmarshal([]byte(read("event.json")), &passed)).To(Succeed())
+		Expect(passed).To(HaveKeyWithValue("action", "provision"))
+		Expect(passed).To(HaveKeyWithValue("phase", "post"))
+		Expect(passed).To(HaveKeyWithValue("instance_id", "instance-id"))
+		Expect(passed).To(HaveKeyWithValue("organization_guid", "org-guid"))
+		Expect(read("env")).To(Equal("post 7"))
+	})
+
+	It("Rejects operations with the output of failing pre hooks", func() {
+		h := hooks.New([]brokerconfig.HookConfig{
+			script("pre", "echo the CMDB is down >&2; exit 1"),
+			script("pre", "touch ran"),
+		}, logger)
+		Expect(h.Before(event)).To(MatchError("hook test failed: the CMDB is down"))
+		Expect(path.Join(tmpDir, "ran")).NotTo(BeAnExistingFile())
+	})
+
+	It("Runs the hooks in their phase for their actions only", func() {
+		h := hooks.New([]brokerconfig.HookConfig{
+			script("pre", "echo -n pre >> ran", "provision"),
+			script("post", "echo -n post >> ran", "deprovision"),
+		}, logger)
+		Expect(h.Before(event)).To(Succeed())
+		h.After(event)
+		Expect(read("ran")).To(Equal("pre"))
+
+		event := event
+		event.Action = hooks.Deprovision
+		Expect(h.Before(event)).To(Succeed())
+		h.After(event)
+		Expect(read("ran")).To(Equal("prepost"))
+	})
+
+	It("Stops commands that take too long", func() {
+		conf := script("pre", "sleep 5")
+		conf.Timeout = 1
+		start := time.Now()
+		Expect(hooks.New([]brokerconfig.HookConfig{conf}, logger).Before(event)).To(MatchError("hook test timed out after 1s"))
+		Expect(time.Since(start)).To(BeNumerically("<", 3*time.Second))
+	})
+})
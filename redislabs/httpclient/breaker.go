@@ -0,0 +1,53 @@
+package httpclient
+
+import (
+	"sync"
+	"time"
+)
+
+// CircuitBreaker stops requests to a failing cluster, so that they fail
+// right away instead of waiting for timeouts. It opens after a number of
+// failed requests in a row and lets requests through again once the
+// cooldown has passed. A nil breaker never opens.
+type CircuitBreaker struct {
+	lock      sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openedAt  time.Time
+}
+
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+// Allow returns ErrCircuitOpen if no request may be sent now.
+func (b *CircuitBreaker) Allow() error {
+	if b == nil {
+		return nil
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.failures >= b.threshold && time.Since(b.openedAt) < b.cooldown {
+		return ErrCircuitOpen
+	}
+	return nil
+}
+
+// Record takes the result of a request into account. A request sent after
+// the cooldown opens the breaker again if it fails.
+func (b *CircuitBreaker) Record(failed bool) {
+	if b == nil {
+		return
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if !failed {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openedAt = time.Now()
+	}
+}
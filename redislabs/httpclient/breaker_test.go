@@ -0,0 +1,39 @@
+package httpclient_test
+
+import (
+	"time"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/httpclient"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Circuit breaker", func() {
+	It("Opens after failures in a row", func() {
+		breaker := httpclient.NewCircuitBreaker(2, time.Minute)
+		breaker.Record(true)
+		breaker.Record(false)
+		breaker.Record(true)
+		Expect(breaker.Allow()).To(Succeed())
+
+		breaker.Record(true)
+		Expect(breaker.Allow()).To(Equal(httpclient.ErrCircuitOpen))
+		Expect(httpclient.ErrCircuitOpen.StatusCode).To(Equal(503))
+	})
+
+	It("Lets a request through after the cooldown", func() {
+		breaker := httpclient.NewCircuitBreaker(1, 50*time.Millisecond)
+		breaker.Record(true)
+		Expect(breaker.Allow()).To(Equal(httpclient.ErrCircuitOpen))
+
+		time.Sleep(60 * time.Millisecond)
+		Expect(breaker.Allow()).To(Succeed())
+		breaker.Record(true)
+		Expect(breaker.Allow()).To(Equal(httpclient.ErrCircuitOpen))
+
+		time.Sleep(60 * time.Millisecond)
+		breaker.Record(false)
+		Expect(breaker.Allow()).To(Succeed())
+	})
+})
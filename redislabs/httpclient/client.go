@@ -23,11 +23,12 @@ type (
 	}
 
 	httpClient struct {
-		password string
-		username string
-		address  string
-		logger   lager.Logger
-		client   *http.Client
+		credentials *Credentials
+		address     string
+		logger      lager.Logger
+		client      *http.Client
+		limiter     *RateLimiter
+		breaker     *CircuitBreaker
 	}
 )
 
@@ -47,14 +48,33 @@ var defaultClient = &http.Client{
 func New(username string, password string, address string, logger lager.Logger) *httpClient {
 	logger.Info("Creating new http client", lager.Data{"address": address})
 	return &httpClient{
-		username: username,
-		password: password,
-		address:  address,
-		logger:   logger,
-		client:   defaultClient,
+		credentials: NewCredentials(username, password),
+		address:     address,
+		logger:      logger,
+		client:      defaultClient,
 	}
 }
 
+// WithCredentials makes the client authenticate with the given
+// credentials, which may be shared with other clients.
+func (c *httpClient) WithCredentials(credentials *Credentials) *httpClient {
+	c.credentials = credentials
+	return c
+}
+
+// WithRateLimiter makes the client wait for the limiter before every
+// request.
+func (c *httpClient) WithRateLimiter(limiter *RateLimiter) *httpClient {
+	c.limiter = limiter
+	return c
+}
+
+// WithCircuitBreaker makes the client fail fast while the breaker is open.
+func (c *httpClient) WithCircuitBreaker(breaker *CircuitBreaker) *httpClient {
+	c.breaker = breaker
+	return c
+}
+
 func (c *httpClient) Put(endpoint string, payload HTTPPayload) (*http.Response, error) {
 	response, err := c.performRequest("PUT", endpoint, HTTPParams{}, payload)
 	if err != nil {
@@ -128,12 +148,18 @@ func (c *httpClient) performRequest(verb string, path string, params HTTPParams,
 			"payload": js,
 		},
 	)
+	if err := c.breaker.Allow(); err != nil {
+		return nil, err
+	}
+	c.limiter.Wait()
 	requestURL := c.buildFullRequestURL(path, params)
 	req, err := http.NewRequest(verb, requestURL, bytes.NewReader(payload))
 	if err != nil {
 		return &http.Response{}, err
 	}
-	req.SetBasicAuth(c.username, c.password)
+	req.SetBasicAuth(c.credentials.Get())
 	req.Header.Add("Content-Type", "application/json")
-	return c.client.Do(req)
+	res, err := c.client.Do(req)
+	c.breaker.Record(err != nil || res.StatusCode >= 500)
+	return res, err
 }
@@ -0,0 +1,30 @@
+package httpclient
+
+import "sync"
+
+// Credentials authenticate the requests of the clients sharing them. They
+// can be replaced while the clients are in use, the next request of every
+// client sends the new ones.
+type Credentials struct {
+	lock     sync.RWMutex
+	username string
+	password string
+}
+
+func NewCredentials(username string, password string) *Credentials {
+	return &Credentials{username: username, password: password}
+}
+
+// Get returns the username and the password.
+func (c *Credentials) Get() (string, string) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.username, c.password
+}
+
+// Set replaces the username and the password.
+func (c *Credentials) Set(username string, password string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.username, c.password = username, password
+}
@@ -0,0 +1,7 @@
+package httpclient
+
+import "github.com/RedisLabs/cf-redislabs-broker/redislabs/brokererrors"
+
+var (
+	ErrCircuitOpen = brokererrors.NewServiceUnavailable("the cluster API keeps failing, requests to it are suspended for a while")
+)
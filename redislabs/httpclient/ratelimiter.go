@@ -0,0 +1,56 @@
+package httpclient
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket limiting the requests sent to the cluster.
+// Clients that share a limiter share its rate. A nil limiter lets all the
+// requests through.
+type RateLimiter struct {
+	lock   sync.Mutex
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter allows rate requests per second on average and up to
+// burst requests at once.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Wait blocks until a request may be sent.
+func (l *RateLimiter) Wait() {
+	if l == nil {
+		return
+	}
+
+	l.lock.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	// The token is taken right away, so that concurrent requests queue up
+	// behind each other.
+	l.tokens--
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.lock.Unlock()
+
+	time.Sleep(wait)
+}
@@ -0,0 +1,35 @@
+package httpclient_test
+
+import (
+	"time"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/httpclient"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Rate limiter", func() {
+	It("Lets a burst through right away", func() {
+		limiter := httpclient.NewRateLimiter(1, 3)
+		start := time.Now()
+		for i := 0; i < 3; i++ {
+			limiter.Wait()
+		}
+		Expect(time.Since(start)).To(BeNumerically("<", 100*time.Millisecond))
+	})
+
+	It("Spreads the requests beyond the burst", func() {
+		limiter := httpclient.NewRateLimiter(20, 1)
+		start := time.Now()
+		for i := 0; i < 5; i++ {
+			limiter.Wait()
+		}
+		Expect(time.Since(start)).To(BeNumerically(">=", 190*time.Millisecond))
+	})
+
+	It("Does not limit anything if it is nil", func() {
+		var limiter *httpclient.RateLimiter
+		limiter.Wait()
+	})
+})
@@ -1,69 +1,521 @@
 package instancebinders
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
 	"github.com/pivotal-cf/brokerapi"
 	"github.com/pivotal-golang/lager"
 
 	"github.com/RedisLabs/cf-redislabs-broker/redislabs/apiclient"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/cluster"
 	"github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/passwords"
 	"github.com/RedisLabs/cf-redislabs-broker/redislabs/persisters"
 )
 
 type defaultBinder struct {
+	conf      config.Config
 	logger    lager.Logger
 	apiClient apiclient.Client
+	// planClients manage the databases of the plans with cluster
+	// credentials of their own.
+	planClients map[string]apiclient.Client
 }
 
+const (
+	// ReadOnlyRole is the bind parameter value requesting credentials
+	// that can only run read commands.
+	ReadOnlyRole = "read-only"
+)
+
+var (
+	UserPasswordLength = 48
+
+	// ReadOnlyACLName names the Redis ACL shared by all read-only
+	// bindings, ReadOnlyACL holds the permitted commands.
+	ReadOnlyACLName = "cf-read-only"
+	ReadOnlyACL     = "+@read ~*"
+
+	// SentinelPort is the port of the discovery service on the cluster
+	// nodes.
+	SentinelPort = 8001
+)
+
 func NewDefault(conf config.Config, logger lager.Logger) *defaultBinder {
 	return &defaultBinder{
-		logger:    logger,
-		apiClient: apiclient.New(conf, logger),
+		conf:        conf,
+		logger:      logger,
+		apiClient:   apiclient.New(conf, logger),
+		planClients: apiclient.NewPlanClients(conf, logger),
 	}
 }
 
+// WithLogger returns a binder sharing the cluster client of this one that
+// logs with the given logger.
+func (d *defaultBinder) WithLogger(logger lager.Logger) *defaultBinder {
+	planClients := map[string]apiclient.Client{}
+	for planID, client := range d.planClients {
+		planClients[planID] = client.WithLogger(logger)
+	}
+	return &defaultBinder{
+		conf:        d.conf,
+		logger:      logger,
+		apiClient:   d.apiClient.WithLogger(logger),
+		planClients: planClients,
+	}
+}
+
+// WithAPIClient returns a binder that talks to the cluster through the
+// given client, e.g. a fake of the cluster in tests. The client is used for
+// every plan.
+func (d *defaultBinder) WithAPIClient(client apiclient.Client) *defaultBinder {
+	return &defaultBinder{
+		conf:      d.conf,
+		logger:    d.logger,
+		apiClient: client,
+	}
+}
+
+// client returns the client managing the databases of the plan, the one of
+// the broker unless the plan has cluster credentials of its own.
+func (d *defaultBinder) client(planID string) apiclient.Client {
+	if client, ok := d.planClients[planID]; ok {
+		return client
+	}
+	return d.apiClient
+}
+
+// Unbind removes the user created for a read-only binding or a binding
+// of a plan with an ACL. Other bindings share the database credentials,
+// so there is nothing to remove for them but the record of the binding.
+// Bindings created before they were recorded have their users removed as
+// well, but are reported as gone.
 func (d *defaultBinder) Unbind(instanceID string, bindingID string, persister persisters.StatePersister) error {
+	state, _, err := persister.Load()
+	if err != nil {
+		d.logger.Error("Failed to load the broker state", err)
+		return err
+	}
+	binding, recorded := state.FindBinding(bindingID)
+	if recorded && binding.InstanceID != instanceID {
+		return brokerapi.ErrBindingDoesNotExist
+	}
+
+	if err = d.removeBindingUser(d.client(instancePlanID(state, instanceID)), instanceDatabaseUID(state, instanceID), instanceID, bindingID); err != nil {
+		return err
+	}
+	if !recorded {
+		return brokerapi.ErrBindingDoesNotExist
+	}
+
+	// The state is reloaded since it may have changed in the meantime.
+	err = persisters.Update(persister, func(state *persisters.State) error {
+		state.RemoveBinding(bindingID)
+		return nil
+	})
+	if err != nil {
+		d.logger.Error("Failed to save the broker state after the unbinding", err, lager.Data{
+			"binding-id": bindingID,
+		})
+		return err
+	}
 	return nil
 }
 
+// instancePlanID returns the plan of the instance, none if it does not
+// exist.
+func instancePlanID(state *persisters.State, instanceID string) string {
+	for _, instance := range state.AvailableInstances {
+		if instance.ID == instanceID {
+			return instance.PlanID
+		}
+	}
+	return ""
+}
+
+// instanceDatabaseUID returns the UID of the database of the instance, 0
+// if it does not exist.
+func instanceDatabaseUID(state *persisters.State, instanceID string) int {
+	for _, instance := range state.AvailableInstances {
+		if instance.ID == instanceID {
+			return instance.Credentials.UID
+		}
+	}
+	return 0
+}
+
+// removeBindingUser removes the user of a binding and its role, after
+// taking the access to the database away from the role.
+func (d *defaultBinder) removeBindingUser(client apiclient.Client, UID int, instanceID string, bindingID string) error {
+	name := bindingUserName(bindingID)
+	userUID, found, err := client.FindUser(name)
+	if err != nil {
+		return err
+	}
+	if found {
+		d.logger.Info("Removing the binding user", lager.Data{
+			"instance-id": instanceID,
+			"binding-id":  bindingID,
+		})
+		if err = client.DeleteUser(userUID); err != nil {
+			return err
+		}
+	}
+
+	roleUID, found, err := client.FindRole(name)
+	if err != nil || !found {
+		return err
+	}
+	if UID != 0 {
+		if err = client.RevokeRole(UID, roleUID); err != nil {
+			return err
+		}
+	}
+	return client.DeleteRole(roleUID)
+}
+
 func (d *defaultBinder) InstanceExists(instanceID string, persister persisters.StatePersister) (bool, error) {
+	state, _, err := persister.Load()
+	if err != nil {
+		return false, err
+	}
+	for _, instance := range state.AvailableInstances {
+		if instance.ID == instanceID {
+			return true, nil
+		}
+	}
 	return false, nil
 }
 
-func (d *defaultBinder) Bind(instanceID string, bindingID string, persister persisters.StatePersister) (interface{}, error) {
-	state, err := persister.Load()
+// Bind returns the credentials for the binding and records it in the
+// state. A binding that exists already with the same parameters gets its
+// credentials again, and existed is true; one with other parameters is
+// refused.
+func (d *defaultBinder) Bind(instanceID string, bindingID string, appGUID string, params map[string]interface{}, persister persisters.StatePersister) (interface{}, bool, error) {
+	credentials, existed, err := d.credentials(instanceID, bindingID, params, persister)
+	if err != nil || existed {
+		return credentials, existed, err
+	}
+
+	// The state is reloaded since creating a user takes a while.
+	password := ""
+	if _, ok := credentials["username"]; ok {
+		password, _ = credentials["password"].(string)
+	}
+	err = persisters.Update(persister, func(state *persisters.State) error {
+		state.AddBinding(persisters.Binding{
+			ID:                     bindingID,
+			InstanceID:             instanceID,
+			AppGUID:                appGUID,
+			CreatedAt:              time.Now().UTC(),
+			CredentialsFingerprint: fingerprint(credentials),
+			Parameters:             params,
+			Password:               password,
+		})
+		return nil
+	})
+	if err != nil {
+		d.logger.Error("Failed to save the broker state after the binding", err, lager.Data{
+			"binding-id": bindingID,
+		})
+		planID, UID := "", 0
+		if state, _, err := persister.Load(); err == nil {
+			planID, UID = instancePlanID(state, instanceID), instanceDatabaseUID(state, instanceID)
+		}
+		d.removeBindingUser(d.client(planID), UID, instanceID, bindingID)
+		return nil, false, err
+	}
+	return credentials, false, nil
+}
+
+// credentials returns the credentials of the binding, and whether the
+// binding exists already with the same parameters.
+func (d *defaultBinder) credentials(instanceID string, bindingID string, params map[string]interface{}, persister persisters.StatePersister) (map[string]interface{}, bool, error) {
+	role, _ := params["role"].(string)
+	if _, ok := params["role"]; ok && role != ReadOnlyRole {
+		return nil, false, ErrUnsupportedRole
+	}
+
+	state, _, err := persister.Load()
 	if err != nil {
 		d.logger.Error("Failed to load the broker state", err)
-		return nil, err
+		return nil, false, err
+	}
+	existing, existed := state.FindBinding(bindingID)
+	if existed && (existing.InstanceID != instanceID || !sameParameters(existing.Parameters, params)) {
+		return nil, false, brokerapi.ErrBindingAlreadyExists
 	}
 	for _, instance := range state.AvailableInstances {
 		if instance.ID == instanceID {
 			creds := instance.Credentials
+			client := d.client(instance.PlanID)
+			// A database removed behind the back of the broker can not
+			// be bound. Failing to ask the cluster does not keep the
+			// stored credentials from being returned, though.
+			if _, err = client.GetDatabaseStatus(creds.UID); err == apiclient.ErrNotFound {
+				d.logger.Error("The database of the instance does not exist", err, lager.Data{
+					"instance-id": instanceID,
+					"UID":         creds.UID,
+				})
+				return nil, false, ErrDatabaseNotFound
+			}
+			if d.conf.ServiceBroker.RefreshEndpointsOnBind {
+				creds = d.refreshEndpoints(client, instanceID, creds, persister)
+			}
 			d.logger.Info("Returning the service credentials", lager.Data{"credentials": creds})
 
-			return map[string]interface{}{
-				"host":     d.getHost(creds.UID, creds.Host),
+			address := d.endpointAddress(instance.PlanID)
+			host := endpointHost(creds.Host, creds.IPList, address)
+			credentials := map[string]interface{}{
+				"host":     host,
 				"port":     creds.Port,
 				"ip_list":  creds.IPList,
 				"password": creds.Password,
-			}, nil
+				"name":     creds.Name,
+				"uri":      redisURI(host, creds.Port, "", creds.Password, creds.TLS),
+			}
+			ip := endpointHost(creds.Host, creds.IPList, "ip")
+			if address == "both" {
+				credentials["ip"] = ip
+				credentials["ip_uri"] = redisURI(ip, creds.Port, "", creds.Password, creds.TLS)
+			}
+			if len(creds.ReadEndpoints) > 0 {
+				readEndpoints := []map[string]interface{}{}
+				for _, e := range creds.ReadEndpoints {
+					readEndpoints = append(readEndpoints, map[string]interface{}{
+						"host":    endpointHost(e.Host, e.IPList, address),
+						"port":    e.Port,
+						"ip_list": e.IPList,
+					})
+				}
+				credentials["read_host"] = readEndpoints[0]["host"]
+				credentials["read_port"] = creds.ReadEndpoints[0].Port
+				credentials["read_endpoints"] = readEndpoints
+			}
+			if d.planClientCA(instance.PlanID) != "" {
+				// Apps authenticate with a certificate signed by the
+				// CA of the plan, e.g. their instance identity one.
+				credentials["tls_client_certificate_required"] = true
+			}
+			if d.planSentinel(instance.PlanID) {
+				credentials["sentinel_host"] = sentinelHost(creds.Host)
+				credentials["sentinel_port"] = SentinelPort
+				credentials["sentinel_master_name"] = creds.Name
+			}
+			acl := config.PlanACLConfig{Role: ReadOnlyRole, Name: ReadOnlyACLName, Rules: ReadOnlyACL}
+			if role == "" {
+				acl = d.planACL(instance.PlanID)
+				role = acl.Role
+			}
+			if role != "" {
+				// The password of a binding recorded by an earlier broker
+				// version is unknown, so it can not be returned again.
+				username, password := bindingUserName(bindingID), existing.Password
+				if existed && password == "" {
+					return nil, false, brokerapi.ErrBindingAlreadyExists
+				}
+				if !existed {
+					username, password, err = d.createUser(client, creds.UID, bindingID, acl)
+					if err != nil {
+						return nil, false, err
+					}
+				}
+				credentials["role"] = role
+				credentials["username"] = username
+				credentials["password"] = password
+				credentials["uri"] = redisURI(host, creds.Port, username, password, creds.TLS)
+				if address == "both" {
+					credentials["ip_uri"] = redisURI(ip, creds.Port, username, password, creds.TLS)
+				}
+			}
+			return credentials, existed, nil
+		}
+	}
+	return nil, false, brokerapi.ErrInstanceDoesNotExist
+}
+
+// refreshEndpoints returns the credentials with the endpoints the cluster
+// reports for the database, and records them if they moved, e.g. after an
+// endpoint migration. The recorded credentials are returned if the
+// cluster can not tell.
+func (d *defaultBinder) refreshEndpoints(client apiclient.Client, instanceID string, creds cluster.InstanceCredentials, persister persisters.StatePersister) cluster.InstanceCredentials {
+	current, err := client.GetDatabase(creds.UID)
+	if err != nil {
+		d.logger.Error("Failed to refresh the endpoints of the instance", err, lager.Data{
+			"instance-id": instanceID,
+			"UID":         creds.UID,
+		})
+		return creds
+	}
+	if current.Host == creds.Host && current.Port == creds.Port &&
+		reflect.DeepEqual(current.IPList, creds.IPList) &&
+		reflect.DeepEqual(current.ReadEndpoints, creds.ReadEndpoints) {
+		return creds
+	}
+
+	refreshed := creds
+	refreshed.Host, refreshed.Port = current.Host, current.Port
+	refreshed.IPList, refreshed.ReadEndpoints = current.IPList, current.ReadEndpoints
+	// Only the endpoints are recorded, the password may have been
+	// rotated in the meantime.
+	err = persisters.Update(persister, func(state *persisters.State) error {
+		for i, instance := range state.AvailableInstances {
+			if instance.ID == instanceID {
+				stored := &state.AvailableInstances[i].Credentials
+				stored.Host, stored.Port = refreshed.Host, refreshed.Port
+				stored.IPList, stored.ReadEndpoints = refreshed.IPList, refreshed.ReadEndpoints
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		d.logger.Error("Failed to record the refreshed endpoints of the instance", err, lager.Data{
+			"instance-id": instanceID,
+		})
+	} else {
+		d.logger.Info("Recorded the moved endpoints of the instance", lager.Data{
+			"instance-id": instanceID,
+			"host":        refreshed.Host,
+			"port":        refreshed.Port,
+		})
+	}
+	return refreshed
+}
+
+// planACL returns the ACL of the plan, an empty one if it has none.
+func (d *defaultBinder) planACL(planID string) config.PlanACLConfig {
+	for _, plan := range d.conf.ServiceBroker.Plans {
+		if plan.ID == planID {
+			acl := plan.ACL
+			if acl.Name == "" {
+				acl.Name = acl.Role
+			}
+			return acl
+		}
+	}
+	return config.PlanACLConfig{}
+}
+
+// endpointAddress returns how the credentials address the databases of
+// the plan, see config.ClusterConfig.EndpointAddress.
+func (d *defaultBinder) endpointAddress(planID string) string {
+	for _, plan := range d.conf.ServiceBroker.Plans {
+		if plan.ID == planID && plan.EndpointAddress != "" {
+			return plan.EndpointAddress
+		}
+	}
+	return d.conf.Cluster.EndpointAddress
+}
+
+// endpointHost returns the first IP address of an endpoint for the "ip"
+// address, or if it has no DNS name, and the DNS name otherwise.
+func endpointHost(host string, ipList []string, address string) string {
+	if len(ipList) > 0 && (address == "ip" || host == "") {
+		return ipList[0]
+	}
+	return host
+}
+
+func (d *defaultBinder) planSentinel(planID string) bool {
+	for _, plan := range d.conf.ServiceBroker.Plans {
+		if plan.ID == planID {
+			return plan.Sentinel
 		}
 	}
-	return nil, brokerapi.ErrInstanceDoesNotExist
+	return false
 }
 
-func (d *defaultBinder) getHost(UID int, host string) string {
-	// if state file contains host just return it
-	if len(host) != 0 {
-		return host
+// planClientCA returns the CA of the client certificates of the plan, if
+// it requires client certificates.
+func (d *defaultBinder) planClientCA(planID string) string {
+	for _, plan := range d.conf.ServiceBroker.Plans {
+		if plan.ID == planID {
+			return plan.ServiceInstanceConfig.ClientCA
+		}
 	}
+	return ""
+}
 
-	// if service instance was created before this update state file
-	// does not contain host. Fetch it here from RLEC
-	instanceCredentials, err := d.apiClient.GetDatabase(UID)
+// sentinelHost returns the cluster name of a database endpoint host like
+// redis-12000.cluster.example.com, which resolves to the cluster nodes
+// running the discovery service.
+func sentinelHost(host string) string {
+	if i := strings.Index(host, "."); i >= 0 && net.ParseIP(host) == nil {
+		return host[i+1:]
+	}
+	return host
+}
+
+// createUser creates a cluster user that may only run the commands the
+// ACL permits against the given database. The user gets a role of its own
+// that is only granted on the database, since a role shared by the users
+// of several databases would let each of them into all of the databases.
+func (d *defaultBinder) createUser(client apiclient.Client, UID int, bindingID string, acl config.PlanACLConfig) (string, string, error) {
+	aclUID, err := client.EnsureRedisACL(acl.Name, acl.Rules)
+	if err != nil {
+		return "", "", err
+	}
+	username := bindingUserName(bindingID)
+	roleUID, err := client.EnsureRole(username)
+	if err != nil {
+		return "", "", err
+	}
+	if err = client.GrantRole(UID, roleUID, aclUID); err != nil {
+		return "", "", err
+	}
+
+	password, err := passwords.Generate(UserPasswordLength)
+	if err != nil {
+		d.logger.Error("Failed to generate a password", err)
+		return "", "", err
+	}
+	if _, err = client.CreateUser(username, password, []int{roleUID}); err != nil {
+		return "", "", err
+	}
+	return username, password, nil
+}
+
+// fingerprint tells credentials apart without revealing them.
+func fingerprint(credentials map[string]interface{}) string {
+	encoded, err := json.Marshal(credentials)
 	if err != nil {
-		d.logger.Error("Failed to get instance details from API", err)
 		return ""
 	}
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:8])
+}
+
+// sameParameters tells whether the parameters of a repeated binding are
+// the ones it was created with. No parameters are the same as empty ones.
+func sameParameters(recorded map[string]interface{}, requested map[string]interface{}) bool {
+	if len(recorded) == 0 && len(requested) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(recorded, requested)
+}
 
-	return instanceCredentials.Host
+func bindingUserName(bindingID string) string {
+	return "cf-" + bindingID
+}
+
+// redisURI composes a connection string that many buildpacks and client
+// libraries expect in addition to the separate connection properties.
+func redisURI(host string, port int, username string, password string, tls bool) string {
+	uri := url.URL{
+		Scheme: "redis",
+		User:   url.UserPassword(username, password),
+		Host:   fmt.Sprintf("%s:%d", host, port),
+	}
+	if tls {
+		uri.Scheme = "rediss"
+	}
+	return uri.String()
 }
@@ -0,0 +1,8 @@
+package instancebinders
+
+import "github.com/RedisLabs/cf-redislabs-broker/redislabs/brokererrors"
+
+var (
+	ErrUnsupportedRole  = brokererrors.NewBadRequest("unsupported binding role, use \"read-only\" or omit the role")
+	ErrDatabaseNotFound = brokererrors.NewUnprocessableEntity("", "the database of the instance does not exist on the cluster anymore")
+)
@@ -0,0 +1,109 @@
+package instancemanagers
+
+import (
+	"time"
+
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-golang/lager"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/persisters"
+)
+
+// Adopt records an existing database of the cluster as the database of the
+// instance, so that databases created outside of the broker can be bound,
+// updated and deprovisioned through the platform. The instance needs an ID
+// and a plan, the database has to be active and must not belong to another
+// instance, deleted ones included.
+func (d *defaultCreator) Adopt(instance persisters.ServiceInstance, UID int, persister persisters.StatePersister) error {
+	known := false
+	for _, plan := range d.conf.ServiceBroker.Plans {
+		if plan.ID == instance.PlanID {
+			known = true
+		}
+	}
+	if !known {
+		return ErrPlanNotFound
+	}
+
+	d = d.forPlan(instance.PlanID)
+	credentials, err := d.apiClient.GetDatabase(UID)
+	if err != nil {
+		d.logger.Error("Failed to get the database to adopt", err, lager.Data{"UID": UID})
+		return err
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	err = persisters.Update(persister, func(state *persisters.State) error {
+		if _, pending := findCreation(state, instance.ID); pending {
+			return ErrInstanceExists
+		}
+		for _, instances := range [][]persisters.ServiceInstance{state.AvailableInstances, state.DeletedInstances} {
+			for _, stored := range instances {
+				if stored.ID == instance.ID {
+					return ErrInstanceExists
+				}
+				if stored.Credentials.UID == UID {
+					return ErrDatabaseInUse
+				}
+			}
+		}
+
+		instance.Credentials = credentials
+		instance.CreatedAt = time.Now().UTC()
+		instance.UpdatedAt = instance.CreatedAt
+		state.AvailableInstances = append(state.AvailableInstances, instance)
+		return nil
+	})
+	if err != nil {
+		d.logger.Error("Failed to record the adopted database", err, lager.Data{
+			"instance-id": instance.ID,
+			"UID":         UID,
+		})
+		return err
+	}
+	d.logger.Info("Adopted a database", lager.Data{
+		"instance-id": instance.ID,
+		"UID":         UID,
+	})
+	return nil
+}
+
+// Detach forgets the instance and its bindings but leaves the database of
+// the instance on the cluster, to be managed by hand or adopted again.
+func (d *defaultCreator) Detach(instanceID string, persister persisters.StatePersister) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	UID := 0
+	err := persisters.Update(persister, func(state *persisters.State) error {
+		found := false
+		instancesLeft := []persisters.ServiceInstance{}
+		for _, instance := range state.AvailableInstances {
+			if instance.ID == instanceID {
+				UID, found = instance.Credentials.UID, true
+				continue
+			}
+			instancesLeft = append(instancesLeft, instance)
+		}
+		if !found {
+			return brokerapi.ErrInstanceDoesNotExist
+		}
+		state.AvailableInstances = instancesLeft
+		state.RemoveInstanceBindings(instanceID)
+		return nil
+	})
+	if err == brokerapi.ErrInstanceDoesNotExist {
+		return err
+	}
+	if err != nil {
+		d.logger.Error("Failed to save the new broker state after detaching the instance", err, lager.Data{
+			"instance-id": instanceID,
+		})
+		return err
+	}
+	d.logger.Info("Detached the database of the instance", lager.Data{
+		"instance-id": instanceID,
+		"UID":         UID,
+	})
+	return nil
+}
@@ -0,0 +1,91 @@
+package instancemanagers_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/apiclient"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/cluster"
+	brokerconfig "github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/fakes"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/instancemanagers"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/persisters"
+	"github.com/pivotal-golang/lager"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Adopting a database", func() {
+	var (
+		persister   persisters.StatePersister
+		apiClient   *fakes.FakeClient
+		tmpStateDir string
+	)
+
+	adopt := func(instanceID string, planID string, UID int) error {
+		manager := instancemanagers.NewDefault(brokerconfig.Config{
+			ServiceBroker: brokerconfig.ServiceBrokerConfig{
+				Plans: []brokerconfig.ServicePlanConfig{{ID: "test-plan"}},
+			},
+		}, lager.NewLogger("test")).WithAPIClient(apiClient)
+		return manager.Adopt(persisters.ServiceInstance{ID: instanceID, PlanID: planID}, UID, persister)
+	}
+
+	BeforeEach(func() {
+		var err error
+		tmpStateDir, err = ioutil.TempDir("", "redislabs-state-test")
+		Expect(err).NotTo(HaveOccurred())
+		persister = persisters.NewLocalPersister(path.Join(tmpStateDir, "state.json"))
+		_, err = persister.Save(&persisters.State{
+			AvailableInstances: []persisters.ServiceInstance{
+				{ID: "test-instance", PlanID: "test-plan", Credentials: cluster.InstanceCredentials{UID: 1}},
+			},
+		}, persisters.AnyRevision)
+		Expect(err).NotTo(HaveOccurred())
+
+		apiClient = &fakes.FakeClient{}
+		apiClient.GetDatabaseReturns(cluster.InstanceCredentials{UID: 2, Host: "legacy.example.com", Port: 12000, Password: "pass"}, nil)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpStateDir)
+	})
+
+	It("Records the database as the database of the instance", func() {
+		Expect(adopt("legacy-instance", "test-plan", 2)).To(Succeed())
+		Expect(apiClient.GetDatabaseArgsForCall(0)).To(Equal(2))
+
+		state, _, err := persister.Load()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state.AvailableInstances).To(HaveLen(2))
+		adopted := state.AvailableInstances[1]
+		Expect(adopted.ID).To(Equal("legacy-instance"))
+		Expect(adopted.PlanID).To(Equal("test-plan"))
+		Expect(adopted.Credentials.Host).To(Equal("legacy.example.com"))
+		Expect(adopted.CreatedAt.IsZero()).To(BeFalse())
+	})
+
+	It("Rejects a database of another instance", func() {
+		Expect(adopt("legacy-instance", "test-plan", 1)).To(Equal(instancemanagers.ErrDatabaseInUse))
+	})
+
+	It("Rejects an instance ID in use", func() {
+		Expect(adopt("test-instance", "test-plan", 2)).To(Equal(instancemanagers.ErrInstanceExists))
+	})
+
+	It("Rejects an unknown plan", func() {
+		Expect(adopt("legacy-instance", "unknown-plan", 2)).To(Equal(instancemanagers.ErrPlanNotFound))
+		Expect(apiClient.GetDatabaseCallCount()).To(Equal(0))
+	})
+
+	It("Rejects a database that is not active", func() {
+		apiClient.GetDatabaseReturns(cluster.InstanceCredentials{}, apiclient.ErrNotActive)
+		Expect(adopt("legacy-instance", "test-plan", 2)).To(Equal(apiclient.ErrNotActive))
+
+		state, _, err := persister.Load()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state.AvailableInstances).To(HaveLen(1))
+	})
+})
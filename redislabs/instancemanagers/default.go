@@ -1,7 +1,10 @@
 package instancemanagers
 
 import (
+	"encoding/json"
 	"fmt"
+	"reflect"
+	"strconv"
 	"sync"
 	"time"
 
@@ -9,116 +12,360 @@ import (
 	"github.com/pivotal-golang/lager"
 
 	"github.com/RedisLabs/cf-redislabs-broker/redislabs/apiclient"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/brokererrors"
 	"github.com/RedisLabs/cf-redislabs-broker/redislabs/cluster"
 	"github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
 	"github.com/RedisLabs/cf-redislabs-broker/redislabs/persisters"
 )
 
 type defaultCreator struct {
-	lock      sync.Mutex
+	lock      *sync.Mutex
+	conf      config.Config
 	logger    lager.Logger
 	apiClient apiclient.Client
+	inFlight  *inFlight
+	// planClients manage the databases of the plans with cluster
+	// credentials of their own.
+	planClients map[string]apiclient.Client
+	// created is called with the instances once they are recorded, see
+	// OnCreated.
+	created func(persisters.ServiceInstance)
 }
 
 var (
 	WaitingForDatabaseTimeout = 15 //seconds
+	WaitingForDeletionTimeout = 60 //seconds
+	// WaitingForAsyncDatabaseTimeout is used for asynchronous creations
+	// unless the config says otherwise.
+	WaitingForAsyncDatabaseTimeout = 3600 //seconds
+	// WaitingForActionTimeout is how long the cluster may take to list
+	// the action of an asynchronous update.
+	WaitingForActionTimeout = 600 //seconds
 )
 
 func NewDefault(conf config.Config, logger lager.Logger) *defaultCreator {
 	return &defaultCreator{
-		logger:    logger,
-		apiClient: apiclient.New(conf, logger),
+		lock:        &sync.Mutex{},
+		conf:        conf,
+		logger:      logger,
+		apiClient:   apiclient.New(conf, logger),
+		inFlight:    newInFlight(),
+		planClients: apiclient.NewPlanClients(conf, logger),
 	}
 }
 
-func (d *defaultCreator) Create(instanceID string, settings map[string]interface{}, persister persisters.StatePersister) error {
-	d.lock.Lock()
-	defer d.lock.Unlock()
+// WithLogger returns a manager sharing the state lock, the operations in
+// flight and the cluster client of this one that logs with the given logger.
+func (d *defaultCreator) WithLogger(logger lager.Logger) *defaultCreator {
+	planClients := map[string]apiclient.Client{}
+	for planID, client := range d.planClients {
+		planClients[planID] = client.WithLogger(logger)
+	}
+	return &defaultCreator{
+		lock:        d.lock,
+		conf:        d.conf,
+		logger:      logger,
+		apiClient:   d.apiClient.WithLogger(logger),
+		inFlight:    d.inFlight,
+		planClients: planClients,
+		created:     d.created,
+	}
+}
+
+// OnCreated makes the manager call fn with every instance it records once
+// its database is active, including the instances created asynchronously
+// or by a previous broker process. fn is called without the state lock,
+// before Create returns if the creation is synchronous. It is to be set
+// before the manager is used.
+func (d *defaultCreator) OnCreated(fn func(persisters.ServiceInstance)) {
+	d.created = fn
+}
+
+// WithAPIClient returns a manager sharing the state lock and the operations
+// in flight of this one that talks to the cluster through the given client,
+// e.g. a fake of the cluster in tests. The client is used for every plan.
+func (d *defaultCreator) WithAPIClient(client apiclient.Client) *defaultCreator {
+	return &defaultCreator{
+		lock:      d.lock,
+		conf:      d.conf,
+		logger:    d.logger,
+		apiClient: client,
+		inFlight:  d.inFlight,
+		created:   d.created,
+	}
+}
+
+// forPlan returns a manager sharing the state of this one that manages
+// the databases of the plan with the cluster credentials of the plan, if
+// it has any.
+func (d *defaultCreator) forPlan(planID string) *defaultCreator {
+	client, ok := d.planClients[planID]
+	if !ok {
+		return d
+	}
+	scoped := *d
+	scoped.apiClient = client
+	return &scoped
+}
+
+// Create creates the database of the instance. If asynchronous operations
+// are allowed, it returns true right after the cluster accepted the
+// request, and the instance is recorded once the database is active.
+func (d *defaultCreator) Create(instance persisters.ServiceInstance, settings map[string]interface{}, asyncAllowed bool, persister persisters.StatePersister) (bool, error) {
+	instanceID := instance.ID
+	d = d.forPlan(instance.PlanID)
 
-	// Load the broker state.
+	// Check whether the instance already exists. The state lock is only
+	// held while the state is read or written, so that databases for
+	// different instances can be created concurrently.
+	d.lock.Lock()
 	d.logger.Info("Loading the broker state", lager.Data{
 		"instance-id": instanceID,
 	})
-	state, err := persister.Load()
+	state, _, err := persister.Load()
+	d.lock.Unlock()
 	if err != nil {
 		d.logger.Fatal("Failed to load the broker state", err)
-		return ErrFailedToLoadState
+		return false, ErrFailedToLoadState
 	}
-
-	// Check whether the instance already exists.
 	for _, s := range (*state).AvailableInstances {
 		if s.ID == instanceID {
 			d.logger.Error(fmt.Sprintf("Received a request to create an instance with ID %s that already exists", instanceID), ErrInstanceExists)
-			return ErrInstanceExists
+			return false, ErrInstanceExists
+		}
+	}
+	if _, pending := findCreation(state, instanceID); pending {
+		return false, ErrInstanceExists
+	}
+	if err = d.inFlight.start(instanceID, "create"); err != nil {
+		return false, err
+	}
+	// An asynchronous creation stays in flight until the database is
+	// active.
+	finish := true
+	defer func() {
+		if finish {
+			d.inFlight.finish(instanceID)
 		}
+	}()
+	if err = d.checkMaintenance(); err != nil {
+		return false, err
 	}
 
 	// Ask the cluster to create a database.
+	if name, ok := settings["name"].(string); ok {
+		settings["name"] = d.uniqueDatabaseName(name)
+	}
+	if err = d.restrictNodes(settings); err != nil {
+		return false, err
+	}
+	if err = d.restrictDefaultUser(instance.PlanID, settings); err != nil {
+		return false, err
+	}
+	if err = d.assignPort(instance.PlanID, settings); err != nil {
+		return false, err
+	}
 	d.logger.Info("Creating a database", lager.Data{
 		"instance-id": instanceID,
+		"name":        settings["name"],
 	})
-	credentials, err := d.createDatabase(settings)
+	stop := make(chan struct{})
+	UID, ch, err := d.apiClient.CreateDatabase(settings, stop)
 	if err != nil {
-		return err
+		return false, err //ErrFailedToCreateDatabase
 	}
 
-	// Save the new state.
-	s := persisters.ServiceInstance{ // the future state
-		ID:          instanceID,
-		Credentials: credentials,
+	// Record the creation, so that a restarted broker can finish it.
+	task := persisters.Task{
+		ID:          CreateDatabaseTask + ":" + instanceID,
+		Kind:        CreateDatabaseTask,
+		Instance:    instance,
+		DatabaseUID: UID,
+		Async:       asyncAllowed,
+		CreatedAt:   time.Now().UTC(),
 	}
-	(*state).AvailableInstances = append((*state).AvailableInstances, s)
-	d.logger.Info("Saving the broker state", lager.Data{
-		"instance-id": instanceID,
-	})
-	if err = persister.Save(state); err != nil {
-		d.logger.Error("Failed to save the new state", err)
-		return ErrFailedToSaveState
+	if err = d.addTask(task, persister); err != nil {
+		close(stop)
+		d.deleteOrphan(UID)
+		return false, err
 	}
-	return nil
+	if asyncAllowed {
+		finish = false
+		go func() {
+			defer d.inFlight.finish(instanceID)
+			d.finishCreation(task, ch, stop, persister)
+		}()
+		return true, nil
+	}
+	return false, d.finishCreation(task, ch, stop, persister)
 }
 
-func (d *defaultCreator) Update(instanceID string, params map[string]interface{}, persister persisters.StatePersister) error {
-	state, err := persister.Load()
+// Update applies the settings to the database. If asynchronous updates
+// are allowed and the shard count changes, it returns true and tracks the
+// resharding as the last operation of the instance.
+func (d *defaultCreator) Update(instance persisters.ServiceInstance, settings map[string]interface{}, asyncAllowed bool, persister persisters.StatePersister) (bool, error) {
+	if err := d.inFlight.start(instance.ID, "update"); err != nil {
+		d.logger.Info("Rejecting an update while another operation is in progress", lager.Data{
+			"instance-id": instance.ID,
+		})
+		return false, err
+	}
+	defer d.inFlight.finish(instance.ID)
+	if err := d.checkMaintenance(); err != nil {
+		return false, err
+	}
+
+	state, _, err := persister.Load()
 	if err != nil {
 		d.logger.Error("Failed to load the broker state", err)
-		return err
+		return false, err
 	}
-	for _, instance := range state.AvailableInstances {
-		if instance.ID == instanceID {
-			return d.updateDatabase(instance.Credentials.UID, params)
+	var operation *persisters.Operation
+	found := false
+	for _, stored := range state.AvailableInstances {
+		if stored.ID == instance.ID {
+			planID := instance.PlanID
+			if planID == "" {
+				planID = stored.PlanID
+			}
+			// The database is managed with the credentials of the plan
+			// it was created with.
+			d = d.forPlan(stored.PlanID)
+			if err = d.checkMemorySize(stored.Credentials.UID, settings, planID); err != nil {
+				return false, err
+			}
+			if err = d.checkDatabaseName(stored.Credentials.UID, settings); err != nil {
+				return false, err
+			}
+			if err = d.restrictNodes(settings); err != nil {
+				return false, err
+			}
+			if settings, err = d.changedSettings(stored.Credentials.UID, settings); err != nil {
+				return false, err
+			}
+			if len(settings) == 0 {
+				d.logger.Info("Nothing to update", lager.Data{
+					"instance-id": instance.ID,
+				})
+				found = true
+				break
+			}
+			if asyncAllowed {
+				if operation, err = d.reshardingOperation(stored.Credentials.UID, settings); err != nil {
+					return false, err
+				}
+			}
+			if err = d.updateDatabase(stored.Credentials.UID, settings); err != nil {
+				return false, err
+			}
+			found = true
+			break
+		}
+	}
+	if !found {
+		return false, brokerapi.ErrInstanceDoesNotExist
+	}
+
+	// Record the new plan and parameters.
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	err = persisters.Update(persister, func(state *persisters.State) error {
+		for i, stored := range state.AvailableInstances {
+			if stored.ID != instance.ID {
+				continue
+			}
+			if instance.PlanID != "" {
+				stored.PlanID = instance.PlanID
+			}
+			if len(instance.Parameters) > 0 && stored.Parameters == nil {
+				stored.Parameters = map[string]interface{}{}
+			}
+			for param, value := range instance.Parameters {
+				stored.Parameters[param] = value
+			}
+			if operation != nil {
+				stored.LastOperation = operation
+			}
+			stored.UpdatedAt = time.Now().UTC()
+			state.AvailableInstances[i] = stored
 		}
+		return nil
+	})
+	if err != nil {
+		d.logger.Error("Failed to save the new state", err, lager.Data{
+			"instance-id": instance.ID,
+		})
+		return false, ErrFailedToSaveState
 	}
-	return brokerapi.ErrInstanceDoesNotExist
+	return operation != nil, nil
 }
 
 func (d *defaultCreator) Destroy(instanceID string, persister persisters.StatePersister) error {
-	state, err := persister.Load()
+	if d.conf.ServiceBroker.DeletionRetentionPeriod > 0 {
+		err := d.retain(instanceID, persister)
+		if err == brokerapi.ErrInstanceDoesNotExist {
+			return d.abandonCreation(instanceID, persister)
+		}
+		return err
+	}
+
+	state, _, err := persister.Load()
 	if err != nil {
 		d.logger.Error("Failed to load the broker state", err)
 		return err
 	}
 
-	instancesLeft := []persisters.ServiceInstance{}
 	removed := false
 	for _, instance := range state.AvailableInstances {
 		if instance.ID == instanceID {
+			d = d.forPlan(instance.PlanID)
+			if err := d.checkMaintenance(); err != nil {
+				return err
+			}
 			if err := d.deleteDatabase(instance.Credentials.UID); err != nil {
 				return err
 			}
+			// Keep the instance until the database is gone, so that a
+			// new database can take its name.
+			// A cluster that failed to answer until the deadline is
+			// reported as such rather than as a slow deletion.
+			deleted, err := d.apiClient.WaitForDeletion(instance.Credentials.UID, time.Second*time.Duration(WaitingForDeletionTimeout))
+			if !deleted && err != nil {
+				d.logger.Error("Failed to wait for the database deletion", err, lager.Data{
+					"instance-id": instanceID,
+				})
+				return err
+			}
+			if !deleted {
+				d.logger.Error("Waiting for the database deletion timed out", ErrDeleteDatabaseTimeoutExpired, lager.Data{
+					"instance-id": instanceID,
+				})
+				return ErrDeleteDatabaseTimeoutExpired
+			}
 			removed = true
-		} else {
-			instancesLeft = append(instancesLeft, instance)
 		}
 	}
 
 	if !removed {
-		return brokerapi.ErrInstanceDoesNotExist
+		return d.abandonCreation(instanceID, persister)
 	}
 
-	// Save the new broker state.
-	state.AvailableInstances = instancesLeft
-	if err = persister.Save(state); err != nil {
+	// Save the new broker state. The state is reloaded since other
+	// instances may have changed while the database was being deleted.
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	err = persisters.Update(persister, func(state *persisters.State) error {
+		instancesLeft := []persisters.ServiceInstance{}
+		for _, instance := range state.AvailableInstances {
+			if instance.ID != instanceID {
+				instancesLeft = append(instancesLeft, instance)
+			}
+		}
+		state.AvailableInstances = instancesLeft
+		state.RemoveInstanceBindings(instanceID)
+		return nil
+	})
+	if err != nil {
 		d.logger.Error("Failed to save the new broker state after the instance removal", err, lager.Data{
 			"instance-id": instanceID,
 		})
@@ -127,25 +374,310 @@ func (d *defaultCreator) Destroy(instanceID string, persister persisters.StatePe
 	return nil
 }
 
-func (d *defaultCreator) InstanceExists(instanceID string, persister persisters.StatePersister) (bool, error) {
-	return false, nil
+// retain moves the instance to the deleted ones instead of deleting its
+// database, see reconcilers.DeletedInstanceReaper. The database is tagged
+// with the time of the deletion, so that operators looking at the cluster
+// tell it from the databases in use.
+func (d *defaultCreator) retain(instanceID string, persister persisters.StatePersister) error {
+	d.lock.Lock()
+	var retained persisters.ServiceInstance
+	err := persisters.Update(persister, func(state *persisters.State) error {
+		removed := false
+		instancesLeft := []persisters.ServiceInstance{}
+		for _, instance := range state.AvailableInstances {
+			if instance.ID != instanceID {
+				instancesLeft = append(instancesLeft, instance)
+				continue
+			}
+			instance.DeletedAt = time.Now().UTC()
+			state.DeletedInstances = append(state.DeletedInstances, instance)
+			retained, removed = instance, true
+		}
+		if !removed {
+			return brokerapi.ErrInstanceDoesNotExist
+		}
+
+		d.logger.Info("Retaining the database of the deleted instance", lager.Data{
+			"instance-id": instanceID,
+		})
+		state.AvailableInstances = instancesLeft
+		state.RemoveInstanceBindings(instanceID)
+		return nil
+	})
+	d.lock.Unlock()
+	if err == brokerapi.ErrInstanceDoesNotExist {
+		return err
+	}
+	if err != nil {
+		d.logger.Error("Failed to save the new broker state after the instance removal", err, lager.Data{
+			"instance-id": instanceID,
+		})
+		return err
+	}
+
+	UID := retained.Credentials.UID
+	deletedAt := retained.DeletedAt.Format(time.RFC3339)
+	if err = apiclient.SetDatabaseTag(d.forPlan(retained.PlanID).apiClient, UID, apiclient.DeletedAtTag, deletedAt); err != nil {
+		d.logger.Error("Failed to tag the retained database", err, lager.Data{
+			"instance-id": instanceID,
+			"UID":         UID,
+		})
+	}
+	return nil
+}
+
+// uniqueDatabaseName returns the given name if no database on the cluster
+// uses it yet. Otherwise a numeric suffix is appended to make it unique.
+func (d *defaultCreator) uniqueDatabaseName(name string) string {
+	databases, err := d.apiClient.ListDatabases()
+	if err != nil {
+		d.logger.Error("Failed to check whether the database name is taken", err)
+		return name
+	}
+
+	taken := map[string]bool{}
+	for _, db := range databases {
+		taken[db.Name] = true
+	}
+
+	candidate := name
+	for i := 2; taken[candidate]; i++ {
+		suffix := fmt.Sprintf("-%d", i)
+		base := name
+		if len(base)+len(suffix) > cluster.MaxDatabaseNameLength {
+			base = base[:cluster.MaxDatabaseNameLength-len(suffix)]
+		}
+		candidate = base + suffix
+	}
+	return candidate
+}
+
+// deleteOrphan removes a database the cluster has accepted but the broker
+// failed to record. Otherwise it would stay on the cluster with no service
+// instance referring to it.
+func (d *defaultCreator) deleteOrphan(UID int) {
+	d.logger.Info("Removing the orphaned database", lager.Data{
+		"UID": UID,
+	})
+	if err := d.deleteDatabase(UID); err != nil {
+		d.logger.Error("Failed to remove the orphaned database", err, lager.Data{
+			"UID": UID,
+		})
+	}
 }
 
-func (d *defaultCreator) createDatabase(settings map[string]interface{}) (cluster.InstanceCredentials, error) {
-	ch, err := d.apiClient.CreateDatabase(settings)
+// checkMemorySize rejects a new memory size that would evict data, i.e.
+// one below the memory in use, and one below the current size if the
+// plan denies shrinking.
+func (d *defaultCreator) checkMemorySize(UID int, settings map[string]interface{}, planID string) error {
+	var size int64
+	switch v := settings["memory_size"].(type) {
+	case int64:
+		size = v
+	case int:
+		size = int64(v)
+	case float64:
+		size = int64(v)
+	default:
+		return nil
+	}
+
+	usage, err := d.apiClient.GetMemoryUsage(UID)
 	if err != nil {
-		return cluster.InstanceCredentials{}, err //ErrFailedToCreateDatabase
+		d.logger.Error("Failed to get the memory usage", err, lager.Data{"UID": UID})
+		return err
+	}
+	if size < usage.Used {
+		return brokererrors.NewUnprocessableEntity("", fmt.Sprintf(
+			"memory_size %d is below the %d bytes the database uses", size, usage.Used))
+	}
+	for _, plan := range d.conf.ServiceBroker.Plans {
+		if plan.ID == planID && plan.ServiceInstanceConfig.DenyMemoryShrink && size < usage.Limit {
+			return brokererrors.NewUnprocessableEntity("", fmt.Sprintf(
+				"memory_size %d is below the current size %d, which the plan does not allow", size, usage.Limit))
+		}
 	}
+	return nil
+}
 
-	for {
-		select {
-		case credentials := <-ch:
-			return credentials, nil
-		case <-time.After(time.Second * time.Duration(WaitingForDatabaseTimeout)):
-			d.logger.Error("Waiting for a database timeout is expired", ErrCreateDatabaseTimeoutExpired)
-			return cluster.InstanceCredentials{}, ErrCreateDatabaseTimeoutExpired
+// checkDatabaseName rejects renaming the database to a name another
+// database on the cluster uses.
+func (d *defaultCreator) checkDatabaseName(UID int, settings map[string]interface{}) error {
+	name, ok := settings["name"].(string)
+	if !ok {
+		return nil
+	}
+	databases, err := d.apiClient.ListDatabasesWith(apiclient.ListOptions{
+		Fields: []string{"uid", "name"},
+		Filter: map[string]string{"name": name},
+	})
+	if err != nil {
+		d.logger.Error("Failed to check whether the database name is taken", err)
+		return err
+	}
+	for _, db := range databases {
+		if db.Name == name && db.UID != UID {
+			return brokererrors.NewUnprocessableEntity("", fmt.Sprintf("the database name %q is taken", name))
 		}
 	}
+	return nil
+}
+
+// restrictNodes replaces the nodes allow-list of the settings with the
+// avoid_nodes setting of the cluster, which lists the other nodes.
+func (d *defaultCreator) restrictNodes(settings map[string]interface{}) error {
+	var allowed []int64
+	switch v := settings["nodes"].(type) {
+	case []int64:
+		allowed = v
+	case nil:
+		return nil
+	default:
+		return fmt.Errorf("unexpected nodes setting %v", v)
+	}
+	delete(settings, "nodes")
+
+	nodes, err := d.apiClient.ListNodes()
+	if err != nil {
+		return err
+	}
+	known := map[int64]bool{}
+	for _, node := range nodes {
+		known[int64(node.UID)] = true
+	}
+	permitted := map[int64]bool{}
+	for _, uid := range allowed {
+		if !known[uid] {
+			return brokererrors.NewUnprocessableEntity("", fmt.Sprintf("node %d is not part of the cluster", uid))
+		}
+		permitted[uid] = true
+	}
+
+	avoided := []string{}
+	for _, node := range nodes {
+		if !permitted[int64(node.UID)] {
+			avoided = append(avoided, strconv.Itoa(node.UID))
+		}
+	}
+	settings["avoid_nodes"] = avoided
+	return nil
+}
+
+// checkMaintenance rejects operations while nodes of the cluster are not
+// active, e.g. during an upgrade, rather than letting the tasks of the
+// cluster fail with confusing errors. The operation goes ahead if the
+// nodes can not be listed, e.g. with plan credentials lacking the
+// permission.
+func (d *defaultCreator) checkMaintenance() error {
+	if d.conf.Cluster.SkipMaintenanceCheck {
+		return nil
+	}
+	nodes, err := d.apiClient.ListNodes()
+	if err != nil {
+		d.logger.Info("Could not check whether the cluster is under maintenance", lager.Data{"error": err.Error()})
+		return nil
+	}
+	for _, node := range nodes {
+		if node.Status != "" && node.Status != "active" {
+			d.logger.Info("Rejecting an operation while the cluster is under maintenance", lager.Data{
+				"node":   node.UID,
+				"status": node.Status,
+			})
+			return ErrClusterUnderMaintenance
+		}
+	}
+	return nil
+}
+
+// restrictDefaultUser applies the plan ACL to the new database. The
+// cluster can not restrict the default user of a database to an ACL, so
+// the default user is disabled, and the apps connect with the users the
+// bindings create with the plan ACL. The ACL is created up front, an
+// existing ACL of the same name is used as it is.
+func (d *defaultCreator) restrictDefaultUser(planID string, settings map[string]interface{}) error {
+	for _, plan := range d.conf.ServiceBroker.Plans {
+		if plan.ID != planID || plan.ACL.Role == "" {
+			continue
+		}
+		name := plan.ACL.Name
+		if name == "" {
+			name = plan.ACL.Role
+		}
+		if _, err := d.apiClient.EnsureRedisACL(name, plan.ACL.Rules); err != nil {
+			return err
+		}
+		settings["default_user"] = false
+	}
+	return nil
+}
+
+// assignPort picks the lowest port of the plan port range that no
+// database of the cluster uses, unless the settings have a port already.
+// Databases created concurrently may get the same port, in which case
+// the cluster rejects all but one.
+func (d *defaultCreator) assignPort(planID string, settings map[string]interface{}) error {
+	if _, ok := settings["port"]; ok {
+		return nil
+	}
+	for _, plan := range d.conf.ServiceBroker.Plans {
+		ports := plan.ServiceInstanceConfig.PortRange
+		if plan.ID != planID || ports.Max == 0 {
+			continue
+		}
+		databases, err := d.apiClient.ListDatabases()
+		if err != nil {
+			d.logger.Error("Failed to list the ports in use", err)
+			return err
+		}
+		used := map[int]bool{}
+		for _, db := range databases {
+			used[db.Port] = true
+			for _, e := range db.ReadEndpoints {
+				used[e.Port] = true
+			}
+		}
+		for port := ports.Min; port <= ports.Max; port++ {
+			if !used[port] {
+				settings["port"] = port
+				return nil
+			}
+		}
+		return brokererrors.NewUnprocessableEntity("", fmt.Sprintf("all the ports from %d to %d are in use", ports.Min, ports.Max))
+	}
+	return nil
+}
+
+// changedSettings reads the current settings of the database and keeps
+// those of the given settings that differ from them. Sending only actual
+// changes leaves concurrent changes to other settings alone, and an
+// update changing nothing is not sent at all.
+func (d *defaultCreator) changedSettings(UID int, settings map[string]interface{}) (map[string]interface{}, error) {
+	current, err := d.apiClient.GetDatabaseSettings(UID)
+	if err != nil {
+		d.logger.Error("Failed to get the database settings", err, lager.Data{"UID": UID})
+		return nil, err
+	}
+	changed := map[string]interface{}{}
+	for name, value := range settings {
+		if currentValue, ok := current[name]; !ok || !sameSetting(currentValue, value) {
+			changed[name] = value
+		}
+	}
+	return changed, nil
+}
+
+// sameSetting compares a setting as the cluster returned it with a
+// requested one, which is converted to JSON types first.
+func sameSetting(current interface{}, requested interface{}) bool {
+	bytes, err := json.Marshal(requested)
+	if err != nil {
+		return false
+	}
+	var value interface{}
+	if err = json.Unmarshal(bytes, &value); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(current, value)
 }
 
 func (d *defaultCreator) updateDatabase(UID int, params map[string]interface{}) error {
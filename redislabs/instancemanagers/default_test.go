@@ -0,0 +1,250 @@
+package instancemanagers_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"time"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/apiclient"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/cluster"
+	brokerconfig "github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/fakes"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/instancemanagers"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/persisters"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/testing"
+	"github.com/pivotal-golang/lager"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Destroying an instance on a fake cluster", func() {
+	var (
+		persister   persisters.StatePersister
+		apiClient   *fakes.FakeClient
+		tmpStateDir string
+		logger      = lager.NewLogger("test")
+	)
+
+	destroy := func() error {
+		manager := instancemanagers.NewDefault(brokerconfig.Config{}, logger).WithAPIClient(apiClient)
+		return manager.Destroy("test-instance", persister)
+	}
+
+	BeforeEach(func() {
+		var err error
+		tmpStateDir, err = ioutil.TempDir("", "redislabs-state-test")
+		Expect(err).NotTo(HaveOccurred())
+		persister = persisters.NewLocalPersister(path.Join(tmpStateDir, "state.json"))
+		_, err = persister.Save(&persisters.State{
+			AvailableInstances: []persisters.ServiceInstance{
+				{ID: "test-instance", Credentials: cluster.InstanceCredentials{UID: 1}},
+			},
+		}, persisters.AnyRevision)
+		Expect(err).NotTo(HaveOccurred())
+		apiClient = &fakes.FakeClient{}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpStateDir)
+	})
+
+	It("Removes the instance once its database is deleted", func() {
+		apiClient.WaitForDeletionReturns(true, nil)
+		Expect(destroy()).To(Succeed())
+
+		Expect(apiClient.DeleteDatabaseCallCount()).To(Equal(1))
+		Expect(apiClient.DeleteDatabaseArgsForCall(0)).To(Equal(1))
+		UID, timeout := apiClient.WaitForDeletionArgsForCall(0)
+		Expect(UID).To(Equal(1))
+		Expect(timeout).To(Equal(time.Duration(instancemanagers.WaitingForDeletionTimeout) * time.Second))
+
+		state, _, err := persister.Load()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state.AvailableInstances).To(BeEmpty())
+	})
+
+	It("Keeps the instance if the database can not be deleted", func() {
+		apiClient.DeleteDatabaseReturns(errors.New("cluster failure"))
+		Expect(destroy()).To(MatchError("cluster failure"))
+		Expect(apiClient.WaitForDeletionCallCount()).To(Equal(0))
+
+		state, _, err := persister.Load()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state.AvailableInstances).To(HaveLen(1))
+	})
+
+	It("Keeps the instance if the database is not deleted in time", func() {
+		apiClient.WaitForDeletionReturns(false, nil)
+		Expect(destroy()).To(Equal(instancemanagers.ErrDeleteDatabaseTimeoutExpired))
+
+		state, _, err := persister.Load()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state.AvailableInstances).To(HaveLen(1))
+	})
+
+	It("Reports the failure of a cluster that can not tell whether the database is deleted", func() {
+		apiClient.WaitForDeletionReturns(false, apiclient.ErrAPIUnavailable)
+		Expect(destroy()).To(Equal(apiclient.ErrAPIUnavailable))
+
+		state, _, err := persister.Load()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state.AvailableInstances).To(HaveLen(1))
+	})
+
+	Context("When the cluster is under maintenance", func() {
+		BeforeEach(func() {
+			apiClient.ListNodesReturns([]cluster.Node{
+				{UID: 1, Status: "active"},
+				{UID: 2, Status: "provisioning"},
+			}, nil)
+		})
+
+		It("Asks to retry later rather than deleting the database", func() {
+			Expect(destroy()).To(Equal(instancemanagers.ErrClusterUnderMaintenance))
+			Expect(apiClient.DeleteDatabaseCallCount()).To(Equal(0))
+		})
+
+		It("Asks to retry later rather than creating or updating databases", func() {
+			manager := instancemanagers.NewDefault(brokerconfig.Config{}, logger).WithAPIClient(apiClient)
+			_, err := manager.Create(persisters.ServiceInstance{ID: "new-instance"}, map[string]interface{}{}, false, persister)
+			Expect(err).To(Equal(instancemanagers.ErrClusterUnderMaintenance))
+			Expect(apiClient.CreateDatabaseCallCount()).To(Equal(0))
+
+			_, err = manager.Update(persisters.ServiceInstance{ID: "test-instance"}, map[string]interface{}{}, false, persister)
+			Expect(err).To(Equal(instancemanagers.ErrClusterUnderMaintenance))
+			Expect(apiClient.UpdateDatabaseCallCount()).To(Equal(0))
+		})
+
+		It("Goes ahead if the check is skipped", func() {
+			apiClient.WaitForDeletionReturns(true, nil)
+			conf := brokerconfig.Config{Cluster: brokerconfig.ClusterConfig{SkipMaintenanceCheck: true}}
+			manager := instancemanagers.NewDefault(conf, logger).WithAPIClient(apiClient)
+			Expect(manager.Destroy("test-instance", persister)).To(Succeed())
+			Expect(apiClient.DeleteDatabaseCallCount()).To(Equal(1))
+		})
+	})
+
+	It("Records a database that became active between the last poll and the timeout", func() {
+		timeout := instancemanagers.WaitingForDatabaseTimeout
+		instancemanagers.WaitingForDatabaseTimeout = 1
+		defer func() { instancemanagers.WaitingForDatabaseTimeout = timeout }()
+		apiClient.CreateDatabaseReturns(2, make(chan cluster.InstanceCredentials), nil)
+		apiClient.GetDatabaseReturns(cluster.InstanceCredentials{UID: 2, Host: "new.example.com"}, nil)
+
+		manager := instancemanagers.NewDefault(brokerconfig.Config{}, logger).WithAPIClient(apiClient)
+		_, err := manager.Create(persisters.ServiceInstance{ID: "new-instance"}, map[string]interface{}{}, false, persister)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(apiClient.DeleteDatabaseCallCount()).To(Equal(0))
+
+		state, _, err := persister.Load()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state.AvailableInstances).To(HaveLen(2))
+		Expect(state.AvailableInstances[1].Credentials.Host).To(Equal("new.example.com"))
+	})
+
+	It("Forgets an asynchronous creation whose instance is deleted before the database is active", func() {
+		ch := make(chan cluster.InstanceCredentials, 1)
+		apiClient.CreateDatabaseReturns(2, ch, nil)
+		// The poller closes the channel once the database is gone.
+		apiClient.DeleteDatabaseStub = func(UID int) error {
+			close(ch)
+			return nil
+		}
+
+		manager := instancemanagers.NewDefault(brokerconfig.Config{}, logger).WithAPIClient(apiClient)
+		async, err := manager.Create(persisters.ServiceInstance{ID: "new-instance"}, map[string]interface{}{}, true, persister)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(async).To(BeTrue())
+		Expect(manager.Destroy("new-instance", persister)).To(Succeed())
+		Expect(apiClient.DeleteDatabaseArgsForCall(0)).To(Equal(2))
+
+		// The creation stops polling once it is done.
+		_, stop := apiClient.CreateDatabaseArgsForCall(0)
+		Eventually(stop).Should(BeClosed())
+		state, _, err := persister.Load()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state.Tasks).To(BeEmpty())
+		Expect(state.AvailableInstances).To(HaveLen(1))
+
+		// The instance is not in flight anymore.
+		ready := make(chan cluster.InstanceCredentials, 1)
+		ready <- cluster.InstanceCredentials{UID: 3, Host: "new.example.com"}
+		apiClient.CreateDatabaseReturns(3, ready, nil)
+		Eventually(func() error {
+			_, err := manager.Create(persisters.ServiceInstance{ID: "new-instance"}, map[string]interface{}{}, false, persister)
+			return err
+		}).Should(Succeed())
+	})
+
+	It("Goes ahead if the nodes can not be listed", func() {
+		apiClient.ListNodesReturns(nil, errors.New("permission denied"))
+		apiClient.WaitForDeletionReturns(true, nil)
+		Expect(destroy()).To(Succeed())
+	})
+})
+
+var _ = Describe("Plans with cluster credentials", func() {
+	var (
+		persister   persisters.StatePersister
+		proxy       testing.HTTPProxy
+		tmpStateDir string
+		usernames   map[string]string
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpStateDir, err = ioutil.TempDir("", "redislabs-state-test")
+		Expect(err).NotTo(HaveOccurred())
+		persister = persisters.NewLocalPersister(path.Join(tmpStateDir, "state.json"))
+		_, err = persister.Save(&persisters.State{
+			AvailableInstances: []persisters.ServiceInstance{
+				{ID: "tenant-instance", PlanID: "tenant-plan", Credentials: cluster.InstanceCredentials{UID: 1}},
+				{ID: "shared-instance", PlanID: "shared-plan", Credentials: cluster.InstanceCredentials{UID: 2}},
+			},
+		}, persisters.AnyRevision)
+		Expect(err).NotTo(HaveOccurred())
+
+		usernames = map[string]string{}
+		proxy = testing.NewHTTPProxy()
+		for _, path := range []string{"/v1/bdbs/1", "/v1/bdbs/2"} {
+			path := path
+			proxy.RegisterEndpointHandler(path, func(w http.ResponseWriter, r *http.Request) interface{} {
+				usernames[path], _, _ = r.BasicAuth()
+				return map[string]interface{}{"status": "active"}
+			})
+		}
+	})
+
+	AfterEach(func() {
+		proxy.Close()
+		os.RemoveAll(tmpStateDir)
+	})
+
+	It("Manages the databases of a plan with the credentials of the plan", func() {
+		manager := instancemanagers.NewDefault(brokerconfig.Config{
+			Cluster: brokerconfig.ClusterConfig{
+				Address: proxy.URL(),
+				Auth:    brokerconfig.AuthConfig{Username: "admin", Password: "admin-password"},
+			},
+			ServiceBroker: brokerconfig.ServiceBrokerConfig{
+				Plans: []brokerconfig.ServicePlanConfig{
+					{ID: "tenant-plan", Auth: brokerconfig.AuthConfig{Username: "tenant", Password: "tenant-password"}},
+					{ID: "shared-plan"},
+				},
+			},
+		}, lager.NewLogger("test")).WithLogger(lager.NewLogger("request"))
+
+		_, err := manager.Status("tenant-instance", persister)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = manager.Status("shared-instance", persister)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(usernames).To(Equal(map[string]string{
+			"/v1/bdbs/1": "tenant",
+			"/v1/bdbs/2": "admin",
+		}))
+	})
+})
@@ -1,11 +1,25 @@
 package instancemanagers
 
-import "errors"
+import (
+	"errors"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/brokererrors"
+)
 
 var (
 	ErrFailedToLoadState            = errors.New("failed to load the broker state")
-	ErrInstanceExists               = errors.New("such instance already exists")
+	ErrInstanceExists               = brokererrors.NewConflict("such instance already exists")
 	ErrFailedToSaveState            = errors.New("failed to save the new broker state")
 	ErrFailedToCreateDatabase       = errors.New("failed to create a database")
 	ErrCreateDatabaseTimeoutExpired = errors.New("create database timeout expired")
+	ErrDeleteDatabaseTimeoutExpired = errors.New("delete database timeout expired")
+	ErrDatabaseRemoved              = errors.New("the database has been removed before it became active")
+	ErrOperationInProgress          = brokererrors.NewConcurrencyError("another operation on the instance is in progress")
+	ErrPlanNotFound                 = errors.New("plan does not exist")
+	ErrDatabaseInUse                = errors.New("the database belongs to another instance")
+	ErrClusterUnderMaintenance      = brokererrors.NewServiceUnavailable("the cluster is under maintenance, retry later")
+
+	// errCreationAbandoned stops recording an instance that has been
+	// deleted while its database was being created.
+	errCreationAbandoned = errors.New("the creation has been abandoned")
 )
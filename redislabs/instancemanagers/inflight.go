@@ -0,0 +1,35 @@
+package instancemanagers
+
+import "sync"
+
+// inFlight registers the operations running on instances by instance ID,
+// so that an operation arriving while another one on the same instance
+// is still running, like an update while the database of the instance
+// is still being created, is rejected rather than racing with it.
+type inFlight struct {
+	lock       sync.Mutex
+	operations map[string]string
+}
+
+func newInFlight() *inFlight {
+	return &inFlight{operations: map[string]string{}}
+}
+
+// start registers the operation on the instance unless another one is
+// in flight, in which case it returns ErrOperationInProgress.
+func (f *inFlight) start(instanceID string, operation string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if _, ok := f.operations[instanceID]; ok {
+		return ErrOperationInProgress
+	}
+	f.operations[instanceID] = operation
+	return nil
+}
+
+// finish forgets the operation on the instance.
+func (f *inFlight) finish(instanceID string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	delete(f.operations, instanceID)
+}
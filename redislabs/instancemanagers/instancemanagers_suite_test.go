@@ -0,0 +1,13 @@
+package instancemanagers_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestInstanceManagers(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Instance Managers Suite")
+}
@@ -0,0 +1,61 @@
+package instancemanagers
+
+import (
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-golang/lager"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/persisters"
+)
+
+func (d *defaultCreator) InstanceExists(instanceID string, persister persisters.StatePersister) (bool, error) {
+	_, err := d.Get(instanceID, persister)
+	if err == brokerapi.ErrInstanceDoesNotExist {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Get returns the instance recorded in the state.
+func (d *defaultCreator) Get(instanceID string, persister persisters.StatePersister) (persisters.ServiceInstance, error) {
+	instances, err := d.List(persister)
+	if err != nil {
+		return persisters.ServiceInstance{}, err
+	}
+	for _, instance := range instances {
+		if instance.ID == instanceID {
+			return instance, nil
+		}
+	}
+	return persisters.ServiceInstance{}, brokerapi.ErrInstanceDoesNotExist
+}
+
+// List returns the instances recorded in the state. Deleted instances
+// whose databases are retained are not included.
+func (d *defaultCreator) List(persister persisters.StatePersister) ([]persisters.ServiceInstance, error) {
+	d.lock.Lock()
+	state, _, err := persister.Load()
+	d.lock.Unlock()
+	if err != nil {
+		d.logger.Error("Failed to load the broker state", err)
+		return nil, ErrFailedToLoadState
+	}
+	return state.AvailableInstances, nil
+}
+
+// Status returns the status the cluster reports for the database of the
+// instance, e.g. "active".
+func (d *defaultCreator) Status(instanceID string, persister persisters.StatePersister) (string, error) {
+	instance, err := d.Get(instanceID, persister)
+	if err != nil {
+		return "", err
+	}
+	status, err := d.forPlan(instance.PlanID).apiClient.GetDatabaseStatus(instance.Credentials.UID)
+	if err != nil {
+		d.logger.Error("Failed to get the database status", err, lager.Data{
+			"instance-id": instanceID,
+			"UID":         instance.Credentials.UID,
+		})
+		return "", err
+	}
+	return status, nil
+}
@@ -0,0 +1,87 @@
+package instancemanagers_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/cluster"
+	brokerconfig "github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/instancemanagers"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/persisters"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/testing"
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-golang/lager"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Recorded instances", func() {
+	var (
+		persister   persisters.StatePersister
+		proxy       testing.HTTPProxy
+		tmpStateDir string
+		logger      = lager.NewLogger("test")
+	)
+
+	newManager := func() redislabs.ServiceInstanceManager {
+		return instancemanagers.NewDefault(brokerconfig.Config{
+			Cluster: brokerconfig.ClusterConfig{Address: proxy.URL()},
+		}, logger)
+	}
+
+	BeforeEach(func() {
+		var err error
+		tmpStateDir, err = ioutil.TempDir("", "redislabs-state-test")
+		Expect(err).NotTo(HaveOccurred())
+		persister = persisters.NewLocalPersister(path.Join(tmpStateDir, "state.json"))
+		_, err = persister.Save(&persisters.State{
+			AvailableInstances: []persisters.ServiceInstance{
+				{ID: "test-instance", PlanID: "test-plan", Credentials: cluster.InstanceCredentials{UID: 1}},
+			},
+			DeletedInstances: []persisters.ServiceInstance{
+				{ID: "deleted-instance", Credentials: cluster.InstanceCredentials{UID: 2}},
+			},
+		}, persisters.AnyRevision)
+		Expect(err).NotTo(HaveOccurred())
+
+		proxy = testing.NewHTTPProxy()
+		proxy.RegisterEndpoints([]testing.Endpoint{
+			{URL: "/v1/bdbs/1", Response: map[string]interface{}{"uid": 1, "status": "active"}},
+		})
+	})
+
+	AfterEach(func() {
+		proxy.Close()
+		os.RemoveAll(tmpStateDir)
+	})
+
+	It("Tells whether an instance exists", func() {
+		manager := newManager()
+		Expect(manager.InstanceExists("test-instance", persister)).To(BeTrue())
+		Expect(manager.InstanceExists("deleted-instance", persister)).To(BeFalse())
+		Expect(manager.InstanceExists("unknown", persister)).To(BeFalse())
+	})
+
+	It("Gets and lists the instances", func() {
+		manager := newManager()
+		instance, err := manager.Get("test-instance", persister)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(instance.PlanID).To(Equal("test-plan"))
+
+		_, err = manager.Get("unknown", persister)
+		Expect(err).To(Equal(brokerapi.ErrInstanceDoesNotExist))
+
+		instances, err := manager.List(persister)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(instances).To(HaveLen(1))
+	})
+
+	It("Reports the status of the database", func() {
+		status, err := newManager().Status("test-instance", persister)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status).To(Equal("active"))
+	})
+})
@@ -0,0 +1,181 @@
+package instancemanagers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-golang/lager"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/persisters"
+)
+
+// reshardingOperation returns the operation tracking the resharding the
+// settings cause, nil if they do not change the shard count.
+func (d *defaultCreator) reshardingOperation(UID int, settings map[string]interface{}) (*persisters.Operation, error) {
+	var shards int64
+	switch v := settings["shards_count"].(type) {
+	case int64:
+		shards = v
+	case int:
+		shards = int64(v)
+	case float64:
+		shards = int64(v)
+	default:
+		return nil, nil
+	}
+
+	current, err := d.apiClient.GetShardCount(UID)
+	if err != nil {
+		d.logger.Error("Failed to get the shard count", err, lager.Data{"UID": UID})
+		return nil, err
+	}
+	if int64(current) == shards {
+		return nil, nil
+	}
+
+	actions, err := d.apiClient.GetDatabaseActions(UID)
+	if err != nil {
+		d.logger.Error("Failed to get the database actions", err, lager.Data{"UID": UID})
+		return nil, err
+	}
+	prior := []string{}
+	for _, action := range actions {
+		prior = append(prior, action.UID)
+	}
+	return &persisters.Operation{
+		Type:         "update",
+		State:        string(brokerapi.InProgress),
+		Description:  fmt.Sprintf("Resharding the database from %d to %d shards", current, shards),
+		PriorActions: prior,
+		StartedAt:    time.Now().UTC(),
+	}, nil
+}
+
+// LastOperation reports the state of the latest asynchronous operation on
+// the instance. The state of an operation in progress is refreshed from
+// the actions the cluster runs on the database. The cluster may list the
+// action of an update only a while after the update, so the operation is
+// in progress until its action has been seen.
+func (d *defaultCreator) LastOperation(instanceID string, persister persisters.StatePersister) (brokerapi.LastOperation, error) {
+	state, _, err := persister.Load()
+	if err != nil {
+		d.logger.Error("Failed to load the broker state", err)
+		return brokerapi.LastOperation{}, err
+	}
+	var instance *persisters.ServiceInstance
+	for i := range state.AvailableInstances {
+		if state.AvailableInstances[i].ID == instanceID {
+			instance = &state.AvailableInstances[i]
+		}
+	}
+	if instance == nil {
+		if task, pending := findCreation(state, instanceID); pending {
+			return d.forPlan(task.Instance.PlanID).creationState(task, persister), nil
+		}
+		return brokerapi.LastOperation{}, brokerapi.ErrInstanceDoesNotExist
+	}
+
+	operation := instance.LastOperation
+	if operation == nil {
+		return brokerapi.LastOperation{State: brokerapi.Succeeded}, nil
+	}
+	if operation.State != string(brokerapi.InProgress) {
+		return brokerapi.LastOperation{
+			State:       brokerapi.LastOperationState(operation.State),
+			Description: operation.Description,
+		}, nil
+	}
+
+	actions, err := d.forPlan(instance.PlanID).apiClient.GetDatabaseActions(instance.Credentials.UID)
+	if err != nil {
+		d.logger.Error("Failed to get the database actions", err, lager.Data{"instance-id": instanceID})
+		return brokerapi.LastOperation{}, err
+	}
+	prior := map[string]bool{}
+	for _, UID := range operation.PriorActions {
+		prior[UID] = true
+	}
+
+	seen := operation.ActionSeen
+	result := brokerapi.LastOperation{State: brokerapi.Succeeded, Description: operation.Description}
+	for _, action := range actions {
+		if prior[action.UID] {
+			continue
+		}
+		seen = true
+		switch action.Status {
+		case "completed":
+		case "failed", "cancelled":
+			result = brokerapi.LastOperation{
+				State:       brokerapi.Failed,
+				Description: fmt.Sprintf("%s: the cluster action %s is %s", operation.Description, action.Name, action.Status),
+			}
+		default:
+			if !operation.ActionSeen {
+				d.recordActionSeen(instanceID, persister)
+			}
+			return brokerapi.LastOperation{
+				State:       brokerapi.InProgress,
+				Description: fmt.Sprintf("%s: %s is %.0f%% done", operation.Description, action.Name, action.Progress),
+			}, nil
+		}
+	}
+	if !seen {
+		if time.Since(operation.StartedAt) < time.Second*time.Duration(WaitingForActionTimeout) {
+			return brokerapi.LastOperation{
+				State:       brokerapi.InProgress,
+				Description: operation.Description + ": waiting for the cluster to start",
+			}, nil
+		}
+		result = brokerapi.LastOperation{
+			State:       brokerapi.Failed,
+			Description: operation.Description + ": the cluster has not started it in time",
+		}
+	}
+
+	if err = d.finishOperation(instanceID, result, persister); err != nil {
+		return brokerapi.LastOperation{}, err
+	}
+	return result, nil
+}
+
+// recordActionSeen records that the cluster has started the last
+// operation, which is then done once its actions are.
+func (d *defaultCreator) recordActionSeen(instanceID string, persister persisters.StatePersister) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	err := persisters.Update(persister, func(state *persisters.State) error {
+		for i, instance := range state.AvailableInstances {
+			if instance.ID == instanceID && instance.LastOperation != nil {
+				state.AvailableInstances[i].LastOperation.ActionSeen = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		d.logger.Error("Failed to save the new state", err, lager.Data{"instance-id": instanceID})
+	}
+}
+
+// finishOperation records the final state of the last operation.
+func (d *defaultCreator) finishOperation(instanceID string, result brokerapi.LastOperation, persister persisters.StatePersister) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	err := persisters.Update(persister, func(state *persisters.State) error {
+		for i, instance := range state.AvailableInstances {
+			if instance.ID == instanceID && instance.LastOperation != nil {
+				state.AvailableInstances[i].LastOperation.State = string(result.State)
+				state.AvailableInstances[i].LastOperation.Description = result.Description
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		d.logger.Error("Failed to save the new state", err, lager.Data{"instance-id": instanceID})
+		return ErrFailedToSaveState
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package instancemanagers
+
+import (
+	"time"
+
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-golang/lager"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/persisters"
+)
+
+// RotatePassword replaces the password of the database of the instance.
+// If a grace period is configured the old password stays valid until it
+// passes, see reconcilers.PasswordRetirer.
+func (d *defaultCreator) RotatePassword(instanceID string, password string, persister persisters.StatePersister) error {
+	state, _, err := persister.Load()
+	if err != nil {
+		d.logger.Error("Failed to load the broker state", err)
+		return err
+	}
+	UID, planID, found := 0, "", false
+	for _, instance := range state.AvailableInstances {
+		if instance.ID == instanceID {
+			UID, planID, found = instance.Credentials.UID, instance.PlanID, true
+		}
+	}
+	if !found {
+		return brokerapi.ErrInstanceDoesNotExist
+	}
+
+	grace := time.Duration(d.conf.ServiceBroker.PasswordRotationGracePeriod) * time.Second
+	d.logger.Info("Rotating the database password", lager.Data{
+		"instance-id":  instanceID,
+		"grace-period": grace.String(),
+	})
+	client := d.forPlan(planID).apiClient
+	if grace > 0 {
+		err = client.AddDatabasePassword(UID, password)
+	} else {
+		err = client.SetDatabasePassword(UID, password)
+	}
+	if err != nil {
+		d.logger.Error("Failed to set the new database password", err, lager.Data{"instance-id": instanceID})
+		return err
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	err = persisters.Update(persister, func(state *persisters.State) error {
+		for i, instance := range state.AvailableInstances {
+			if instance.ID != instanceID {
+				continue
+			}
+			if grace > 0 {
+				instance.ExpiringPasswords = append(instance.ExpiringPasswords, persisters.ExpiringPassword{
+					Password:  instance.Credentials.Password,
+					ExpiresAt: time.Now().UTC().Add(grace),
+				})
+			}
+			instance.Credentials.Password = password
+			instance.UpdatedAt = time.Now().UTC()
+			state.AvailableInstances[i] = instance
+		}
+		return nil
+	})
+	if err != nil {
+		d.logger.Error("Failed to save the new state", err, lager.Data{"instance-id": instanceID})
+		return ErrFailedToSaveState
+	}
+	return nil
+}
@@ -0,0 +1,271 @@
+package instancemanagers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-golang/lager"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/cluster"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/persisters"
+)
+
+// Kinds of persisted tasks.
+const (
+	// CreateDatabaseTask waits for the database of a new instance to
+	// become active and records the instance.
+	CreateDatabaseTask = "create-database"
+)
+
+// ResumeTasks finishes the tasks a previous broker process has left
+// unfinished. It returns once they are started. The tasks this process is
+// finishing already are left alone, so it may be called again, e.g. every
+// time the broker becomes the leader.
+func (d *defaultCreator) ResumeTasks(persister persisters.StatePersister) error {
+	d.lock.Lock()
+	state, _, err := persister.Load()
+	d.lock.Unlock()
+	if err != nil {
+		d.logger.Error("Failed to load the broker state", err)
+		return ErrFailedToLoadState
+	}
+
+	for _, task := range state.Tasks {
+		d.logger.Info("Resuming a task", lager.Data{
+			"task-id":     task.ID,
+			"instance-id": task.Instance.ID,
+		})
+		switch {
+		case task.Error != "":
+			// The failure is yet to be reported.
+		case task.Kind == CreateDatabaseTask:
+			if d.inFlight.start(task.Instance.ID, "create") != nil {
+				continue
+			}
+			go func(task persisters.Task) {
+				defer d.inFlight.finish(task.Instance.ID)
+				scoped := d.forPlan(task.Instance.PlanID)
+				stop := make(chan struct{})
+				scoped.finishCreation(task, scoped.apiClient.WaitForDatabase(task.DatabaseUID, stop), stop, persister)
+			}(task)
+		default:
+			d.logger.Info("Skipping a task of an unknown kind", lager.Data{
+				"task-id": task.ID,
+				"kind":    task.Kind,
+			})
+		}
+	}
+	return nil
+}
+
+// finishCreation records the instance once its database delivered on ch
+// is active. If that takes too long the database is deleted. Closing stop
+// tells the poller of ch that nobody is waiting anymore.
+func (d *defaultCreator) finishCreation(task persisters.Task, ch chan cluster.InstanceCredentials, stop chan struct{}, persister persisters.StatePersister) error {
+	defer close(stop)
+	var (
+		credentials cluster.InstanceCredentials
+		active      bool
+	)
+	select {
+	case credentials, active = <-ch:
+		if active {
+			break
+		}
+		// The database is gone, usually since the instance has been
+		// deleted while its database was being created.
+		d.logger.Info("The database has been removed while it was being created", lager.Data{
+			"instance-id": task.Instance.ID,
+		})
+		d.failCreation(task, ErrDatabaseRemoved, persister)
+		return ErrDatabaseRemoved
+	case <-time.After(d.creationTimeout(task)):
+		// The polls back off, so the database may have become active
+		// since the last one. It is asked once more before it is given
+		// up.
+		var err error
+		if credentials, err = d.apiClient.GetDatabase(task.DatabaseUID); err == nil {
+			break
+		}
+		d.logger.Error("Waiting for a database timeout is expired", ErrCreateDatabaseTimeoutExpired, lager.Data{
+			"instance-id": task.Instance.ID,
+		})
+		d.deleteOrphan(task.DatabaseUID)
+		d.failCreation(task, ErrCreateDatabaseTimeoutExpired, persister)
+		return ErrCreateDatabaseTimeoutExpired
+	}
+
+	// Save the new state. The state is reloaded since other instances
+	// may have been saved while the database was being created.
+	d.lock.Lock()
+	instance := task.Instance
+	instance.Credentials = credentials
+	instance.CreatedAt = time.Now().UTC()
+	instance.UpdatedAt = instance.CreatedAt
+	if task.Async {
+		instance.LastOperation = &persisters.Operation{
+			Type:        "create",
+			State:       string(brokerapi.Succeeded),
+			Description: "Created the database",
+			StartedAt:   task.CreatedAt,
+		}
+	}
+	err := persisters.Update(persister, func(state *persisters.State) error {
+		if _, pending := findCreation(state, task.Instance.ID); !pending {
+			return errCreationAbandoned
+		}
+		state.AvailableInstances = append(state.AvailableInstances, instance)
+		state.RemoveTask(task.ID)
+		d.logger.Info("Saving the broker state", lager.Data{
+			"instance-id": instance.ID,
+		})
+		return nil
+	})
+	d.lock.Unlock()
+	if err == errCreationAbandoned {
+		d.logger.Info("The instance has been deleted while its database was being created", lager.Data{
+			"instance-id": task.Instance.ID,
+		})
+		return nil
+	}
+	if err != nil {
+		d.logger.Error("Failed to save the new state", err)
+		d.deleteOrphan(credentials.UID)
+		return ErrFailedToSaveState
+	}
+	if d.created != nil {
+		d.created(instance)
+	}
+	return nil
+}
+
+// failCreation records the failure of an asynchronous creation, to be
+// reported as its last operation, and forgets a synchronous one, whose
+// failure is responded. A creation that has been abandoned in the
+// meantime is not recorded again.
+func (d *defaultCreator) failCreation(task persisters.Task, cause error, persister persisters.StatePersister) {
+	if !task.Async {
+		d.removeTask(task.ID, persister)
+		return
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	task.Error = cause.Error()
+	err := persisters.Update(persister, func(state *persisters.State) error {
+		if _, pending := findCreation(state, task.Instance.ID); !pending {
+			return errCreationAbandoned
+		}
+		state.AddTask(task)
+		return nil
+	})
+	if err != nil && err != errCreationAbandoned {
+		d.logger.Error("Failed to save the task", err, lager.Data{"task-id": task.ID})
+	}
+}
+
+// creationTimeout returns how much longer the database of the task may
+// take to become active. Nobody waits for the response of an asynchronous
+// creation, so it may take as long as large databases take. Its deadline
+// counts from the creation of the task, which a resumed task keeps.
+func (d *defaultCreator) creationTimeout(task persisters.Task) time.Duration {
+	if !task.Async {
+		return time.Second * time.Duration(WaitingForDatabaseTimeout)
+	}
+	timeout := d.conf.ServiceBroker.AsyncCreationTimeout
+	if timeout <= 0 {
+		timeout = WaitingForAsyncDatabaseTimeout
+	}
+	return task.CreatedAt.Add(time.Second * time.Duration(timeout)).Sub(time.Now())
+}
+
+// creationState reports the progress of the database creation of an
+// instance that is not recorded yet. A failure is reported only once.
+func (d *defaultCreator) creationState(task persisters.Task, persister persisters.StatePersister) brokerapi.LastOperation {
+	if task.Error == "" {
+		return brokerapi.LastOperation{State: brokerapi.InProgress, Description: d.creationProgress(task)}
+	}
+	d.removeTask(task.ID, persister)
+	return brokerapi.LastOperation{State: brokerapi.Failed, Description: "Failed to create the database: " + task.Error}
+}
+
+// creationProgress describes what the cluster is doing to create the
+// database of the task. Without an answer of the cluster there is nothing
+// to tell but that the database is being created.
+func (d *defaultCreator) creationProgress(task persisters.Task) string {
+	description := "Creating the database"
+	progress, err := d.apiClient.GetDatabaseProgress(task.DatabaseUID)
+	if err != nil {
+		d.logger.Error("Failed to get the progress of the database creation", err, lager.Data{
+			"instance-id": task.Instance.ID,
+		})
+		return description
+	}
+	switch {
+	case progress.Status == "active":
+		return description + ": the database is active and about to be recorded"
+	case progress.Status != "pending":
+		return fmt.Sprintf("%s: the database is %s", description, progress.Status)
+	case progress.Shards < progress.ShardsWanted:
+		return fmt.Sprintf("%s: waiting for shards placement, %d of %d shards placed", description, progress.Shards, progress.ShardsWanted)
+	case progress.Endpoints == 0:
+		return description + ": endpoint pending"
+	}
+	return description
+}
+
+// abandonCreation deletes the database of an instance that is deleted
+// before its creation has finished.
+func (d *defaultCreator) abandonCreation(instanceID string, persister persisters.StatePersister) error {
+	state, _, err := persister.Load()
+	if err != nil {
+		d.logger.Error("Failed to load the broker state", err)
+		return err
+	}
+	task, pending := findCreation(state, instanceID)
+	if !pending {
+		return brokerapi.ErrInstanceDoesNotExist
+	}
+	if task.Error == "" {
+		if err = d.deleteDatabase(task.DatabaseUID); err != nil {
+			return err
+		}
+	}
+	d.removeTask(task.ID, persister)
+	return nil
+}
+
+func findCreation(state *persisters.State, instanceID string) (persisters.Task, bool) {
+	for _, task := range state.Tasks {
+		if task.Kind == CreateDatabaseTask && task.Instance.ID == instanceID {
+			return task, true
+		}
+	}
+	return persisters.Task{}, false
+}
+
+func (d *defaultCreator) addTask(task persisters.Task, persister persisters.StatePersister) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	err := persisters.Update(persister, func(state *persisters.State) error {
+		state.AddTask(task)
+		return nil
+	})
+	if err != nil {
+		d.logger.Error("Failed to save the task", err, lager.Data{"task-id": task.ID})
+		return ErrFailedToSaveState
+	}
+	return nil
+}
+
+func (d *defaultCreator) removeTask(ID string, persister persisters.StatePersister) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	err := persisters.Update(persister, func(state *persisters.State) error {
+		state.RemoveTask(ID)
+		return nil
+	})
+	if err != nil {
+		d.logger.Error("Failed to remove the task", err, lager.Data{"task-id": ID})
+	}
+}
@@ -0,0 +1,178 @@
+package instancemanagers_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/cluster"
+	brokerconfig "github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/fakes"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/instancemanagers"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/persisters"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/testing"
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-golang/lager"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Persisted tasks", func() {
+	var (
+		persister   persisters.StatePersister
+		proxy       testing.HTTPProxy
+		tmpStateDir string
+		conf        brokerconfig.Config
+		logger      = lager.NewLogger("test")
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpStateDir, err = ioutil.TempDir("", "redislabs-state-test")
+		Expect(err).NotTo(HaveOccurred())
+		persister = persisters.NewLocalPersister(path.Join(tmpStateDir, "state.json"))
+		_, err = persister.Save(&persisters.State{
+			Tasks: []persisters.Task{{
+				ID:          "create-database:test-instance",
+				Kind:        instancemanagers.CreateDatabaseTask,
+				Instance:    persisters.ServiceInstance{ID: "test-instance", PlanID: "test-plan"},
+				DatabaseUID: 1,
+				CreatedAt:   time.Now(),
+			}},
+		}, persisters.AnyRevision)
+		Expect(err).NotTo(HaveOccurred())
+
+		proxy = testing.NewHTTPProxy()
+		proxy.RegisterEndpoints([]testing.Endpoint{
+			{URL: "/v1/bdbs/1", Response: map[string]interface{}{
+				"uid":                       1,
+				"authentication_redis_pass": "pass",
+				"status":                    "active",
+				"endpoints": []map[string]interface{}{{
+					"dns_name": "domain.com",
+					"port":     11909,
+					"addr":     []string{"10.0.2.4"},
+				}},
+			}},
+		})
+		conf = brokerconfig.Config{
+			Cluster: brokerconfig.ClusterConfig{
+				Address: proxy.URL(),
+				Polling: brokerconfig.PollingConfig{InitialInterval: 10},
+			},
+		}
+	})
+
+	AfterEach(func() {
+		proxy.Close()
+		os.RemoveAll(tmpStateDir)
+	})
+
+	It("Reports a resumed asynchronous creation as the last operation", func() {
+		state, revision, err := persister.Load()
+		Expect(err).NotTo(HaveOccurred())
+		state.Tasks[0].Async = true
+		_, err = persister.Save(state, revision)
+		Expect(err).NotTo(HaveOccurred())
+
+		manager := instancemanagers.NewDefault(conf, logger)
+		operation, err := manager.LastOperation("test-instance", persister)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(operation.State).To(Equal(brokerapi.InProgress))
+
+		Expect(manager.ResumeTasks(persister)).To(Succeed())
+		Eventually(func() brokerapi.LastOperationState {
+			operation, err := manager.LastOperation("test-instance", persister)
+			Expect(err).NotTo(HaveOccurred())
+			return operation.State
+		}).Should(Equal(brokerapi.Succeeded))
+	})
+
+	It("Leaves alone the tasks it is finishing already when resumed again", func() {
+		apiClient := &fakes.FakeClient{}
+		ch := make(chan cluster.InstanceCredentials, 1)
+		apiClient.WaitForDatabaseReturns(ch)
+		manager := instancemanagers.NewDefault(conf, logger).WithAPIClient(apiClient)
+		Expect(manager.ResumeTasks(persister)).To(Succeed())
+		Expect(manager.ResumeTasks(persister)).To(Succeed())
+
+		ch <- cluster.InstanceCredentials{UID: 1, Host: "domain.com"}
+		Eventually(func() []persisters.Task {
+			state, _, err := persister.Load()
+			Expect(err).NotTo(HaveOccurred())
+			return state.Tasks
+		}).Should(BeEmpty())
+		Expect(apiClient.WaitForDatabaseCallCount()).To(Equal(1))
+		state, _, err := persister.Load()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state.AvailableInstances).To(HaveLen(1))
+	})
+
+	It("Describes the progress of a creation", func() {
+		apiClient := &fakes.FakeClient{}
+		manager := instancemanagers.NewDefault(conf, logger).WithAPIClient(apiClient)
+		description := func() string {
+			operation, err := manager.LastOperation("test-instance", persister)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(operation.State).To(Equal(brokerapi.InProgress))
+			return operation.Description
+		}
+
+		apiClient.GetDatabaseProgressReturns(cluster.DatabaseProgress{Status: "pending", Shards: 1, ShardsWanted: 2}, nil)
+		Expect(description()).To(Equal("Creating the database: waiting for shards placement, 1 of 2 shards placed"))
+		Expect(apiClient.GetDatabaseProgressArgsForCall(0)).To(Equal(1))
+
+		apiClient.GetDatabaseProgressReturns(cluster.DatabaseProgress{Status: "pending", Shards: 2, ShardsWanted: 2}, nil)
+		Expect(description()).To(Equal("Creating the database: endpoint pending"))
+
+		apiClient.GetDatabaseProgressReturns(cluster.DatabaseProgress{Status: "active", Shards: 2, ShardsWanted: 2, Endpoints: 1}, nil)
+		Expect(description()).To(Equal("Creating the database: the database is active and about to be recorded"))
+
+		apiClient.GetDatabaseProgressReturns(cluster.DatabaseProgress{}, errors.New("cluster failure"))
+		Expect(description()).To(Equal("Creating the database"))
+	})
+
+	It("Does not resume failed tasks", func() {
+		state, revision, err := persister.Load()
+		Expect(err).NotTo(HaveOccurred())
+		state.Tasks[0].Async = true
+		state.Tasks[0].Error = "timeout"
+		_, err = persister.Save(state, revision)
+		Expect(err).NotTo(HaveOccurred())
+
+		manager := instancemanagers.NewDefault(conf, logger)
+		Expect(manager.ResumeTasks(persister)).To(Succeed())
+		operation, err := manager.LastOperation("test-instance", persister)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(operation.State).To(Equal(brokerapi.Failed))
+		Expect(operation.Description).To(ContainSubstring("timeout"))
+
+		state, _, err = persister.Load()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state.AvailableInstances).To(BeEmpty())
+		Expect(state.Tasks).To(BeEmpty())
+	})
+
+	It("Finishes the creation of a database after a restart", func() {
+		manager := instancemanagers.NewDefault(conf, logger)
+		Expect(manager.ResumeTasks(persister)).To(Succeed())
+
+		Eventually(func() []persisters.Task {
+			state, _, err := persister.Load()
+			Expect(err).NotTo(HaveOccurred())
+			return state.Tasks
+		}).Should(BeEmpty())
+
+		state, _, err := persister.Load()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state.AvailableInstances).To(HaveLen(1))
+		instance := state.AvailableInstances[0]
+		Expect(instance.ID).To(Equal("test-instance"))
+		Expect(instance.PlanID).To(Equal("test-plan"))
+		Expect(instance.Credentials.Host).To(Equal("domain.com"))
+		Expect(instance.Credentials.Password).To(Equal("pass"))
+	})
+})
@@ -0,0 +1,10 @@
+package logging
+
+import "errors"
+
+var (
+	ErrUnknownLevel    = errors.New("unknown log level, use debug, info or error")
+	ErrUnknownFormat   = errors.New("unknown log format, use json or human")
+	ErrUnknownSinkType = errors.New("unknown log sink type, use stdout, file or syslog")
+	ErrNoLogFilePath   = errors.New("file log sinks need a path")
+)
@@ -0,0 +1,107 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/pivotal-golang/lager"
+)
+
+// Redacted replaces the sensitive values of the log lines.
+const Redacted = "[REDACTED]"
+
+// sensitiveKeys are the parts of the names of the log data whose values
+// are redacted, e.g. password, authentication_redis_pass or client_secret.
+var sensitiveKeys = []string{"pass", "secret", "token"}
+
+// uriCredentials matches the password of URIs like redis://:password@host.
+var uriCredentials = regexp.MustCompile(`([a-z][a-z0-9+.-]*://[^:/@\s]*:)[^@\s]+@`)
+
+// NewRedactingSink returns a sink redacting the passwords, secrets and
+// tokens of the log lines before they reach the sink.
+func NewRedactingSink(sink lager.Sink) lager.Sink {
+	return &redactingSink{sink: sink}
+}
+
+type redactingSink struct {
+	sink lager.Sink
+}
+
+func (s *redactingSink) Log(level lager.LogLevel, payload []byte) {
+	s.sink.Log(level, Redact(payload))
+}
+
+// Redact returns the JSON log line of lager with the values of sensitive
+// keys and the passwords of URIs replaced, at any depth of the log data.
+// Lines it cannot parse are returned as they are.
+func Redact(payload []byte) []byte {
+	var log lager.LogFormat
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	// Numbers are kept as they were logged rather than as floats.
+	decoder.UseNumber()
+	if err := decoder.Decode(&log); err != nil {
+		return payload
+	}
+	log.Message = redactString(log.Message)
+	for key, value := range log.Data {
+		log.Data[key] = redactValue(key, value)
+	}
+	redacted, err := json.Marshal(log)
+	if err != nil {
+		return payload
+	}
+	return redacted
+}
+
+// RedactValues returns a copy of the values with the values of sensitive
+// keys redacted at any depth, e.g. to show the parameters of an instance.
+func RedactValues(values map[string]interface{}) map[string]interface{} {
+	if values == nil {
+		return nil
+	}
+	return redactValue("", values).(map[string]interface{})
+}
+
+// redactValue returns the value with the sensitive parts replaced. Maps and
+// slices are copied rather than changed.
+func redactValue(key string, value interface{}) interface{} {
+	if isSensitive(key) {
+		if value == nil || value == "" {
+			return value
+		}
+		return Redacted
+	}
+	switch value := value.(type) {
+	case string:
+		return redactString(value)
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(value))
+		for k, v := range value {
+			redacted[k] = redactValue(k, v)
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(value))
+		for i, v := range value {
+			redacted[i] = redactValue("", v)
+		}
+		return redacted
+	}
+	return value
+}
+
+func redactString(s string) string {
+	return uriCredentials.ReplaceAllString(s, "${1}"+Redacted+"@")
+}
+
+func isSensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, sensitive := range sensitiveKeys {
+		if strings.Contains(key, sensitive) {
+			return true
+		}
+	}
+	return false
+}
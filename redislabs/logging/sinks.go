@@ -0,0 +1,201 @@
+// Package logging sets up the sinks the broker logs to.
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/syslog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pivotal-golang/lager"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+)
+
+const (
+	JSONFormat  = "json"
+	HumanFormat = "human"
+)
+
+var levels = map[string]lager.LogLevel{
+	"debug": lager.DEBUG,
+	"info":  lager.INFO,
+	"error": lager.ERROR,
+}
+
+// ParseLevel returns the lager level named by level. An empty level means
+// debug.
+func ParseLevel(level string) (lager.LogLevel, error) {
+	if level == "" {
+		return lager.DEBUG, nil
+	}
+	l, ok := levels[strings.ToLower(level)]
+	if !ok {
+		return lager.DEBUG, ErrUnknownLevel
+	}
+	return l, nil
+}
+
+// Configure registers the sinks of conf with the logger.
+func Configure(logger lager.Logger, conf config.LogConfig) error {
+	sinks, err := NewSinks(conf)
+	if err != nil {
+		return err
+	}
+	for _, sink := range sinks {
+		logger.RegisterSink(sink)
+	}
+	return nil
+}
+
+// NewSinks creates the sinks of conf, a stdout sink if there are none. The
+// sinks redact sensitive values unless conf says otherwise.
+func NewSinks(conf config.LogConfig) ([]lager.Sink, error) {
+	level, err := ParseLevel(conf.Level)
+	if err != nil {
+		return nil, err
+	}
+	format := conf.Format
+	if format == "" {
+		format = JSONFormat
+	}
+	if format != JSONFormat && format != HumanFormat {
+		return nil, ErrUnknownFormat
+	}
+
+	sinkConfs := conf.Sinks
+	if len(sinkConfs) == 0 {
+		sinkConfs = []config.LogSinkConfig{{Type: "stdout"}}
+	}
+	sinks := []lager.Sink{}
+	for _, sinkConf := range sinkConfs {
+		sink, err := newSink(sinkConf, level, format)
+		if err != nil {
+			return nil, err
+		}
+		if !conf.LogSensitive {
+			sink = NewRedactingSink(sink)
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks, nil
+}
+
+func newSink(conf config.LogSinkConfig, level lager.LogLevel, format string) (lager.Sink, error) {
+	switch conf.Type {
+	case "stdout":
+		return &writerSink{writer: os.Stdout, level: level, format: format}, nil
+	case "file":
+		if conf.Path == "" {
+			return nil, ErrNoLogFilePath
+		}
+		file, err := openRotatingFile(conf.Path, int64(conf.MaxSize)*1024*1024, conf.MaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		return &writerSink{writer: file, level: level, format: format}, nil
+	case "syslog":
+		tag := conf.Tag
+		if tag == "" {
+			tag = "redislabs-service-broker"
+		}
+		writer, err := syslog.Dial(conf.Network, conf.Address, syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to syslog: %s", err)
+		}
+		return &syslogSink{writer: writer, level: level, format: format}, nil
+	}
+	return nil, ErrUnknownSinkType
+}
+
+// writerSink writes every log line with a single call, so that a rotating
+// file never splits a line.
+type writerSink struct {
+	lock   sync.Mutex
+	writer io.Writer
+	level  lager.LogLevel
+	format string
+}
+
+func (s *writerSink) Log(level lager.LogLevel, payload []byte) {
+	if level < s.level {
+		return
+	}
+	// The payload is shared with the other sinks, so it is copied
+	// rather than appended to.
+	formatted := formatLine(s.format, payload)
+	line := make([]byte, len(formatted)+1)
+	copy(line, formatted)
+	line[len(formatted)] = '\n'
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.writer.Write(line)
+}
+
+type syslogSink struct {
+	writer *syslog.Writer
+	level  lager.LogLevel
+	format string
+}
+
+func (s *syslogSink) Log(level lager.LogLevel, payload []byte) {
+	if level < s.level {
+		return
+	}
+	line := string(formatLine(s.format, payload))
+	switch level {
+	case lager.DEBUG:
+		s.writer.Debug(line)
+	case lager.INFO:
+		s.writer.Info(line)
+	case lager.ERROR:
+		s.writer.Err(line)
+	default:
+		s.writer.Crit(line)
+	}
+}
+
+var levelNames = map[lager.LogLevel]string{
+	lager.DEBUG: "DEBUG",
+	lager.INFO:  "INFO",
+	lager.ERROR: "ERROR",
+	lager.FATAL: "FATAL",
+}
+
+// formatLine turns the JSON payload of lager into a line of the given
+// format. Human readable lines look like
+//
+//	2016-01-02T15:04:05.000Z INFO source.message {"key":"value"}
+func formatLine(format string, payload []byte) []byte {
+	if format != HumanFormat {
+		return payload
+	}
+	var log lager.LogFormat
+	if err := json.Unmarshal(payload, &log); err != nil {
+		return payload
+	}
+
+	var line bytes.Buffer
+	if seconds, err := strconv.ParseFloat(log.Timestamp, 64); err == nil {
+		timestamp := time.Unix(0, int64(seconds*float64(time.Second))).UTC()
+		line.WriteString(timestamp.Format("2006-01-02T15:04:05.000Z"))
+	} else {
+		line.WriteString(log.Timestamp)
+	}
+	fmt.Fprintf(&line, " %s %s", levelNames[log.LogLevel], log.Message)
+	if len(log.Data) > 0 {
+		data, err := json.Marshal(log.Data)
+		if err == nil {
+			line.WriteByte(' ')
+			line.Write(data)
+		}
+	}
+	return line.Bytes()
+}
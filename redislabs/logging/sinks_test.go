@@ -0,0 +1,131 @@
+package logging_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/pivotal-golang/lager"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/logging"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Sinks", func() {
+	var (
+		dir     string
+		logPath string
+		conf    config.LogConfig
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "logging")
+		Expect(err).NotTo(HaveOccurred())
+		logPath = path.Join(dir, "broker.log")
+		conf = config.LogConfig{
+			Sinks: []config.LogSinkConfig{{Type: "file", Path: logPath}},
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	logLines := func(file string) []string {
+		contents, err := ioutil.ReadFile(file)
+		Expect(err).NotTo(HaveOccurred())
+		return strings.Split(strings.TrimSpace(string(contents)), "\n")
+	}
+
+	newLogger := func() lager.Logger {
+		logger := lager.NewLogger("broker")
+		Expect(logging.Configure(logger, conf)).To(Succeed())
+		return logger
+	}
+
+	It("Logs JSON at the debug level by default", func() {
+		newLogger().Debug("debugging", lager.Data{"key": "value"})
+		lines := logLines(logPath)
+		Expect(lines).To(HaveLen(1))
+		Expect(lines[0]).To(HavePrefix("{"))
+		Expect(lines[0]).To(ContainSubstring(`"message":"broker.debugging"`))
+	})
+
+	It("Drops the log lines below the configured level", func() {
+		conf.Level = "error"
+		logger := newLogger()
+		logger.Info("ignored")
+		logger.Error("failed", os.ErrNotExist)
+		lines := logLines(logPath)
+		Expect(lines).To(HaveLen(1))
+		Expect(lines[0]).To(ContainSubstring("broker.failed"))
+	})
+
+	It("Logs human readable lines", func() {
+		conf.Format = logging.HumanFormat
+		newLogger().Info("started", lager.Data{"port": 8080})
+		lines := logLines(logPath)
+		Expect(lines).To(HaveLen(1))
+		Expect(lines[0]).To(MatchRegexp(`^\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{3}Z INFO broker\.started \{"port":8080\}$`))
+	})
+
+	It("Redacts sensitive values", func() {
+		newLogger().Info("created", lager.Data{
+			"settings": map[string]interface{}{
+				"authentication_redis_pass": "secret-1",
+				"memory_size":               23622320128,
+			},
+			"credentials": []interface{}{map[string]interface{}{
+				"password": "secret-2",
+				"uri":      "redis://:secret-3@redis-12001.example.com:12001",
+			}},
+			"client_secret": "secret-4",
+		})
+		lines := logLines(logPath)
+		Expect(lines).To(HaveLen(1))
+		Expect(lines[0]).NotTo(ContainSubstring("secret-"))
+		Expect(lines[0]).To(ContainSubstring(`"authentication_redis_pass":"[REDACTED]"`))
+		Expect(lines[0]).To(ContainSubstring(`"memory_size":23622320128`))
+		Expect(lines[0]).To(ContainSubstring(`"uri":"redis://:[REDACTED]@redis-12001.example.com:12001"`))
+	})
+
+	It("Logs sensitive values if configured to", func() {
+		conf.LogSensitive = true
+		newLogger().Info("created", lager.Data{"password": "secret-1"})
+		lines := logLines(logPath)
+		Expect(lines).To(HaveLen(1))
+		Expect(lines[0]).To(ContainSubstring(`"password":"secret-1"`))
+	})
+
+	It("Rotates log files", func() {
+		conf.Sinks[0].MaxSize = 1
+		conf.Sinks[0].MaxBackups = 2
+		logger := newLogger()
+		data := lager.Data{"padding": strings.Repeat("x", 400*1024)}
+		for i := 0; i < 10; i++ {
+			logger.Info("filling", data)
+		}
+
+		Expect(logLines(logPath)).To(HaveLen(2))
+		Expect(logLines(logPath + ".1")).To(HaveLen(2))
+		Expect(logLines(logPath + ".2")).To(HaveLen(2))
+		_, err := os.Stat(logPath + ".3")
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+
+	It("Rejects unknown settings", func() {
+		_, err := logging.NewSinks(config.LogConfig{Level: "verbose"})
+		Expect(err).To(Equal(logging.ErrUnknownLevel))
+		_, err = logging.NewSinks(config.LogConfig{Format: "xml"})
+		Expect(err).To(Equal(logging.ErrUnknownFormat))
+		_, err = logging.NewSinks(config.LogConfig{Sinks: []config.LogSinkConfig{{Type: "kafka"}}})
+		Expect(err).To(Equal(logging.ErrUnknownSinkType))
+		_, err = logging.NewSinks(config.LogConfig{Sinks: []config.LogSinkConfig{{Type: "file"}}})
+		Expect(err).To(Equal(logging.ErrNoLogFilePath))
+	})
+})
@@ -0,0 +1,109 @@
+// Package metrics forwards the stats of the databases of the service
+// instances to the metrics system of the platform, so that developers see
+// them alongside the metrics of their apps.
+package metrics
+
+import (
+	"time"
+
+	"github.com/pivotal-golang/lager"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/apiclient"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/persisters"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/reconcilers"
+)
+
+// Gauge is the latest value of a stat of the database of an instance.
+type Gauge struct {
+	Name  string
+	Value float64
+	// Tags identify the instance: instance_id, plan_id,
+	// organization_guid and space_guid.
+	Tags map[string]string
+}
+
+// Sink receives the gauges of an instance.
+type Sink interface {
+	Send(gauges []Gauge) error
+}
+
+// Forwarder pulls the stats of the databases of all the instances and
+// sends them to a sink.
+type Forwarder struct {
+	apiClient apiclient.Client
+	persister persisters.StatePersister
+	sink      Sink
+	logger    lager.Logger
+	leader    reconcilers.Leader
+}
+
+func NewForwarder(conf config.Config, persister persisters.StatePersister, sink Sink, logger lager.Logger) *Forwarder {
+	return &Forwarder{
+		apiClient: apiclient.New(conf, logger),
+		persister: persister,
+		sink:      sink,
+		logger:    logger.Session("metrics"),
+	}
+}
+
+// WithLeader makes Run skip the forwards while another broker leads, so
+// that the stats are not sent twice.
+func (f *Forwarder) WithLeader(leader reconcilers.Leader) *Forwarder {
+	f.leader = leader
+	return f
+}
+
+// Forward sends the stats of the databases of the available instances,
+// and returns the number of instances whose stats were sent. The
+// instances the cluster has no stats of are skipped.
+func (f *Forwarder) Forward() (int, error) {
+	state, _, err := f.persister.Load()
+	if err != nil {
+		f.logger.Error("Failed to load the broker state", err)
+		return 0, err
+	}
+
+	forwarded := 0
+	for _, instance := range state.AvailableInstances {
+		stats, err := f.apiClient.GetDatabaseStats(instance.Credentials.UID)
+		if err != nil {
+			f.logger.Error("Failed to get the database stats", err, lager.Data{"instance-id": instance.ID})
+			continue
+		}
+		tags := map[string]string{
+			"instance_id":       instance.ID,
+			"plan_id":           instance.PlanID,
+			"organization_guid": instance.OrganizationGUID,
+			"space_guid":        instance.SpaceGUID,
+		}
+		gauges := []Gauge{
+			{Name: "memory_limit", Value: float64(stats.MemoryLimit), Tags: tags},
+			{Name: "used_memory", Value: float64(stats.UsedMemory), Tags: tags},
+			{Name: "ops_per_sec", Value: stats.OpsPerSec, Tags: tags},
+			{Name: "connections", Value: float64(stats.Connections), Tags: tags},
+			{Name: "keys", Value: float64(stats.Keys), Tags: tags},
+		}
+		if err := f.sink.Send(gauges); err != nil {
+			f.logger.Error("Failed to send the database stats", err, lager.Data{"instance-id": instance.ID})
+			continue
+		}
+		forwarded++
+	}
+	return forwarded, nil
+}
+
+// Run forwards the stats every interval. It never returns, so it is
+// supposed to be run in a goroutine.
+func (f *Forwarder) Run(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		if f.leader != nil && !f.leader.IsLeader() {
+			continue
+		}
+
+		if forwarded, err := f.Forward(); err == nil {
+			f.logger.Debug("Forwarded the database stats", lager.Data{"instances": forwarded})
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package metrics_test
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/cluster"
+	brokerconfig "github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/metrics"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/persisters"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/testing"
+	"github.com/pivotal-golang/lager"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Metrics forwarder", func() {
+	var (
+		persister   persisters.StatePersister
+		proxy       testing.HTTPProxy
+		tmpStateDir string
+		statsd      net.PacketConn
+		conf        brokerconfig.Config
+		logger      = lager.NewLogger("test")
+	)
+
+	// received returns the lines of the next packet statsd received.
+	received := func() []string {
+		buffer := make([]byte, 4096)
+		statsd.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := statsd.ReadFrom(buffer)
+		Expect(err).NotTo(HaveOccurred())
+		return strings.Split(strings.TrimSpace(string(buffer[:n])), "\n")
+	}
+
+	forward := func(metricsConf brokerconfig.MetricsConfig) int {
+		metricsConf.Address = statsd.LocalAddr().String()
+		sink, err := metrics.NewStatsD(metricsConf)
+		Expect(err).NotTo(HaveOccurred())
+		defer sink.Close()
+		forwarded, err := metrics.NewForwarder(conf, persister, sink, logger).Forward()
+		Expect(err).NotTo(HaveOccurred())
+		return forwarded
+	}
+
+	BeforeEach(func() {
+		var err error
+		tmpStateDir, err = ioutil.TempDir("", "redislabs-state-test")
+		Expect(err).NotTo(HaveOccurred())
+		persister = persisters.NewLocalPersister(path.Join(tmpStateDir, "state.json"))
+		_, err = persister.Save(&persisters.State{
+			AvailableInstances: []persisters.ServiceInstance{
+				{
+					ID:               "instance-1",
+					PlanID:           "plan-1",
+					OrganizationGUID: "org-1",
+					SpaceGUID:        "space-1",
+					Credentials:      cluster.InstanceCredentials{UID: 1},
+				},
+				// The cluster has no stats of the second instance.
+				{ID: "instance-2", Credentials: cluster.InstanceCredentials{UID: 2}},
+			},
+		}, persisters.AnyRevision)
+		Expect(err).NotTo(HaveOccurred())
+
+		proxy = testing.NewHTTPProxy()
+		proxy.RegisterEndpointHandler("/v1/bdbs/1", func(w http.ResponseWriter, r *http.Request) interface{} {
+			return map[string]interface{}{"uid": 1, "memory_size": 1024}
+		})
+		proxy.RegisterEndpointHandler("/v1/bdbs/stats/last/1", func(w http.ResponseWriter, r *http.Request) interface{} {
+			return map[string]interface{}{"1": map[string]interface{}{
+				"used_memory": 512.0, "total_req": 2.5, "conns": 3.0, "no_of_keys": 42.0,
+			}}
+		})
+		conf = brokerconfig.Config{Cluster: brokerconfig.ClusterConfig{Address: proxy.URL()}}
+
+		statsd, err = net.ListenPacket("udp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		statsd.Close()
+		proxy.Close()
+		os.RemoveAll(tmpStateDir)
+	})
+
+	It("Sends the stats of the databases as gauges named after the instances", func() {
+		Expect(forward(brokerconfig.MetricsConfig{})).To(Equal(1))
+		Expect(received()).To(Equal([]string{
+			"redislabs.instance-1.memory_limit:1024|g",
+			"redislabs.instance-1.used_memory:512|g",
+			"redislabs.instance-1.ops_per_sec:2.5|g",
+			"redislabs.instance-1.connections:3|g",
+			"redislabs.instance-1.keys:42|g",
+		}))
+	})
+
+	It("Identifies the instances with tags", func() {
+		Expect(forward(brokerconfig.MetricsConfig{Prefix: "redis", Tags: true})).To(Equal(1))
+		lines := received()
+		Expect(lines).To(HaveLen(5))
+		Expect(lines[1]).To(Equal("redis.used_memory:512|g|#instance_id:instance-1,organization_guid:org-1,plan_id:plan-1,space_guid:space-1"))
+	})
+})
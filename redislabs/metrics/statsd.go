@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+)
+
+// Defaults of the StatsD sink, the ones of the statsd injector.
+const (
+	DefaultAddress = "localhost:8125"
+	DefaultPrefix  = "redislabs"
+)
+
+// StatsD sends the gauges over UDP, the gauges of an instance in a single
+// packet. Their names are <prefix>.<instance_id>.<stat>, or <prefix>.<stat>
+// with DogStatsD tags identifying the instance.
+type StatsD struct {
+	conn   net.Conn
+	prefix string
+	tags   bool
+}
+
+func NewStatsD(conf config.MetricsConfig) (*StatsD, error) {
+	address := conf.Address
+	if address == "" {
+		address = DefaultAddress
+	}
+	prefix := conf.Prefix
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to statsd: %s", err)
+	}
+	return &StatsD{conn: conn, prefix: prefix, tags: conf.Tags}, nil
+}
+
+func (s *StatsD) Send(gauges []Gauge) error {
+	packet := &bytes.Buffer{}
+	for _, gauge := range gauges {
+		value := strconv.FormatFloat(gauge.Value, 'f', -1, 64)
+		if !s.tags {
+			fmt.Fprintf(packet, "%s.%s.%s:%s|g\n", s.prefix, gauge.Tags["instance_id"], gauge.Name, value)
+			continue
+		}
+		fmt.Fprintf(packet, "%s.%s:%s|g", s.prefix, gauge.Name, value)
+		keys := []string{}
+		for key, tag := range gauge.Tags {
+			if tag != "" {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for i, key := range keys {
+			separator := ","
+			if i == 0 {
+				separator = "|#"
+			}
+			fmt.Fprintf(packet, "%s%s:%s", separator, key, gauge.Tags[key])
+		}
+		packet.WriteString("\n")
+	}
+	_, err := s.conn.Write(packet.Bytes())
+	return err
+}
+
+// Close closes the connection of the sink.
+func (s *StatsD) Close() error {
+	return s.conn.Close()
+}
@@ -0,0 +1,50 @@
+package migrations
+
+import (
+	"github.com/pivotal-golang/lager"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/apiclient"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/persisters"
+)
+
+// Default returns the migrations of the broker state in the order of
+// versions. New migrations must only ever be appended.
+func Default(conf config.Config, logger lager.Logger) []persisters.Migration {
+	apiClient := apiclient.New(conf, logger)
+	return []persisters.Migration{
+		fillHosts(apiClient, logger),
+	}
+}
+
+// fillHosts records the hosts of the instances that were created before
+// the broker saved them. Instances whose databases no longer exist keep
+// an empty host; the reconcile command reports them. While the cluster is
+// unreachable the migration is deferred, so that the state still loads.
+func fillHosts(apiClient apiclient.Client, logger lager.Logger) persisters.Migration {
+	return func(s *persisters.State) error {
+		missing := false
+		for _, instance := range s.AvailableInstances {
+			missing = missing || instance.Credentials.Host == ""
+		}
+		if !missing {
+			return nil
+		}
+
+		databases, err := apiClient.ListDatabases()
+		if err != nil {
+			logger.Error("Failed to list the databases, the hosts are filled in later", err)
+			return persisters.ErrMigrationDeferred
+		}
+		hosts := map[int]string{}
+		for _, database := range databases {
+			hosts[database.UID] = database.Host
+		}
+		for i, instance := range s.AvailableInstances {
+			if instance.Credentials.Host == "" {
+				s.AvailableInstances[i].Credentials.Host = hosts[instance.Credentials.UID]
+			}
+		}
+		return nil
+	}
+}
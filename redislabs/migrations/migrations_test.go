@@ -0,0 +1,113 @@
+package migrations_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/cluster"
+	brokerconfig "github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/migrations"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/persisters"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/testing"
+	"github.com/pivotal-golang/lager"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("State migrations", func() {
+	var (
+		local       persisters.StatePersister
+		persister   persisters.StatePersister
+		proxy       testing.HTTPProxy
+		tmpStateDir string
+		reachable   bool
+		logger      = lager.NewLogger("test")
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpStateDir, err = ioutil.TempDir("", "redislabs-state-test")
+		Expect(err).NotTo(HaveOccurred())
+		local = persisters.NewLocalPersister(path.Join(tmpStateDir, "state.json"))
+		// The state of a broker that did not record the hosts.
+		_, err = local.Save(&persisters.State{
+			AvailableInstances: []persisters.ServiceInstance{
+				{ID: "test-instance", Credentials: cluster.InstanceCredentials{UID: 1, Port: 10001}},
+			},
+		}, persisters.AnyRevision)
+		Expect(err).NotTo(HaveOccurred())
+
+		reachable = true
+		proxy = testing.NewHTTPProxy()
+		proxy.RegisterEndpointHandler("/v1/bdbs", func(w http.ResponseWriter, r *http.Request) interface{} {
+			if !reachable {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return map[string]interface{}{"error_code": "unavailable", "description": "the cluster is unavailable"}
+			}
+			return []map[string]interface{}{{
+				"uid":                       1,
+				"authentication_redis_pass": "pass",
+				"status":                    "active",
+				"endpoints": []map[string]interface{}{{
+					"dns_name": "one.example.com",
+					"port":     10001,
+					"addr":     []string{"10.0.0.1"},
+				}},
+			}}
+		})
+		conf := brokerconfig.Config{Cluster: brokerconfig.ClusterConfig{Address: proxy.URL()}}
+		persister = persisters.NewMigratingPersister(local, migrations.Default(conf, logger))
+	})
+
+	AfterEach(func() {
+		proxy.Close()
+		os.RemoveAll(tmpStateDir)
+	})
+
+	It("Fills in the hosts of the instances", func() {
+		state, _, err := persister.Load()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state.AvailableInstances[0].Credentials.Host).To(Equal("one.example.com"))
+
+		saved, _, err := local.Load()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(saved.Version).To(Equal(1))
+		Expect(saved.AvailableInstances[0].Credentials.Host).To(Equal("one.example.com"))
+	})
+
+	Context("When the cluster is unreachable", func() {
+		BeforeEach(func() {
+			reachable = false
+		})
+
+		It("Loads the state and fills in the hosts on a later save", func() {
+			state, revision, err := persister.Load()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(state.AvailableInstances).To(HaveLen(1))
+			Expect(state.AvailableInstances[0].Credentials.Host).To(BeEmpty())
+
+			state.AvailableInstances = append(state.AvailableInstances, persisters.ServiceInstance{
+				ID:          "new-instance",
+				Credentials: cluster.InstanceCredentials{UID: 2, Host: "two.example.com"},
+			})
+			revision, err = persister.Save(state, revision)
+			Expect(err).NotTo(HaveOccurred())
+			saved, _, err := local.Load()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(saved.Version).To(Equal(0))
+			Expect(saved.AvailableInstances).To(HaveLen(2))
+
+			reachable = true
+			_, err = persister.Save(saved, revision)
+			Expect(err).NotTo(HaveOccurred())
+			saved, _, err = local.Load()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(saved.Version).To(Equal(1))
+			Expect(saved.AvailableInstances[0].Credentials.Host).To(Equal("one.example.com"))
+			Expect(saved.AvailableInstances[1].Credentials.Host).To(Equal("two.example.com"))
+		})
+	})
+})
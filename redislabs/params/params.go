@@ -0,0 +1,268 @@
+package params
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/brokererrors"
+)
+
+// Kind is the type of a parameter value.
+type Kind int
+
+const (
+	String Kind = iota
+	Integer
+	Boolean
+	// IntegerList and StringList values are lists, given as an array
+	// or as a comma-separated string.
+	IntegerList
+	StringList
+)
+
+// Parameter describes a database setting that developers may pass
+// on provision or update.
+type Parameter struct {
+	Kind Kind
+	// Range limits integer values and the items of integer lists. Zero
+	// bounds are not checked.
+	Range Range
+	// Values lists the allowed string values, any string is allowed
+	// if empty.
+	Values []string
+	// Pattern, if set, has to match string values and the items of
+	// string lists.
+	Pattern *regexp.Regexp
+}
+
+// Range is an inclusive range of integer values. A zero bound is
+// not checked.
+type Range struct {
+	Min int64
+	Max int64
+}
+
+// Known lists the parameters accepted by the broker. Other parameters
+// are rejected.
+var Known = map[string]Parameter{
+	"name":                      {Kind: String, Pattern: regexp.MustCompile(`^[A-Za-z0-9_-]+$`)},
+	"memory_size":               {Kind: Integer, Range: Range{Min: 1}},
+	"replication":               {Kind: Boolean},
+	"shards_count":              {Kind: Integer, Range: Range{Min: 1}},
+	"port":                      {Kind: Integer, Range: Range{Min: 10000, Max: 19999}},
+	"authentication_redis_pass": {Kind: String},
+	"rotate_password":           {Kind: Boolean},
+	"deletion_protection":       {Kind: Boolean},
+	"retain_database":           {Kind: Boolean},
+	"uid":                       {Kind: Integer, Range: Range{Min: 1}},
+	"data_persistence":          {Kind: String, Values: []string{"disabled", "aof", "snapshot"}},
+	"aof_policy":                {Kind: String, Values: []string{"appendfsync-every-sec", "appendfsync-always"}},
+	"shards_placement":          {Kind: String, Values: []string{"dense", "sparse"}},
+	"nodes":                     {Kind: IntegerList, Range: Range{Min: 1}},
+	"max_connections":           {Kind: Integer, Range: Range{Min: 1}},
+	"source_ips":                {Kind: StringList, Pattern: regexp.MustCompile(`^[0-9A-Fa-f:.]+(/[0-9]{1,3})?$`)},
+	"eviction_policy": {Kind: String, Values: []string{
+		"noeviction", "allkeys-lru", "allkeys-lfu", "allkeys-random",
+		"volatile-lru", "volatile-lfu", "volatile-random", "volatile-ttl",
+	}},
+}
+
+// Validate checks the parameters against Known and returns them with
+// values converted to their kind, e.g. "1024" to 1024 for integers.
+// The ranges narrow the ranges of Known, e.g. to the memory sizes a
+// plan allows. All problems are reported at once in an error that can
+// be shown to developers.
+func Validate(params map[string]interface{}, ranges map[string]Range) (map[string]interface{}, error) {
+	names := []string{}
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	valid := map[string]interface{}{}
+	problems := []string{}
+	for _, name := range names {
+		parameter, ok := Known[name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("unknown parameter %q", name))
+			continue
+		}
+		value, err := parameter.convert(params[name])
+		if err == nil {
+			err = parameter.check(value, ranges[name])
+		}
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("parameter %q %s", name, err))
+			continue
+		}
+		valid[name] = value
+	}
+
+	if len(problems) > 0 {
+		return nil, brokererrors.NewBadRequest("invalid parameters: " + strings.Join(problems, "; "))
+	}
+	return valid, nil
+}
+
+func (p Parameter) convert(value interface{}) (interface{}, error) {
+	switch p.Kind {
+	case Integer:
+		if i, ok := toInteger(value); ok {
+			return i, nil
+		}
+		return nil, fmt.Errorf("must be an integer")
+	case Boolean:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			if b, err := strconv.ParseBool(v); err == nil {
+				return b, nil
+			}
+		}
+		return nil, fmt.Errorf("must be true or false")
+	case IntegerList:
+		items, ok := toList(value)
+		if !ok {
+			return nil, fmt.Errorf("must be a list of integers")
+		}
+		list := []int64{}
+		for _, item := range items {
+			i, ok := toInteger(item)
+			if !ok {
+				return nil, fmt.Errorf("must be a list of integers")
+			}
+			list = append(list, i)
+		}
+		return list, nil
+	case StringList:
+		items, ok := toList(value)
+		if !ok {
+			return nil, fmt.Errorf("must be a list of strings")
+		}
+		list := []string{}
+		for _, item := range items {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("must be a list of strings")
+			}
+			list = append(list, s)
+		}
+		return list, nil
+	default:
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+		return nil, fmt.Errorf("must be a string")
+	}
+}
+
+func (p Parameter) check(value interface{}, narrowed Range) error {
+	switch v := value.(type) {
+	case []int64:
+		if len(v) == 0 {
+			return fmt.Errorf("must not be empty")
+		}
+		for _, item := range v {
+			if err := p.check(item, narrowed); err != nil {
+				return err
+			}
+		}
+	case []string:
+		for _, item := range v {
+			if err := p.check(item, narrowed); err != nil {
+				return err
+			}
+		}
+	case int64:
+		for _, r := range []Range{p.Range, narrowed} {
+			if r.Min != 0 && v < r.Min {
+				return fmt.Errorf("must be at least %d", r.Min)
+			}
+			if r.Max != 0 && v > r.Max {
+				return fmt.Errorf("must be at most %d", r.Max)
+			}
+		}
+	case string:
+		if p.Pattern != nil && !p.Pattern.MatchString(v) {
+			return fmt.Errorf("must match %s", p.Pattern)
+		}
+		if len(p.Values) == 0 {
+			return nil
+		}
+		for _, allowed := range p.Values {
+			if v == allowed {
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of %s", strings.Join(p.Values, ", "))
+	}
+	return nil
+}
+
+// toList splits comma-separated strings, an empty string is an empty
+// list.
+func toList(value interface{}) ([]interface{}, bool) {
+	switch v := value.(type) {
+	case []interface{}:
+		return v, true
+	case string:
+		items := []interface{}{}
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		return items, true
+	}
+	return nil, false
+}
+
+func toInteger(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int64:
+		return v, true
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < math.MaxInt64 {
+			return int64(v), true
+		}
+	case json.Number:
+		i, err := v.Int64()
+		return i, err == nil
+	case string:
+		i, err := strconv.ParseInt(v, 10, 64)
+		return i, err == nil
+	}
+	return 0, false
+}
+
+// CheckAllowed rejects the parameters missing from the allowed list.
+// A nil list allows all the parameters.
+func CheckAllowed(params map[string]interface{}, allowed []string) error {
+	if allowed == nil {
+		return nil
+	}
+	permitted := map[string]bool{}
+	for _, name := range allowed {
+		permitted[name] = true
+	}
+
+	denied := []string{}
+	for name := range params {
+		if !permitted[name] {
+			denied = append(denied, fmt.Sprintf("%q", name))
+		}
+	}
+	if len(denied) == 0 {
+		return nil
+	}
+	sort.Strings(denied)
+	return brokererrors.NewBadRequest("the plan does not allow to set " + strings.Join(denied, ", "))
+}
@@ -0,0 +1,95 @@
+package params_test
+
+import (
+	"net/http"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/brokererrors"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/params"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Validate", func() {
+	It("Converts values to their kind", func() {
+		valid, err := params.Validate(map[string]interface{}{
+			"name":             "db",
+			"memory_size":      "1024",
+			"shards_count":     float64(2),
+			"replication":      "true",
+			"data_persistence": "aof",
+		}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(valid).To(Equal(map[string]interface{}{
+			"name":             "db",
+			"memory_size":      int64(1024),
+			"shards_count":     int64(2),
+			"replication":      true,
+			"data_persistence": "aof",
+		}))
+	})
+
+	It("Reports all the problems as a bad request", func() {
+		_, err := params.Validate(map[string]interface{}{
+			"memory_size":      1.5,
+			"data_persistence": "always",
+			"port":             80,
+			"color":            "red",
+		}, nil)
+		Expect(err).To(HaveOccurred())
+		Expect(err.(*brokererrors.Error).StatusCode).To(Equal(http.StatusBadRequest))
+		Expect(err.Error()).To(Equal(`invalid parameters: unknown parameter "color"; ` +
+			`parameter "data_persistence" must be one of disabled, aof, snapshot; ` +
+			`parameter "memory_size" must be an integer; ` +
+			`parameter "port" must be at least 10000`))
+	})
+
+	It("Accepts lists of integers as arrays and comma-separated strings", func() {
+		valid, err := params.Validate(map[string]interface{}{"nodes": []interface{}{float64(1), "2"}}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(valid["nodes"]).To(Equal([]int64{1, 2}))
+
+		valid, err = params.Validate(map[string]interface{}{"nodes": "3, 4"}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(valid["nodes"]).To(Equal([]int64{3, 4}))
+
+		_, err = params.Validate(map[string]interface{}{"nodes": []interface{}{0}}, nil)
+		Expect(err).To(MatchError(ContainSubstring(`parameter "nodes" must be at least 1`)))
+		_, err = params.Validate(map[string]interface{}{"nodes": []interface{}{}}, nil)
+		Expect(err).To(MatchError(ContainSubstring(`parameter "nodes" must not be empty`)))
+		_, err = params.Validate(map[string]interface{}{"nodes": "one"}, nil)
+		Expect(err).To(MatchError(ContainSubstring(`parameter "nodes" must be a list of integers`)))
+	})
+
+	It("Checks the items of string lists against the pattern", func() {
+		valid, err := params.Validate(map[string]interface{}{"source_ips": []interface{}{"10.0.0.0/16", "192.168.1.7"}}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(valid["source_ips"]).To(Equal([]string{"10.0.0.0/16", "192.168.1.7"}))
+
+		valid, err = params.Validate(map[string]interface{}{"source_ips": ""}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(valid["source_ips"]).To(BeEmpty())
+
+		_, err = params.Validate(map[string]interface{}{"source_ips": []interface{}{"example.com"}}, nil)
+		Expect(err).To(MatchError(ContainSubstring(`parameter "source_ips" must match`)))
+	})
+
+	It("Applies the narrowed ranges", func() {
+		ranges := map[string]params.Range{"memory_size": {Min: 100, Max: 200}}
+		_, err := params.Validate(map[string]interface{}{"memory_size": 50}, ranges)
+		Expect(err).To(MatchError(ContainSubstring("must be at least 100")))
+		_, err = params.Validate(map[string]interface{}{"memory_size": 150}, ranges)
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
+
+var _ = Describe("CheckAllowed", func() {
+	It("Allows all the parameters without a list", func() {
+		Expect(params.CheckAllowed(map[string]interface{}{"port": 10001}, nil)).To(Succeed())
+	})
+
+	It("Rejects the parameters missing from the list", func() {
+		err := params.CheckAllowed(map[string]interface{}{"port": 10001, "name": "db"}, []string{"name"})
+		Expect(err).To(MatchError(`the plan does not allow to set "port"`))
+	})
+})
@@ -0,0 +1,8 @@
+package passwords
+
+import "errors"
+
+var (
+	ErrUnknownCharacterClass = errors.New("the password policy refers to an unknown character class")
+	ErrPolicyTooShort        = errors.New("the password policy length is less than the number of required character classes")
+)
@@ -0,0 +1,13 @@
+package passwords_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestPasswords(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Passwords Suite")
+}
@@ -0,0 +1,85 @@
+package passwords
+
+import (
+	"crypto/rand"
+	"math/big"
+)
+
+// Character classes a password policy may require.
+const (
+	Lowercase = "lowercase"
+	Uppercase = "uppercase"
+	Digits    = "digits"
+	Symbols   = "symbols"
+)
+
+var (
+	// AllCharacterClasses are used by a policy that lists no classes.
+	AllCharacterClasses = []string{Lowercase, Uppercase, Digits, Symbols}
+
+	characterClasses = map[string][]byte{
+		Lowercase: []byte("abcdefghijklmnopqrstuvwxyz"),
+		Uppercase: []byte("ABCDEFGHIJKLMNOPQRSTUVWXYZ"),
+		Digits:    []byte("0123456789"),
+		Symbols:   []byte("!@#$%^*()-_=+,.?/:;{}[]`~"),
+	}
+)
+
+// Policy describes the passwords to generate.
+type Policy struct {
+	Length int
+	// Classes are the character classes a password consists of. Every
+	// one of them is present at least once.
+	Classes []string
+}
+
+// Generate returns a randomly generated password that follows the policy.
+func (p Policy) Generate() (string, error) {
+	classes := p.Classes
+	if len(classes) == 0 {
+		classes = AllCharacterClasses
+	}
+	if p.Length < len(classes) {
+		return "", ErrPolicyTooShort
+	}
+
+	all := []byte{}
+	pass := []byte{}
+	for _, class := range classes {
+		chars, ok := characterClasses[class]
+		if !ok {
+			return "", ErrUnknownCharacterClass
+		}
+		all = append(all, chars...)
+		c, err := pick(chars)
+		if err != nil {
+			return "", err
+		}
+		pass = append(pass, c)
+	}
+	for len(pass) < p.Length {
+		c, err := pick(all)
+		if err != nil {
+			return "", err
+		}
+		pass = append(pass, c)
+	}
+
+	// Shuffle so that the required characters are not always in front.
+	for i := len(pass) - 1; i > 0; i-- {
+		j, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return "", err
+		}
+		pass[i], pass[j.Int64()] = pass[j.Int64()], pass[i]
+	}
+	return string(pass), nil
+}
+
+func pick(chars []byte) (byte, error) {
+	pos, err := rand.Int(rand.Reader, big.NewInt(int64(len(chars))))
+	if err != nil {
+		return 0, err
+	}
+	return chars[pos.Int64()], nil
+}
@@ -0,0 +1,42 @@
+package passwords_test
+
+import (
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/passwords"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Password policy", func() {
+	It("Uses every character class by default", func() {
+		for i := 0; i < 20; i++ {
+			password, err := passwords.Policy{Length: 4}.Generate()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(password).To(HaveLen(4))
+			Expect(password).To(MatchRegexp(`[a-z]`))
+			Expect(password).To(MatchRegexp(`[A-Z]`))
+			Expect(password).To(MatchRegexp(`[0-9]`))
+			Expect(password).To(MatchRegexp(`[^a-zA-Z0-9]`))
+		}
+	})
+
+	It("Restricts the password to the given classes", func() {
+		policy := passwords.Policy{
+			Length:  32,
+			Classes: []string{passwords.Lowercase, passwords.Digits},
+		}
+		password, err := policy.Generate()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(password).To(MatchRegexp(`^[a-z0-9]{32}$`))
+	})
+
+	It("Rejects unknown classes", func() {
+		_, err := passwords.Policy{Length: 8, Classes: []string{"emoji"}}.Generate()
+		Expect(err).To(Equal(passwords.ErrUnknownCharacterClass))
+	})
+
+	It("Rejects a length that cannot fit every class", func() {
+		_, err := passwords.Policy{Length: 3}.Generate()
+		Expect(err).To(Equal(passwords.ErrPolicyTooShort))
+	})
+})
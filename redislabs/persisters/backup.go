@@ -0,0 +1,48 @@
+package persisters
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+var (
+	ErrStateNotEmpty = errors.New("the broker state already has service instances")
+)
+
+// Export writes the complete broker state as a single JSON document
+// that Import accepts, e.g. to back the broker up or to move it to
+// another VM.
+func Export(persister StatePersister, w io.Writer) error {
+	s, _, err := persister.Load()
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(s)
+}
+
+// Import replaces the broker state with a document written by Export.
+// States exported by earlier broker versions are migrated first, as far as
+// they can be; the persister finishes deferred migrations. Unless
+// overwrite is set, a state that has service instances is not replaced.
+func Import(persister StatePersister, r io.Reader, migrations []Migration, overwrite bool) error {
+	s := State{}
+	if err := json.NewDecoder(r).Decode(&s); err != nil {
+		return err
+	}
+	if err := Migrate(&s, migrations); err != nil && err != ErrMigrationDeferred {
+		return err
+	}
+	if !overwrite {
+		current, _, err := persister.Load()
+		if err != nil {
+			return err
+		}
+		if len(current.AvailableInstances) > 0 {
+			return ErrStateNotEmpty
+		}
+	}
+	// The state replaces whatever is saved.
+	_, err := persister.Save(&s, AnyRevision)
+	return err
+}
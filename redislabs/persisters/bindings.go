@@ -0,0 +1,69 @@
+package persisters
+
+import "time"
+
+// Binding is a binding of an app to a service instance. The credentials
+// are not recorded, only a fingerprint to tell them apart, except for the
+// password of a dedicated user.
+type Binding struct {
+	ID                     string
+	InstanceID             string
+	AppGUID                string
+	CreatedAt              time.Time
+	CredentialsFingerprint string
+	// Parameters are the ones the binding was created with.
+	Parameters map[string]interface{}
+	// Password is the one of the user of the binding, empty if the
+	// binding shares the credentials of the database. With the
+	// parameters it lets a repeated binding get the same credentials.
+	Password string
+}
+
+// AddBinding records the binding, replacing a binding with the same ID.
+func (s *State) AddBinding(binding Binding) {
+	s.RemoveBinding(binding.ID)
+	s.Bindings = append(s.Bindings, binding)
+}
+
+// RemoveBinding forgets the binding with the ID, if there is one.
+func (s *State) RemoveBinding(ID string) {
+	bindings := []Binding{}
+	for _, binding := range s.Bindings {
+		if binding.ID != ID {
+			bindings = append(bindings, binding)
+		}
+	}
+	s.Bindings = bindings
+}
+
+// FindBinding returns the binding with the ID.
+func (s *State) FindBinding(ID string) (Binding, bool) {
+	for _, binding := range s.Bindings {
+		if binding.ID == ID {
+			return binding, true
+		}
+	}
+	return Binding{}, false
+}
+
+// InstanceBindings returns the bindings of the instance.
+func (s *State) InstanceBindings(instanceID string) []Binding {
+	bindings := []Binding{}
+	for _, binding := range s.Bindings {
+		if binding.InstanceID == instanceID {
+			bindings = append(bindings, binding)
+		}
+	}
+	return bindings
+}
+
+// RemoveInstanceBindings forgets the bindings of the instance.
+func (s *State) RemoveInstanceBindings(instanceID string) {
+	bindings := []Binding{}
+	for _, binding := range s.Bindings {
+		if binding.InstanceID != instanceID {
+			bindings = append(bindings, binding)
+		}
+	}
+	s.Bindings = bindings
+}
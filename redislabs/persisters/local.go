@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
 	"sync"
 )
 
@@ -12,6 +13,17 @@ var (
 	stateFileMask = os.FileMode(0777)
 )
 
+// savedState is the content of the state file, the state along with a
+// counter of its saves.
+type savedState struct {
+	*State
+	Revision int64
+}
+
+func localRevision(count int64) Revision {
+	return Revision(strconv.FormatInt(count, 10))
+}
+
 // Local implements StatePersister and stores the broker state
 // in a JSON file in the file system.
 type local struct {
@@ -21,53 +33,77 @@ type local struct {
 
 // Load loads the state from the local JSON file. If such file
 // does not exist (no Save has been made to date) it returns an empty state.
-func (l *local) Load() (*State, error) {
+func (l *local) Load() (*State, Revision, error) {
 	l.lock.Lock()
 	defer l.lock.Unlock()
 
 	// Return an empty state if the file does not exist.
 	if _, err := os.Stat(l.stateFilePath); os.IsNotExist(err) {
-		return &State{}, nil
+		return &State{}, localRevision(0), nil
 	}
 
 	bytes, err := ioutil.ReadFile(l.stateFilePath)
 	if err != nil {
-		return nil, err
+		return nil, AnyRevision, err
 	}
-	s := State{}
-	err = json.Unmarshal(bytes, &s)
+	saved := savedState{State: &State{}}
+	err = json.Unmarshal(bytes, &saved)
 	if err != nil {
-		return nil, err
+		return nil, AnyRevision, err
 	}
-	return &s, nil
+	return saved.State, localRevision(saved.Revision), nil
 }
 
 // Save saves the state to the local JSON file. It creates it if it does not
 // exist.
-func (l *local) Save(s *State) error {
+func (l *local) Save(s *State, revision Revision) (Revision, error) {
 	l.lock.Lock()
 	defer l.lock.Unlock()
 
+	current, err := l.revision()
+	if err != nil {
+		return AnyRevision, err
+	}
+	if revision != AnyRevision && revision != localRevision(current) {
+		return AnyRevision, ErrConflict
+	}
+
 	stateFileFolder, err := filepath.Abs(filepath.Dir(l.stateFilePath))
 	if err != nil {
-		return err
+		return AnyRevision, err
 	}
 
 	err = os.MkdirAll(stateFileFolder, stateFileMask)
 	if err != nil {
-		return err
+		return AnyRevision, err
 	}
 
-	bytes, err := json.Marshal(s)
+	bytes, err := json.Marshal(savedState{State: s, Revision: current + 1})
 	if err != nil {
-		return err
+		return AnyRevision, err
 	}
 
 	err = ioutil.WriteFile(l.stateFilePath, bytes, stateFileMask)
 	if err != nil {
-		return err
+		return AnyRevision, err
+	}
+	return localRevision(current + 1), nil
+}
+
+// revision returns the revision of the saved state, 0 if there is none.
+func (l *local) revision() (int64, error) {
+	bytes, err := ioutil.ReadFile(l.stateFilePath)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var saved struct{ Revision int64 }
+	if err = json.Unmarshal(bytes, &saved); err != nil {
+		return 0, err
 	}
-	return nil
+	return saved.Revision, nil
 }
 
 func NewLocalPersister(path string) StatePersister {
@@ -0,0 +1,98 @@
+package persisters
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var (
+	// ErrMigrationDeferred is returned by migrations that can not run
+	// yet, e.g. while the cluster is unreachable. The state keeps the
+	// version it reached and is migrated again on the next load or save.
+	ErrMigrationDeferred = errors.New("the migration of the state is deferred")
+)
+
+// Migration upgrades a state by one layout version. The migration at
+// index i of a migration list upgrades a state of version i to i+1.
+type Migration func(s *State) error
+
+type migrating struct {
+	persister  StatePersister
+	migrations []Migration
+	lock       sync.Mutex
+}
+
+// NewMigratingPersister wraps a persister so that states saved by
+// earlier broker versions are upgraded on load. A migrated state is
+// saved right away, so every migration runs once. Saved states are
+// stamped with the latest version, unless a migration is deferred.
+func NewMigratingPersister(persister StatePersister, migrations []Migration) StatePersister {
+	return &migrating{
+		persister:  persister,
+		migrations: migrations,
+	}
+}
+
+func (m *migrating) Load() (*State, Revision, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	s, revision, err := m.persister.Load()
+	if err != nil {
+		return nil, AnyRevision, err
+	}
+	if s.Version == len(m.migrations) {
+		return s, revision, nil
+	}
+	if len(s.AvailableInstances) == 0 && s.Version < len(m.migrations) {
+		s.Version = len(m.migrations)
+		return s, revision, nil
+	}
+
+	version := s.Version
+	err = Migrate(s, m.migrations)
+	if err == ErrMigrationDeferred && s.Version == version {
+		return s, revision, nil
+	}
+	if err != nil && err != ErrMigrationDeferred {
+		return nil, AnyRevision, err
+	}
+	if revision, err = m.persister.Save(s, revision); err != nil {
+		return nil, AnyRevision, err
+	}
+	return s, revision, nil
+}
+
+func (m *migrating) Save(s *State, revision Revision) (Revision, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	// A state whose migration was deferred gets another chance.
+	if s.Version < len(m.migrations) && len(s.AvailableInstances) > 0 {
+		if err := Migrate(s, m.migrations); err != nil && err != ErrMigrationDeferred {
+			return AnyRevision, err
+		}
+	} else {
+		s.Version = len(m.migrations)
+	}
+	return m.persister.Save(s, revision)
+}
+
+// Migrate upgrades the state to the latest version by applying the
+// migrations it has not seen yet. It stops at a deferred migration and
+// returns ErrMigrationDeferred.
+func Migrate(s *State, migrations []Migration) error {
+	if s.Version > len(migrations) {
+		return fmt.Errorf("the state version %d is newer than the latest known version %d", s.Version, len(migrations))
+	}
+	for s.Version < len(migrations) {
+		if err := migrations[s.Version](s); err == ErrMigrationDeferred {
+			return err
+		} else if err != nil {
+			return fmt.Errorf("failed to migrate the state to version %d: %s", s.Version+1, err)
+		}
+		s.Version++
+	}
+	return nil
+}
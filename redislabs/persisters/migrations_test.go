@@ -0,0 +1,144 @@
+package persisters_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/persisters"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Migrating persister", func() {
+	var (
+		tmpStateDir string
+		local       persisters.StatePersister
+		applied     []int
+		migrations  []persisters.Migration
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpStateDir, err = ioutil.TempDir("", "redislabs-state-test")
+		Expect(err).NotTo(HaveOccurred())
+		local = persisters.NewLocalPersister(path.Join(tmpStateDir, "state.json"))
+
+		applied = []int{}
+		migrations = []persisters.Migration{
+			func(s *persisters.State) error {
+				applied = append(applied, 1)
+				s.AvailableInstances[0].Credentials.Host = "example.com"
+				return nil
+			},
+			func(s *persisters.State) error {
+				applied = append(applied, 2)
+				return nil
+			},
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpStateDir)
+	})
+
+	Context("Given a state saved before versions were recorded", func() {
+		BeforeEach(func() {
+			_, err := local.Save(&persisters.State{
+				AvailableInstances: []persisters.ServiceInstance{{ID: "test-id"}},
+			}, persisters.AnyRevision)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Applies all the migrations once and saves the result", func() {
+			persister := persisters.NewMigratingPersister(local, migrations)
+			state, revision, err := persister.Load()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(state.Version).To(Equal(2))
+			Expect(state.AvailableInstances[0].Credentials.Host).To(Equal("example.com"))
+			_, err = persister.Save(state, revision)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, _, err = persister.Load()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(applied).To(Equal([]int{1, 2}))
+
+			saved, _, err := local.Load()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(saved.Version).To(Equal(2))
+		})
+
+		It("Loads the state when a migration is deferred and retries it on save", func() {
+			deferred := true
+			migrations[1] = func(s *persisters.State) error {
+				if deferred {
+					return persisters.ErrMigrationDeferred
+				}
+				applied = append(applied, 2)
+				return nil
+			}
+			persister := persisters.NewMigratingPersister(local, migrations)
+			state, revision, err := persister.Load()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(state.Version).To(Equal(1))
+			Expect(state.AvailableInstances[0].Credentials.Host).To(Equal("example.com"))
+
+			deferred = false
+			_, err = persister.Save(state, revision)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(applied).To(Equal([]int{1, 2}))
+			saved, _, err := local.Load()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(saved.Version).To(Equal(2))
+		})
+
+		It("Leaves the state untouched when a migration fails", func() {
+			migrations[1] = func(s *persisters.State) error {
+				return errors.New("cluster unavailable")
+			}
+			_, _, err := persisters.NewMigratingPersister(local, migrations).Load()
+			Expect(err).To(MatchError(ContainSubstring("cluster unavailable")))
+
+			saved, _, err := local.Load()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(saved.Version).To(Equal(0))
+			Expect(saved.AvailableInstances[0].Credentials.Host).To(BeEmpty())
+		})
+	})
+
+	Context("Given a state saved at an intermediate version", func() {
+		It("Applies only the newer migrations", func() {
+			_, err := local.Save(&persisters.State{
+				Version:            1,
+				AvailableInstances: []persisters.ServiceInstance{{ID: "test-id"}},
+			}, persisters.AnyRevision)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, _, err = persisters.NewMigratingPersister(local, migrations).Load()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(applied).To(Equal([]int{2}))
+		})
+	})
+
+	Context("Given a state saved by a newer broker", func() {
+		It("Refuses to load it", func() {
+			_, err := local.Save(&persisters.State{Version: 3}, persisters.AnyRevision)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, _, err = persisters.NewMigratingPersister(local, migrations).Load()
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	It("Stamps saved states with the latest version", func() {
+		persister := persisters.NewMigratingPersister(local, migrations)
+		_, err := persister.Save(&persisters.State{}, persisters.AnyRevision)
+		Expect(err).NotTo(HaveOccurred())
+
+		saved, _, err := local.Load()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(saved.Version).To(Equal(2))
+	})
+})
@@ -40,12 +40,59 @@ var _ = Describe("Persisters", func() {
 				Expect(err).NotTo(HaveOccurred())
 				defer os.RemoveAll(tmpStateDir)
 				local := persisters.NewLocalPersister(path.Join(tmpStateDir, "state.json"))
-				err = local.Save(&state)
+				_, err = local.Save(&state, persisters.AnyRevision)
 				Expect(err).NotTo(HaveOccurred())
-				loaded, err := local.Load()
+				loaded, _, err := local.Load()
 				Expect(err).NotTo(HaveOccurred())
 				Expect(loaded).To(Equal(&state))
 			})
 		})
+		Context("Given a state file saved by an earlier broker version", func() {
+			It("Loads the instances without a plan and parameters", func() {
+				tmpStateDir, err := ioutil.TempDir("", "redislabs-state-test")
+				Expect(err).NotTo(HaveOccurred())
+				defer os.RemoveAll(tmpStateDir)
+				statePath := path.Join(tmpStateDir, "state.json")
+				err = ioutil.WriteFile(statePath, []byte(`{"AvailableInstances":[{"ID":"test-id","Credentials":{"UID":1,"Port":11909}}]}`), 0600)
+				Expect(err).NotTo(HaveOccurred())
+
+				loaded, _, err := persisters.NewLocalPersister(statePath).Load()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(loaded.AvailableInstances).To(HaveLen(1))
+				instance := loaded.AvailableInstances[0]
+				Expect(instance.ID).To(Equal("test-id"))
+				Expect(instance.Credentials.UID).To(Equal(1))
+				Expect(instance.PlanID).To(BeEmpty())
+				Expect(instance.Parameters).To(BeNil())
+				Expect(instance.CreatedAt.IsZero()).To(BeTrue())
+			})
+		})
+	})
+
+	Describe("Removing an instance", func() {
+		BeforeEach(func() {
+			state.DeletedInstances = []persisters.ServiceInstance{{ID: "deleted-id"}}
+			state.AddBinding(persisters.Binding{ID: "binding-id", InstanceID: "test-id"})
+			state.AddBinding(persisters.Binding{ID: "other-binding-id", InstanceID: "other-id"})
+		})
+
+		It("Forgets an available instance and its bindings", func() {
+			Expect(state.RemoveInstance("test-id")).To(BeTrue())
+			Expect(state.AvailableInstances).To(BeEmpty())
+			Expect(state.DeletedInstances).To(HaveLen(1))
+			Expect(state.Bindings).To(ConsistOf(persisters.Binding{ID: "other-binding-id", InstanceID: "other-id"}))
+		})
+
+		It("Forgets a deleted instance", func() {
+			Expect(state.RemoveInstance("deleted-id")).To(BeTrue())
+			Expect(state.DeletedInstances).To(BeEmpty())
+			Expect(state.AvailableInstances).To(HaveLen(1))
+		})
+
+		It("Reports unknown instances", func() {
+			Expect(state.RemoveInstance("unknown-id")).To(BeFalse())
+			Expect(state.AvailableInstances).To(HaveLen(1))
+			Expect(state.Bindings).To(HaveLen(2))
+		})
 	})
 })
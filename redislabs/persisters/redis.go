@@ -0,0 +1,149 @@
+package persisters
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/resp"
+)
+
+var (
+	DefaultRedisKeyPrefix = "redislabs-broker:"
+	RedisTimeout          = 10 * time.Second
+)
+
+// Leaser grants named leases to one holder at a time. Persisters that
+// brokers can share implement it, so that the brokers can elect a
+// leader.
+type Leaser interface {
+	// AcquireLease grants or renews the lease for ttl unless another
+	// holder has it.
+	AcquireLease(name string, holder string, ttl time.Duration) (bool, error)
+}
+
+// saveScript saves the state given as ARGV[2] if the revision is still
+// ARGV[1], or if ARGV[1] is empty, and returns the new revision.
+const saveScript = `
+local revision = tonumber(redis.call('GET', KEYS[2]) or '0')
+if ARGV[1] ~= '' and tonumber(ARGV[1]) ~= revision then
+	return redis.error_reply('CONFLICT')
+end
+redis.call('SET', KEYS[1], ARGV[2])
+return redis.call('INCR', KEYS[2])
+`
+
+// leaseScript grants the lease KEYS[1] to ARGV[1] for ARGV[2]
+// milliseconds unless somebody else holds it.
+const leaseScript = `
+local holder = redis.call('GET', KEYS[1])
+if holder and holder ~= ARGV[1] then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+return 1
+`
+
+// redisPersister stores the broker state as a JSON document in a Redis
+// database, next to a counter of its revisions.
+type redisPersister struct {
+	conf   config.RedisStateConfig
+	prefix string
+	lock   sync.Mutex
+	conn   *resp.Conn
+}
+
+func NewRedisPersister(conf config.RedisStateConfig) StatePersister {
+	prefix := conf.KeyPrefix
+	if prefix == "" {
+		prefix = DefaultRedisKeyPrefix
+	}
+	return &redisPersister{
+		conf:   conf,
+		prefix: prefix,
+	}
+}
+
+// Load returns an empty state if none has been saved yet.
+func (r *redisPersister) Load() (*State, Revision, error) {
+	reply, err := r.do("MGET", r.prefix+"state", r.prefix+"revision")
+	if err != nil {
+		return nil, AnyRevision, err
+	}
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != 2 {
+		return nil, AnyRevision, fmt.Errorf("unexpected reply to MGET: %v", reply)
+	}
+
+	s := State{}
+	if document, ok := values[0].(string); ok {
+		if err = json.Unmarshal([]byte(document), &s); err != nil {
+			return nil, AnyRevision, err
+		}
+	}
+	revision := Revision("0")
+	if saved, ok := values[1].(string); ok {
+		revision = Revision(saved)
+	}
+	return &s, revision, nil
+}
+
+func (r *redisPersister) Save(s *State, revision Revision) (Revision, error) {
+	document, err := json.Marshal(s)
+	if err != nil {
+		return AnyRevision, err
+	}
+	reply, err := r.do("EVAL", saveScript, "2", r.prefix+"state", r.prefix+"revision",
+		string(revision), string(document))
+	if err == resp.Error("CONFLICT") {
+		return AnyRevision, ErrConflict
+	}
+	if err != nil {
+		return AnyRevision, err
+	}
+	saved, ok := reply.(int64)
+	if !ok {
+		return AnyRevision, fmt.Errorf("unexpected reply to the save: %v", reply)
+	}
+	return Revision(strconv.FormatInt(saved, 10)), nil
+}
+
+func (r *redisPersister) AcquireLease(name string, holder string, ttl time.Duration) (bool, error) {
+	reply, err := r.do("EVAL", leaseScript, "1", r.prefix+"lease:"+name,
+		holder, strconv.FormatInt(int64(ttl/time.Millisecond), 10))
+	if err != nil {
+		return false, err
+	}
+	return reply == int64(1), nil
+}
+
+// do sends a command over the connection, which is established on first
+// use and again after network errors.
+func (r *redisPersister) do(args ...string) (interface{}, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.conn == nil {
+		conn, err := resp.Dial(r.conf.Address, r.conf.TLS, RedisTimeout)
+		if err != nil {
+			return nil, err
+		}
+		if r.conf.Password != "" {
+			if err = conn.Auth("", r.conf.Password); err != nil {
+				conn.Close()
+				return nil, err
+			}
+		}
+		r.conn = conn
+	}
+
+	reply, err := r.conn.Do(args...)
+	if _, replied := err.(resp.Error); err != nil && !replied {
+		r.conn.Close()
+		r.conn = nil
+	}
+	return reply, err
+}
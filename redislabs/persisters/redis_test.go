@@ -0,0 +1,132 @@
+package persisters_test
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/persisters"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// fakeRedis keeps the keys of the broker and runs its scripts: scripts
+// with two keys save the state, scripts with one key acquire leases.
+type fakeRedis struct {
+	lock sync.Mutex
+	keys map[string]string
+}
+
+func (f *fakeRedis) reply(args []string) string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	switch args[0] {
+	case "AUTH":
+		if args[1] != "secret" {
+			return "-WRONGPASS"
+		}
+		return "+OK"
+	case "MGET":
+		reply := "*" + strconv.Itoa(len(args)-1)
+		for _, key := range args[1:] {
+			value, ok := f.keys[key]
+			if ok {
+				reply += "\r\n" + testing.BulkString(&value)
+			} else {
+				reply += "\r\n" + testing.BulkString(nil)
+			}
+		}
+		return reply
+	case "EVAL":
+		if args[2] == "2" {
+			stateKey, revisionKey, expected, document := args[3], args[4], args[5], args[6]
+			revision, _ := strconv.Atoi(f.keys[revisionKey])
+			if expected != "" && expected != strconv.Itoa(revision) {
+				return "-CONFLICT"
+			}
+			f.keys[stateKey] = document
+			f.keys[revisionKey] = strconv.Itoa(revision + 1)
+			return ":" + strconv.Itoa(revision+1)
+		}
+		key, holder := args[3], args[4]
+		if current, ok := f.keys[key]; ok && current != holder {
+			return ":0"
+		}
+		f.keys[key] = holder
+		return ":1"
+	}
+	return "-ERR unknown command"
+}
+
+var _ = Describe("Redis persister", func() {
+	var (
+		fake      *fakeRedis
+		server    *testing.RedisServer
+		persister persisters.StatePersister
+	)
+
+	BeforeEach(func() {
+		fake = &fakeRedis{keys: map[string]string{}}
+		server = testing.NewRedisServer(fake.reply)
+		persister = persisters.NewRedisPersister(config.RedisStateConfig{
+			Address:  server.Address(),
+			Password: "secret",
+		})
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("Returns an empty state if none has been saved", func() {
+		state, _, err := persister.Load()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state).To(Equal(&persisters.State{}))
+	})
+
+	It("Saves the state and loads it back", func() {
+		state := &persisters.State{
+			AvailableInstances: []persisters.ServiceInstance{{ID: "test-id"}},
+		}
+		saved, err := persister.Save(state, persisters.AnyRevision)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fake.keys).To(HaveKey("redislabs-broker:state"))
+
+		loaded, revision, err := persister.Load()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(loaded).To(Equal(state))
+		Expect(revision).To(Equal(saved))
+		Expect(server.Commands()[0]).To(Equal([]string{"AUTH", "secret"}))
+	})
+
+	It("Rejects conflicting saves", func() {
+		first, firstRevision, _ := persister.Load()
+		second, secondRevision, _ := persister.Load()
+		_, err := persister.Save(first, firstRevision)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = persister.Save(second, secondRevision)
+		Expect(err).To(Equal(persisters.ErrConflict))
+	})
+
+	It("Grants a lease to one holder at a time", func() {
+		leaser := persister.(persisters.Leaser)
+		Expect(leaser.AcquireLease("leader", "broker-1", time.Minute)).To(BeTrue())
+		Expect(leaser.AcquireLease("leader", "broker-2", time.Minute)).To(BeFalse())
+		Expect(leaser.AcquireLease("leader", "broker-1", time.Minute)).To(BeTrue())
+	})
+
+	It("Reconnects after the connection is lost", func() {
+		_, _, err := persister.Load()
+		Expect(err).NotTo(HaveOccurred())
+		server.DropConnections()
+		_, _, err = persister.Load()
+		Expect(err).To(HaveOccurred())
+
+		_, _, err = persister.Load()
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
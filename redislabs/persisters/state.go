@@ -1,20 +1,121 @@
 package persisters
 
-import "github.com/RedisLabs/cf-redislabs-broker/redislabs/cluster"
+import (
+	"time"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/cluster"
+)
 
 // StatePersister is responsible for saving & retrieving
 // the broker state, the information about available service
 // instances and their parameters.
+//
+// Load returns the state along with its revision. Save saves a state
+// only if the given revision is still the current one, so that changes
+// of concurrent operations are not lost, and returns the new revision.
+// It fails with ErrConflict otherwise, see Update.
 type StatePersister interface {
-	Save(s *State) error
-	Load() (*State, error)
+	Save(s *State, revision Revision) (Revision, error)
+	Load() (*State, Revision, error)
 }
 
+// Revision identifies a saved version of the state. It is opaque to
+// everybody but the persister that issued it.
+type Revision string
+
+// AnyRevision saves a state regardless of the current revision, e.g. a
+// state that replaces the saved one rather than changing it.
+const AnyRevision Revision = ""
+
 type State struct {
+	// Version is the layout version of the state, see Migration.
+	// States saved before the version was recorded have version 0.
+	Version            int
 	AvailableInstances []ServiceInstance
+	// DeletedInstances were deprovisioned, but their databases are kept
+	// until the retention period passes.
+	DeletedInstances []ServiceInstance
+	// Tasks are the operations in progress, see Task.
+	Tasks []Task
+	// Bindings are the bindings of the available instances. Bindings
+	// created by earlier broker versions are not recorded.
+	Bindings []Binding
 }
 
+// ServiceInstance describes a provisioned instance. Instances saved by
+// earlier broker versions have only the ID and credentials set.
 type ServiceInstance struct {
-	ID          string
+	ID               string
+	PlanID           string
+	ServiceID        string
+	OrganizationGUID string
+	SpaceGUID        string
+	// Parameters holds the parameters supplied by the platform user
+	// on provision, merged with the ones supplied on later updates.
+	Parameters  map[string]interface{}
 	Credentials cluster.InstanceCredentials
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	DeletedAt   time.Time
+	// LastOperation is the latest asynchronous operation on the
+	// instance, nil if there was none.
+	LastOperation *Operation
+	// ExpiringPasswords are the database passwords replaced by a
+	// rotation that stay valid until they expire.
+	ExpiringPasswords []ExpiringPassword
+}
+
+type ExpiringPassword struct {
+	Password  string
+	ExpiresAt time.Time
+}
+
+// Operation is an asynchronous operation the platform polls for via
+// the last operation endpoint.
+type Operation struct {
+	Type string
+	// State is one of the states of the last operation endpoint:
+	// "in progress", "succeeded" or "failed".
+	State       string
+	Description string
+	// PriorActions lists the cluster actions of the database that
+	// existed before the operation started, they are not tracked.
+	PriorActions []string
+	StartedAt    time.Time
+	// ActionSeen tells that a cluster action of the operation has been
+	// seen, until then the operation has not started on the cluster.
+	ActionSeen bool
+}
+
+// FindInstance returns the available or deleted instance with the ID.
+func (s *State) FindInstance(ID string) (ServiceInstance, bool) {
+	for _, instances := range [][]ServiceInstance{s.AvailableInstances, s.DeletedInstances} {
+		for _, instance := range instances {
+			if instance.ID == ID {
+				return instance, true
+			}
+		}
+	}
+	return ServiceInstance{}, false
+}
+
+// RemoveInstance forgets the available or deleted instance with the ID
+// together with its bindings, and reports whether there was one. The
+// database of the instance is left alone.
+func (s *State) RemoveInstance(ID string) bool {
+	_, found := s.FindInstance(ID)
+	s.AvailableInstances = withoutInstance(s.AvailableInstances, ID)
+	s.DeletedInstances = withoutInstance(s.DeletedInstances, ID)
+	s.RemoveInstanceBindings(ID)
+	return found
+}
+
+func withoutInstance(instances []ServiceInstance, ID string) []ServiceInstance {
+	remaining := []ServiceInstance{}
+	for _, instance := range instances {
+		if instance.ID != ID {
+			remaining = append(remaining, instance)
+		}
+	}
+	return remaining
 }
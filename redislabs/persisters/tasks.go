@@ -0,0 +1,39 @@
+package persisters
+
+import "time"
+
+// Task is an operation on the cluster the broker has started but not
+// finished yet. Tasks are recorded in the state, so that a restarted
+// broker can resume them.
+type Task struct {
+	ID   string
+	Kind string
+	// Instance is the service instance the task works on, as it is to
+	// be recorded once the task is finished.
+	Instance    ServiceInstance
+	DatabaseUID int
+	// Async tasks were accepted by the broker and report their progress
+	// as the last operation of the instance.
+	Async bool
+	// Error is set if the task has failed. Failed async tasks are kept
+	// until the failure is reported.
+	Error     string
+	CreatedAt time.Time
+}
+
+// AddTask records the task, replacing a task with the same ID.
+func (s *State) AddTask(task Task) {
+	s.RemoveTask(task.ID)
+	s.Tasks = append(s.Tasks, task)
+}
+
+// RemoveTask forgets the task with the ID, if there is one.
+func (s *State) RemoveTask(ID string) {
+	tasks := []Task{}
+	for _, task := range s.Tasks {
+		if task.ID != ID {
+			tasks = append(tasks, task)
+		}
+	}
+	s.Tasks = tasks
+}
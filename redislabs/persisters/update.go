@@ -0,0 +1,31 @@
+package persisters
+
+import "errors"
+
+var (
+	ErrConflict = errors.New("the broker state has been changed concurrently")
+
+	// MaxUpdateAttempts is how many times Update applies a change
+	// before it gives up on conflicting saves.
+	MaxUpdateAttempts = 5
+)
+
+// Update loads the state, applies change to it and saves it. If the
+// state is saved concurrently in the meantime, it starts over with the
+// new state, so change may run more than once. Errors returned by change
+// abort the update.
+func Update(persister StatePersister, change func(s *State) error) error {
+	for attempt := 1; ; attempt++ {
+		s, revision, err := persister.Load()
+		if err != nil {
+			return err
+		}
+		if err = change(s); err != nil {
+			return err
+		}
+		_, err = persister.Save(s, revision)
+		if err != ErrConflict || attempt >= MaxUpdateAttempts {
+			return err
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package persisters_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/persisters"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Concurrent saves", func() {
+	var (
+		tmpStateDir string
+		persister   persisters.StatePersister
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpStateDir, err = ioutil.TempDir("", "redislabs-state-test")
+		Expect(err).NotTo(HaveOccurred())
+		persister = persisters.NewLocalPersister(path.Join(tmpStateDir, "state.json"))
+		_, err = persister.Save(&persisters.State{}, persisters.AnyRevision)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpStateDir)
+	})
+
+	It("Advances the revision on every save", func() {
+		state, loaded, err := persister.Load()
+		Expect(err).NotTo(HaveOccurred())
+		saved, err := persister.Save(state, loaded)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(saved).NotTo(Equal(loaded))
+
+		_, err = persister.Save(state, saved)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = persister.Save(state, saved)
+		Expect(err).To(Equal(persisters.ErrConflict))
+	})
+
+	It("Rejects a state that was saved by someone else since it was loaded", func() {
+		first, firstRevision, _ := persister.Load()
+		second, secondRevision, _ := persister.Load()
+		first.AvailableInstances = []persisters.ServiceInstance{{ID: "first"}}
+		_, err := persister.Save(first, firstRevision)
+		Expect(err).NotTo(HaveOccurred())
+
+		second.AvailableInstances = []persisters.ServiceInstance{{ID: "second"}}
+		_, err = persister.Save(second, secondRevision)
+		Expect(err).To(Equal(persisters.ErrConflict))
+
+		loaded, _, _ := persister.Load()
+		Expect(loaded.AvailableInstances).To(Equal([]persisters.ServiceInstance{{ID: "first"}}))
+	})
+
+	It("Saves a state regardless of the revision given any revision", func() {
+		_, err := persister.Save(&persisters.State{Tasks: []persisters.Task{{ID: "task"}}}, persisters.AnyRevision)
+		Expect(err).NotTo(HaveOccurred())
+		loaded, _, _ := persister.Load()
+		Expect(loaded.Tasks).To(HaveLen(1))
+	})
+
+	It("Detects conflicting first saves", func() {
+		os.RemoveAll(tmpStateDir)
+		first, firstRevision, _ := persister.Load()
+		second, secondRevision, _ := persister.Load()
+		_, err := persister.Save(first, firstRevision)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = persister.Save(second, secondRevision)
+		Expect(err).To(Equal(persisters.ErrConflict))
+	})
+
+	Describe("Update", func() {
+		It("Applies the change again to a state saved in the meantime", func() {
+			attempts := 0
+			err := persisters.Update(persister, func(s *persisters.State) error {
+				attempts++
+				if attempts == 1 {
+					concurrent, revision, _ := persister.Load()
+					concurrent.AddTask(persisters.Task{ID: "concurrent"})
+					_, err := persister.Save(concurrent, revision)
+					Expect(err).NotTo(HaveOccurred())
+				}
+				s.AddTask(persisters.Task{ID: "update"})
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(attempts).To(Equal(2))
+
+			loaded, _, _ := persister.Load()
+			Expect(loaded.Tasks).To(HaveLen(2))
+		})
+
+		It("Gives up after too many conflicts", func() {
+			attempts := 0
+			err := persisters.Update(persister, func(s *persisters.State) error {
+				attempts++
+				concurrent, revision, _ := persister.Load()
+				_, err := persister.Save(concurrent, revision)
+				Expect(err).NotTo(HaveOccurred())
+				return nil
+			})
+			Expect(err).To(Equal(persisters.ErrConflict))
+			Expect(attempts).To(Equal(persisters.MaxUpdateAttempts))
+		})
+
+		It("Does not save if the change fails", func() {
+			err := persisters.Update(persister, func(s *persisters.State) error {
+				s.AddTask(persisters.Task{ID: "task"})
+				return persisters.ErrStateNotEmpty
+			})
+			Expect(err).To(Equal(persisters.ErrStateNotEmpty))
+			loaded, _, _ := persister.Load()
+			Expect(loaded.Tasks).To(BeEmpty())
+		})
+	})
+})
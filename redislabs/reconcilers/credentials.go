@@ -0,0 +1,123 @@
+package reconcilers
+
+import (
+	"reflect"
+	"sync/atomic"
+	"time"
+
+	"github.com/pivotal-golang/lager"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/apiclient"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/cluster"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/persisters"
+)
+
+// credentialDrifts counts the instances whose recorded credentials were
+// found to differ from their databases since the broker started.
+var credentialDrifts int64
+
+// CredentialDrifts returns the number of drifts the refreshers have
+// corrected since the broker started.
+func CredentialDrifts() int64 {
+	return atomic.LoadInt64(&credentialDrifts)
+}
+
+// CredentialRefresher keeps the recorded credentials of the instances in
+// line with their databases, e.g. after an endpoint migration or a
+// password changed on the cluster, so that new bindings get working
+// credentials.
+type CredentialRefresher struct {
+	apiClient apiclient.Client
+	persister persisters.StatePersister
+	logger    lager.Logger
+	leader    Leader
+}
+
+func NewCredentialRefresher(conf config.Config, persister persisters.StatePersister, logger lager.Logger) *CredentialRefresher {
+	return &CredentialRefresher{
+		apiClient: apiclient.New(conf, logger),
+		persister: persister,
+		logger:    logger,
+	}
+}
+
+// WithLeader makes Run skip the refreshes while another broker leads.
+func (r *CredentialRefresher) WithLeader(leader Leader) *CredentialRefresher {
+	r.leader = leader
+	return r
+}
+
+// Refresh records the host, port, IPs and password of the databases that
+// differ from the credentials of their instances, and returns how many
+// instances drifted. Databases that are not active yet are skipped, and
+// so are the passwords of instances within a rotation grace period.
+func (r *CredentialRefresher) Refresh() (int, error) {
+	databases, err := r.apiClient.ListDatabases()
+	if err != nil {
+		r.logger.Error("Failed to list the databases", err)
+		return 0, err
+	}
+	byUID := map[int]cluster.InstanceCredentials{}
+	for _, db := range databases {
+		if db.Host != "" {
+			byUID[db.UID] = db
+		}
+	}
+
+	drifted := 0
+	err = persisters.Update(r.persister, func(state *persisters.State) error {
+		drifted = 0
+		for i, instance := range state.AvailableInstances {
+			db, ok := byUID[instance.Credentials.UID]
+			if !ok {
+				continue
+			}
+			stored := &state.AvailableInstances[i].Credentials
+			changed := []string{}
+			if db.Host != stored.Host || db.Port != stored.Port {
+				stored.Host, stored.Port = db.Host, db.Port
+				changed = append(changed, "endpoint")
+			}
+			if !reflect.DeepEqual(db.IPList, stored.IPList) && len(db.IPList) > 0 {
+				stored.IPList = db.IPList
+				changed = append(changed, "ip-list")
+			}
+			if db.Password != "" && db.Password != stored.Password && len(instance.ExpiringPasswords) == 0 {
+				stored.Password = db.Password
+				changed = append(changed, "password")
+			}
+			if len(changed) == 0 {
+				continue
+			}
+			drifted++
+			r.logger.Info("Refreshed the drifted credentials of an instance", lager.Data{
+				"instance-id": instance.ID,
+				"UID":         stored.UID,
+				"changed":     changed,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		r.logger.Error("Failed to record the refreshed credentials", err)
+		return 0, err
+	}
+	atomic.AddInt64(&credentialDrifts, int64(drifted))
+	return drifted, nil
+}
+
+// Run refreshes the credentials every interval. It never returns, so it
+// is supposed to be run in a goroutine.
+func (r *CredentialRefresher) Run(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		if !leading(r.leader) {
+			continue
+		}
+
+		if _, err := r.Refresh(); err != nil {
+			r.logger.Error("Failed to refresh the credentials of the instances", err)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package reconcilers_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"time"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/cluster"
+	brokerconfig "github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/persisters"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/reconcilers"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/testing"
+	"github.com/pivotal-golang/lager"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Credential refresher", func() {
+	var (
+		refresher   *reconcilers.CredentialRefresher
+		persister   persisters.StatePersister
+		proxy       testing.HTTPProxy
+		tmpStateDir string
+		logger      = lager.NewLogger("test")
+	)
+
+	database := func(UID int, host string, port int, password string) map[string]interface{} {
+		return map[string]interface{}{
+			"uid":                       UID,
+			"status":                    "active",
+			"authentication_redis_pass": password,
+			"endpoints": []map[string]interface{}{
+				{"dns_name": host, "port": port, "addr": []string{"10.0.0.1"}},
+			},
+		}
+	}
+
+	BeforeEach(func() {
+		var err error
+		tmpStateDir, err = ioutil.TempDir("", "redislabs-state-test")
+		Expect(err).NotTo(HaveOccurred())
+		persister = persisters.NewLocalPersister(path.Join(tmpStateDir, "state.json"))
+		_, err = persister.Save(&persisters.State{
+			AvailableInstances: []persisters.ServiceInstance{
+				{
+					ID:          "unchanged",
+					Credentials: cluster.InstanceCredentials{UID: 1, Host: "redis-1", Port: 12001, IPList: []string{"10.0.0.1"}, Password: "pass-1"},
+				},
+				{
+					ID:          "moved",
+					Credentials: cluster.InstanceCredentials{UID: 2, Host: "redis-2", Port: 12002, IPList: []string{"10.0.0.1"}, Password: "pass-2"},
+				},
+				{
+					ID:          "rotating",
+					Credentials: cluster.InstanceCredentials{UID: 3, Host: "redis-3", Port: 12003, IPList: []string{"10.0.0.1"}, Password: "new"},
+					ExpiringPasswords: []persisters.ExpiringPassword{
+						{Password: "old", ExpiresAt: time.Now().Add(time.Hour)},
+					},
+				},
+			},
+		}, persisters.AnyRevision)
+		Expect(err).NotTo(HaveOccurred())
+
+		proxy = testing.NewHTTPProxy()
+		proxy.RegisterEndpointHandler("/v1/bdbs", func(w http.ResponseWriter, r *http.Request) interface{} {
+			return []map[string]interface{}{
+				database(1, "redis-1", 12001, "pass-1"),
+				database(2, "redis-2.moved", 12020, "changed"),
+				database(3, "redis-3", 12003, "old"),
+				{"uid": 4, "status": "pending"},
+			}
+		})
+		refresher = reconcilers.NewCredentialRefresher(brokerconfig.Config{
+			Cluster: brokerconfig.ClusterConfig{Address: proxy.URL()},
+		}, persister, logger)
+	})
+
+	AfterEach(func() {
+		proxy.Close()
+		os.RemoveAll(tmpStateDir)
+	})
+
+	It("Records the credentials that drifted from the databases", func() {
+		drifts := reconcilers.CredentialDrifts()
+		drifted, err := refresher.Refresh()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(drifted).To(Equal(1))
+		Expect(reconcilers.CredentialDrifts()).To(Equal(drifts + 1))
+
+		state, _, err := persister.Load()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state.AvailableInstances[0].Credentials.Host).To(Equal("redis-1"))
+		moved := state.AvailableInstances[1].Credentials
+		Expect(moved.Host).To(Equal("redis-2.moved"))
+		Expect(moved.Port).To(Equal(12020))
+		Expect(moved.Password).To(Equal("changed"))
+		Expect(state.AvailableInstances[2].Credentials.Password).To(Equal("new"))
+	})
+})
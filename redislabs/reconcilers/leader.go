@@ -0,0 +1,95 @@
+package reconcilers
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/pivotal-golang/lager"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/persisters"
+)
+
+// LeaderLease is the name of the lease held by the leader.
+const LeaderLease = "leader"
+
+// DefaultLeaseTTL is used unless the config says otherwise.
+var DefaultLeaseTTL = 30 * time.Second
+
+// Leader tells whether this broker runs the background tasks.
+type Leader interface {
+	IsLeader() bool
+}
+
+// Elector holds the leader lease as long as it can, so that only one of
+// the brokers sharing a state runs the background tasks.
+type Elector struct {
+	leaser persisters.Leaser
+	holder string
+	ttl    time.Duration
+	leader int32
+	logger lager.Logger
+	// elected is called whenever the broker becomes the leader.
+	elected func()
+}
+
+func NewElector(leaser persisters.Leaser, holder string, ttl time.Duration, logger lager.Logger) *Elector {
+	return &Elector{
+		leaser: leaser,
+		holder: holder,
+		ttl:    ttl,
+		logger: logger.Session("elector", lager.Data{"holder": holder}),
+	}
+}
+
+// OnElected makes the elector call fn every time the broker becomes the
+// leader, e.g. to take over the work of the previous leader. fn is called
+// by Elect, so it is to return quickly.
+func (e *Elector) OnElected(fn func()) *Elector {
+	e.elected = fn
+	return e
+}
+
+func (e *Elector) IsLeader() bool {
+	return atomic.LoadInt32(&e.leader) == 1
+}
+
+// Elect tries to acquire or renew the leader lease. A broker that cannot
+// reach the lease store stops being the leader.
+func (e *Elector) Elect() bool {
+	acquired, err := e.leaser.AcquireLease(LeaderLease, e.holder, e.ttl)
+	if err != nil {
+		e.logger.Error("Failed to acquire the leader lease", err)
+		acquired = false
+	}
+
+	var leader int32
+	if acquired {
+		leader = 1
+	}
+	if atomic.SwapInt32(&e.leader, leader) != leader {
+		if acquired {
+			e.logger.Info("Became the leader")
+			if e.elected != nil {
+				e.elected()
+			}
+		} else {
+			e.logger.Info("Stopped being the leader")
+		}
+	}
+	return acquired
+}
+
+// Run renews the lease well before it expires. It never returns, so it
+// is supposed to be run in a goroutine.
+func (e *Elector) Run() {
+	for {
+		time.Sleep(e.ttl / 3)
+		e.Elect()
+	}
+}
+
+// leading reports whether leader, if any, is the leader. Without a leader
+// the broker is on its own.
+func leading(leader Leader) bool {
+	return leader == nil || leader.IsLeader()
+}
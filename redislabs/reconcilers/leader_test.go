@@ -0,0 +1,73 @@
+package reconcilers_test
+
+import (
+	"errors"
+	"time"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/reconcilers"
+	"github.com/pivotal-golang/lager"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// fakeLeaser grants the lease to the first holder that asks for it.
+type fakeLeaser struct {
+	holder string
+	err    error
+}
+
+func (l *fakeLeaser) AcquireLease(name string, holder string, ttl time.Duration) (bool, error) {
+	if l.err != nil {
+		return false, l.err
+	}
+	if l.holder == "" {
+		l.holder = holder
+	}
+	return l.holder == holder, nil
+}
+
+var _ = Describe("Elector", func() {
+	var (
+		leaser *fakeLeaser
+		logger = lager.NewLogger("test")
+	)
+
+	BeforeEach(func() {
+		leaser = &fakeLeaser{}
+	})
+
+	It("Elects a single leader", func() {
+		first := reconcilers.NewElector(leaser, "broker-1", time.Minute, logger)
+		second := reconcilers.NewElector(leaser, "broker-2", time.Minute, logger)
+		Expect(first.IsLeader()).To(BeFalse())
+
+		Expect(first.Elect()).To(BeTrue())
+		Expect(second.Elect()).To(BeFalse())
+		Expect(first.IsLeader()).To(BeTrue())
+		Expect(second.IsLeader()).To(BeFalse())
+	})
+
+	It("Tells every time the broker becomes the leader", func() {
+		elections := 0
+		elector := reconcilers.NewElector(leaser, "broker-1", time.Minute, logger).OnElected(func() { elections++ })
+		Expect(elector.Elect()).To(BeTrue())
+		Expect(elector.Elect()).To(BeTrue())
+		Expect(elections).To(Equal(1))
+
+		leaser.err = errors.New("connection refused")
+		Expect(elector.Elect()).To(BeFalse())
+		leaser.err = nil
+		Expect(elector.Elect()).To(BeTrue())
+		Expect(elections).To(Equal(2))
+	})
+
+	It("Steps down when the lease cannot be renewed", func() {
+		elector := reconcilers.NewElector(leaser, "broker-1", time.Minute, logger)
+		Expect(elector.Elect()).To(BeTrue())
+
+		leaser.err = errors.New("connection refused")
+		Expect(elector.Elect()).To(BeFalse())
+		Expect(elector.IsLeader()).To(BeFalse())
+	})
+})
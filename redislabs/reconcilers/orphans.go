@@ -0,0 +1,89 @@
+package reconcilers
+
+import (
+	"time"
+
+	"github.com/pivotal-golang/lager"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/apiclient"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/cluster"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/persisters"
+)
+
+// OrphanDetector compares the databases present on the cluster with the
+// broker state and reports the ones no service instance refers to.
+type OrphanDetector struct {
+	apiClient apiclient.Client
+	persister persisters.StatePersister
+	logger    lager.Logger
+	leader    Leader
+}
+
+func NewOrphanDetector(conf config.Config, persister persisters.StatePersister, logger lager.Logger) *OrphanDetector {
+	return &OrphanDetector{
+		apiClient: apiclient.New(conf, logger),
+		persister: persister,
+		logger:    logger,
+	}
+}
+
+// WithLeader makes Run skip the checks while another broker leads.
+func (o *OrphanDetector) WithLeader(leader Leader) *OrphanDetector {
+	o.leader = leader
+	return o
+}
+
+// Orphans returns the cluster databases that are missing in the broker state.
+func (o *OrphanDetector) Orphans() ([]cluster.InstanceCredentials, error) {
+	state, _, err := o.persister.Load()
+	if err != nil {
+		o.logger.Error("Failed to load the broker state", err)
+		return nil, err
+	}
+	databases, err := o.apiClient.ListDatabases()
+	if err != nil {
+		return nil, err
+	}
+
+	known := map[int]bool{}
+	for _, instance := range state.AvailableInstances {
+		known[instance.Credentials.UID] = true
+	}
+	for _, instance := range state.DeletedInstances {
+		known[instance.Credentials.UID] = true
+	}
+	for _, task := range state.Tasks {
+		known[task.DatabaseUID] = true
+	}
+	orphans := []cluster.InstanceCredentials{}
+	for _, db := range databases {
+		if !known[db.UID] {
+			orphans = append(orphans, db)
+		}
+	}
+	return orphans, nil
+}
+
+// Run checks for orphaned databases every interval and logs the ones it
+// finds. It never returns, so it is supposed to be run in a goroutine.
+func (o *OrphanDetector) Run(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		if !leading(o.leader) {
+			continue
+		}
+
+		orphans, err := o.Orphans()
+		if err != nil {
+			o.logger.Error("Failed to check the cluster for orphaned databases", err)
+			continue
+		}
+		for _, db := range orphans {
+			o.logger.Info("Found a database that is not present in the broker state", lager.Data{
+				"UID":  db.UID,
+				"host": db.Host,
+			})
+		}
+	}
+}
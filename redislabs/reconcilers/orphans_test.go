@@ -0,0 +1,99 @@
+package reconcilers_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/cluster"
+	brokerconfig "github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/persisters"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/reconcilers"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/testing"
+	"github.com/pivotal-golang/lager"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Orphan detector", func() {
+	var (
+		detector    *reconcilers.OrphanDetector
+		persister   persisters.StatePersister
+		proxy       testing.HTTPProxy
+		reachable   bool
+		databases   []int
+		tmpStateDir string
+		logger      = lager.NewLogger("test")
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpStateDir, err = ioutil.TempDir("", "redislabs-state-test")
+		Expect(err).NotTo(HaveOccurred())
+		persister = persisters.NewLocalPersister(path.Join(tmpStateDir, "state.json"))
+		_, err = persister.Save(&persisters.State{
+			AvailableInstances: []persisters.ServiceInstance{
+				{ID: "present", Credentials: cluster.InstanceCredentials{UID: 1}},
+				{ID: "gone", Credentials: cluster.InstanceCredentials{UID: 2}},
+			},
+			DeletedInstances: []persisters.ServiceInstance{
+				{ID: "retained", Credentials: cluster.InstanceCredentials{UID: 3}},
+			},
+			Tasks: []persisters.Task{
+				{ID: "creating", DatabaseUID: 4},
+			},
+		}, persisters.AnyRevision)
+		Expect(err).NotTo(HaveOccurred())
+
+		reachable = true
+		databases = []int{1, 3, 4, 5}
+		proxy = testing.NewHTTPProxy()
+		proxy.RegisterEndpointHandler("/v1/bdbs", func(w http.ResponseWriter, r *http.Request) interface{} {
+			if !reachable {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return map[string]interface{}{"error_code": "unavailable", "description": "the cluster is unavailable"}
+			}
+			list := []map[string]interface{}{}
+			for _, UID := range databases {
+				list = append(list, map[string]interface{}{"uid": UID, "status": "active"})
+			}
+			return list
+		})
+		detector = reconcilers.NewOrphanDetector(brokerconfig.Config{
+			Cluster: brokerconfig.ClusterConfig{Address: proxy.URL()},
+		}, persister, logger)
+	})
+
+	AfterEach(func() {
+		proxy.Close()
+		os.RemoveAll(tmpStateDir)
+	})
+
+	It("Reports the databases missing in the state", func() {
+		orphans, err := detector.Orphans()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(orphans).To(HaveLen(1))
+		Expect(orphans[0].UID).To(Equal(5))
+	})
+
+	It("Leaves the instances whose database is gone alone", func() {
+		databases = []int{1, 3, 4}
+		orphans, err := detector.Orphans()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(orphans).To(BeEmpty())
+
+		state, _, err := persister.Load()
+		Expect(err).NotTo(HaveOccurred())
+		_, found := state.FindInstance("gone")
+		Expect(found).To(BeTrue())
+	})
+
+	It("Fails if the cluster can not list its databases", func() {
+		reachable = false
+		orphans, err := detector.Orphans()
+		Expect(err).To(MatchError("the cluster is unavailable"))
+		Expect(orphans).To(BeNil())
+	})
+})
@@ -0,0 +1,101 @@
+package reconcilers
+
+import (
+	"time"
+
+	"github.com/pivotal-golang/lager"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/apiclient"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/persisters"
+)
+
+// PasswordRetirer invalidates the database passwords whose grace period
+// after a rotation has passed.
+type PasswordRetirer struct {
+	apiClient apiclient.Client
+	persister persisters.StatePersister
+	logger    lager.Logger
+	leader    Leader
+}
+
+func NewPasswordRetirer(conf config.Config, persister persisters.StatePersister, logger lager.Logger) *PasswordRetirer {
+	return &PasswordRetirer{
+		apiClient: apiclient.New(conf, logger),
+		persister: persister,
+		logger:    logger,
+	}
+}
+
+// WithLeader makes Run skip the retirements while another broker leads.
+func (r *PasswordRetirer) WithLeader(leader Leader) *PasswordRetirer {
+	r.leader = leader
+	return r
+}
+
+// Retire invalidates the expired passwords. The cluster can only replace
+// all the passwords of a database, so the current password is set and
+// the passwords that have not expired yet are added back.
+func (r *PasswordRetirer) Retire() error {
+	state, _, err := r.persister.Load()
+	if err != nil {
+		r.logger.Error("Failed to load the broker state", err)
+		return err
+	}
+
+	now := time.Now()
+	retired := map[string][]persisters.ExpiringPassword{}
+	for _, instance := range state.AvailableInstances {
+		valid := []persisters.ExpiringPassword{}
+		for _, p := range instance.ExpiringPasswords {
+			if p.ExpiresAt.After(now) {
+				valid = append(valid, p)
+			}
+		}
+		if len(valid) == len(instance.ExpiringPasswords) {
+			continue
+		}
+
+		UID := instance.Credentials.UID
+		if err = r.apiClient.SetDatabasePassword(UID, instance.Credentials.Password); err != nil {
+			r.logger.Error("Failed to retire the expired passwords", err, lager.Data{"instance-id": instance.ID})
+			continue
+		}
+		for _, p := range valid {
+			if err = r.apiClient.AddDatabasePassword(UID, p.Password); err != nil {
+				r.logger.Error("Failed to restore a password in its grace period", err, lager.Data{"instance-id": instance.ID})
+			}
+		}
+		r.logger.Info("Retired the expired passwords", lager.Data{"instance-id": instance.ID})
+		retired[instance.ID] = valid
+	}
+
+	if len(retired) == 0 {
+		return nil
+	}
+	// The state is reloaded since it may have changed while the
+	// passwords were being retired.
+	return persisters.Update(r.persister, func(state *persisters.State) error {
+		for i, instance := range state.AvailableInstances {
+			if valid, ok := retired[instance.ID]; ok {
+				state.AvailableInstances[i].ExpiringPasswords = valid
+			}
+		}
+		return nil
+	})
+}
+
+// Run retires expired passwords every interval. It never returns, so it
+// is supposed to be run in a goroutine.
+func (r *PasswordRetirer) Run(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		if !leading(r.leader) {
+			continue
+		}
+
+		if err := r.Retire(); err != nil {
+			r.logger.Error("Failed to retire the expired passwords", err)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package reconcilers_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"time"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/cluster"
+	brokerconfig "github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/persisters"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/reconcilers"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/testing"
+	"github.com/pivotal-golang/lager"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Password retirer", func() {
+	var (
+		retirer       *reconcilers.PasswordRetirer
+		persister     persisters.StatePersister
+		proxy         testing.HTTPProxy
+		tmpStateDir   string
+		passwordCalls []string
+		logger        = lager.NewLogger("test")
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpStateDir, err = ioutil.TempDir("", "redislabs-state-test")
+		Expect(err).NotTo(HaveOccurred())
+		persister = persisters.NewLocalPersister(path.Join(tmpStateDir, "state.json"))
+
+		passwordCalls = []string{}
+		proxy = testing.NewHTTPProxy()
+		proxy.RegisterEndpointHandler("/v1/bdbs/1/passwords", func(w http.ResponseWriter, r *http.Request) interface{} {
+			var body map[string]string
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				panic(err)
+			}
+			passwordCalls = append(passwordCalls, r.Method+" "+body["password"])
+			return nil
+		})
+
+		conf := brokerconfig.Config{
+			Cluster: brokerconfig.ClusterConfig{Address: proxy.URL()},
+		}
+		retirer = reconcilers.NewPasswordRetirer(conf, persister, logger)
+	})
+
+	AfterEach(func() {
+		proxy.Close()
+		os.RemoveAll(tmpStateDir)
+	})
+
+	It("Invalidates the expired passwords only", func() {
+		_, err := persister.Save(&persisters.State{
+			AvailableInstances: []persisters.ServiceInstance{{
+				ID:          "instance",
+				Credentials: cluster.InstanceCredentials{UID: 1, Password: "current"},
+				ExpiringPasswords: []persisters.ExpiringPassword{
+					{Password: "expired", ExpiresAt: time.Now().Add(-time.Minute)},
+					{Password: "valid", ExpiresAt: time.Now().Add(time.Minute)},
+				},
+			}},
+		}, persisters.AnyRevision)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(retirer.Retire()).To(Succeed())
+		Expect(passwordCalls).To(Equal([]string{"PUT current", "POST valid"}))
+
+		state, _, err := persister.Load()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state.AvailableInstances[0].ExpiringPasswords).To(HaveLen(1))
+		Expect(state.AvailableInstances[0].ExpiringPasswords[0].Password).To(Equal("valid"))
+	})
+
+	It("Leaves the instances without expired passwords alone", func() {
+		_, err := persister.Save(&persisters.State{
+			AvailableInstances: []persisters.ServiceInstance{{
+				ID:          "instance",
+				Credentials: cluster.InstanceCredentials{UID: 1, Password: "current"},
+			}},
+		}, persisters.AnyRevision)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(retirer.Retire()).To(Succeed())
+		Expect(passwordCalls).To(BeEmpty())
+	})
+})
@@ -0,0 +1,91 @@
+package reconcilers
+
+import (
+	"time"
+
+	"github.com/pivotal-golang/lager"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/apiclient"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/persisters"
+)
+
+// DeletedInstanceReaper deletes the databases of deprovisioned instances
+// once the retention period has passed.
+type DeletedInstanceReaper struct {
+	apiClient apiclient.Client
+	persister persisters.StatePersister
+	retention time.Duration
+	logger    lager.Logger
+	leader    Leader
+}
+
+func NewDeletedInstanceReaper(conf config.Config, persister persisters.StatePersister, logger lager.Logger) *DeletedInstanceReaper {
+	return &DeletedInstanceReaper{
+		apiClient: apiclient.New(conf, logger),
+		persister: persister,
+		retention: time.Duration(conf.ServiceBroker.DeletionRetentionPeriod) * time.Second,
+		logger:    logger,
+	}
+}
+
+// WithLeader makes Run skip the reaping while another broker leads.
+func (r *DeletedInstanceReaper) WithLeader(leader Leader) *DeletedInstanceReaper {
+	r.leader = leader
+	return r
+}
+
+// Reap deletes the databases whose retention period has passed and
+// forgets their instances.
+func (r *DeletedInstanceReaper) Reap() error {
+	state, _, err := r.persister.Load()
+	if err != nil {
+		r.logger.Error("Failed to load the broker state", err)
+		return err
+	}
+
+	now := time.Now()
+	reaped := map[string]bool{}
+	for _, instance := range state.DeletedInstances {
+		if instance.DeletedAt.Add(r.retention).After(now) {
+			continue
+		}
+		if err = r.apiClient.DeleteDatabase(instance.Credentials.UID); err != nil {
+			r.logger.Error("Failed to delete the database of a deleted instance", err, lager.Data{"instance-id": instance.ID})
+			continue
+		}
+		r.logger.Info("Deleted the database of a deleted instance", lager.Data{"instance-id": instance.ID})
+		reaped[instance.ID] = true
+	}
+	if len(reaped) == 0 {
+		return nil
+	}
+
+	// The state is reloaded since it may have changed while the databases
+	// were being deleted.
+	return persisters.Update(r.persister, func(state *persisters.State) error {
+		kept := []persisters.ServiceInstance{}
+		for _, instance := range state.DeletedInstances {
+			if !reaped[instance.ID] {
+				kept = append(kept, instance)
+			}
+		}
+		state.DeletedInstances = kept
+		return nil
+	})
+}
+
+// Run reaps deleted instances every interval. It never returns, so it is
+// supposed to be run in a goroutine.
+func (r *DeletedInstanceReaper) Run(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		if !leading(r.leader) {
+			continue
+		}
+
+		if err := r.Reap(); err != nil {
+			r.logger.Error("Failed to reap the deleted instances", err)
+		}
+	}
+}
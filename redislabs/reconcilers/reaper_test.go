@@ -0,0 +1,82 @@
+package reconcilers_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"time"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/cluster"
+	brokerconfig "github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/persisters"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/reconcilers"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/testing"
+	"github.com/pivotal-golang/lager"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Deleted instance reaper", func() {
+	var (
+		reaper      *reconcilers.DeletedInstanceReaper
+		persister   persisters.StatePersister
+		proxy       testing.HTTPProxy
+		tmpStateDir string
+		deleted     []string
+		logger      = lager.NewLogger("test")
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpStateDir, err = ioutil.TempDir("", "redislabs-state-test")
+		Expect(err).NotTo(HaveOccurred())
+		persister = persisters.NewLocalPersister(path.Join(tmpStateDir, "state.json"))
+		_, err = persister.Save(&persisters.State{
+			DeletedInstances: []persisters.ServiceInstance{
+				{
+					ID:          "expired",
+					Credentials: cluster.InstanceCredentials{UID: 1},
+					DeletedAt:   time.Now().Add(-2 * time.Hour),
+				},
+				{
+					ID:          "retained",
+					Credentials: cluster.InstanceCredentials{UID: 2},
+					DeletedAt:   time.Now(),
+				},
+			},
+		}, persisters.AnyRevision)
+		Expect(err).NotTo(HaveOccurred())
+
+		deleted = []string{}
+		proxy = testing.NewHTTPProxy()
+		proxy.RegisterEndpointHandler("/v1/bdbs/", func(w http.ResponseWriter, r *http.Request) interface{} {
+			deleted = append(deleted, r.Method+" "+r.URL.Path)
+			return nil
+		})
+
+		conf := brokerconfig.Config{
+			Cluster: brokerconfig.ClusterConfig{Address: proxy.URL()},
+			ServiceBroker: brokerconfig.ServiceBrokerConfig{
+				DeletionRetentionPeriod: 3600,
+			},
+		}
+		reaper = reconcilers.NewDeletedInstanceReaper(conf, persister, logger)
+	})
+
+	AfterEach(func() {
+		proxy.Close()
+		os.RemoveAll(tmpStateDir)
+	})
+
+	It("Deletes the databases whose retention period has passed", func() {
+		Expect(reaper.Reap()).To(Succeed())
+		Expect(deleted).To(Equal([]string{"DELETE /v1/bdbs/1"}))
+
+		state, _, err := persister.Load()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state.DeletedInstances).To(HaveLen(1))
+		Expect(state.DeletedInstances[0].ID).To(Equal("retained"))
+	})
+})
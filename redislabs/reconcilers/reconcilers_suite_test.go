@@ -0,0 +1,13 @@
+package reconcilers_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestReconcilers(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Reconcilers Suite")
+}
@@ -0,0 +1,161 @@
+package reconcilers
+
+import (
+	"errors"
+	"reflect"
+
+	"github.com/pivotal-golang/lager"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/apiclient"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/cluster"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/persisters"
+)
+
+// errNothingToRepair leaves the broker state alone if it matches the
+// cluster.
+var errNothingToRepair = errors.New("nothing to repair")
+
+// Kinds of drift between the broker state and the cluster.
+const (
+	DatabaseMissing    = "database-missing"
+	CredentialsMissing = "credentials-missing"
+	CredentialsChanged = "credentials-changed"
+	DatabaseOrphaned   = "database-orphaned"
+)
+
+// Drift describes a single difference between the broker state and
+// the cluster. InstanceID is empty for databases the broker does not know.
+type Drift struct {
+	Kind       string
+	InstanceID string
+	Stored     cluster.InstanceCredentials
+	Actual     cluster.InstanceCredentials
+}
+
+// StateReconciler finds and repairs differences between the broker
+// state and the databases present on the cluster.
+type StateReconciler struct {
+	apiClient apiclient.Client
+	persister persisters.StatePersister
+	logger    lager.Logger
+}
+
+func NewStateReconciler(conf config.Config, persister persisters.StatePersister, logger lager.Logger) *StateReconciler {
+	return &StateReconciler{
+		apiClient: apiclient.New(conf, logger),
+		persister: persister,
+		logger:    logger,
+	}
+}
+
+// Diff returns the differences between the broker state and the cluster
+// without changing anything.
+func (r *StateReconciler) Diff() ([]Drift, error) {
+	drifts, err := r.diff()
+	return drifts, err
+}
+
+// Repair brings the broker state in line with the cluster: instances whose
+// databases are gone are removed and stale credentials are replaced with
+// the actual ones. Orphaned databases are only reported. It returns
+// the differences that have been found.
+func (r *StateReconciler) Repair() ([]Drift, error) {
+	drifts, err := r.diff()
+	if err != nil {
+		return nil, err
+	}
+
+	err = persisters.Update(r.persister, func(state *persisters.State) error {
+		changed := false
+		instances := []persisters.ServiceInstance{}
+		for _, instance := range state.AvailableInstances {
+			drift, found := findDrift(drifts, instance.ID)
+			switch {
+			case !found:
+				instances = append(instances, instance)
+			case drift.Kind == DatabaseMissing:
+				changed = true
+			case drift.Kind == CredentialsMissing, drift.Kind == CredentialsChanged:
+				instance.Credentials = drift.Actual
+				instances = append(instances, instance)
+				changed = true
+			default:
+				instances = append(instances, instance)
+			}
+		}
+		if !changed {
+			return errNothingToRepair
+		}
+		state.AvailableInstances = instances
+		return nil
+	})
+	if err == errNothingToRepair {
+		return drifts, nil
+	}
+	if err != nil {
+		r.logger.Error("Failed to save the reconciled broker state", err)
+		return nil, err
+	}
+	return drifts, nil
+}
+
+func (r *StateReconciler) diff() ([]Drift, error) {
+	state, _, err := r.persister.Load()
+	if err != nil {
+		r.logger.Error("Failed to load the broker state", err)
+		return nil, err
+	}
+	databases, err := r.apiClient.ListDatabases()
+	if err != nil {
+		return nil, err
+	}
+
+	byUID := map[int]cluster.InstanceCredentials{}
+	for _, db := range databases {
+		byUID[db.UID] = db
+	}
+
+	drifts := []Drift{}
+	known := map[int]bool{}
+	for _, instance := range state.AvailableInstances {
+		stored := instance.Credentials
+		known[stored.UID] = true
+
+		actual, ok := byUID[stored.UID]
+		if !ok {
+			drifts = append(drifts, Drift{Kind: DatabaseMissing, InstanceID: instance.ID, Stored: stored})
+			continue
+		}
+		// Databases that have no endpoints yet can not be compared.
+		if actual.Host == "" {
+			continue
+		}
+		if stored.Host == "" || stored.Port == 0 {
+			drifts = append(drifts, Drift{Kind: CredentialsMissing, InstanceID: instance.ID, Stored: stored, Actual: actual})
+		} else if !reflect.DeepEqual(stored, actual) {
+			drifts = append(drifts, Drift{Kind: CredentialsChanged, InstanceID: instance.ID, Stored: stored, Actual: actual})
+		}
+	}
+	for _, instance := range state.DeletedInstances {
+		known[instance.Credentials.UID] = true
+	}
+	for _, task := range state.Tasks {
+		known[task.DatabaseUID] = true
+	}
+	for _, db := range databases {
+		if !known[db.UID] {
+			drifts = append(drifts, Drift{Kind: DatabaseOrphaned, Actual: db})
+		}
+	}
+	return drifts, nil
+}
+
+func findDrift(drifts []Drift, instanceID string) (Drift, bool) {
+	for _, drift := range drifts {
+		if drift.InstanceID == instanceID {
+			return drift, true
+		}
+	}
+	return Drift{}, false
+}
@@ -0,0 +1,114 @@
+package reconcilers_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/cluster"
+	brokerconfig "github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/persisters"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/reconcilers"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/testing"
+	"github.com/pivotal-golang/lager"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("State reconciler", func() {
+	var (
+		reconciler  *reconcilers.StateReconciler
+		persister   persisters.StatePersister
+		proxy       testing.HTTPProxy
+		tmpStateDir string
+		logger      = lager.NewLogger("test")
+	)
+
+	endpoint := func(host string, port int) []map[string]interface{} {
+		return []map[string]interface{}{{
+			"dns_name": host,
+			"port":     port,
+			"addr":     []string{"10.0.0.1"},
+		}}
+	}
+
+	BeforeEach(func() {
+		var err error
+		tmpStateDir, err = ioutil.TempDir("", "redislabs-state-test")
+		Expect(err).NotTo(HaveOccurred())
+		persister = persisters.NewLocalPersister(path.Join(tmpStateDir, "state.json"))
+		_, err = persister.Save(&persisters.State{
+			AvailableInstances: []persisters.ServiceInstance{
+				{
+					ID: "in-sync",
+					Credentials: cluster.InstanceCredentials{
+						UID: 1, Host: "one.example.com", Port: 10001, IPList: []string{"10.0.0.1"}, Password: "pass",
+					},
+				},
+				{
+					ID: "moved",
+					Credentials: cluster.InstanceCredentials{
+						UID: 2, Host: "old.example.com", Port: 10002, IPList: []string{"10.0.0.1"}, Password: "pass",
+					},
+				},
+				{
+					ID:          "deleted",
+					Credentials: cluster.InstanceCredentials{UID: 3},
+				},
+			},
+		}, persisters.AnyRevision)
+		Expect(err).NotTo(HaveOccurred())
+
+		proxy = testing.NewHTTPProxy()
+		proxy.RegisterEndpoints([]testing.Endpoint{
+			{URL: "/v1/bdbs", Response: []map[string]interface{}{
+				{"uid": 1, "authentication_redis_pass": "pass", "status": "active", "endpoints": endpoint("one.example.com", 10001)},
+				{"uid": 2, "authentication_redis_pass": "pass", "status": "active", "endpoints": endpoint("new.example.com", 10002)},
+				{"uid": 4, "authentication_redis_pass": "pass", "status": "active", "endpoints": endpoint("four.example.com", 10004)},
+			}},
+		})
+
+		conf := brokerconfig.Config{
+			Cluster: brokerconfig.ClusterConfig{Address: proxy.URL()},
+		}
+		reconciler = reconcilers.NewStateReconciler(conf, persister, logger)
+	})
+
+	AfterEach(func() {
+		proxy.Close()
+		os.RemoveAll(tmpStateDir)
+	})
+
+	It("Reports every kind of drift", func() {
+		drifts, err := reconciler.Diff()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(drifts).To(HaveLen(3))
+		Expect(drifts[0].Kind).To(Equal(reconcilers.CredentialsChanged))
+		Expect(drifts[0].InstanceID).To(Equal("moved"))
+		Expect(drifts[0].Actual.Host).To(Equal("new.example.com"))
+		Expect(drifts[1].Kind).To(Equal(reconcilers.DatabaseMissing))
+		Expect(drifts[1].InstanceID).To(Equal("deleted"))
+		Expect(drifts[2].Kind).To(Equal(reconcilers.DatabaseOrphaned))
+		Expect(drifts[2].Actual.UID).To(Equal(4))
+	})
+
+	It("Does not change the state while diffing", func() {
+		_, err := reconciler.Diff()
+		Expect(err).NotTo(HaveOccurred())
+		state, _, err := persister.Load()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state.AvailableInstances).To(HaveLen(3))
+	})
+
+	It("Repairs the state", func() {
+		_, err := reconciler.Repair()
+		Expect(err).NotTo(HaveOccurred())
+		state, _, err := persister.Load()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state.AvailableInstances).To(HaveLen(2))
+		Expect(state.AvailableInstances[0].ID).To(Equal("in-sync"))
+		Expect(state.AvailableInstances[1].ID).To(Equal("moved"))
+		Expect(state.AvailableInstances[1].Credentials.Host).To(Equal("new.example.com"))
+	})
+})
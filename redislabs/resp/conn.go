@@ -0,0 +1,132 @@
+// Package resp speaks the Redis protocol, just enough for the broker to
+// talk to a database: it sends commands and reads their replies.
+package resp
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// Error is an error reply of the database.
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+// Conn is a connection to a database. It is not safe for concurrent use.
+type Conn struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	timeout time.Duration
+}
+
+// Dial connects to the database at address. Every command has to be
+// answered within timeout.
+func Dial(address string, useTLS bool, timeout time.Duration) (*Conn, error) {
+	dialer := &net.Dialer{Timeout: timeout}
+	var (
+		conn net.Conn
+		err  error
+	)
+	if useTLS {
+		host, _, _ := net.SplitHostPort(address)
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{conn: conn, reader: bufio.NewReader(conn), timeout: timeout}, nil
+}
+
+// Auth authenticates the connection, as the default user if username is
+// empty.
+func (c *Conn) Auth(username string, password string) error {
+	args := []string{"AUTH", password}
+	if username != "" {
+		args = []string{"AUTH", username, password}
+	}
+	_, err := c.Do(args...)
+	return err
+}
+
+// Do sends a command and returns its reply: a string for simple and bulk
+// strings, an int64 for integers, nil for null replies and a slice for
+// arrays. Error replies are returned as Error.
+func (c *Conn) Do(args ...string) (interface{}, error) {
+	request := fmt.Sprintf("*%d\r\n", len(args))
+	for _, arg := range args {
+		request += fmt.Sprintf("$%d\r\n%s\r\n", len(arg), arg)
+	}
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	if _, err := io.WriteString(c.conn, request); err != nil {
+		return nil, err
+	}
+	return c.read()
+}
+
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Conn) read() (interface{}, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("malformed reply %q", line)
+	}
+	kind, payload := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return payload, nil
+	case '-':
+		return nil, Error(payload)
+	case ':':
+		return strconv.ParseInt(payload, 10, 64)
+	case '$':
+		size, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, err
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		bulk := make([]byte, size+2)
+		if _, err = io.ReadFull(c.reader, bulk); err != nil {
+			return nil, err
+		}
+		return string(bulk[:size]), nil
+	case '*':
+		count, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, err
+		}
+		if count < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, count)
+		for i := range items {
+			// Error replies within arrays are kept as items.
+			item, err := c.read()
+			if e, ok := err.(Error); ok {
+				item, err = e, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("unknown reply type %q", kind)
+}
@@ -0,0 +1,139 @@
+// Package settings translates the plans of the config and the parameters
+// of provisioning and update requests into the settings of the cluster
+// databases.
+package settings
+
+import (
+	"sync"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+)
+
+// Mapper adds the settings a plan implies to the settings of its
+// databases.
+type Mapper func(plan config.ServiceInstanceConfig, settings map[string]interface{})
+
+var (
+	lock sync.RWMutex
+	// mappers are applied in order, so that a mapper may override the
+	// settings of the previous ones.
+	mappers = []Mapper{
+		mapCapacity,
+		mapSharding,
+		mapPlacement,
+		mapEndpoint,
+		mapTLS,
+		mapPersistence,
+	}
+)
+
+// Register adds a mapper applied after the built-in ones and the ones
+// registered before, e.g. to set a cluster setting the config has no
+// field for. Mappers should be registered before the broker is created,
+// since the broker maps its plans once.
+func Register(mapper Mapper) {
+	lock.Lock()
+	defer lock.Unlock()
+	mappers = append(mappers, mapper)
+}
+
+// ForPlan returns the settings of the databases of a plan.
+func ForPlan(plan config.ServiceInstanceConfig) map[string]interface{} {
+	lock.RLock()
+	defer lock.RUnlock()
+	settings := map[string]interface{}{}
+	for _, mapper := range mappers {
+		mapper(plan, settings)
+	}
+	return settings
+}
+
+// ForPlans returns the settings of the databases of every plan by plan ID.
+func ForPlans(plans []config.ServicePlanConfig) map[string]map[string]interface{} {
+	settingsByID := map[string]map[string]interface{}{}
+	for _, plan := range plans {
+		settingsByID[plan.ID] = ForPlan(plan.ServiceInstanceConfig)
+	}
+	return settingsByID
+}
+
+// Merge returns the settings of a plan overridden by the parameters of a
+// request, except for the ignored parameters. The settings of the plan
+// are left as they are.
+func Merge(plan map[string]interface{}, parameters map[string]interface{}, ignored map[string]bool) map[string]interface{} {
+	settings := map[string]interface{}{}
+	for name, value := range plan {
+		settings[name] = value
+	}
+	for name, value := range parameters {
+		if ignored[name] {
+			continue
+		}
+		settings[name] = value
+	}
+	return settings
+}
+
+func mapCapacity(plan config.ServiceInstanceConfig, settings map[string]interface{}) {
+	settings["memory_size"] = plan.MemoryLimit
+	settings["replication"] = plan.Replication
+	if plan.MaxConnections > 0 {
+		settings["max_connections"] = plan.MaxConnections
+	}
+}
+
+func mapSharding(plan config.ServiceInstanceConfig, settings map[string]interface{}) {
+	settings["shards_count"] = plan.ShardCount
+	settings["sharding"] = plan.ShardCount > 1
+	settings["implicit_shard_key"] = plan.ShardCount > 1
+	if plan.ShardCount > 1 {
+		settings["shard_key_regex"] = []map[string]string{
+			{"regex": `.*\{(?<tag>.*)\}.*`},
+			{"regex": `(?<tag>.*)`},
+		}
+	}
+}
+
+func mapPlacement(plan config.ServiceInstanceConfig, settings map[string]interface{}) {
+	if plan.RackAware {
+		settings["rack_aware"] = true
+	}
+	if plan.ShardsPlacement != "" {
+		settings["shards_placement"] = plan.ShardsPlacement
+	}
+	if len(plan.Nodes) > 0 {
+		settings["nodes"] = plan.Nodes
+	}
+}
+
+func mapEndpoint(plan config.ServiceInstanceConfig, settings map[string]interface{}) {
+	if plan.Port > 0 {
+		settings["port"] = plan.Port
+	}
+}
+
+func mapTLS(plan config.ServiceInstanceConfig, settings map[string]interface{}) {
+	if plan.TLS {
+		settings["tls_mode"] = "enabled"
+	}
+	if plan.ClientCA != "" {
+		settings["enforce_client_authentication"] = "enabled"
+		settings["authentication_ssl_client_certs"] = []map[string]string{
+			{"client_cert": plan.ClientCA},
+		}
+	}
+}
+
+func mapPersistence(plan config.ServiceInstanceConfig, settings map[string]interface{}) {
+	settings["data_persistence"] = plan.Persistence
+	if plan.Persistence == "snapshot" {
+		policy := []map[string]int{}
+		for _, rule := range plan.Snapshot {
+			policy = append(policy, map[string]int{
+				"writes": rule.Writes,
+				"secs":   rule.Secs,
+			})
+		}
+		settings["snapshot_policy"] = policy
+	}
+}
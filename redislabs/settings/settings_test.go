@@ -0,0 +1,105 @@
+package settings_test
+
+import (
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/settings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Settings", func() {
+	plain := config.ServiceInstanceConfig{MemoryLimit: 1024, ShardCount: 1, Persistence: "aof"}
+
+	DescribeTable("Mapping a plan",
+		func(plan config.ServiceInstanceConfig, expected map[string]interface{}) {
+			mapped := settings.ForPlan(plan)
+			for name, value := range expected {
+				Expect(mapped).To(HaveKeyWithValue(name, value))
+			}
+		},
+		Entry("maps the capacity", plain, map[string]interface{}{
+			"memory_size":      int64(1024),
+			"replication":      false,
+			"data_persistence": "aof",
+		}),
+		Entry("shards databases with several shards", config.ServiceInstanceConfig{ShardCount: 2}, map[string]interface{}{
+			"shards_count":       int64(2),
+			"sharding":           true,
+			"implicit_shard_key": true,
+			"shard_key_regex": []map[string]string{
+				{"regex": `.*\{(?<tag>.*)\}.*`},
+				{"regex": `(?<tag>.*)`},
+			},
+		}),
+		Entry("places the shards", config.ServiceInstanceConfig{RackAware: true, ShardsPlacement: "sparse", Nodes: []int64{4, 5}}, map[string]interface{}{
+			"rack_aware":       true,
+			"shards_placement": "sparse",
+			"nodes":            []int64{4, 5},
+		}),
+		Entry("sets the endpoint", config.ServiceInstanceConfig{Port: 12000, MaxConnections: 100}, map[string]interface{}{
+			"port":            12000,
+			"max_connections": int64(100),
+		}),
+		Entry("requires TLS and client certificates", config.ServiceInstanceConfig{TLS: true, ClientCA: "PEM"}, map[string]interface{}{
+			"tls_mode":                        "enabled",
+			"enforce_client_authentication":   "enabled",
+			"authentication_ssl_client_certs": []map[string]string{{"client_cert": "PEM"}},
+		}),
+		Entry("lists the snapshot rules", config.ServiceInstanceConfig{
+			Persistence: "snapshot",
+			Snapshot:    config.SnapshotPolicy{{Writes: 1, Secs: 3600}, {Writes: 100, Secs: 60}},
+		}, map[string]interface{}{
+			"snapshot_policy": []map[string]int{{"writes": 1, "secs": 3600}, {"writes": 100, "secs": 60}},
+		}),
+	)
+
+	DescribeTable("Leaving out the settings a plan does not set",
+		func(name string) {
+			Expect(settings.ForPlan(plain)).NotTo(HaveKey(name))
+		},
+		Entry("without shards", "shard_key_regex"),
+		Entry("without rack awareness", "rack_aware"),
+		Entry("without placement", "shards_placement"),
+		Entry("without nodes", "nodes"),
+		Entry("without a port", "port"),
+		Entry("without a connection limit", "max_connections"),
+		Entry("without snapshots", "snapshot_policy"),
+		Entry("without TLS", "tls_mode"),
+		Entry("without client certificates", "authentication_ssl_client_certs"),
+	)
+
+	It("Maps every plan by ID", func() {
+		mapped := settings.ForPlans([]config.ServicePlanConfig{
+			{ID: "small", ServiceInstanceConfig: config.ServiceInstanceConfig{MemoryLimit: 1}},
+			{ID: "large", ServiceInstanceConfig: config.ServiceInstanceConfig{MemoryLimit: 2}},
+		})
+		Expect(mapped).To(HaveLen(2))
+		Expect(mapped["small"]["memory_size"]).To(Equal(int64(1)))
+		Expect(mapped["large"]["memory_size"]).To(Equal(int64(2)))
+	})
+
+	It("Applies registered mappers after the built-in ones", func() {
+		settings.Register(func(plan config.ServiceInstanceConfig, mapped map[string]interface{}) {
+			if plan.Persistence == "custom" {
+				mapped["data_persistence"] = "aof"
+				mapped["aof_policy"] = "appendfsync-always"
+			}
+		})
+		mapped := settings.ForPlan(config.ServiceInstanceConfig{Persistence: "custom"})
+		Expect(mapped["data_persistence"]).To(Equal("aof"))
+		Expect(mapped["aof_policy"]).To(Equal("appendfsync-always"))
+		Expect(settings.ForPlan(plain)).NotTo(HaveKey("aof_policy"))
+	})
+
+	It("Overrides the plan with the parameters", func() {
+		plan := map[string]interface{}{"memory_size": 1024, "replication": false}
+		merged := settings.Merge(plan, map[string]interface{}{
+			"memory_size":         2048,
+			"deletion_protection": true,
+		}, map[string]bool{"deletion_protection": true})
+		Expect(merged).To(Equal(map[string]interface{}{"memory_size": 2048, "replication": false}))
+		Expect(plan["memory_size"]).To(Equal(1024))
+	})
+})
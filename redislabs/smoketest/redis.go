@@ -0,0 +1,33 @@
+package smoketest
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/resp"
+)
+
+// Ping connects to a database, authenticates if a password is given and
+// expects PONG in reply to PING.
+func Ping(host string, port int, username string, password string, useTLS bool, timeout time.Duration) error {
+	conn, err := resp.Dial(net.JoinHostPort(host, fmt.Sprintf("%d", port)), useTLS, timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if password != "" {
+		if err = conn.Auth(username, password); err != nil {
+			return fmt.Errorf("AUTH failed: %s", err)
+		}
+	}
+	reply, err := conn.Do("PING")
+	if err != nil {
+		return fmt.Errorf("PING failed: %s", err)
+	}
+	if reply != "PONG" {
+		return fmt.Errorf("PING returned an unexpected reply %q", reply)
+	}
+	return nil
+}
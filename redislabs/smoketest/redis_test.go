@@ -0,0 +1,94 @@
+package smoketest_test
+
+import (
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/smoketest"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Ping", func() {
+	var (
+		server *testing.RedisServer
+		reply  func(args []string) string
+	)
+
+	ping := func(username string, password string) error {
+		host, port, _ := net.SplitHostPort(server.Address())
+		p, _ := strconv.Atoi(port)
+		return smoketest.Ping(host, p, username, password, false, time.Second)
+	}
+
+	BeforeEach(func() {
+		reply = func(args []string) string {
+			if args[0] == "AUTH" {
+				return "+OK"
+			}
+			return "+PONG"
+		}
+	})
+
+	JustBeforeEach(func() {
+		server = testing.NewRedisServer(func(args []string) string { return reply(args) })
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("authenticates and pings", func() {
+		Expect(ping("", "secret")).To(Succeed())
+		Expect(server.Commands()).To(Equal([][]string{
+			{"AUTH", "secret"},
+			{"PING"},
+		}))
+	})
+
+	It("passes the username of read-only credentials", func() {
+		Expect(ping("cf-binding", "secret")).To(Succeed())
+		Expect(server.Commands()).To(ContainElement([]string{"AUTH", "cf-binding", "secret"}))
+	})
+
+	It("skips the authentication without a password", func() {
+		Expect(ping("", "")).To(Succeed())
+		Expect(server.Commands()).To(Equal([][]string{{"PING"}}))
+	})
+
+	Context("When the database rejects the password", func() {
+		BeforeEach(func() {
+			reply = func(args []string) string {
+				return "-WRONGPASS invalid username-password pair"
+			}
+		})
+
+		It("reports the error", func() {
+			Expect(ping("", "wrong")).To(MatchError("AUTH failed: WRONGPASS invalid username-password pair"))
+		})
+	})
+
+	Context("When the reply is unexpected", func() {
+		BeforeEach(func() {
+			reply = func(args []string) string {
+				return "+QUEUED"
+			}
+		})
+
+		It("fails", func() {
+			Expect(ping("", "")).NotTo(Succeed())
+		})
+	})
+
+	It("fails when the database cannot be reached", func() {
+		listener, _ := net.Listen("tcp", "127.0.0.1:0")
+		host, port, _ := net.SplitHostPort(listener.Addr().String())
+		listener.Close()
+		p, _ := strconv.Atoi(port)
+
+		Expect(smoketest.Ping(host, p, "", "", false, time.Second)).NotTo(Succeed())
+	})
+})
@@ -0,0 +1,230 @@
+// Package smoketest runs the lifecycle of a service instance against a
+// cluster to verify a deployment of the broker.
+package smoketest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-golang/lager"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/instancebinders"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/instancemanagers"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/persisters"
+)
+
+var (
+	// TinyMemorySize is the memory of the test database, unless the plan
+	// requires more or does not let it be chosen.
+	TinyMemorySize int64 = 100 * 1024 * 1024
+	// PingTimeout bounds connecting to the test database and the replies
+	// to its commands.
+	PingTimeout = 10 * time.Second
+)
+
+// Runner provisions a database, binds it, pings it, unbinds and
+// deprovisions it through the service broker, reporting every step.
+type Runner struct {
+	conf   config.Config
+	planID string
+	out    io.Writer
+	logger lager.Logger
+}
+
+// NewRunner creates a runner for the given plan, the first plan of the
+// config if planID is empty. The steps are reported to out.
+func NewRunner(conf config.Config, planID string, out io.Writer, logger lager.Logger) *Runner {
+	if planID == "" && len(conf.ServiceBroker.Plans) > 0 {
+		planID = conf.ServiceBroker.Plans[0].ID
+	}
+	// Deprovisioning must delete the test database rather than retain it,
+	// and the test binding must not block it.
+	conf.ServiceBroker.DeletionRetentionPeriod = 0
+	conf.ServiceBroker.RejectDeprovisionWithBindings = false
+	return &Runner{
+		conf:   conf,
+		planID: planID,
+		out:    out,
+		logger: logger,
+	}
+}
+
+// Run performs the steps and returns the first failure. The instance is
+// deprovisioned whenever it was provisioned, even if a later step fails.
+// The broker state is kept in a temporary directory, so the state of a
+// running broker is left alone.
+func (r *Runner) Run() (err error) {
+	plan, ok := r.plan()
+	if !ok {
+		return r.step("provision", func() error { return redislabs.ErrPlanDoesNotExist })
+	}
+
+	stateDir, err := ioutil.TempDir("", "redislabs-smoke-test")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(stateDir)
+
+	persister := persisters.NewLocalPersister(path.Join(stateDir, "state.json"))
+	broker := redislabs.NewServiceBroker(
+		instancemanagers.NewDefault(r.conf, r.logger),
+		instancebinders.NewDefault(r.conf, r.logger),
+		persister,
+		r.conf,
+		r.logger,
+	)
+
+	suffix, err := randomSuffix()
+	if err != nil {
+		return err
+	}
+	instanceID := "smoke-test-" + suffix
+	bindingID := "smoke-test-" + suffix
+	org := "smoke-test"
+	if len(plan.AllowedOrgs) > 0 {
+		org = plan.AllowedOrgs[0]
+	}
+
+	err = r.step("provision", func() error {
+		_, err := broker.Provision(instanceID, brokerapi.ProvisionDetails{
+			ServiceID:        r.conf.ServiceBroker.ServiceID,
+			PlanID:           plan.ID,
+			OrganizationGUID: org,
+			SpaceGUID:        "smoke-test",
+			RawParameters:    provisionParameters(plan, instanceID),
+		}, false)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		deprovisionErr := r.step("deprovision", func() error {
+			_, err := broker.Deprovision(instanceID, brokerapi.DeprovisionDetails{
+				ServiceID: r.conf.ServiceBroker.ServiceID,
+				PlanID:    plan.ID,
+			}, false)
+			return err
+		})
+		if err == nil {
+			err = deprovisionErr
+		}
+	}()
+
+	var binding brokerapi.Binding
+	err = r.step("bind", func() error {
+		var err error
+		binding, err = broker.Bind(instanceID, bindingID, brokerapi.BindDetails{
+			ServiceID: r.conf.ServiceBroker.ServiceID,
+			PlanID:    plan.ID,
+			AppGUID:   "smoke-test",
+		})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	pingErr := r.step("ping", func() error {
+		return pingCredentials(binding.Credentials)
+	})
+	err = r.step("unbind", func() error {
+		return broker.Unbind(instanceID, bindingID, brokerapi.UnbindDetails{
+			ServiceID: r.conf.ServiceBroker.ServiceID,
+			PlanID:    plan.ID,
+		})
+	})
+	if pingErr != nil {
+		return pingErr
+	}
+	return err
+}
+
+// step runs action and reports whether it passed and how long it took.
+func (r *Runner) step(name string, action func() error) error {
+	start := time.Now()
+	err := action()
+	duration := time.Since(start) / time.Millisecond * time.Millisecond
+	if err != nil {
+		fmt.Fprintf(r.out, "%-12s FAIL (%s): %s\n", name, duration, err)
+		return fmt.Errorf("%s failed: %s", name, err)
+	}
+	fmt.Fprintf(r.out, "%-12s PASS (%s)\n", name, duration)
+	return nil
+}
+
+func (r *Runner) plan() (config.ServicePlanConfig, bool) {
+	for _, plan := range r.conf.ServiceBroker.Plans {
+		if plan.ID == r.planID {
+			return plan, true
+		}
+	}
+	return config.ServicePlanConfig{}, false
+}
+
+// provisionParameters names the test database after the instance and asks
+// for a tiny one, as far as the plan allows either.
+func provisionParameters(plan config.ServicePlanConfig, instanceID string) json.RawMessage {
+	parameters := map[string]interface{}{}
+	if parameterAllowed(plan, "name") {
+		parameters["name"] = instanceID
+	}
+	settings := plan.ServiceInstanceConfig
+	if parameterAllowed(plan, "memory_size") && settings.MemoryLimit > TinyMemorySize {
+		size := TinyMemorySize
+		if size < settings.MinMemoryLimit {
+			size = settings.MinMemoryLimit
+		}
+		parameters["memory_size"] = size
+	}
+	encoded, _ := json.Marshal(parameters)
+	return encoded
+}
+
+func parameterAllowed(plan config.ServicePlanConfig, name string) bool {
+	if plan.AllowedParameters == nil {
+		return true
+	}
+	for _, allowed := range plan.AllowedParameters {
+		if allowed == name {
+			return true
+		}
+	}
+	return false
+}
+
+// pingCredentials pings the database the binding credentials point at.
+func pingCredentials(credentials interface{}) error {
+	creds, ok := credentials.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("unexpected credentials %T", credentials)
+	}
+	host, _ := creds["host"].(string)
+	port, _ := creds["port"].(int)
+	username, _ := creds["username"].(string)
+	password, _ := creds["password"].(string)
+	uri, _ := creds["uri"].(string)
+	if host == "" || port == 0 {
+		return fmt.Errorf("the credentials have no endpoint")
+	}
+	return Ping(host, port, username, password, strings.HasPrefix(uri, "rediss:"), PingTimeout)
+}
+
+func randomSuffix() (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,13 @@
+package smoketest_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestSmoketest(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Smoke Test Suite")
+}
@@ -0,0 +1,25 @@
+package smoketest_test
+
+import (
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/smoketest"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/pivotal-golang/lager"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Runner", func() {
+	It("fails without provisioning when the plan does not exist", func() {
+		conf := config.Config{
+			ServiceBroker: config.ServiceBrokerConfig{
+				Plans: []config.ServicePlanConfig{{ID: "plan-id"}},
+			},
+		}
+		out := gbytes.NewBuffer()
+		runner := smoketest.NewRunner(conf, "unknown", out, lager.NewLogger("test"))
+		Expect(runner.Run()).To(MatchError("provision failed: plan does not exist"))
+		Expect(out).To(gbytes.Say(`provision\s+FAIL`))
+	})
+})
@@ -0,0 +1,100 @@
+package redislabs
+
+import (
+	"fmt"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/cluster"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+)
+
+// MaxSuggestedShards bounds the shards of the large suggested plan.
+var MaxSuggestedShards = 4
+
+// SuggestPlans returns small, medium and large plans sized for the nodes of
+// a cluster, to bootstrap the plans of a new deployment. The memory of the
+// plans is a power of two fitting in the smallest node: a sixteenth of it
+// for a small database, a quarter for a medium one with replication, and
+// half of it per shard for a large one with a shard per node. It returns
+// no plans if the memory of the nodes is unknown.
+func SuggestPlans(nodes []cluster.Node) []config.ServicePlanConfig {
+	smallest := int64(0)
+	for _, node := range nodes {
+		if smallest == 0 || node.TotalMemory < smallest {
+			smallest = node.TotalMemory
+		}
+	}
+	if smallest <= 0 {
+		return nil
+	}
+	// A replica needs another node.
+	replication := len(nodes) > 1
+	shards := len(nodes)
+	if shards > MaxSuggestedShards {
+		shards = MaxSuggestedShards
+	}
+
+	large := config.ServiceInstanceConfig{
+		MemoryLimit: roundedMemory(smallest/2) * int64(shards),
+		Replication: replication,
+		ShardCount:  int64(shards),
+		Persistence: "aof",
+	}
+	if shards > 1 {
+		large.ShardsPlacement = "sparse"
+	}
+	return []config.ServicePlanConfig{
+		suggestedPlan("small", config.ServiceInstanceConfig{
+			MemoryLimit: roundedMemory(smallest / 16),
+			ShardCount:  1,
+			Persistence: "disabled",
+		}),
+		suggestedPlan("medium", config.ServiceInstanceConfig{
+			MemoryLimit: roundedMemory(smallest / 4),
+			Replication: replication,
+			ShardCount:  1,
+			Persistence: "aof",
+		}),
+		suggestedPlan("large", large),
+	}
+}
+
+func suggestedPlan(name string, settings config.ServiceInstanceConfig) config.ServicePlanConfig {
+	description := fmt.Sprintf("Redis, %s memory limit", formatMemory(settings.MemoryLimit))
+	if settings.ShardCount > 1 {
+		description += fmt.Sprintf(", cluster with %d shards", settings.ShardCount)
+	}
+	if settings.Replication {
+		description += ", with replication for HA"
+	} else {
+		description += ", no replication"
+	}
+	if settings.Persistence == "aof" {
+		description += ", AOF persistence"
+	} else {
+		description += ", no persistence"
+	}
+	return config.ServicePlanConfig{
+		ID:                    "redislabs-" + name,
+		Name:                  name,
+		Description:           description,
+		ServiceInstanceConfig: settings,
+	}
+}
+
+// roundedMemory returns the largest power of two megabytes up to the
+// memory, at least a megabyte.
+func roundedMemory(memory int64) int64 {
+	rounded := int64(1024 * 1024)
+	for rounded*2 <= memory {
+		rounded *= 2
+	}
+	return rounded
+}
+
+func formatMemory(memory int64) string {
+	const gigabyte = 1024 * 1024 * 1024
+	if memory >= gigabyte && memory%gigabyte == 0 {
+		return fmt.Sprintf("%dGB", memory/gigabyte)
+	}
+	return fmt.Sprintf("%dMB", memory/(1024*1024))
+}
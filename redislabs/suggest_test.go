@@ -0,0 +1,53 @@
+package redislabs_test
+
+import (
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/cluster"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Suggesting plans", func() {
+	const gigabyte = 1024 * 1024 * 1024
+
+	It("Sizes the plans for the smallest node", func() {
+		plans := redislabs.SuggestPlans([]cluster.Node{
+			{UID: 1, TotalMemory: 30 * gigabyte},
+			{UID: 2, TotalMemory: 16 * gigabyte},
+			{UID: 3, TotalMemory: 64 * gigabyte},
+		})
+		Expect(plans).To(HaveLen(3))
+
+		small, medium, large := plans[0], plans[1], plans[2]
+		Expect(small.Name).To(Equal("small"))
+		Expect(small.ServiceInstanceConfig.MemoryLimit).To(Equal(int64(gigabyte)))
+		Expect(small.ServiceInstanceConfig.Replication).To(BeFalse())
+		Expect(small.Description).To(Equal("Redis, 1GB memory limit, no replication, no persistence"))
+
+		Expect(medium.ID).To(Equal("redislabs-medium"))
+		Expect(medium.ServiceInstanceConfig.MemoryLimit).To(Equal(int64(4 * gigabyte)))
+		Expect(medium.ServiceInstanceConfig.Replication).To(BeTrue())
+
+		Expect(large.ServiceInstanceConfig.ShardCount).To(Equal(int64(3)))
+		Expect(large.ServiceInstanceConfig.MemoryLimit).To(Equal(int64(24 * gigabyte)))
+		Expect(large.ServiceInstanceConfig.ShardsPlacement).To(Equal("sparse"))
+		Expect(large.Description).To(Equal("Redis, 24GB memory limit, cluster with 3 shards, with replication for HA, AOF persistence"))
+	})
+
+	It("Suggests no replication on a single node", func() {
+		plans := redislabs.SuggestPlans([]cluster.Node{{UID: 1, TotalMemory: 3 * gigabyte}})
+		Expect(plans).To(HaveLen(3))
+		for _, plan := range plans {
+			Expect(plan.ServiceInstanceConfig.Replication).To(BeFalse())
+			Expect(plan.ServiceInstanceConfig.ShardCount).To(Equal(int64(1)))
+		}
+		Expect(plans[0].ServiceInstanceConfig.MemoryLimit).To(Equal(int64(128 * 1024 * 1024)))
+		Expect(plans[0].Description).To(HavePrefix("Redis, 128MB memory limit"))
+	})
+
+	It("Suggests nothing without the memory of the nodes", func() {
+		Expect(redislabs.SuggestPlans(nil)).To(BeEmpty())
+		Expect(redislabs.SuggestPlans([]cluster.Node{{UID: 1}})).To(BeEmpty())
+	})
+})
@@ -0,0 +1,184 @@
+package testing
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type (
+	// Recording is a conversation with the cluster API recorded against
+	// a given version of the cluster. Recordings are kept as JSON files
+	// under recordings/<version>/<scenario>.json.
+	Recording struct {
+		Exchanges []Exchange `json:"exchanges"`
+	}
+	// Exchange is a request to the cluster API and the response of the
+	// cluster.
+	Exchange struct {
+		Request  RecordedRequest  `json:"request"`
+		Response RecordedResponse `json:"response"`
+	}
+	// RecordedRequest is matched against the requests of the client. The
+	// query has to be the same, and so does the JSON body if it is
+	// recorded.
+	RecordedRequest struct {
+		Method string            `json:"method"`
+		Path   string            `json:"path"`
+		Query  map[string]string `json:"query,omitempty"`
+		Body   json.RawMessage   `json:"body,omitempty"`
+	}
+	// RecordedResponse is sent back as it is. The status defaults to 200.
+	RecordedResponse struct {
+		Status int             `json:"status"`
+		Body   json.RawMessage `json:"body"`
+	}
+
+	// RecordedAPI replays a recording, see NewRecordedAPI.
+	RecordedAPI struct {
+		server    *httptest.Server
+		lock      sync.Mutex
+		exchanges []Exchange
+		played    []bool
+		unmatched []string
+	}
+)
+
+// RecordingVersions returns the cluster versions recorded in the directory.
+func RecordingVersions(dir string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	versions := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			versions = append(versions, entry.Name())
+		}
+	}
+	sort.Strings(versions)
+	return versions, nil
+}
+
+// LoadRecording reads the recording of a scenario against a version of the
+// cluster from the directory.
+func LoadRecording(dir string, version string, scenario string) (Recording, error) {
+	recording := Recording{}
+	bytes, err := ioutil.ReadFile(filepath.Join(dir, version, scenario+".json"))
+	if err != nil {
+		return recording, err
+	}
+	if err := json.Unmarshal(bytes, &recording); err != nil {
+		return recording, fmt.Errorf("recording %s/%s is malformed: %s", version, scenario, err)
+	}
+	return recording, nil
+}
+
+// NewRecordedAPI serves the recording. Every request is answered with the
+// response of the first exchange not played yet that it matches, and
+// with 501 if there is none. The API should be shut down via Close.
+func NewRecordedAPI(recording Recording) *RecordedAPI {
+	api := &RecordedAPI{
+		exchanges: recording.Exchanges,
+		played:    make([]bool, len(recording.Exchanges)),
+	}
+	api.server = httptest.NewServer(http.HandlerFunc(api.serve))
+	return api
+}
+
+func (a *RecordedAPI) URL() string {
+	return a.server.URL
+}
+
+func (a *RecordedAPI) Close() {
+	a.server.Close()
+}
+
+// Unmatched returns the requests that were not recorded, e.g. "GET /v1/bdbs".
+func (a *RecordedAPI) Unmatched() []string {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return append([]string{}, a.unmatched...)
+}
+
+// Unplayed returns the recorded requests that have not been made.
+func (a *RecordedAPI) Unplayed() []string {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	unplayed := []string{}
+	for i, exchange := range a.exchanges {
+		if !a.played[i] {
+			unplayed = append(unplayed, exchange.Request.Method+" "+exchange.Request.Path)
+		}
+	}
+	return unplayed
+}
+
+func (a *RecordedAPI) serve(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		panic(err)
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	for i, exchange := range a.exchanges {
+		if a.played[i] || !exchange.Request.matches(r, body) {
+			continue
+		}
+		a.played[i] = true
+		status := exchange.Response.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write(exchange.Response.Body)
+		return
+	}
+
+	request := r.Method + " " + r.URL.Path
+	if r.URL.RawQuery != "" {
+		request += "?" + r.URL.RawQuery
+	}
+	if len(body) > 0 {
+		request += " " + string(body)
+	}
+	a.unmatched = append(a.unmatched, request)
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+func (r RecordedRequest) matches(req *http.Request, body []byte) bool {
+	if !strings.EqualFold(r.Method, req.Method) || r.Path != req.URL.Path {
+		return false
+	}
+
+	query := req.URL.Query()
+	if len(query) != len(r.Query) {
+		return false
+	}
+	for key, value := range r.Query {
+		if query.Get(key) != value {
+			return false
+		}
+	}
+
+	if len(r.Body) == 0 {
+		return true
+	}
+	var recorded, actual interface{}
+	if err := json.Unmarshal(r.Body, &recorded); err != nil {
+		return false
+	}
+	if err := json.Unmarshal(body, &actual); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(recorded, actual)
+}
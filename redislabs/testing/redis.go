@@ -0,0 +1,111 @@
+package testing
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// RedisServer answers Redis commands with the replies of a handler. The
+// replies are raw RESP, e.g. "+OK" or ":1", without the trailing CRLF.
+type RedisServer struct {
+	listener net.Listener
+	handler  func(args []string) string
+	lock     sync.Mutex
+	commands [][]string
+	conns    []net.Conn
+}
+
+// NewRedisServer starts a server on a random local port. It should be
+// shut down via Close.
+func NewRedisServer(handler func(args []string) string) *RedisServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	s := &RedisServer{listener: listener, handler: handler}
+	go s.serve()
+	return s
+}
+
+func (s *RedisServer) Address() string {
+	return s.listener.Addr().String()
+}
+
+// Commands returns the commands received so far.
+func (s *RedisServer) Commands() [][]string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([][]string{}, s.commands...)
+}
+
+// DropConnections closes the open connections, the server keeps
+// accepting new ones.
+func (s *RedisServer) DropConnections() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+}
+
+func (s *RedisServer) Close() {
+	s.listener.Close()
+	s.DropConnections()
+}
+
+func (s *RedisServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.lock.Lock()
+		s.conns = append(s.conns, conn)
+		s.lock.Unlock()
+		go s.handle(conn)
+	}
+}
+
+func (s *RedisServer) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		header, err := reader.ReadString('\n')
+		if err != nil || !strings.HasPrefix(header, "*") {
+			return
+		}
+		count, _ := strconv.Atoi(strings.TrimSpace(header[1:]))
+		args := []string{}
+		for i := 0; i < count; i++ {
+			sizeLine, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			size, _ := strconv.Atoi(strings.TrimSpace(sizeLine[1:]))
+			arg := make([]byte, size+2)
+			if _, err = io.ReadFull(reader, arg); err != nil {
+				return
+			}
+			args = append(args, string(arg[:size]))
+		}
+
+		s.lock.Lock()
+		s.commands = append(s.commands, args)
+		s.lock.Unlock()
+		conn.Write([]byte(s.handler(args) + "\r\n"))
+	}
+}
+
+// BulkString encodes a RESP bulk string reply, a null reply if value is
+// nil.
+func BulkString(value *string) string {
+	if value == nil {
+		return "$-1"
+	}
+	return "$" + strconv.Itoa(len(*value)) + "\r\n" + *value
+}
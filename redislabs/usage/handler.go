@@ -0,0 +1,100 @@
+package usage
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/pivotal-golang/lager"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/apiclient"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/persisters"
+)
+
+type handler struct {
+	apiClient apiclient.Client
+	persister persisters.StatePersister
+	logger    lager.Logger
+}
+
+type usageResponse struct {
+	InstanceID  string  `json:"instance_id"`
+	MemoryLimit int64   `json:"memory_limit"`
+	UsedMemory  int64   `json:"used_memory"`
+	OpsPerSec   float64 `json:"ops_per_sec"`
+	Connections int64   `json:"connections"`
+	Keys        int64   `json:"keys"`
+}
+
+type errorResponse struct {
+	Description string `json:"description"`
+}
+
+// NewHandler returns the API that lets developers check the utilization
+// of their service instances without access to the cluster UI. Requests
+// authenticate with the database password of the instance, which
+// developers find in the binding credentials.
+func NewHandler(conf config.Config, persister persisters.StatePersister, logger lager.Logger) http.Handler {
+	h := &handler{
+		apiClient: apiclient.New(conf, logger),
+		persister: persister,
+		logger:    logger.Session("usage"),
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/instances/{instance_id}/usage", h.showUsage).Methods("GET")
+	return router
+}
+
+func (h *handler) showUsage(w http.ResponseWriter, req *http.Request) {
+	instanceID := mux.Vars(req)["instance_id"]
+
+	state, _, err := h.persister.Load()
+	if err != nil {
+		h.logger.Error("Failed to load the broker state", err)
+		h.respond(w, http.StatusInternalServerError, errorResponse{Description: "failed to load the broker state"})
+		return
+	}
+
+	// Unknown instances are reported like wrong passwords, so that the
+	// API does not reveal which instances exist.
+	var instance *persisters.ServiceInstance
+	for i := range state.AvailableInstances {
+		if state.AvailableInstances[i].ID == instanceID {
+			instance = &state.AvailableInstances[i]
+		}
+	}
+	_, password, ok := req.BasicAuth()
+	if !ok || instance == nil || instance.Credentials.Password == "" ||
+		subtle.ConstantTimeCompare([]byte(password), []byte(instance.Credentials.Password)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Basic realm="redislabs"`)
+		h.respond(w, http.StatusUnauthorized, errorResponse{Description: "not authorized"})
+		return
+	}
+
+	stats, err := h.apiClient.GetDatabaseStats(instance.Credentials.UID)
+	if err != nil {
+		h.logger.Error("Failed to get the database stats", err, lager.Data{"instance-id": instanceID})
+		h.respond(w, http.StatusBadGateway, errorResponse{Description: "the cluster did not provide the stats"})
+		return
+	}
+	h.respond(w, http.StatusOK, usageResponse{
+		InstanceID:  instanceID,
+		MemoryLimit: stats.MemoryLimit,
+		UsedMemory:  stats.UsedMemory,
+		OpsPerSec:   stats.OpsPerSec,
+		Connections: stats.Connections,
+		Keys:        stats.Keys,
+	})
+}
+
+func (h *handler) respond(w http.ResponseWriter, status int, response interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		h.logger.Error("Failed to encode the response", err, lager.Data{"status": status})
+	}
+}
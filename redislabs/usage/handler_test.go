@@ -0,0 +1,100 @@
+package usage_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/cluster"
+	brokerconfig "github.com/RedisLabs/cf-redislabs-broker/redislabs/config"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/persisters"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/testing"
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/usage"
+	"github.com/pivotal-golang/lager"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Usage API", func() {
+	var (
+		handler     http.Handler
+		proxy       testing.HTTPProxy
+		tmpStateDir string
+	)
+
+	request := func(path string, password string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", path, nil)
+		Expect(err).NotTo(HaveOccurred())
+		req.SetBasicAuth("", password)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	BeforeEach(func() {
+		var err error
+		tmpStateDir, err = ioutil.TempDir("", "redislabs-state-test")
+		Expect(err).NotTo(HaveOccurred())
+		persister := persisters.NewLocalPersister(path.Join(tmpStateDir, "state.json"))
+		_, err = persister.Save(&persisters.State{
+			AvailableInstances: []persisters.ServiceInstance{
+				{
+					ID:          "test-instance",
+					Credentials: cluster.InstanceCredentials{UID: 1, Password: "secret"},
+				},
+			},
+		}, persisters.AnyRevision)
+		Expect(err).NotTo(HaveOccurred())
+
+		proxy = testing.NewHTTPProxy()
+		proxy.RegisterEndpoints([]testing.Endpoint{
+			{URL: "/v1/bdbs/1", Response: map[string]interface{}{"uid": 1, "memory_size": 1024}},
+			{URL: "/v1/bdbs/stats/last/1", Response: map[string]interface{}{
+				"1": map[string]interface{}{
+					"used_memory": 512.0,
+					"total_req":   20.5,
+					"conns":       3.0,
+					"no_of_keys":  42.0,
+				},
+			}},
+		})
+
+		conf := brokerconfig.Config{
+			Cluster: brokerconfig.ClusterConfig{Address: proxy.URL()},
+		}
+		handler = usage.NewHandler(conf, persister, lager.NewLogger("test"))
+	})
+
+	AfterEach(func() {
+		proxy.Close()
+		os.RemoveAll(tmpStateDir)
+	})
+
+	It("Shows the utilization of the database", func() {
+		res := request("/instances/test-instance/usage", "secret")
+		Expect(res.Code).To(Equal(http.StatusOK))
+
+		var body map[string]interface{}
+		Expect(json.Unmarshal(res.Body.Bytes(), &body)).To(Succeed())
+		Expect(body).To(Equal(map[string]interface{}{
+			"instance_id":  "test-instance",
+			"memory_limit": 1024.0,
+			"used_memory":  512.0,
+			"ops_per_sec":  20.5,
+			"connections":  3.0,
+			"keys":         42.0,
+		}))
+	})
+
+	It("Requires the database password", func() {
+		Expect(request("/instances/test-instance/usage", "wrong").Code).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("Does not reveal whether an instance exists", func() {
+		Expect(request("/instances/unknown/usage", "secret").Code).To(Equal(http.StatusUnauthorized))
+	})
+})
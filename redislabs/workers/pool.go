@@ -0,0 +1,86 @@
+package workers
+
+import "sync"
+
+// Pool runs operations on a fixed number of worker goroutines so that
+// a burst of requests can not overload the cluster. Operations submitted
+// with the same key never run concurrently.
+type Pool struct {
+	jobs  chan job
+	lock  sync.Mutex
+	locks map[string]*keyLock
+}
+
+type job struct {
+	run  func() error
+	done chan error
+}
+
+type keyLock struct {
+	sync.Mutex
+	refs int
+}
+
+// NewPool starts a pool with the given number of workers.
+func NewPool(size int) *Pool {
+	if size < 1 {
+		size = 1
+	}
+	p := &Pool{
+		jobs:  make(chan job),
+		locks: map[string]*keyLock{},
+	}
+	for i := 0; i < size; i++ {
+		go p.work()
+	}
+	return p
+}
+
+// Do waits until no other operation with the same key is running and
+// a worker is free, then runs the operation and returns its result.
+func (p *Pool) Do(key string, run func() error) error {
+	l := p.acquire(key)
+	defer p.release(key, l)
+
+	done := make(chan error, 1)
+	p.jobs <- job{run: run, done: done}
+	return <-done
+}
+
+// Stop terminates the workers. The pool can not be used afterwards.
+func (p *Pool) Stop() {
+	close(p.jobs)
+}
+
+func (p *Pool) work() {
+	for j := range p.jobs {
+		j.done <- j.run()
+	}
+}
+
+// The key lock is taken before a worker is, so that operations waiting
+// for their turn do not occupy workers.
+func (p *Pool) acquire(key string) *keyLock {
+	p.lock.Lock()
+	l, ok := p.locks[key]
+	if !ok {
+		l = &keyLock{}
+		p.locks[key] = l
+	}
+	l.refs++
+	p.lock.Unlock()
+
+	l.Lock()
+	return l
+}
+
+func (p *Pool) release(key string, l *keyLock) {
+	l.Unlock()
+
+	p.lock.Lock()
+	l.refs--
+	if l.refs == 0 {
+		delete(p.locks, key)
+	}
+	p.lock.Unlock()
+}
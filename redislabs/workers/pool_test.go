@@ -0,0 +1,76 @@
+package workers_test
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/RedisLabs/cf-redislabs-broker/redislabs/workers"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Pool", func() {
+	var pool *workers.Pool
+
+	// runConcurrently submits an operation per key and returns the highest
+	// number of operations that were running at the same time.
+	runConcurrently := func(keys []string) int {
+		var (
+			lock    sync.Mutex
+			running int
+			maximum int
+			wg      sync.WaitGroup
+		)
+		for _, key := range keys {
+			wg.Add(1)
+			go func(key string) {
+				defer wg.Done()
+				pool.Do(key, func() error {
+					lock.Lock()
+					running++
+					if running > maximum {
+						maximum = running
+					}
+					lock.Unlock()
+
+					time.Sleep(20 * time.Millisecond)
+
+					lock.Lock()
+					running--
+					lock.Unlock()
+					return nil
+				})
+			}(key)
+		}
+		wg.Wait()
+		return maximum
+	}
+
+	BeforeEach(func() {
+		pool = workers.NewPool(2)
+	})
+
+	AfterEach(func() {
+		pool.Stop()
+	})
+
+	It("Returns the result of the operation", func() {
+		err := pool.Do("instance", func() error { return errors.New("failed") })
+		Expect(err).To(MatchError("failed"))
+	})
+
+	It("Does not run more operations than there are workers", func() {
+		keys := []string{}
+		for i := 0; i < 6; i++ {
+			keys = append(keys, fmt.Sprintf("instance-%d", i))
+		}
+		Expect(runConcurrently(keys)).To(Equal(2))
+	})
+
+	It("Serializes operations with the same key", func() {
+		Expect(runConcurrently([]string{"instance", "instance", "instance"})).To(Equal(1))
+	})
+})
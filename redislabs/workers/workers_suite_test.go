@@ -0,0 +1,13 @@
+package workers_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestWorkers(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Workers Suite")
+}